@@ -21,6 +21,46 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// RestoredCheckpointAnnotation is set on the pods restored from a checkpoint, with the name of the Checkpoint,
+// prefixed by its namespace and a slash when it is not in the namespace of the pod.
+const RestoredCheckpointAnnotation = "checkpoint-restore.kcr.io/restored-checkpoint"
+
+// RestoreStatusAnnotation is set on the pods restored from a checkpoint with the status of the restore, one
+// of RestoreStatusRestoring, RestoreStatusRestored or RestoreStatusFailed.
+const RestoreStatusAnnotation = "checkpoint-restore.kcr.io/restore-status"
+
+// RestoredContainerAnnotation is set on the pods restored from a checkpoint with the name of the container
+// running the checkpoint image.
+const RestoredContainerAnnotation = "checkpoint-restore.kcr.io/restored-container"
+
+const (
+	// RestoreStatusRestoring is the status of a pod set to be restored whose container does not run yet.
+	RestoreStatusRestoring = "Restoring"
+	// RestoreStatusRestored is the status of a pod whose restored container runs.
+	RestoreStatusRestored = "Restored"
+	// RestoreStatusFailed is the status of a pod whose container could not be restored.
+	RestoreStatusFailed = "Failed"
+)
+
+// ImportedCheckpointAnnotation is set on the checkpoints imported from a bundle, with the namespace and the
+// name of the exported Checkpoint. Their image is pushed when they are imported, so they are never processed.
+const ImportedCheckpointAnnotation = "checkpoint-restore.kcr.io/imported-from"
+
+// CheckpointPhase is the phase of the image of a Checkpoint.
+// +kubebuilder:validation:Enum=Created;Processing;ImageBuilt;Failed
+type CheckpointPhase string
+
+const (
+	// CheckpointPhaseCreated is the phase of a checkpoint whose image was not built yet.
+	CheckpointPhaseCreated CheckpointPhase = "Created"
+	// CheckpointPhaseProcessing is the phase of a checkpoint whose image is being built.
+	CheckpointPhaseProcessing CheckpointPhase = "Processing"
+	// CheckpointPhaseImageBuilt is the phase of a checkpoint whose image was built and pushed.
+	CheckpointPhaseImageBuilt CheckpointPhase = "ImageBuilt"
+	// CheckpointPhaseFailed is the phase of a checkpoint whose image could not be built or pushed.
+	CheckpointPhaseFailed CheckpointPhase = "Failed"
+)
+
 // CheckpointSpec defines the desired state of Checkpoint.
 type CheckpointSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
@@ -53,6 +93,144 @@ type CheckpointSpec struct {
 	// NodeName is the name of the node where the checkpoint was created
 	// and where the checkpoint data is stored
 	NodeName string `json:"nodeName,omitempty"`
+
+	// ParentCheckpoint is a reference to the previous checkpoint of the same container. The image
+	// of this checkpoint reuses the layers of the parent image for the files that did not change,
+	// the checkpoint fails when its image builder is not able to.
+	// +optional
+	ParentCheckpoint *corev1.LocalObjectReference `json:"parentCheckpoint,omitempty"`
+
+	// Compression is the compression of the checkpoint image layers, in the form algorithm[:level],
+	// e.g. zstd:3. The algorithm is one of none, gzip, zstd and zstd:chunked. When empty the
+	// compression configured in the manager is used.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^(none|gzip|zstd|zstd:chunked)(:[0-9]+)?$`
+	Compression string `json:"compression,omitempty"`
+
+	// CheckpointRegistry is the name of the CheckpointRegistry the checkpoint image is pushed to.
+	// When empty the registry configured in the manager is used.
+	// +optional
+	CheckpointRegistry string `json:"checkpointRegistry,omitempty"`
+
+	// Filter removes sensitive data from the checkpoint archive before its image is built.
+	// +optional
+	Filter *CheckpointFilter `json:"filter,omitempty"`
+}
+
+// CheckpointFilter describes the data removed from a checkpoint archive before its image is built. Only
+// the files of the container root file system and of the tmpfs mounted in the container are removed, the
+// memory of the process is kept as is.
+type CheckpointFilter struct {
+	// ExcludePaths are directories of the container file system, like a tmpfs holding tokens, whose
+	// files are removed from the checkpoint. The volumes mounted in the container, like secrets, are
+	// never in the checkpoint.
+	// +optional
+	ExcludePaths []string `json:"excludePaths,omitempty"`
+
+	// ExcludeFiles are glob patterns of files of the container file system removed from the
+	// checkpoint, e.g. /root/.aws/*. A matching directory removes every file below it.
+	// +optional
+	ExcludeFiles []string `json:"excludeFiles,omitempty"`
+
+	// ExcludeRootfsDiff removes every change to the container root file system, keeping only the
+	// process state. The container is restored on top of its image.
+	// +optional
+	ExcludeRootfsDiff bool `json:"excludeRootfsDiff,omitempty"`
+}
+
+// CheckpointArchive describes the checkpointed container and its CRIU dump, as read from the config.dump,
+// spec.dump, stats-dump and CRIU images of the checkpoint archive.
+type CheckpointArchive struct {
+	// Image is the name of the image of the checkpointed container.
+	Image string `json:"image,omitempty"`
+
+	// ImageID is the ID of the image of the checkpointed container.
+	ImageID string `json:"imageID,omitempty"`
+
+	// Engine is the container engine that created the checkpoint, e.g. cri-o.
+	Engine string `json:"engine,omitempty"`
+
+	// Runtime is the OCI runtime of the checkpointed container, e.g. runc or crun.
+	Runtime string `json:"runtime,omitempty"`
+
+	// CheckpointedAt is the time the container engine checkpointed the container.
+	CheckpointedAt *metav1.Time `json:"checkpointedAt,omitempty"`
+
+	// CRIUImageVersion is the version of the CRIU image format of the dump. The archive does not record
+	// the CRIU release that created it, the nodes restoring the checkpoint need one supporting this format.
+	CRIUImageVersion int32 `json:"criuImageVersion,omitempty"`
+
+	// DumpStatistics are the statistics CRIU collected while dumping the container.
+	DumpStatistics *CheckpointDumpStatistics `json:"dumpStatistics,omitempty"`
+
+	// Mounts are the mounts of the checkpointed container, they must be available to restore it.
+	Mounts []CheckpointMount `json:"mounts,omitempty"`
+
+	// ProcessTree summarizes the processes of the checkpointed container.
+	ProcessTree *CheckpointProcessTree `json:"processTree,omitempty"`
+}
+
+// CheckpointDumpStatistics are the statistics CRIU collected while dumping the container.
+type CheckpointDumpStatistics struct {
+	// FreezingTime is the time spent freezing the processes.
+	FreezingTime metav1.Duration `json:"freezingTime"`
+
+	// FrozenTime is the time the processes were frozen, from the freeze to the end of the dump. It is
+	// the downtime of the container caused by the checkpoint.
+	FrozenTime metav1.Duration `json:"frozenTime"`
+
+	// MemdumpTime is the time spent collecting the memory pages.
+	MemdumpTime metav1.Duration `json:"memdumpTime"`
+
+	// MemwriteTime is the time spent writing the memory pages.
+	MemwriteTime metav1.Duration `json:"memwriteTime"`
+
+	// PagesScanned is the number of memory pages of the processes.
+	PagesScanned int64 `json:"pagesScanned"`
+
+	// PagesSkippedParent is the number of memory pages unchanged since the parent checkpoint.
+	PagesSkippedParent int64 `json:"pagesSkippedParent,omitempty"`
+
+	// PagesWritten is the number of memory pages written to the dump.
+	PagesWritten int64 `json:"pagesWritten"`
+}
+
+// CheckpointMount is a mount of the checkpointed container.
+type CheckpointMount struct {
+	// Destination is the path of the mount in the container.
+	Destination string `json:"destination"`
+
+	// Type is the file system type of the mount.
+	Type string `json:"type,omitempty"`
+
+	// Source is the source of the mount on the node or the file system.
+	Source string `json:"source,omitempty"`
+}
+
+// CheckpointProcessTree summarizes the processes of the checkpointed container.
+type CheckpointProcessTree struct {
+	// ProcessCount is the number of processes of the container.
+	ProcessCount int32 `json:"processCount"`
+
+	// ThreadCount is the number of threads of all the processes of the container.
+	ThreadCount int32 `json:"threadCount"`
+
+	// Processes are the first processes of the container ordered by PID, the first one is the
+	// container init process.
+	// +optional
+	Processes []CheckpointProcess `json:"processes,omitempty"`
+}
+
+// CheckpointProcess is a process of the checkpointed container.
+type CheckpointProcess struct {
+	// PID is the process ID in the PID namespace of the container.
+	PID int32 `json:"pid"`
+
+	// PPID is the ID of the parent process, 0 for the container init process.
+	PPID int32 `json:"ppid"`
+
+	// Command is the command name of the process.
+	Command string `json:"command,omitempty"`
 }
 
 // CheckpointStatus defines the observed state of Checkpoint.
@@ -66,11 +244,30 @@ type CheckpointStatus struct {
 	// RuntimeImage is the reference to the image that was uploaded to the runtime image registry.
 	RuntimeImage string `json:"runtimeImage,omitempty"`
 
+	// Registry is the registry, with an optional repository prefix, the checkpoint image was pushed to.
+	Registry string `json:"registry,omitempty"`
+
+	// ImageDigest is the digest of the manifest of the checkpoint image pushed to the registry. The
+	// checkpoint is restored from the image with this digest, even if RuntimeImage is retagged.
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// Signed reports whether the checkpoint image was signed after it was pushed.
+	Signed bool `json:"signed,omitempty"`
+
+	// FilteredFiles is the number of files removed from the checkpoint archive by the Filter.
+	FilteredFiles int `json:"filteredFiles,omitempty"`
+
+	// EncryptionKeys identify the public keys the checkpoint image layers were encrypted for, as the
+	// sha256 digest of their PKIX encoding. Only the matching private keys can restore the checkpoint.
+	EncryptionKeys []string `json:"encryptionKeys,omitempty"`
+
 	// Phase represents the current phase of the checkpoint (Created, Processing, ImageBuilt, Failed)
-	// +kubebuilder:validation:Enum=Created;Processing;ImageBuilt;Failed
-	Phase string `json:"phase,omitempty"`
+	Phase CheckpointPhase `json:"phase,omitempty"`
 
 	// Conditions represents the latest available observations of the checkpoint's current state
+	// +optional
+	// +listType=map
+	// +listMapKey=type
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 
 	// LastTransitionTime is the last time the status changed from one status to another
@@ -78,6 +275,25 @@ type CheckpointStatus struct {
 
 	// FailedReason is the message for the reason the checkpoint failed.
 	FailedReason string `json:"failedReason,omitempty"`
+
+	// Compression is the compression used for the checkpoint image layers.
+	Compression string `json:"compression,omitempty"`
+
+	// ArchiveDigest is the sha256 digest of the checkpoint archive, computed when it is verified.
+	ArchiveDigest string `json:"archiveDigest,omitempty"`
+
+	// Archive describes the checkpointed container and its CRIU dump, as read from the checkpoint archive.
+	Archive *CheckpointArchive `json:"archive,omitempty"`
+
+	// RawSize is the size in bytes of the checkpoint archive before compression.
+	RawSize int64 `json:"rawSize,omitempty"`
+
+	// CompressedSize is the size in bytes of the checkpoint image layers stored in the registry.
+	CompressedSize int64 `json:"compressedSize,omitempty"`
+
+	// PushedBytes is the number of bytes of the checkpoint image layers uploaded to the registry, reported
+	// while the image is pushed. The layers already in the registry are not uploaded.
+	PushedBytes int64 `json:"pushedBytes,omitempty"`
 }
 
 // +kubebuilder:object:root=true
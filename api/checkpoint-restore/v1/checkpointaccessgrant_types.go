@@ -0,0 +1,87 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// CheckpointAccessGrantPodKind lets the namespaces checkpoint the pods of the namespace of the
+	// grant, their Checkpoints live in the namespace of the CheckpointRequest.
+	CheckpointAccessGrantPodKind = "Pod"
+	// CheckpointAccessGrantCheckpointKind lets the namespaces read the Checkpoints of the namespace of
+	// the grant and restore them in their pods.
+	CheckpointAccessGrantCheckpointKind = "Checkpoint"
+)
+
+// CheckpointAccessGrantFrom is a namespace granted access.
+type CheckpointAccessGrantFrom struct {
+	// Namespace is the namespace granted access.
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+}
+
+// CheckpointAccessGrantTo is the resources of the namespace of the grant access is granted to.
+type CheckpointAccessGrantTo struct {
+	// Kind is the kind of the resources, Pod to checkpoint the pods or Checkpoint to read and restore the
+	// checkpoints.
+	// +kubebuilder:validation:Enum=Pod;Checkpoint
+	Kind string `json:"kind"`
+
+	// Name is the name of the resource, all the resources of the kind when empty.
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// CheckpointAccessGrantSpec defines the desired state of CheckpointAccessGrant.
+type CheckpointAccessGrantSpec struct {
+	// From are the namespaces granted access.
+	// +kubebuilder:validation:MinItems=1
+	From []CheckpointAccessGrantFrom `json:"from"`
+
+	// To are the resources of the namespace of the grant the namespaces are granted access to.
+	// +kubebuilder:validation:MinItems=1
+	To []CheckpointAccessGrantTo `json:"to"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CheckpointAccessGrant is the Schema for the checkpointaccessgrants API. Like a Gateway API
+// ReferenceGrant, it is created by the owners of a namespace to let other namespaces checkpoint its pods
+// or restore its checkpoints, which is denied otherwise.
+type CheckpointAccessGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CheckpointAccessGrantSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CheckpointAccessGrantList contains a list of CheckpointAccessGrant.
+type CheckpointAccessGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []CheckpointAccessGrant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CheckpointAccessGrant{}, &CheckpointAccessGrantList{})
+}
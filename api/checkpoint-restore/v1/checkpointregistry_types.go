@@ -0,0 +1,99 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretReference references a Secret in a namespace.
+type SecretReference struct {
+	// Name is the name of the Secret.
+	Name string `json:"name"`
+	// Namespace is the namespace of the Secret.
+	Namespace string `json:"namespace"`
+}
+
+// CheckpointRegistrySpec defines the desired state of CheckpointRegistry.
+type CheckpointRegistrySpec struct {
+	// URL is the registry, with an optional repository prefix, the checkpoint images are pushed to,
+	// e.g. registry.example.com/team-a.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// CredentialsSecretRef references a Secret of type kubernetes.io/dockerconfigjson with the
+	// credentials of the registry, which the operator only reads in its own namespace unless granted
+	// otherwise. When empty the credentials configured in the manager are used.
+	// +optional
+	CredentialsSecretRef *SecretReference `json:"credentialsSecretRef,omitempty"`
+
+	// Insecure disables the TLS verification of the registry and allows plain HTTP.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// RepositoryTemplate is the Go template of the repository of the checkpoint images, relative to
+	// the URL. The template receives the Namespace, Pod, Container, Checkpoint, Schedule and Node
+	// names and the Timestamp of the checkpoint, e.g. {{ .Namespace }}/{{ .Pod }}-{{ .Container }}.
+	// +optional
+	// +kubebuilder:default="checkpoint-{{ .Checkpoint }}"
+	RepositoryTemplate string `json:"repositoryTemplate,omitempty"`
+
+	// TagTemplate is the Go template of the tag of the checkpoint images, it receives the same
+	// values as RepositoryTemplate, e.g. {{ .Timestamp.Format "20060102-150405" }}.
+	// +optional
+	// +kubebuilder:default="latest"
+	TagTemplate string `json:"tagTemplate,omitempty"`
+
+	// AllowedNamespaces are the namespaces whose checkpoints may be pushed to the registry.
+	// +optional
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// NamespaceSelector selects the namespaces whose checkpoints may be pushed to the registry, in
+	// addition to AllowedNamespaces. An empty selector allows every namespace, and when neither is set
+	// no namespace may use the registry.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="URL",type="string",JSONPath=".spec.url"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CheckpointRegistry is the Schema for the checkpointregistries API. It describes a registry the
+// checkpoint images are pushed to and how the images are named, and is referenced by name from
+// CheckpointSchedules and CheckpointRequests.
+type CheckpointRegistry struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CheckpointRegistrySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CheckpointRegistryList contains a list of CheckpointRegistry.
+type CheckpointRegistryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []CheckpointRegistry `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CheckpointRegistry{}, &CheckpointRegistryList{})
+}
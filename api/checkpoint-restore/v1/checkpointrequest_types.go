@@ -21,6 +21,15 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// RequesterAnnotation is set by the admission webhook on the CheckpointRequests, CheckpointSchedules and
+// PodClones with the user who created them, as the JSON of an authentication.k8s.io/v1 UserInfo. The
+// CheckpointRequests created for a CheckpointSchedule or a PodClone get the user who created it.
+const RequesterAnnotation = "checkpoint-restore.kcr.io/requester"
+
+// TraceContextAnnotation is set on the CheckpointRequests and Checkpoints with the W3C traceparent of the
+// span of the stage that created them, so the spans of the next stages join the trace of the checkpoint.
+const TraceContextAnnotation = "checkpoint-restore.kcr.io/trace-context"
+
 // PodReference contains the information to identify a pod
 type PodReference struct {
 	// Name is the name of the pod
@@ -47,13 +56,38 @@ type CheckpointRequestSpec struct {
 	// +optional
 	// +kubebuilder:default=300
 	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// Incremental makes the created Checkpoint a child of the last built checkpoint of the
+	// same container, so its image only adds the files that changed since then. The checkpoint
+	// fails when its image builder does not reuse the parent layers, like buildah
+	// +optional
+	Incremental bool `json:"incremental,omitempty"`
+
+	// CheckpointRegistry is the name of the CheckpointRegistry the checkpoint image is pushed to.
+	// When empty the registry configured in the manager is used
+	// +optional
+	CheckpointRegistry string `json:"checkpointRegistry,omitempty"`
 }
 
+// CheckpointRequestPhase is the phase of a CheckpointRequest.
+// +kubebuilder:validation:Enum=Pending;InProgress;Completed;Failed
+type CheckpointRequestPhase string
+
+const (
+	// CheckpointRequestPhasePending is the phase of a request whose checkpoint did not start yet.
+	CheckpointRequestPhasePending CheckpointRequestPhase = "Pending"
+	// CheckpointRequestPhaseInProgress is the phase of a request whose pod is being checkpointed.
+	CheckpointRequestPhaseInProgress CheckpointRequestPhase = "InProgress"
+	// CheckpointRequestPhaseCompleted is the phase of a request whose Checkpoint was created.
+	CheckpointRequestPhaseCompleted CheckpointRequestPhase = "Completed"
+	// CheckpointRequestPhaseFailed is the phase of a request whose pod could not be checkpointed.
+	CheckpointRequestPhaseFailed CheckpointRequestPhase = "Failed"
+)
+
 // CheckpointRequestStatus defines the observed state of CheckpointRequest
 type CheckpointRequestStatus struct {
 	// Phase represents the current state of the checkpoint request
-	// +kubebuilder:validation:Enum=Pending;InProgress;Completed;Failed
-	Phase string `json:"phase,omitempty"`
+	Phase CheckpointRequestPhase `json:"phase,omitempty"`
 
 	// StartTime is when the checkpoint operation started
 	// +optional
@@ -70,11 +104,18 @@ type CheckpointRequestStatus struct {
 	// Message is a human-readable status or error message
 	// +optional
 	Message string `json:"message,omitempty"`
+
+	// Conditions represents the latest available observations of the checkpoint request's current state
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // CheckpointRequest is the Schema for the checkpointrequests API
@@ -26,6 +26,24 @@ type CheckpointScheduleSpec struct {
 	Selector metav1.LabelSelector `json:"selector,omitempty"`
 	// The schedule to create checkpoints.
 	Schedule string `json:"schedule,omitempty"`
+	// Incremental chains every checkpoint of a container to the previous one, so the images
+	// only add the files that changed since the last checkpoint. The checkpoints fail when their
+	// image builder does not reuse the parent layers, like buildah.
+	// +optional
+	Incremental bool `json:"incremental,omitempty"`
+	// Compression is the compression of the checkpoint image layers, in the form algorithm[:level],
+	// e.g. zstd:3. The algorithm is one of none, gzip, zstd and zstd:chunked. When empty the
+	// compression configured in the manager is used.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^(none|gzip|zstd|zstd:chunked)(:[0-9]+)?$`
+	Compression string `json:"compression,omitempty"`
+	// CheckpointRegistry is the name of the CheckpointRegistry the checkpoint images are pushed to.
+	// When empty the registry configured in the manager is used.
+	// +optional
+	CheckpointRegistry string `json:"checkpointRegistry,omitempty"`
+	// Filter removes sensitive data from the checkpoint archives before their images are built.
+	// +optional
+	Filter *CheckpointFilter `json:"filter,omitempty"`
 }
 
 // CheckpointScheduleStatus defines the observed state of CheckpointSchedule.
@@ -0,0 +1,72 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// Types of the conditions of the CheckpointRequests and Checkpoints. Every condition is set with the
+// generation it observed, and the Ready condition summarizes the others, so that tools can wait for a
+// checkpoint with kubectl wait --for=condition=Ready.
+const (
+	// ConditionReady reports whether a CheckpointRequest created its Checkpoint, and whether the image of a
+	// Checkpoint was built and pushed.
+	ConditionReady = "Ready"
+
+	// CheckpointRequestPodFound reports whether the pod of a CheckpointRequest was found and may be
+	// checkpointed.
+	CheckpointRequestPodFound = "PodFound"
+	// CheckpointRequestCheckpointed reports whether the container runtime checkpointed the pod of a
+	// CheckpointRequest and its Checkpoint was created.
+	CheckpointRequestCheckpointed = "Checkpointed"
+
+	// CheckpointArchiveVerified reports whether the archive of a Checkpoint passed the integrity verification
+	// before its image was built. It is only set when the archives are verified.
+	CheckpointArchiveVerified = "ArchiveVerified"
+	// CheckpointImageBuilt reports whether the image of a Checkpoint was built.
+	CheckpointImageBuilt = "ImageBuilt"
+	// CheckpointImagePushed reports whether the image of a Checkpoint was pushed to its registry, and signed
+	// when the images are signed.
+	CheckpointImagePushed = "ImagePushed"
+)
+
+// Reasons of the conditions of the CheckpointRequests and Checkpoints. The conditions of the transitions
+// recorded in Events use the reasons of the Events.
+const (
+	// ConditionReasonPending is the reason of a condition whose stage did not complete yet.
+	ConditionReasonPending = "Pending"
+	// ConditionReasonProcessing is the reason of the Ready condition of a checkpoint whose image is being
+	// built.
+	ConditionReasonProcessing = "Processing"
+	// ConditionReasonCompleted is the reason of the Ready condition of a completed checkpoint.
+	ConditionReasonCompleted = "Completed"
+	// ConditionReasonPodFound is the reason of the PodFound condition of a request whose pod was found.
+	ConditionReasonPodFound = "PodFound"
+	// ConditionReasonPodNotFound is the reason of the PodFound condition of a request whose pod could not be
+	// found.
+	ConditionReasonPodNotFound = "PodNotFound"
+	// ConditionReasonAccessNotGranted is the reason of the PodFound condition of a request whose namespace is
+	// not granted to checkpoint the pod of another namespace.
+	ConditionReasonAccessNotGranted = "AccessNotGranted"
+	// ConditionReasonNotAuthorized is the reason of the PodFound condition of a request whose requester may
+	// not checkpoint the pod.
+	ConditionReasonNotAuthorized = "NotAuthorized"
+	// ConditionReasonRegistryNotAllowed is the reason of the PodFound condition of a request whose
+	// CheckpointRegistry does not allow its namespace.
+	ConditionReasonRegistryNotAllowed = "RegistryNotAllowed"
+	// ConditionReasonArchiveValid is the reason of the ArchiveVerified condition of a valid archive.
+	ConditionReasonArchiveValid = "ArchiveValid"
+	// ConditionReasonInvalidArchive is the reason of the ArchiveVerified condition of an invalid archive.
+	ConditionReasonInvalidArchive = "InvalidArchive"
+)
@@ -0,0 +1,46 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// Reasons of the Events recorded on the CheckpointSchedules, CheckpointRequests, Checkpoints, PodClones and
+// on the checkpointed and restored Pods and Deployments. The same reason is used on every object an Event of
+// a transition is recorded on.
+const (
+	// EventReasonCheckpointScheduled is recorded on a Deployment when its CheckpointSchedule is created or
+	// updated.
+	EventReasonCheckpointScheduled = "CheckpointScheduled"
+	// EventReasonCheckpointStarted is recorded when the checkpoint of a pod is requested and when it starts.
+	EventReasonCheckpointStarted = "CheckpointStarted"
+	// EventReasonCheckpointSucceeded is recorded when the container runtime checkpointed a pod.
+	EventReasonCheckpointSucceeded = "CheckpointSucceeded"
+	// EventReasonCheckpointFailed is recorded when a pod cannot be checkpointed.
+	EventReasonCheckpointFailed = "CheckpointFailed"
+	// EventReasonImageBuilt is recorded when the image of a checkpoint is built.
+	EventReasonImageBuilt = "ImageBuilt"
+	// EventReasonImageBuildFailed is recorded when the image of a checkpoint cannot be built.
+	EventReasonImageBuildFailed = "ImageBuildFailed"
+	// EventReasonImagePushed is recorded when the image of a checkpoint is pushed to its registry.
+	EventReasonImagePushed = "ImagePushed"
+	// EventReasonImagePushFailed is recorded when the image of a checkpoint cannot be pushed or signed.
+	EventReasonImagePushFailed = "ImagePushFailed"
+	// EventReasonRestoreTriggered is recorded when a pod is set to be restored from a checkpoint.
+	EventReasonRestoreTriggered = "RestoreTriggered"
+	// EventReasonRestoreSucceeded is recorded when the container restored from a checkpoint runs.
+	EventReasonRestoreSucceeded = "RestoreSucceeded"
+	// EventReasonRestoreFailed is recorded when a pod cannot be restored from a checkpoint.
+	EventReasonRestoreFailed = "RestoreFailed"
+)
@@ -0,0 +1,132 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PodCloneLabel is set on the clones of a pod and on their NetworkPolicy, with the name of the PodClone.
+const PodCloneLabel = "checkpoint-restore.kcr.io/clone"
+
+// PodCloneSpec defines the desired state of PodClone.
+type PodCloneSpec struct {
+	// PodName is the name of the pod to clone, in the namespace of the PodClone.
+	// +kubebuilder:validation:MinLength=1
+	PodName string `json:"podName"`
+
+	// ContainerName is the name of the container to checkpoint, defaults to the first container of the pod.
+	// +optional
+	ContainerName string `json:"containerName,omitempty"`
+
+	// Replicas is the number of clones started from the checkpoint.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// StripServiceLabels removes from the clones the labels the Services of the namespace select the pod
+	// with, so the clones don't receive the traffic of the Services.
+	// +optional
+	StripServiceLabels bool `json:"stripServiceLabels,omitempty"`
+
+	// IsolateNetwork creates a NetworkPolicy denying all the ingress and egress traffic of the clones.
+	// +optional
+	IsolateNetwork bool `json:"isolateNetwork,omitempty"`
+
+	// CheckpointRegistry is the name of the CheckpointRegistry the checkpoint image is pushed to.
+	// When empty the registry configured in the manager is used
+	// +optional
+	CheckpointRegistry string `json:"checkpointRegistry,omitempty"`
+}
+
+// PodClonePhase is the phase of a PodClone.
+// +kubebuilder:validation:Enum=Pending;Checkpointing;Completed;Failed
+type PodClonePhase string
+
+const (
+	// PodClonePhasePending is the phase of a clone whose pod was not checkpointed yet.
+	PodClonePhasePending PodClonePhase = "Pending"
+	// PodClonePhaseCheckpointing is the phase of a clone whose pod is being checkpointed.
+	PodClonePhaseCheckpointing PodClonePhase = "Checkpointing"
+	// PodClonePhaseCompleted is the phase of a clone whose clones were created.
+	PodClonePhaseCompleted PodClonePhase = "Completed"
+	// PodClonePhaseFailed is the phase of a clone whose pod could not be checkpointed or restored.
+	PodClonePhaseFailed PodClonePhase = "Failed"
+)
+
+// PodCloneStatus defines the observed state of PodClone.
+type PodCloneStatus struct {
+	// Phase represents the current state of the clone
+	Phase PodClonePhase `json:"phase,omitempty"`
+
+	// StartTime is when the pod started to be checkpointed
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the clones were created
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// CheckpointRequest is the name of the CheckpointRequest checkpointing the pod
+	// +optional
+	CheckpointRequest string `json:"checkpointRequest,omitempty"`
+
+	// Checkpoint is a reference to the Checkpoint the clones are restored from
+	// +optional
+	Checkpoint *corev1.ObjectReference `json:"checkpoint,omitempty"`
+
+	// Clones are the names of the pods restored from the checkpoint
+	// +optional
+	Clones []string `json:"clones,omitempty"`
+
+	// Message is a human-readable status or error message
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Pod",type="string",JSONPath=".spec.podName"
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.replicas"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// PodClone is the Schema for the podclones API. It checkpoints a running pod, which keeps running, and
+// starts copies of it restored from the checkpoint.
+type PodClone struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PodCloneSpec   `json:"spec,omitempty"`
+	Status PodCloneStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PodCloneList contains a list of PodClone.
+type PodCloneList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []PodClone `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PodClone{}, &PodCloneList{})
+}
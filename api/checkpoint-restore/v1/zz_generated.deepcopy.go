@@ -53,6 +53,193 @@ func (in *Checkpoint) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointAccessGrant) DeepCopyInto(out *CheckpointAccessGrant) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointAccessGrant.
+func (in *CheckpointAccessGrant) DeepCopy() *CheckpointAccessGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointAccessGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CheckpointAccessGrant) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointAccessGrantFrom) DeepCopyInto(out *CheckpointAccessGrantFrom) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointAccessGrantFrom.
+func (in *CheckpointAccessGrantFrom) DeepCopy() *CheckpointAccessGrantFrom {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointAccessGrantFrom)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointAccessGrantList) DeepCopyInto(out *CheckpointAccessGrantList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CheckpointAccessGrant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointAccessGrantList.
+func (in *CheckpointAccessGrantList) DeepCopy() *CheckpointAccessGrantList {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointAccessGrantList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CheckpointAccessGrantList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointAccessGrantSpec) DeepCopyInto(out *CheckpointAccessGrantSpec) {
+	*out = *in
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = make([]CheckpointAccessGrantFrom, len(*in))
+		copy(*out, *in)
+	}
+	if in.To != nil {
+		in, out := &in.To, &out.To
+		*out = make([]CheckpointAccessGrantTo, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointAccessGrantSpec.
+func (in *CheckpointAccessGrantSpec) DeepCopy() *CheckpointAccessGrantSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointAccessGrantSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointAccessGrantTo) DeepCopyInto(out *CheckpointAccessGrantTo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointAccessGrantTo.
+func (in *CheckpointAccessGrantTo) DeepCopy() *CheckpointAccessGrantTo {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointAccessGrantTo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointArchive) DeepCopyInto(out *CheckpointArchive) {
+	*out = *in
+	if in.CheckpointedAt != nil {
+		in, out := &in.CheckpointedAt, &out.CheckpointedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.DumpStatistics != nil {
+		in, out := &in.DumpStatistics, &out.DumpStatistics
+		*out = new(CheckpointDumpStatistics)
+		**out = **in
+	}
+	if in.Mounts != nil {
+		in, out := &in.Mounts, &out.Mounts
+		*out = make([]CheckpointMount, len(*in))
+		copy(*out, *in)
+	}
+	if in.ProcessTree != nil {
+		in, out := &in.ProcessTree, &out.ProcessTree
+		*out = new(CheckpointProcessTree)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointArchive.
+func (in *CheckpointArchive) DeepCopy() *CheckpointArchive {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointArchive)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointDumpStatistics) DeepCopyInto(out *CheckpointDumpStatistics) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointDumpStatistics.
+func (in *CheckpointDumpStatistics) DeepCopy() *CheckpointDumpStatistics {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointDumpStatistics)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointFilter) DeepCopyInto(out *CheckpointFilter) {
+	*out = *in
+	if in.ExcludePaths != nil {
+		in, out := &in.ExcludePaths, &out.ExcludePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludeFiles != nil {
+		in, out := &in.ExcludeFiles, &out.ExcludeFiles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointFilter.
+func (in *CheckpointFilter) DeepCopy() *CheckpointFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CheckpointList) DeepCopyInto(out *CheckpointList) {
 	*out = *in
@@ -85,6 +272,144 @@ func (in *CheckpointList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointMount) DeepCopyInto(out *CheckpointMount) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointMount.
+func (in *CheckpointMount) DeepCopy() *CheckpointMount {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointMount)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointProcess) DeepCopyInto(out *CheckpointProcess) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointProcess.
+func (in *CheckpointProcess) DeepCopy() *CheckpointProcess {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointProcess)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointProcessTree) DeepCopyInto(out *CheckpointProcessTree) {
+	*out = *in
+	if in.Processes != nil {
+		in, out := &in.Processes, &out.Processes
+		*out = make([]CheckpointProcess, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointProcessTree.
+func (in *CheckpointProcessTree) DeepCopy() *CheckpointProcessTree {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointProcessTree)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointRegistry) DeepCopyInto(out *CheckpointRegistry) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointRegistry.
+func (in *CheckpointRegistry) DeepCopy() *CheckpointRegistry {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointRegistry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CheckpointRegistry) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointRegistryList) DeepCopyInto(out *CheckpointRegistryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CheckpointRegistry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointRegistryList.
+func (in *CheckpointRegistryList) DeepCopy() *CheckpointRegistryList {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointRegistryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CheckpointRegistryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointRegistrySpec) DeepCopyInto(out *CheckpointRegistrySpec) {
+	*out = *in
+	if in.CredentialsSecretRef != nil {
+		in, out := &in.CredentialsSecretRef, &out.CredentialsSecretRef
+		*out = new(SecretReference)
+		**out = **in
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointRegistrySpec.
+func (in *CheckpointRegistrySpec) DeepCopy() *CheckpointRegistrySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointRegistrySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CheckpointRequest) DeepCopyInto(out *CheckpointRequest) {
 	*out = *in
@@ -181,6 +506,13 @@ func (in *CheckpointRequestStatus) DeepCopyInto(out *CheckpointRequestStatus) {
 		*out = new(corev1.ObjectReference)
 		**out = **in
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointRequestStatus.
@@ -256,6 +588,11 @@ func (in *CheckpointScheduleList) DeepCopyObject() runtime.Object {
 func (in *CheckpointScheduleSpec) DeepCopyInto(out *CheckpointScheduleSpec) {
 	*out = *in
 	in.Selector.DeepCopyInto(&out.Selector)
+	if in.Filter != nil {
+		in, out := &in.Filter, &out.Filter
+		*out = new(CheckpointFilter)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointScheduleSpec.
@@ -304,6 +641,16 @@ func (in *CheckpointSpec) DeepCopyInto(out *CheckpointSpec) {
 		*out = new(corev1.ObjectReference)
 		**out = **in
 	}
+	if in.ParentCheckpoint != nil {
+		in, out := &in.ParentCheckpoint, &out.ParentCheckpoint
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Filter != nil {
+		in, out := &in.Filter, &out.Filter
+		*out = new(CheckpointFilter)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointSpec.
@@ -319,6 +666,11 @@ func (in *CheckpointSpec) DeepCopy() *CheckpointSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CheckpointStatus) DeepCopyInto(out *CheckpointStatus) {
 	*out = *in
+	if in.EncryptionKeys != nil {
+		in, out := &in.EncryptionKeys, &out.EncryptionKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
@@ -330,6 +682,11 @@ func (in *CheckpointStatus) DeepCopyInto(out *CheckpointStatus) {
 		in, out := &in.LastTransitionTime, &out.LastTransitionTime
 		*out = (*in).DeepCopy()
 	}
+	if in.Archive != nil {
+		in, out := &in.Archive, &out.Archive
+		*out = new(CheckpointArchive)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointStatus.
@@ -342,6 +699,113 @@ func (in *CheckpointStatus) DeepCopy() *CheckpointStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodClone) DeepCopyInto(out *PodClone) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodClone.
+func (in *PodClone) DeepCopy() *PodClone {
+	if in == nil {
+		return nil
+	}
+	out := new(PodClone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PodClone) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodCloneList) DeepCopyInto(out *PodCloneList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PodClone, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodCloneList.
+func (in *PodCloneList) DeepCopy() *PodCloneList {
+	if in == nil {
+		return nil
+	}
+	out := new(PodCloneList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PodCloneList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodCloneSpec) DeepCopyInto(out *PodCloneSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodCloneSpec.
+func (in *PodCloneSpec) DeepCopy() *PodCloneSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PodCloneSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodCloneStatus) DeepCopyInto(out *PodCloneStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Checkpoint != nil {
+		in, out := &in.Checkpoint, &out.Checkpoint
+		*out = new(corev1.ObjectReference)
+		**out = **in
+	}
+	if in.Clones != nil {
+		in, out := &in.Clones, &out.Clones
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodCloneStatus.
+func (in *PodCloneStatus) DeepCopy() *PodCloneStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PodCloneStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodReference) DeepCopyInto(out *PodReference) {
 	*out = *in
@@ -356,3 +820,18 @@ func (in *PodReference) DeepCopy() *PodReference {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretReference) DeepCopyInto(out *SecretReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretReference.
+func (in *SecretReference) DeepCopy() *SecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,361 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kcr-agent runs on every node of the cluster as a DaemonSet. It processes the checkpoints created
+// on its node, building and pushing the checkpoint images from the archives the kubelet writes to the
+// node, so the manager does not need access to the host.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	// to ensure that exec-entrypoint and run can make use of them.
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/containers/buildah"
+	"github.com/containers/storage/pkg/unshare"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	checkpointrestorecontroller "github.com/GianOrtiz/kcr/internal/controller/checkpoint-restore"
+	corecontroller "github.com/GianOrtiz/kcr/internal/controller/core"
+	"github.com/GianOrtiz/kcr/internal/tracing"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
+)
+
+var (
+	scheme   = runtime.NewScheme()
+	setupLog = ctrl.Log.WithName("setup")
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+
+	utilruntime.Must(checkpointrestorev1.AddToScheme(scheme))
+}
+
+func main() {
+	var nodeName string
+	var checkpointsDirectory string
+	var registryUrl string
+	var registryAuthFile string
+	var registryUsername string
+	var registryPassword string
+	var registryCertsDirectory string
+	var registryInsecure bool
+	var signingKey string
+	var signingKeyPassphraseFile string
+	var encryptionRecipients string
+	var verifyCheckpointArchives bool
+	var decryptionKeysSecret string
+	var decryptionKeysDirectory string
+	var decryptionKeysTimeout time.Duration
+	var tracingEndpoint string
+	var tracingInsecure bool
+	var registryCredentialsSecret string
+	var namespaceRegistryCredentialsSecret string
+	var allowedNamespaceRegistries string
+	var checkpointImageFormat string
+	var imageBuilderName string
+	var ociLayoutDirectory string
+	var streamChunkSize int
+	var buildWorkers int
+	var maxProcessingCheckpoints int
+	var processingCheckpointTimeout time.Duration
+	var layerCompression string
+	var metricsAddr string
+	var probeAddr string
+	flag.StringVar(&nodeName, "node-name", os.Getenv("NODE_NAME"),
+		"The name of the node the agent runs on, defaults to the NODE_NAME environment variable")
+	flag.StringVar(
+		&checkpointsDirectory,
+		"checkpoints-directory",
+		"/var/lib/kubelet/checkpoints",
+		"The directory where the kubelet stores the checkpoints",
+	)
+	flag.StringVar(&registryUrl, "registry-url", "localhost:5001", "Registry to use for pushing checkpoint images")
+	flag.StringVar(&checkpointImageFormat, "checkpoint-image-format", string(imagebuilder.ImageFormatOCI),
+		"Format of the checkpoint images: oci follows the checkpoint image specification and can be restored by "+
+			"CRI-O and containerd, cri-o only sets the annotations required by CRI-O")
+	flag.StringVar(&imageBuilderName, "image-builder", imagebuilder.ImageBuilderBuildah,
+		"Image builder used to build the checkpoint images: buildah requires root and a containers storage, "+
+			"oci writes OCI image layouts in pure Go and can run unprivileged, stream compresses and uploads the "+
+			"checkpoint archive straight to the registry without storing the image on disk")
+	flag.StringVar(&ociLayoutDirectory, "oci-layout-directory", filepath.Join(os.TempDir(), "kcr-images"),
+		"Directory where the oci image builder writes the image layouts before pushing them")
+	flag.IntVar(&streamChunkSize, "stream-chunk-size", imagebuilder.DefaultStreamChunkSize,
+		"Size in bytes of the chunks uploaded to the registry by the stream image builder")
+	flag.IntVar(&buildWorkers, "build-workers", 2,
+		"Number of checkpoint images built and pushed at the same time by the process")
+	flag.IntVar(&maxProcessingCheckpoints, "max-processing-checkpoints", 0,
+		"Number of checkpoints of the cluster whose image is being built from which the builds wait to start, "+
+			"0 for no limit")
+	flag.DurationVar(&processingCheckpointTimeout, "processing-checkpoint-timeout",
+		checkpointrestorecontroller.DefaultProcessingTimeout, "Time after which a checkpoint whose image is being "+
+			"built is no longer counted in max-processing-checkpoints, as its build was probably interrupted")
+	flag.StringVar(&layerCompression, "layer-compression", imagebuilder.CompressionGzip,
+		"Compression of the checkpoint image layers in the form algorithm[:level], the algorithm is one of none, "+
+			"gzip, zstd and zstd:chunked. Checkpoints and schedules may override it")
+	flag.StringVar(&registryAuthFile, "registry-auth-file", "", "Registry auth file to use for authentication")
+	flag.StringVar(
+		&registryUsername,
+		"registry-username",
+		os.Getenv("REGISTRY_USERNAME"),
+		"Registry username to use for authentication requires registry-password, defaults to the "+
+			"REGISTRY_USERNAME environment variable",
+	)
+	flag.StringVar(
+		&registryPassword,
+		"registry-password",
+		os.Getenv("REGISTRY_PASSWORD"),
+		"Registry password to use for authentication requires registry-username, defaults to the "+
+			"REGISTRY_PASSWORD environment variable. Prefer registry-credentials-secret, flags are visible "+
+			"in the process list",
+	)
+	flag.StringVar(&registryCredentialsSecret, "registry-credentials-secret", "",
+		"Secret of type kubernetes.io/dockerconfigjson, in the form namespace/name, with the credentials of the "+
+			"registry. It is read on every push, so rotated credentials are used without restarting")
+	flag.StringVar(&namespaceRegistryCredentialsSecret, "namespace-registry-credentials-secret",
+		"kcr-registry-credentials",
+		"Name of the kubernetes.io/dockerconfigjson Secret with the registry credentials of a namespace. When "+
+			"it exists in the namespace of a checkpoint it is used instead of registry-credentials-secret, and "+
+			"its registry key sets the registry and repository the checkpoint images of the namespace are pushed to")
+	flag.StringVar(&allowedNamespaceRegistries, "allowed-namespace-registries", "",
+		"Comma-separated registries, with an optional repository prefix, e.g. registry.example.com/tenants, the "+
+			"registry key of the namespace registry credentials Secrets may set. The key is rejected when empty, as "+
+			"anyone writing Secrets in a namespace could otherwise send its checkpoints to any host")
+	flag.StringVar(&registryCertsDirectory, "registry-certs-directory", "",
+		"Directory with the TLS certificates of the registry following the /etc/containers/certs.d layout: "+
+			"*.crt files are CA certificates, *.cert and *.key files are client certificates and keys")
+	flag.BoolVar(&registryInsecure, "registry-insecure", false,
+		"Disable the TLS verification of the registry and allow plain HTTP, only for development registries")
+	flag.StringVar(&signingKey, "signing-key", "",
+		"Sigstore private key, as generated by cosign generate-key-pair, to sign the pushed checkpoint images with. "+
+			"Mount it from a Secret, it is read on every signature. The images are not signed when empty")
+	flag.StringVar(&signingKeyPassphraseFile, "signing-key-passphrase-file", "",
+		"File with the passphrase of the signing-key")
+	flag.BoolVar(&verifyCheckpointArchives, "verify-checkpoint-archives", true,
+		"If set, the structure and integrity of a checkpoint archive are verified before its image is built")
+	flag.StringVar(&encryptionRecipients, "encryption-recipients", "",
+		"Comma-separated recipients to encrypt the checkpoint image layers for, as jwe:<public key file> or "+
+			"pkcs7:<certificate file>. The layers are not encrypted when empty")
+	flag.StringVar(&decryptionKeysSecret, "decryption-keys-secret", "",
+		"Secret, as namespace/name, with the private keys of the encrypted checkpoint images. The keys are "+
+			"provided to the container runtime only while a pod is restored from an encrypted checkpoint")
+	flag.StringVar(&decryptionKeysDirectory, "decryption-keys-directory", "/etc/crio/keys",
+		"Directory the container runtime reads the image decryption keys from")
+	flag.DurationVar(&decryptionKeysTimeout, "decryption-keys-timeout", corecontroller.DefaultDecryptionKeysTimeout,
+		"Time since the restore of a pod started after which its decryption keys are removed, even though its "+
+			"restored container does not run")
+	flag.StringVar(&tracingEndpoint, "tracing-endpoint", "",
+		"The host:port of the OTLP gRPC collector the traces of the checkpoints are exported to. "+
+			"Tracing is disabled when empty")
+	flag.BoolVar(&tracingInsecure, "tracing-insecure", false,
+		"If set, the traces are exported to the tracing-endpoint without TLS")
+	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
+		"Use :8080 for HTTP, or leave as 0 to disable the metrics service.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	opts := zap.Options{
+		Development: true,
+	}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	// buildah runs parts of the build in children of the process, which are started without its flags and
+	// so parse the default buildah image builder. The other image builders never start any.
+	if imageBuilderName == imagebuilder.ImageBuilderBuildah && buildah.InitReexec() {
+		return
+	}
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	if nodeName == "" {
+		setupLog.Error(nil, "node-name must be provided")
+		os.Exit(1)
+	}
+
+	if (registryUsername != "" && registryPassword == "") || (registryUsername == "" && registryPassword != "") {
+		setupLog.Error(nil, "registry-username and registry-password must be provided together")
+		os.Exit(1)
+	}
+
+	imageFormat, err := imagebuilder.ParseImageFormat(checkpointImageFormat)
+	if err != nil {
+		setupLog.Error(err, "invalid checkpoint-image-format")
+		os.Exit(1)
+	}
+
+	compression, err := imagebuilder.ParseCompression(layerCompression)
+	if err != nil {
+		setupLog.Error(err, "invalid layer-compression")
+		os.Exit(1)
+	}
+
+	var registrySecret types.NamespacedName
+	if registryCredentialsSecret != "" {
+		if registrySecret, err = imagebuilder.ParseSecretReference(registryCredentialsSecret); err != nil {
+			setupLog.Error(err, "invalid registry-credentials-secret")
+			os.Exit(1)
+		}
+	}
+
+	var imageSigner imagebuilder.ImageSigner
+	if signingKey != "" {
+		if imageSigner, err = imagebuilder.NewSigstoreImageSigner(signingKey, signingKeyPassphraseFile); err != nil {
+			setupLog.Error(err, "invalid signing-key")
+			os.Exit(1)
+		}
+	}
+
+	var encryption *imagebuilder.Encryption
+	if encryptionRecipients != "" {
+		if encryption, err = imagebuilder.NewEncryption(strings.Split(encryptionRecipients, ",")); err != nil {
+			setupLog.Error(err, "invalid encryption-recipients")
+			os.Exit(1)
+		}
+	}
+
+	var decryptionSecret types.NamespacedName
+	if decryptionKeysSecret != "" {
+		if decryptionSecret, err = imagebuilder.ParseSecretReference(decryptionKeysSecret); err != nil {
+			setupLog.Error(err, "invalid decryption-keys-secret")
+			os.Exit(1)
+		}
+	}
+
+	switch imageBuilderName {
+	case imagebuilder.ImageBuilderBuildah:
+		// buildah requires a user namespace when not running as root.
+		unshare.MaybeReexecUsingUserNamespace(false)
+	case imagebuilder.ImageBuilderOCI, imagebuilder.ImageBuilderStream:
+	default:
+		setupLog.Error(nil, "image-builder must be one of buildah, oci, stream", "image-builder", imageBuilderName)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Endpoint:    tracingEndpoint,
+		Insecure:    tracingInsecure,
+		ServiceName: "kcr-agent",
+	}, nil)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
+	// Each agent only handles the checkpoints of its own node, there is no need for leader election.
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
+		HealthProbeBindAddress: probeAddr,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to start agent")
+		os.Exit(1)
+	}
+
+	registryAuth := imagebuilder.NewRegistryAuth(registryUrl, registryUsername, registryPassword, registryAuthFile)
+	registryAuth.CertsDirectory = registryCertsDirectory
+	registryAuth.Insecure = registryInsecure
+	var imageBuilder imagebuilder.ImageBuilder
+	switch imageBuilderName {
+	case imagebuilder.ImageBuilderOCI:
+		imageBuilder, err = imagebuilder.NewOCIImageBuilder(imageFormat, ociLayoutDirectory)
+	case imagebuilder.ImageBuilderStream:
+		imageBuilder, err = imagebuilder.NewStreamingImageBuilder(imageFormat, streamChunkSize)
+	default:
+		imageBuilder, err = imagebuilder.NewBuildahImageBuilder(imageFormat)
+	}
+	if err != nil {
+		setupLog.Error(err, "unable to create image builder")
+		os.Exit(1)
+	}
+
+	if err = (&checkpointrestorecontroller.CheckpointReconciler{
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		ImageBuilder:     imageBuilder,
+		LayerCompression: compression,
+		RegistryResolver: imagebuilder.RegistryResolver{
+			Reader:              mgr.GetAPIReader(),
+			Default:             registryAuth,
+			Secret:              registrySecret,
+			NamespaceSecretName: namespaceRegistryCredentialsSecret,
+			AllowedRegistries:   strings.Split(allowedNamespaceRegistries, ","),
+		},
+		ImageSigner:          imageSigner,
+		Encryption:           encryption,
+		VerifyArchives:       verifyCheckpointArchives,
+		CheckpointsDirectory: checkpointsDirectory,
+		NodeName:             nodeName,
+		Recorder:             mgr.GetEventRecorderFor("kcr-agent"),
+		Builds: &checkpointrestorecontroller.BuildQueue{
+			Workers:           buildWorkers,
+			MaxProcessing:     maxProcessingCheckpoints,
+			ProcessingTimeout: processingCheckpointTimeout,
+		},
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Checkpoint")
+		os.Exit(1)
+	}
+
+	if decryptionKeysSecret != "" {
+		if err = (&corecontroller.DecryptionKeyReconciler{
+			Client:        mgr.GetClient(),
+			Scheme:        mgr.GetScheme(),
+			NodeName:      nodeName,
+			SecretReader:  mgr.GetAPIReader(),
+			Secret:        decryptionSecret,
+			KeysDirectory: decryptionKeysDirectory,
+			KeysTimeout:   decryptionKeysTimeout,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "DecryptionKey")
+			os.Exit(1)
+		}
+	}
+
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+
+	setupLog.Info("starting agent", "node", nodeName)
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		setupLog.Error(err, "problem running agent")
+		os.Exit(1)
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "unable to export the remaining traces")
+	}
+}
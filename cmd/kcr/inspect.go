@@ -0,0 +1,374 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/opencontainers/go-digest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/archive"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/forensics"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
+)
+
+// inspectOptions are the flags of the inspect command.
+type inspectOptions struct {
+	kubeconfig             string
+	namespace              string
+	format                 string
+	extractDirectory       string
+	registryURL            string
+	registryAuthFile       string
+	registryCertsDirectory string
+	registryInsecure       bool
+	decryptionKeys         string
+	dumpMemory             string
+	memoryOutput           string
+	pageSize               int
+}
+
+func runInspect(ctx context.Context, args []string, stdout io.Writer) error {
+	var options inspectOptions
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprint(flags.Output(), `Analyze the processes, open files, sockets, environment, memory mappings and root file system
+changes of a checkpoint. The checkpoint is either the path of a checkpoint archive or the name of a
+Checkpoint, whose archive is read from the node when it is available and pulled from its image otherwise.
+
+Usage:
+  kcr inspect [flags] <checkpoint name | archive path>
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&options.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file, defaults to the KUBECONFIG "+
+		"environment variable and ~/.kube/config")
+	flags.StringVar(&options.namespace, "namespace", "", "Namespace of the Checkpoint, defaults to the namespace "+
+		"of the current kubeconfig context")
+	flags.StringVar(&options.format, "format", "text", "Output format of the report, text or json")
+	flags.StringVar(&options.extractDirectory, "extract-directory", "", "Directory to extract the checkpoint "+
+		"archive to and keep after the analysis, e.g. for crit, defaults to a temporary directory")
+	flags.StringVar(&options.registryURL, "registry-url", "", "Registry of the checkpoint image, when the "+
+		"Checkpoint status does not record it")
+	flags.StringVar(&options.registryAuthFile, "registry-auth-file", "", "Registry auth file to use for "+
+		"authentication, defaults to the containers auth file")
+	flags.StringVar(&options.registryCertsDirectory, "registry-certs-directory", "", "Directory with the "+
+		"registry certificates, in the /etc/containers/certs.d layout")
+	flags.BoolVar(&options.registryInsecure, "registry-insecure", false, "Skip the TLS verification of the "+
+		"registry and allow plain HTTP")
+	flags.StringVar(&options.decryptionKeys, "decryption-keys", "", "Comma-separated private key files, in "+
+		"PEM format, to decrypt encrypted checkpoint images")
+	flags.StringVar(&options.dumpMemory, "dump-memory", "", "Memory region to dump instead of the report, as "+
+		"PID:START-END with the addresses in hexadecimal as listed in the memory mappings")
+	flags.StringVar(&options.memoryOutput, "memory-output", "", "File the memory region is written to")
+	flags.IntVar(&options.pageSize, "page-size", 0, "Page size of the node that checkpointed the container, "+
+		"detected from the CRIU images by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a Checkpoint name or an archive path")
+	}
+	if options.format != "text" && options.format != "json" {
+		return fmt.Errorf("invalid format %q, must be text or json", options.format)
+	}
+	if (options.dumpMemory == "") != (options.memoryOutput == "") {
+		return fmt.Errorf("dump-memory and memory-output must be provided together")
+	}
+	if options.pageSize < 0 || options.pageSize&(options.pageSize-1) != 0 {
+		return fmt.Errorf("invalid page-size %d, must be a power of 2", options.pageSize)
+	}
+
+	directory := options.extractDirectory
+	if directory == "" {
+		temporaryDirectory, err := os.MkdirTemp("", "kcr-inspect-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = os.RemoveAll(temporaryDirectory)
+		}()
+		directory = temporaryDirectory
+	} else if err := os.MkdirAll(directory, 0o700); err != nil {
+		return err
+	}
+
+	archivePath, err := checkpointArchive(ctx, flags.Arg(0), options, directory)
+	if err != nil {
+		return err
+	}
+	if err := archive.Extract(archivePath, directory); err != nil {
+		return fmt.Errorf("failed to extract checkpoint archive: %w", err)
+	}
+
+	if options.dumpMemory != "" {
+		return dumpMemory(directory, options, stdout)
+	}
+
+	report, err := forensics.Analyze(directory, options.pageSize)
+	if err != nil {
+		return err
+	}
+	if options.format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return writeReport(stdout, report)
+}
+
+// checkpointArchive returns the path of the archive of the checkpoint. An existing file is the archive
+// itself, otherwise the checkpoint is the name of a Checkpoint. Its archive is used when this host has it,
+// as on the node of the checkpoint, and pulled from its image into directory otherwise.
+func checkpointArchive(ctx context.Context, checkpoint string, options inspectOptions, directory string) (string, error) {
+	if info, err := os.Stat(checkpoint); err == nil && info.Mode().IsRegular() {
+		return checkpoint, nil
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = options.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	namespace := options.namespace
+	if namespace == "" {
+		var err error
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			return "", err
+		}
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return "", fmt.Errorf("%s is not a checkpoint archive and the cluster is not reachable: %w", checkpoint, err)
+	}
+	k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return "", err
+	}
+
+	var resource checkpointrestorev1.Checkpoint
+	if err := k8sClient.Get(ctx, client.ObjectKey{Name: checkpoint, Namespace: namespace}, &resource); err != nil {
+		return "", fmt.Errorf("failed to get Checkpoint %s/%s: %w", namespace, checkpoint, err)
+	}
+	if _, err := os.Stat(resource.Spec.CheckpointData); err == nil {
+		return resource.Spec.CheckpointData, nil
+	}
+	if resource.Status.RuntimeImage == "" {
+		return "", fmt.Errorf("the archive of Checkpoint %s/%s is not on this host and its image was not built",
+			namespace, checkpoint)
+	}
+
+	registryURL := resource.Status.Registry
+	if registryURL == "" {
+		registryURL = options.registryURL
+	}
+	if registryURL == "" {
+		return "", fmt.Errorf("the registry of Checkpoint %s/%s is unknown, set registry-url", namespace, checkpoint)
+	}
+	registryAuth := imagebuilder.NewRegistryAuth(registryURL, "", "", options.registryAuthFile)
+	registryAuth.CertsDirectory = options.registryCertsDirectory
+	registryAuth.Insecure = options.registryInsecure
+
+	var decryption *imagebuilder.Decryption
+	if options.decryptionKeys != "" {
+		var privateKeys [][]byte
+		for _, keyPath := range strings.Split(options.decryptionKeys, ",") {
+			privateKey, err := os.ReadFile(keyPath)
+			if err != nil {
+				return "", fmt.Errorf("failed to read decryption key: %w", err)
+			}
+			privateKeys = append(privateKeys, privateKey)
+		}
+		if decryption, err = imagebuilder.NewDecryption(privateKeys); err != nil {
+			return "", fmt.Errorf("invalid decryption-keys: %w", err)
+		}
+	}
+
+	// The pulled archive is kept next to the extracted files, it holds the same data.
+	archivePath := filepath.Join(directory, "checkpoint.tar")
+	file, err := os.OpenFile(archivePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	err = imagebuilder.PullCheckpointArchive(ctx, registryAuth, resource.Status.RuntimeImage,
+		digest.Digest(resource.Status.ImageDigest), decryption, file)
+	if err != nil {
+		return "", err
+	}
+	return archivePath, file.Close()
+}
+
+// dumpMemory writes the memory region of the dump-memory flag to the memory output file.
+func dumpMemory(directory string, options inspectOptions, stdout io.Writer) error {
+	pidValue, region, ok := strings.Cut(options.dumpMemory, ":")
+	startValue, endValue, ok2 := strings.Cut(region, "-")
+	if !ok || !ok2 {
+		return fmt.Errorf("invalid dump-memory %q, must be PID:START-END", options.dumpMemory)
+	}
+	pid, err := strconv.ParseUint(pidValue, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid dump-memory PID %q: %w", pidValue, err)
+	}
+	start, err := strconv.ParseUint(strings.TrimPrefix(startValue, "0x"), 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid dump-memory start address %q: %w", startValue, err)
+	}
+	end, err := strconv.ParseUint(strings.TrimPrefix(endValue, "0x"), 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid dump-memory end address %q: %w", endValue, err)
+	}
+
+	file, err := os.OpenFile(options.memoryOutput, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if err := forensics.DumpMemory(directory, uint32(pid), start, end, options.pageSize, file); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "Wrote %s of the memory of process %d to %s\n",
+		formatSize(end-start), pid, options.memoryOutput)
+	return err
+}
+
+// writeReport writes the report in a human readable form.
+func writeReport(w io.Writer, report *forensics.Report) error {
+	out := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	line := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(out, format+"\n", args...)
+	}
+
+	container := report.Container
+	line("Container:\t%s", container.Name)
+	line("Image:\t%s", container.Image)
+	line("Image ID:\t%s", container.ImageID)
+	line("Engine:\t%s", container.Engine)
+	line("Runtime:\t%s", container.Runtime)
+	if !container.CheckpointedAt.IsZero() {
+		line("Checkpointed at:\t%s", container.CheckpointedAt.Format("2006-01-02 15:04:05 MST"))
+	}
+	if len(container.Environment) > 0 {
+		line("Environment:")
+		for _, variable := range container.Environment {
+			line("  %s", variable)
+		}
+	}
+	line("")
+
+	line("PID\tPPID\tPGID\tSID\tCOMMAND\tARGUMENTS")
+	for _, process := range report.Processes {
+		line("%d\t%d\t%d\t%d\t%s\t%s", process.PID, process.PPID, process.PGID, process.SID, process.Command,
+			strings.Join(process.Arguments, " "))
+	}
+
+	for _, process := range report.Processes {
+		line("")
+		line("Process %d (%s)", process.PID, process.Command)
+		if len(process.Files) > 0 {
+			line("  Open files:")
+			line("    FD\tTYPE\tPATH")
+			for _, file := range process.Files {
+				line("    %s\t%s\t%s", file.Fd, file.Type, file.Path)
+			}
+		}
+		if len(process.Sockets) > 0 {
+			line("  Sockets:")
+			line("    FD\tFAMILY\tTYPE\tPROTOCOL\tSTATE\tSOURCE\tDESTINATION")
+			for _, socket := range process.Sockets {
+				line("    %d\t%s\t%s\t%s\t%s\t%s\t%s", socket.Fd, socket.Family, socket.Type, socket.Protocol,
+					socket.State, socketAddress(socket.SrcAddr, socket.SrcPort),
+					socketAddress(socket.DestAddr, socket.DestPort))
+			}
+		}
+		if len(process.Environment) > 0 {
+			line("  Environment:")
+			for _, variable := range process.Environment {
+				line("    %s", variable)
+			}
+		}
+		if memory := process.Memory; memory != nil {
+			line("  Memory: %d mappings, %s mapped, %s dumped, executable %s", len(memory.Mappings),
+				formatSize(memory.MappedSize), formatSize(memory.DumpedSize), memory.Executable)
+			line("    START\tEND\tSIZE\tPROT\tRESOURCE")
+			for _, mapping := range memory.Mappings {
+				line("    %s\t%s\t%s\t%s\t%s", mapping.Start, mapping.End, formatSize(mapping.Size),
+					mapping.Protection, mapping.Resource)
+			}
+		}
+	}
+
+	if changes := report.RootfsChanges; changes != nil {
+		line("")
+		line("Root file system changes:")
+		for _, file := range changes.Changed {
+			line("  M %s", file)
+		}
+		for _, file := range changes.Deleted {
+			line("  D %s", file)
+		}
+	}
+	if len(report.Warnings) > 0 {
+		line("")
+		line("Warnings:")
+		for _, warning := range report.Warnings {
+			line("  %s", warning)
+		}
+	}
+	return out.Flush()
+}
+
+func socketAddress(address string, port uint32) string {
+	if port == 0 {
+		return address
+	}
+	return fmt.Sprintf("%s:%d", address, port)
+}
+
+// formatSize formats a size in bytes with a binary unit.
+func formatSize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	criucore "github.com/checkpoint-restore/go-criu/v7/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/fdinfo"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/fown"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/mm"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/pagemap"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/pstree"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/regfile"
+	"github.com/checkpoint-restore/go-criu/v7/magic"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/forensics"
+)
+
+const (
+	// testPageSize is the page size of the node of the test checkpoint.
+	testPageSize = 16 * 1024
+	// testMemoryAddress is the address of the memory page of the test process, holding its arguments.
+	testMemoryAddress = 0x10000
+	testArguments     = "app\x00--port=80\x00"
+)
+
+// criuImage returns a CRIU image file of the given type with the given entries.
+func criuImage(t *testing.T, imageType string, entries ...proto.Message) []byte {
+	t.Helper()
+	magics := magic.LoadMagic()
+	content := binary.LittleEndian.AppendUint32(nil, uint32(magics.ByName["IMG_COMMON"]))
+	content = binary.LittleEndian.AppendUint32(content, uint32(magics.ByName[imageType]))
+	for _, entry := range entries {
+		payload, err := proto.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = binary.LittleEndian.AppendUint32(content, uint32(len(payload)))
+		content = append(content, payload...)
+	}
+	return content
+}
+
+// tarContent returns a tar file with the given entries.
+func tarContent(t *testing.T, entries map[string][]byte) []byte {
+	t.Helper()
+	content := &bytes.Buffer{}
+	writer := tar.NewWriter(content)
+	for name, data := range entries {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return content.Bytes()
+}
+
+// writeTestArchive writes the archive of a checkpoint of the app container, with a single process whose
+// arguments are in its only memory page, returning its path.
+func writeTestArchive(t *testing.T) string {
+	t.Helper()
+	pages := make([]byte, testPageSize)
+	copy(pages, testArguments)
+	content := tarContent(t, map[string][]byte{
+		"config.dump":     []byte(`{"id":"0123","name":"app","rootfsImageName":"docker.io/library/app:1.0"}`),
+		"spec.dump":       []byte(`{"ociVersion":"1.0.2","process":{"env":["PATH=/bin"]}}`),
+		"rootfs-diff.tar": tarContent(t, map[string][]byte{"etc/app.conf": []byte("port=80")}),
+		"deleted.files":   []byte(`["/tmp/lock"]`),
+		"checkpoint/pstree.img": criuImage(t, "PSTREE", &pstree.PstreeEntry{
+			Pid: proto.Uint32(1), Ppid: proto.Uint32(0), Pgid: proto.Uint32(1), Sid: proto.Uint32(1),
+		}),
+		"checkpoint/core-1.img": criuImage(t, "CORE", &criucore.CoreEntry{
+			Mtype: criucore.CoreEntry_X86_64.Enum(),
+			Tc: &criucore.TaskCoreEntry{
+				TaskState:   proto.Uint32(1),
+				ExitCode:    proto.Uint32(0),
+				Personality: proto.Uint32(0),
+				Flags:       proto.Uint32(0),
+				BlkSigset:   proto.Uint64(0),
+				Comm:        proto.String("app"),
+			},
+		}),
+		"checkpoint/pagemap-1.img": criuImage(t, "PAGEMAP",
+			&pagemap.PagemapHead{PagesId: proto.Uint32(1)},
+			&pagemap.PagemapEntry{Vaddr: proto.Uint64(testMemoryAddress), NrPages: proto.Uint32(1)},
+		),
+		"checkpoint/pages-1.img": pages,
+		"checkpoint/files.img": criuImage(t, "FILES", &fdinfo.FileEntry{
+			Type: fdinfo.FdTypes_REG.Enum(),
+			Id:   proto.Uint32(1),
+			Reg: &regfile.RegFileEntry{
+				Id:    proto.Uint32(1),
+				Flags: proto.Uint32(0),
+				Pos:   proto.Uint64(0),
+				Fown: &fown.FownEntry{
+					Uid: proto.Uint32(0), Euid: proto.Uint32(0), Signum: proto.Uint32(0),
+					PidType: proto.Uint32(0), Pid: proto.Uint32(0),
+				},
+				Name: proto.String("/usr/bin/app"),
+			},
+		}),
+		"checkpoint/mm-1.img": criuImage(t, "MM", &mm.MmEntry{
+			MmStartCode:  proto.Uint64(0),
+			MmEndCode:    proto.Uint64(0),
+			MmStartData:  proto.Uint64(0),
+			MmEndData:    proto.Uint64(0),
+			MmStartStack: proto.Uint64(0),
+			MmStartBrk:   proto.Uint64(0),
+			MmBrk:        proto.Uint64(0),
+			MmArgStart:   proto.Uint64(testMemoryAddress),
+			MmArgEnd:     proto.Uint64(testMemoryAddress + uint64(len(testArguments))),
+			MmEnvStart:   proto.Uint64(testMemoryAddress),
+			MmEnvEnd:     proto.Uint64(testMemoryAddress),
+			ExeFileId:    proto.Uint32(1),
+		}),
+	})
+	path := filepath.Join(t.TempDir(), "checkpoint.tar")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunInspect(t *testing.T) {
+	archivePath := writeTestArchive(t)
+	memoryOutput := filepath.Join(t.TempDir(), "memory")
+	// An empty kubeconfig has no cluster to get the Checkpoints from.
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfig, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "text report",
+			args: []string{archivePath},
+			want: []string{"Container:  app", "docker.io/library/app:1.0", "app      app --port=80",
+				"16.0 KiB dumped", "M /etc/app.conf", "D /tmp/lock"},
+		},
+		{
+			name: "report with the page size set",
+			args: []string{"--page-size", "4096", archivePath},
+			want: []string{"4.0 KiB dumped"},
+		},
+		{
+			name: "memory dump",
+			args: []string{"--dump-memory", "1:10000-10010", "--memory-output", memoryOutput, archivePath},
+			want: []string{"Wrote 16 B of the memory of process 1 to " + memoryOutput},
+		},
+		{name: "no checkpoint", wantErr: "expected a Checkpoint name or an archive path"},
+		{name: "invalid format", args: []string{"--format", "yaml", archivePath}, wantErr: "invalid format"},
+		{
+			name:    "memory dump without output",
+			args:    []string{"--dump-memory", "1:10000-10010", archivePath},
+			wantErr: "dump-memory and memory-output must be provided together",
+		},
+		{
+			name:    "invalid memory region",
+			args:    []string{"--dump-memory", "1:10000", "--memory-output", memoryOutput, archivePath},
+			wantErr: "invalid dump-memory",
+		},
+		{name: "invalid page size", args: []string{"--page-size", "5000", archivePath}, wantErr: "invalid page-size"},
+		{
+			name:    "missing checkpoint",
+			args:    []string{"--kubeconfig", kubeconfig, "--namespace", "default", "missing"},
+			wantErr: "missing is not a checkpoint archive and the cluster is not reachable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runInspect(context.Background(), tt.args, &stdout)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("runInspect() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("output does not contain %q:\n%s", want, stdout.String())
+				}
+			}
+		})
+	}
+
+	memory, err := os.ReadFile(memoryOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(memory) != testArguments+"\x00\x00" {
+		t.Errorf("dumped memory is %q, want the arguments of the process", memory)
+	}
+}
+
+func TestRunInspectJSON(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := runInspect(context.Background(), []string{"--format", "json", writeTestArchive(t)}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+
+	var report forensics.Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Processes) != 1 {
+		t.Fatalf("report has %d processes, want 1", len(report.Processes))
+	}
+	process := report.Processes[0]
+	if strings.Join(process.Arguments, " ") != "app --port=80" {
+		t.Errorf("process has arguments %q", process.Arguments)
+	}
+	if process.Memory == nil || process.Memory.DumpedSize != testPageSize {
+		t.Errorf("process memory is %+v, want %d bytes dumped", process.Memory, testPageSize)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want string
+	}{
+		{size: 0, want: "0 B"},
+		{size: 1023, want: "1023 B"},
+		{size: 1024, want: "1.0 KiB"},
+		{size: 1536, want: "1.5 KiB"},
+		{size: 16 * 1024 * 1024, want: "16.0 MiB"},
+		{size: 3 << 30, want: "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.size); got != tt.want {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
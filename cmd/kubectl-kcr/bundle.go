@@ -0,0 +1,307 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/bundle"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
+)
+
+// registryOptions are the flags to access the registry of the checkpoint images.
+type registryOptions struct {
+	url            string
+	authFile       string
+	certsDirectory string
+	insecure       bool
+}
+
+func (options *registryOptions) addFlags(flags *flag.FlagSet, urlUsage string) {
+	flags.StringVar(&options.url, "registry-url", "", urlUsage)
+	flags.StringVar(&options.authFile, "registry-auth-file", "", "Registry auth file to use for authentication, "+
+		"defaults to the containers auth file")
+	flags.StringVar(&options.certsDirectory, "registry-certs-directory", "", "Directory with the registry "+
+		"certificates, in the /etc/containers/certs.d layout")
+	flags.BoolVar(&options.insecure, "registry-insecure", false, "Skip the TLS verification of the registry and "+
+		"allow plain HTTP")
+}
+
+func (options registryOptions) registryAuth(url string) imagebuilder.RegistryAuth {
+	registryAuth := imagebuilder.NewRegistryAuth(url, "", "", options.authFile)
+	registryAuth.CertsDirectory = options.certsDirectory
+	registryAuth.Insecure = options.insecure
+	return registryAuth
+}
+
+func runExport(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	var registry registryOptions
+	var output string
+	flags := newFlagSet("export", `Export a checkpoint as a bundle holding the Checkpoint, its image and their checksums, to import
+it in another cluster or keep it outside of the registry.
+
+Usage:
+  kubectl kcr export <checkpoint> -o bundle.tar`, &clientOptions)
+	registry.addFlags(flags, "Registry of the checkpoint image, when the Checkpoint status does not record it")
+	flags.StringVar(&output, "output", "", "File to write the bundle to, - for the standard output")
+	flags.StringVar(&output, "o", "", "Shorthand for output")
+	args, err := parseArgs(flags, args, 1, "a Checkpoint name")
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		return fmt.Errorf("output is required")
+	}
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	var checkpoint checkpointrestorev1.Checkpoint
+	if err := k8sClient.Get(ctx, client.ObjectKey{Name: args[0], Namespace: namespace}, &checkpoint); err != nil {
+		return fmt.Errorf("failed to get Checkpoint %s/%s: %w", namespace, args[0], err)
+	}
+	if checkpoint.Status.Phase != checkpointrestorev1.CheckpointPhaseImageBuilt {
+		return fmt.Errorf("the image of Checkpoint %s is not built, its phase is %q", checkpoint.Name,
+			checkpoint.Status.Phase)
+	}
+	registryURL := checkpoint.Status.Registry
+	if registryURL == "" {
+		registryURL = registry.url
+	}
+	if registryURL == "" {
+		return fmt.Errorf("the registry of Checkpoint %s is unknown, set registry-url", checkpoint.Name)
+	}
+
+	directory, err := os.MkdirTemp("", "kcr-export-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(directory)
+	}()
+
+	manifest := bundle.Manifest{
+		ExportedAt:  time.Now().UTC(),
+		Checkpoint:  checkpoint.Namespace + "/" + checkpoint.Name,
+		Registry:    registryURL,
+		Image:       checkpoint.Status.RuntimeImage,
+		ImageDigest: digest.Digest(checkpoint.Status.ImageDigest),
+	}
+	if manifest.Image == "" {
+		manifest.Image = checkpoint.Status.CheckpointImage
+	}
+	err = imagebuilder.ExportCheckpointImage(ctx, registry.registryAuth(registryURL), manifest.Image,
+		manifest.ImageDigest, filepath.Join(directory, bundle.ImageDirectory))
+	if err != nil {
+		return err
+	}
+	if err := bundle.WriteManifest(directory, manifest); err != nil {
+		return err
+	}
+
+	// The object is exported without the fields the API server of this cluster set.
+	checkpoint.APIVersion = checkpointrestorev1.GroupVersion.String()
+	checkpoint.Kind = "Checkpoint"
+	checkpoint.ObjectMeta = metav1.ObjectMeta{
+		Name:        checkpoint.Name,
+		Namespace:   checkpoint.Namespace,
+		Labels:      checkpoint.Labels,
+		Annotations: checkpoint.Annotations,
+	}
+	content, err := yaml.Marshal(&checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(directory, bundle.CheckpointFile), content, 0o600); err != nil {
+		return err
+	}
+
+	if output == "-" {
+		return bundle.Write(stdout, directory)
+	}
+	file, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if err := bundle.Write(file, directory); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "checkpoint/%s exported to %s\n", checkpoint.Name, output)
+	return err
+}
+
+func runImport(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	var registry registryOptions
+	var name, image string
+	flags := newFlagSet("import", `Import a checkpoint bundle written by export: push its image to the registry and create its
+Checkpoint, ready to be restored.
+
+Usage:
+  kubectl kcr import <bundle.tar | -> --registry-url registry`, &clientOptions)
+	registry.addFlags(flags, "Registry to push the checkpoint image to, defaults to the registry it was exported from")
+	flags.StringVar(&name, "name", "", "Name of the imported Checkpoint, defaults to the name of the exported one")
+	flags.StringVar(&image, "image", "", "Name of the pushed image, relative to the registry, defaults to the "+
+		"name of the exported image")
+	args, err := parseArgs(flags, args, 1, "a bundle path")
+	if err != nil {
+		return err
+	}
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	directory, err := os.MkdirTemp("", "kcr-import-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(directory)
+	}()
+	var input io.Reader = os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		input = file
+	}
+	manifest, err := bundle.Read(input, directory)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(filepath.Join(directory, bundle.CheckpointFile))
+	if err != nil {
+		return fmt.Errorf("invalid bundle: %w", err)
+	}
+	var exported checkpointrestorev1.Checkpoint
+	if err := yaml.UnmarshalStrict(content, &exported); err != nil {
+		return fmt.Errorf("invalid bundle: failed to decode %s: %w", bundle.CheckpointFile, err)
+	}
+
+	registryURL := registry.url
+	if registryURL == "" {
+		registryURL = manifest.Registry
+	}
+	if image == "" {
+		image = manifest.Image
+	}
+	pushed, err := imagebuilder.ImportCheckpointImage(ctx, filepath.Join(directory, bundle.ImageDirectory),
+		registry.registryAuth(registryURL), image)
+	if err != nil {
+		return err
+	}
+	if manifest.ImageDigest != "" && pushed.Digest != manifest.ImageDigest {
+		return fmt.Errorf("the pushed image has digest %s instead of the exported %s", pushed.Digest,
+			manifest.ImageDigest)
+	}
+
+	checkpoint := importedCheckpoint(&exported, manifest, namespace)
+	if name != "" {
+		checkpoint.Name = name
+	}
+	checkpoint.Spec.CheckpointID = checkpoint.Name
+	if err := k8sClient.Create(ctx, checkpoint); err != nil {
+		return fmt.Errorf("failed to create Checkpoint: %w", err)
+	}
+	checkpoint.Status = exported.Status
+	checkpoint.Status.Phase = checkpointrestorev1.CheckpointPhaseImageBuilt
+	checkpoint.Status.Registry = registryURL
+	checkpoint.Status.RuntimeImage = image
+	checkpoint.Status.ImageDigest = pushed.Digest.String()
+	checkpoint.Status.CompressedSize = pushed.Size
+	// The signatures are not exported, the image must be signed again in this cluster.
+	checkpoint.Status.Signed = false
+	checkpoint.Status.LastTransitionTime = &metav1.Time{Time: time.Now()}
+	meta.SetStatusCondition(&checkpoint.Status.Conditions, metav1.Condition{
+		Type:               checkpointrestorev1.CheckpointImagePushed,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: checkpoint.Generation,
+		Reason:             checkpointrestorev1.EventReasonImagePushed,
+		Message:            fmt.Sprintf("Imported image %s/%s@%s", registryURL, image, pushed.Digest),
+	})
+	meta.SetStatusCondition(&checkpoint.Status.Conditions, metav1.Condition{
+		Type:               checkpointrestorev1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: checkpoint.Generation,
+		Reason:             checkpointrestorev1.ConditionReasonCompleted,
+		Message:            "Checkpoint imported from " + manifest.Checkpoint,
+	})
+	if err := k8sClient.Status().Update(ctx, checkpoint); err != nil {
+		return fmt.Errorf("failed to update the status of Checkpoint %s: %w", checkpoint.Name, err)
+	}
+	_, err = fmt.Fprintf(stdout, "checkpoint/%s imported from %s with image %s/%s\n", checkpoint.Name,
+		manifest.Checkpoint, registryURL, imagebuilder.DigestReference(image, pushed.Digest))
+	return err
+}
+
+// importedCheckpoint returns the Checkpoint to create in namespace for the exported one. The references to
+// the resources of the exporting cluster, like the node of the archive or the parent checkpoint, are
+// removed, the imported image holds every layer.
+func importedCheckpoint(
+	exported *checkpointrestorev1.Checkpoint, manifest *bundle.Manifest, namespace string,
+) *checkpointrestorev1.Checkpoint {
+	checkpoint := &checkpointrestorev1.Checkpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      exported.Name,
+			Namespace: namespace,
+			Labels:    map[string]string{},
+			Annotations: map[string]string{
+				checkpointrestorev1.ImportedCheckpointAnnotation: manifest.Checkpoint,
+			},
+		},
+		Spec: *exported.Spec.DeepCopy(),
+	}
+	for _, label := range []string{"pod", "container"} {
+		if value, ok := exported.Labels[label]; ok {
+			checkpoint.Labels[label] = value
+		}
+	}
+	// Restoring the checkpoint in this cluster creates the pod in the namespace of the Checkpoint.
+	checkpoint.Labels["pod-ns"] = namespace
+	checkpoint.Spec.CheckpointData = ""
+	checkpoint.Spec.NodeName = ""
+	checkpoint.Spec.CheckpointScheduleRef = nil
+	checkpoint.Spec.ParentCheckpoint = nil
+	checkpoint.Spec.CheckpointRegistry = ""
+	return checkpoint
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+// checkpointOptions are the options of the CheckpointRequest created for a pod.
+type checkpointOptions struct {
+	container   string
+	incremental bool
+	registry    string
+	wait        bool
+	timeout     time.Duration
+}
+
+func (options *checkpointOptions) addFlags(flags *flag.FlagSet) {
+	flags.StringVar(&options.container, "container", "", "Container to checkpoint, defaults to the first "+
+		"container of the pod")
+	flags.StringVar(&options.container, "c", "", "Shorthand for container")
+	flags.BoolVar(&options.incremental, "incremental", false, "Only store the changes since the last "+
+		"checkpoint of the container")
+	flags.StringVar(&options.registry, "registry", "", "CheckpointRegistry to push the checkpoint image to, "+
+		"defaults to the registry of the namespace")
+	flags.DurationVar(&options.timeout, "timeout", 10*time.Minute, "How long to wait for each step")
+}
+
+func runCheckpoint(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	var options checkpointOptions
+	flags := newFlagSet("checkpoint", `Checkpoint a container of a pod by creating a CheckpointRequest.
+
+Usage:
+  kubectl kcr checkpoint <pod> [-c container] [--wait]`, &clientOptions)
+	options.addFlags(flags)
+	flags.BoolVar(&options.wait, "wait", false, "Wait until the checkpoint image is built, printing its progress")
+	args, err := parseArgs(flags, args, 1, "a pod name")
+	if err != nil {
+		return err
+	}
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	checkpointRequest, err := createCheckpointRequest(ctx, k8sClient, namespace, args[0], options)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(stdout, "checkpointrequest/%s created for container %s of pod %s\n",
+		checkpointRequest.Name, checkpointRequest.Spec.ContainerName, checkpointRequest.Spec.PodReference.Name)
+	if !options.wait {
+		return nil
+	}
+	_, err = waitForCheckpoint(ctx, k8sClient, checkpointRequest, options.timeout, stdout)
+	return err
+}
+
+// createCheckpointRequest creates the CheckpointRequest checkpointing the container of the pod.
+func createCheckpointRequest(
+	ctx context.Context, k8sClient client.Client, namespace, podName string, options checkpointOptions,
+) (*checkpointrestorev1.CheckpointRequest, error) {
+	var pod corev1.Pod
+	if err := k8sClient.Get(ctx, client.ObjectKey{Name: podName, Namespace: namespace}, &pod); err != nil {
+		return nil, fmt.Errorf("failed to get pod %s/%s: %w", namespace, podName, err)
+	}
+	containerName := options.container
+	if containerName == "" {
+		containerName = pod.Spec.Containers[0].Name
+	} else if !hasContainer(&pod, containerName) {
+		return nil, fmt.Errorf("pod %s/%s has no container %s", namespace, podName, containerName)
+	}
+
+	checkpointRequest := &checkpointrestorev1.CheckpointRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", pod.Name, time.Now().Unix()),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":    "checkpoint-restore",
+				"pod":    pod.Name,
+				"pod-ns": pod.Namespace,
+			},
+		},
+		Spec: checkpointrestorev1.CheckpointRequestSpec{
+			PodReference: checkpointrestorev1.PodReference{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+			ContainerName:      containerName,
+			Incremental:        options.incremental,
+			CheckpointRegistry: options.registry,
+		},
+	}
+	if err := k8sClient.Create(ctx, checkpointRequest); err != nil {
+		return nil, fmt.Errorf("failed to create CheckpointRequest: %w", err)
+	}
+	return checkpointRequest, nil
+}
+
+func hasContainer(pod *corev1.Pod, containerName string) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForCheckpoint waits until the Checkpoint created for the request has its image built, printing the
+// phases and the conditions of the request and the checkpoint as they change.
+func waitForCheckpoint(
+	ctx context.Context,
+	k8sClient client.Client,
+	checkpointRequest *checkpointrestorev1.CheckpointRequest,
+	timeout time.Duration,
+	stdout io.Writer,
+) (*checkpointrestorev1.Checkpoint, error) {
+	progress := newProgress(stdout)
+	var checkpoint checkpointrestorev1.Checkpoint
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		if checkpointRequest.Status.Checkpoint == nil {
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(checkpointRequest), checkpointRequest); err != nil {
+				return false, err
+			}
+			progress.phase("checkpointrequest/"+checkpointRequest.Name, string(checkpointRequest.Status.Phase))
+			progress.conditions("checkpointrequest/"+checkpointRequest.Name, checkpointRequest.Status.Conditions)
+			switch checkpointRequest.Status.Phase {
+			case checkpointrestorev1.CheckpointRequestPhaseFailed:
+				return false, fmt.Errorf("checkpoint request %s failed: %s", checkpointRequest.Name,
+					checkpointRequest.Status.Message)
+			case checkpointrestorev1.CheckpointRequestPhaseCompleted:
+			default:
+				return false, nil
+			}
+			if checkpointRequest.Status.Checkpoint == nil {
+				return false, fmt.Errorf("checkpoint request %s completed without a Checkpoint", checkpointRequest.Name)
+			}
+		}
+
+		key := client.ObjectKey{
+			Name:      checkpointRequest.Status.Checkpoint.Name,
+			Namespace: checkpointRequest.Status.Checkpoint.Namespace,
+		}
+		if err := k8sClient.Get(ctx, key, &checkpoint); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		progress.phase("checkpoint/"+checkpoint.Name, string(checkpoint.Status.Phase))
+		progress.conditions("checkpoint/"+checkpoint.Name, checkpoint.Status.Conditions)
+		switch checkpoint.Status.Phase {
+		case checkpointrestorev1.CheckpointPhaseFailed:
+			return false, fmt.Errorf("checkpoint %s failed: %s", checkpoint.Name, checkpoint.Status.FailedReason)
+		case checkpointrestorev1.CheckpointPhaseImageBuilt:
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// progress prints the changes of the phases and the conditions of the resources being waited for.
+type progress struct {
+	out    io.Writer
+	phases map[string]string
+	seen   map[string]bool
+}
+
+func newProgress(out io.Writer) *progress {
+	return &progress{out: out, phases: map[string]string{}, seen: map[string]bool{}}
+}
+
+func (p *progress) phase(resource, phase string) {
+	if phase == "" || p.phases[resource] == phase {
+		return
+	}
+	p.phases[resource] = phase
+	_, _ = fmt.Fprintf(p.out, "%s: %s\n", resource, phase)
+}
+
+func (p *progress) conditions(resource string, conditions []metav1.Condition) {
+	for _, condition := range conditions {
+		key := resource + "/" + condition.Type + "/" + string(condition.Status) + "/" + condition.Reason
+		if p.seen[key] {
+			continue
+		}
+		p.seen[key] = true
+		_, _ = fmt.Fprintf(p.out, "%s: %s=%s %s: %s\n", resource, condition.Type, condition.Status,
+			condition.Reason, condition.Message)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pollInterval is the interval the status of the resources is read at while waiting for them.
+const pollInterval = 2 * time.Second
+
+// clientOptions are the flags selecting the cluster and the namespace, shared by every command.
+type clientOptions struct {
+	kubeconfig string
+	namespace  string
+}
+
+// newFlagSet returns the flag set of a command, with the client flags and a usage describing the command.
+func newFlagSet(name, description string, options *clientOptions) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(flags.Output(), "%s\n\nFlags:\n", description)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&options.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file, defaults to the KUBECONFIG "+
+		"environment variable and ~/.kube/config")
+	flags.StringVar(&options.namespace, "namespace", "", "Namespace of the resources, defaults to the namespace "+
+		"of the current kubeconfig context")
+	flags.StringVar(&options.namespace, "n", "", "Shorthand for namespace")
+	return flags
+}
+
+// newClient returns a client of the cluster of the kubeconfig and the namespace to work in.
+func (options clientOptions) newClient() (client.Client, string, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = options.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	namespace := options.namespace
+	if namespace == "" {
+		var err error
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			return nil, "", err
+		}
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	k8sClient, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, "", err
+	}
+	return k8sClient, namespace, nil
+}
+
+// parseArgs parses the flags of the command, which may come before or after its arguments as with
+// kubectl, and returns the arguments. It fails with the usage of the command when it was not given count
+// arguments.
+func parseArgs(flags *flag.FlagSet, args []string, count int, names string) ([]string, error) {
+	var arguments []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		arguments = append(arguments, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(arguments) != count {
+		flags.Usage()
+		return nil, fmt.Errorf("expected %s", names)
+	}
+	return arguments, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+func runClone(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	var container, registry, name string
+	var replicas int
+	var stripServiceLabels, isolateNetwork, waitClones bool
+	var timeout time.Duration
+	flags := newFlagSet("clone", `Clone a running pod by creating a PodClone: checkpoint a container of the pod, which keeps
+running, and start copies of the pod restored from the checkpoint.
+
+Usage:
+  kubectl kcr clone <pod> [--replicas n] [--strip-service-labels] [--isolate-network] [--wait]`, &clientOptions)
+	flags.StringVar(&container, "container", "", "Container to checkpoint, defaults to the first container of "+
+		"the pod")
+	flags.StringVar(&container, "c", "", "Shorthand for container")
+	flags.IntVar(&replicas, "replicas", 1, "Number of clones")
+	flags.BoolVar(&stripServiceLabels, "strip-service-labels", false, "Remove the labels the Services select "+
+		"the pod with from the clones")
+	flags.BoolVar(&isolateNetwork, "isolate-network", false, "Deny all the traffic of the clones with a "+
+		"NetworkPolicy")
+	flags.StringVar(&registry, "registry", "", "CheckpointRegistry to push the checkpoint image to, defaults "+
+		"to the registry of the namespace")
+	flags.StringVar(&name, "name", "", "Name of the PodClone, defaults to a name generated from the pod")
+	flags.BoolVar(&waitClones, "wait", false, "Wait until the clones are created")
+	flags.DurationVar(&timeout, "timeout", 10*time.Minute, "How long to wait for the clones")
+	args, err := parseArgs(flags, args, 1, "a pod name")
+	if err != nil {
+		return err
+	}
+	if replicas < 1 {
+		return fmt.Errorf("replicas must be at least 1")
+	}
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	podClone := &checkpointrestorev1.PodClone{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: checkpointrestorev1.PodCloneSpec{
+			PodName:            args[0],
+			ContainerName:      container,
+			Replicas:           int32(replicas),
+			StripServiceLabels: stripServiceLabels,
+			IsolateNetwork:     isolateNetwork,
+			CheckpointRegistry: registry,
+		},
+	}
+	if podClone.Name == "" {
+		podClone.Name = fmt.Sprintf("%s-clone-%d", args[0], time.Now().Unix())
+	}
+	if err := k8sClient.Create(ctx, podClone); err != nil {
+		return fmt.Errorf("failed to create PodClone: %w", err)
+	}
+	_, _ = fmt.Fprintf(stdout, "podclone/%s created for pod %s\n", podClone.Name, args[0])
+	if !waitClones {
+		return nil
+	}
+
+	progress := newProgress(stdout)
+	err = wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(podClone), podClone); err != nil {
+			return false, err
+		}
+		progress.phase("podclone/"+podClone.Name, string(podClone.Status.Phase))
+		switch podClone.Status.Phase {
+		case checkpointrestorev1.PodClonePhaseCompleted:
+			return true, nil
+		case checkpointrestorev1.PodClonePhaseFailed:
+			return false, fmt.Errorf("PodClone %s failed: %s", podClone.Name, podClone.Status.Message)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "pods %s created\n", strings.Join(podClone.Status.Clones, ", "))
+	return err
+}
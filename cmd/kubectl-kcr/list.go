@@ -0,0 +1,237 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+func runList(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	var podName, scheduleName string
+	var allNamespaces bool
+	flags := newFlagSet("list", `List the checkpoints, oldest first.
+
+Usage:
+  kubectl kcr list [--pod pod | --schedule schedule]`, &clientOptions)
+	flags.StringVar(&podName, "pod", "", "Only list the checkpoints of this pod")
+	flags.StringVar(&scheduleName, "schedule", "", "Only list the checkpoints of this CheckpointSchedule")
+	flags.BoolVar(&allNamespaces, "all-namespaces", false, "List the checkpoints of every namespace")
+	flags.BoolVar(&allNamespaces, "A", false, "Shorthand for all-namespaces")
+	if _, err := parseArgs(flags, args, 0, "no arguments"); err != nil {
+		return err
+	}
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	var options []client.ListOption
+	if !allNamespaces {
+		options = append(options, client.InNamespace(namespace))
+	}
+	if podName != "" {
+		options = append(options, client.MatchingLabels{"pod": podName})
+	}
+	var checkpoints checkpointrestorev1.CheckpointList
+	if err := k8sClient.List(ctx, &checkpoints, options...); err != nil {
+		return fmt.Errorf("failed to list Checkpoints: %w", err)
+	}
+	items := filterSchedule(checkpoints.Items, scheduleName)
+	sortCheckpoints(items)
+
+	out := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	header := "NAME\tPOD\tCONTAINER\tNODE\tPHASE\tSIZE\tAGE"
+	if allNamespaces {
+		header = "NAMESPACE\t" + header
+	}
+	_, _ = fmt.Fprintln(out, header)
+	for _, checkpoint := range items {
+		row := []string{
+			checkpoint.Name,
+			checkpoint.Labels["pod"],
+			checkpoint.Spec.ContainerName,
+			checkpoint.Spec.NodeName,
+			string(checkpoint.Status.Phase),
+			checkpointSize(&checkpoint),
+			duration.HumanDuration(time.Since(checkpointTime(&checkpoint))),
+		}
+		if allNamespaces {
+			row = append([]string{checkpoint.Namespace}, row...)
+		}
+		_, _ = fmt.Fprintln(out, strings.Join(row, "\t"))
+	}
+	return out.Flush()
+}
+
+func runDescribe(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	flags := newFlagSet("describe", `Show the details of a checkpoint.
+
+Usage:
+  kubectl kcr describe <checkpoint>`, &clientOptions)
+	args, err := parseArgs(flags, args, 1, "a Checkpoint name")
+	if err != nil {
+		return err
+	}
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	var checkpoint checkpointrestorev1.Checkpoint
+	if err := k8sClient.Get(ctx, client.ObjectKey{Name: args[0], Namespace: namespace}, &checkpoint); err != nil {
+		return fmt.Errorf("failed to get Checkpoint %s/%s: %w", namespace, args[0], err)
+	}
+	return describeCheckpoint(stdout, &checkpoint)
+}
+
+// describeCheckpoint writes the details of the checkpoint in a human readable form.
+func describeCheckpoint(w io.Writer, checkpoint *checkpointrestorev1.Checkpoint) error {
+	out := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	line := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(out, format+"\n", args...)
+	}
+	optional := func(name, value string) {
+		if value != "" {
+			line("%s:\t%s", name, value)
+		}
+	}
+
+	spec, status := checkpoint.Spec, checkpoint.Status
+	line("Name:\t%s", checkpoint.Name)
+	line("Namespace:\t%s", checkpoint.Namespace)
+	line("Pod:\t%s/%s", checkpoint.Labels["pod-ns"], checkpoint.Labels["pod"])
+	line("Container:\t%s", spec.ContainerName)
+	line("Node:\t%s", spec.NodeName)
+	line("Checkpointed at:\t%s", checkpointTime(checkpoint).Format(time.RFC3339))
+	if spec.CheckpointScheduleRef != nil {
+		line("Schedule:\t%s", spec.CheckpointScheduleRef.Name)
+	}
+	if spec.ParentCheckpoint != nil {
+		line("Parent checkpoint:\t%s", spec.ParentCheckpoint.Name)
+	}
+	optional("Archive", spec.CheckpointData)
+	line("Phase:\t%s", status.Phase)
+	optional("Failed reason", status.FailedReason)
+	if status.RuntimeImage != "" {
+		line("Image:\t%s/%s", status.Registry, status.RuntimeImage)
+	}
+	optional("Image digest", status.ImageDigest)
+	line("Signed:\t%t", status.Signed)
+	line("Encrypted:\t%t", len(status.EncryptionKeys) > 0)
+	optional("Compression", status.Compression)
+	if status.RawSize > 0 {
+		line("Size:\t%s, %s compressed", formatSize(status.RawSize), formatSize(status.CompressedSize))
+	}
+	optional("Archive digest", status.ArchiveDigest)
+	if status.FilteredFiles > 0 {
+		line("Filtered files:\t%d", status.FilteredFiles)
+	}
+
+	if archive := status.Archive; archive != nil {
+		line("Container image:\t%s", archive.Image)
+		line("Engine:\t%s", archive.Engine)
+		line("Runtime:\t%s", archive.Runtime)
+		if archive.CRIUImageVersion > 0 {
+			line("CRIU image version:\t%d", archive.CRIUImageVersion)
+		}
+		if tree := archive.ProcessTree; tree != nil {
+			line("Processes:\t%d processes, %d threads", tree.ProcessCount, tree.ThreadCount)
+			for _, process := range tree.Processes {
+				line("  %d\t%s", process.PID, process.Command)
+			}
+		}
+		if statistics := archive.DumpStatistics; statistics != nil {
+			line("Frozen time:\t%s", statistics.FrozenTime.Duration)
+			line("Pages written:\t%d", statistics.PagesWritten)
+		}
+	}
+
+	if len(status.Conditions) > 0 {
+		line("Conditions:")
+		line("  TYPE\tSTATUS\tREASON\tMESSAGE")
+		for _, condition := range status.Conditions {
+			line("  %s\t%s\t%s\t%s", condition.Type, condition.Status, condition.Reason, condition.Message)
+		}
+	}
+	return out.Flush()
+}
+
+// filterSchedule returns the checkpoints created by the schedule, or all of them when schedule is empty.
+func filterSchedule(checkpoints []checkpointrestorev1.Checkpoint, schedule string) []checkpointrestorev1.Checkpoint {
+	if schedule == "" {
+		return checkpoints
+	}
+	var filtered []checkpointrestorev1.Checkpoint
+	for _, checkpoint := range checkpoints {
+		if ref := checkpoint.Spec.CheckpointScheduleRef; ref != nil && ref.Name == schedule {
+			filtered = append(filtered, checkpoint)
+		}
+	}
+	return filtered
+}
+
+// sortCheckpoints sorts the checkpoints from the oldest to the newest.
+func sortCheckpoints(checkpoints []checkpointrestorev1.Checkpoint) {
+	sort.SliceStable(checkpoints, func(i, j int) bool {
+		return checkpointTime(&checkpoints[i]).Before(checkpointTime(&checkpoints[j]))
+	})
+}
+
+// checkpointTime returns when the checkpoint was taken, or created for checkpoints without a timestamp.
+func checkpointTime(checkpoint *checkpointrestorev1.Checkpoint) time.Time {
+	if checkpoint.Spec.CheckpointTimestamp != nil {
+		return checkpoint.Spec.CheckpointTimestamp.Time
+	}
+	return checkpoint.CreationTimestamp.Time
+}
+
+func checkpointSize(checkpoint *checkpointrestorev1.Checkpoint) string {
+	if checkpoint.Status.CompressedSize > 0 {
+		return formatSize(checkpoint.Status.CompressedSize)
+	}
+	if checkpoint.Status.RawSize > 0 {
+		return formatSize(checkpoint.Status.RawSize)
+	}
+	return "<none>"
+}
+
+// formatSize formats a size in bytes with a binary unit.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-kcr is the kubectl plugin to checkpoint, restore, migrate and clone pods with kcr. Installed in the
+// PATH, it runs as "kubectl kcr", and creates and reads the resources of api/checkpoint-restore/v1 so
+// the checkpoints do not need to be written by hand.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+
+	utilruntime.Must(checkpointrestorev1.AddToScheme(scheme))
+}
+
+// command runs a subcommand with its arguments, writing its output to stdout.
+type command func(ctx context.Context, args []string, stdout io.Writer) error
+
+var commands = map[string]command{
+	"checkpoint": runCheckpoint,
+	"restore":    runRestore,
+	"list":       runList,
+	"describe":   runDescribe,
+	"schedule":   runSchedule,
+	"prune":      runPrune,
+	"migrate":    runMigrate,
+	"clone":      runClone,
+	"export":     runExport,
+	"import":     runImport,
+}
+
+func usage(w io.Writer) {
+	_, _ = fmt.Fprint(w, `kubectl kcr checkpoints, restores, migrates and clones pods with kcr.
+
+Usage:
+  kubectl kcr <command> [flags]
+
+Commands:
+  checkpoint <pod>          Checkpoint a container of a pod
+  restore <checkpoint>      Restore a checkpoint in a new pod
+  list                      List the checkpoints
+  describe <checkpoint>     Show the details of a checkpoint
+  schedule create <name>    Create a checkpoint schedule
+  prune                     Delete old checkpoints
+  migrate <pod>             Checkpoint a pod and restore it on another node
+  clone <pod>               Start copies of a running pod from a checkpoint
+  export <checkpoint>       Export a checkpoint as a portable bundle
+  import <bundle>           Import a checkpoint bundle
+
+Run "kubectl kcr <command> -h" for the flags of a command.
+`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch name := os.Args[1]; name {
+	case "help", "-h", "--help":
+		usage(os.Stdout)
+	default:
+		run, ok := commands[name]
+		if !ok {
+			_, _ = fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+			usage(os.Stderr)
+			os.Exit(2)
+		}
+		err = run(ctx, os.Args[2:], os.Stdout)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error:", err)
+		stop()
+		os.Exit(1)
+	}
+}
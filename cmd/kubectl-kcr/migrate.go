@@ -0,0 +1,90 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func runMigrate(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	var checkpoint checkpointOptions
+	var restore restoreOptions
+	var keepSource bool
+	flags := newFlagSet("migrate", `Migrate a pod to another node: checkpoint a container of the pod, restore the checkpoint in a new
+pod on the node and delete the pod once the restored pod runs.
+
+Usage:
+  kubectl kcr migrate <pod> --node node [-c container]`, &clientOptions)
+	checkpoint.addFlags(flags)
+	restore.addFlags(flags)
+	flags.StringVar(&restore.node, "node", "", "Node to migrate the pod to")
+	flags.StringVar(&restore.name, "name", "", "Name of the migrated pod, defaults to a name generated from "+
+		"the pod")
+	flags.BoolVar(&keepSource, "keep-source", false, "Keep the pod after the migration")
+	args, err := parseArgs(flags, args, 1, "a pod name")
+	if err != nil {
+		return err
+	}
+	if restore.node == "" {
+		return fmt.Errorf("node is required")
+	}
+	if err := restore.setupVerifier(); err != nil {
+		return err
+	}
+	restore.timeout = checkpoint.timeout
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	checkpointRequest, err := createCheckpointRequest(ctx, k8sClient, namespace, args[0], checkpoint)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(stdout, "checkpointrequest/%s created for container %s of pod %s\n",
+		checkpointRequest.Name, checkpointRequest.Spec.ContainerName, checkpointRequest.Spec.PodReference.Name)
+	built, err := waitForCheckpoint(ctx, k8sClient, checkpointRequest, checkpoint.timeout, stdout)
+	if err != nil {
+		return err
+	}
+
+	pod, err := restorePod(ctx, k8sClient, built, restore)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(stdout, "pod/%s created from checkpoint %s on node %s\n", pod.Name, built.Name, restore.node)
+	if err := waitForPod(ctx, k8sClient, pod, restore.timeout, stdout); err != nil {
+		return err
+	}
+	if keepSource {
+		return nil
+	}
+
+	source := &corev1.Pod{}
+	source.Name, source.Namespace = args[0], namespace
+	if err := k8sClient.Delete(ctx, source); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete pod %s: %w", source.Name, err)
+	}
+	_, err = fmt.Fprintf(stdout, "pod/%s deleted\n", source.Name)
+	return err
+}
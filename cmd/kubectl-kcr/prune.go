@@ -0,0 +1,132 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+func runPrune(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	var podName, scheduleName string
+	var keep int
+	var olderThan time.Duration
+	var failed, dryRun bool
+	flags := newFlagSet("prune", `Delete the checkpoints matching any of the keep, older-than and failed criteria. The parents of
+the kept incremental checkpoints are always kept, as restoring them needs their parent images.
+
+Usage:
+  kubectl kcr prune [--keep count] [--older-than duration] [--failed] [--dry-run]`, &clientOptions)
+	flags.StringVar(&podName, "pod", "", "Only prune the checkpoints of this pod")
+	flags.StringVar(&scheduleName, "schedule", "", "Only prune the checkpoints of this CheckpointSchedule")
+	flags.IntVar(&keep, "keep", -1, "Keep the given number of newest checkpoints of every container and delete "+
+		"the others")
+	flags.DurationVar(&olderThan, "older-than", 0, "Delete the checkpoints older than the given duration, e.g. 72h")
+	flags.BoolVar(&failed, "failed", false, "Delete the failed checkpoints")
+	flags.BoolVar(&dryRun, "dry-run", false, "Only print the checkpoints that would be deleted")
+	if _, err := parseArgs(flags, args, 0, "no arguments"); err != nil {
+		return err
+	}
+	if keep < 0 && olderThan == 0 && !failed {
+		return fmt.Errorf("at least one of keep, older-than and failed is required")
+	}
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	options := []client.ListOption{client.InNamespace(namespace)}
+	if podName != "" {
+		options = append(options, client.MatchingLabels{"pod": podName})
+	}
+	var checkpoints checkpointrestorev1.CheckpointList
+	if err := k8sClient.List(ctx, &checkpoints, options...); err != nil {
+		return fmt.Errorf("failed to list Checkpoints: %w", err)
+	}
+	items := filterSchedule(checkpoints.Items, scheduleName)
+	sortCheckpoints(items)
+
+	for _, checkpoint := range prunedCheckpoints(items, keep, olderThan, failed, time.Now()) {
+		if dryRun {
+			_, _ = fmt.Fprintf(stdout, "checkpoint/%s would be deleted\n", checkpoint.Name)
+			continue
+		}
+		if err := k8sClient.Delete(ctx, checkpoint); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete Checkpoint %s: %w", checkpoint.Name, err)
+		}
+		_, _ = fmt.Fprintf(stdout, "checkpoint/%s deleted\n", checkpoint.Name)
+	}
+	return nil
+}
+
+// prunedCheckpoints returns the checkpoints to delete among the checkpoints sorted from the oldest to the
+// newest. A checkpoint is deleted when it is not among the keep newest of its container, when it was taken
+// before now minus olderThan, or when it failed, unless it is the parent of a kept checkpoint. The criteria
+// with a negative keep, a zero olderThan or a false failed are ignored.
+func prunedCheckpoints(
+	checkpoints []checkpointrestorev1.Checkpoint, keep int, olderThan time.Duration, failed bool, now time.Time,
+) []*checkpointrestorev1.Checkpoint {
+	// Containers are identified by their pod, which keeps its name when it is recreated by a StatefulSet.
+	newer := map[string]int{}
+	prune := map[string]bool{}
+	for i := len(checkpoints) - 1; i >= 0; i-- {
+		checkpoint := &checkpoints[i]
+		container := checkpoint.Labels["pod-ns"] + "/" + checkpoint.Labels["pod"] + "/" + checkpoint.Spec.ContainerName
+		if keep >= 0 && newer[container] >= keep {
+			prune[checkpoint.Name] = true
+		}
+		if olderThan > 0 && checkpointTime(checkpoint).Before(now.Add(-olderThan)) {
+			prune[checkpoint.Name] = true
+		}
+		if failed && checkpoint.Status.Phase == checkpointrestorev1.CheckpointPhaseFailed {
+			prune[checkpoint.Name] = true
+		}
+		newer[container]++
+	}
+
+	parents := map[string]string{}
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Spec.ParentCheckpoint != nil {
+			parents[checkpoint.Name] = checkpoint.Spec.ParentCheckpoint.Name
+		}
+	}
+	kept := map[string]bool{}
+	for _, checkpoint := range checkpoints {
+		if prune[checkpoint.Name] {
+			continue
+		}
+		for parent, ok := parents[checkpoint.Name]; ok && !kept[parent]; parent, ok = parents[parent] {
+			kept[parent] = true
+			delete(prune, parent)
+		}
+	}
+
+	var pruned []*checkpointrestorev1.Checkpoint
+	for i := range checkpoints {
+		if prune[checkpoints[i].Name] {
+			pruned = append(pruned, &checkpoints[i])
+		}
+	}
+	return pruned
+}
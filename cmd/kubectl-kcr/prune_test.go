@@ -0,0 +1,109 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+// testCheckpoint returns a checkpoint of the container of the pod taken age before now, with the phase and
+// the optional parent checkpoint.
+func testCheckpoint(
+	name, pod string, age time.Duration, phase checkpointrestorev1.CheckpointPhase, parent string, now time.Time,
+) checkpointrestorev1.Checkpoint {
+	checkpoint := checkpointrestorev1.Checkpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"pod": pod, "pod-ns": "default"},
+		},
+		Spec: checkpointrestorev1.CheckpointSpec{
+			ContainerName:       "app",
+			CheckpointTimestamp: &metav1.Time{Time: now.Add(-age)},
+		},
+		Status: checkpointrestorev1.CheckpointStatus{Phase: phase},
+	}
+	if parent != "" {
+		checkpoint.Spec.ParentCheckpoint = &corev1.LocalObjectReference{Name: parent}
+	}
+	return checkpoint
+}
+
+func TestPrunedCheckpoints(t *testing.T) {
+	now := time.Now()
+	built := checkpointrestorev1.CheckpointPhaseImageBuilt
+	failed := checkpointrestorev1.CheckpointPhaseFailed
+	// Sorted from the oldest to the newest, web-3 is incremental on web-1 and web-2 failed.
+	checkpoints := []checkpointrestorev1.Checkpoint{
+		testCheckpoint("web-0", "web", 4*time.Hour, built, "", now),
+		testCheckpoint("web-1", "web", 3*time.Hour, built, "", now),
+		testCheckpoint("api-0", "api", 3*time.Hour, built, "", now),
+		testCheckpoint("web-2", "web", 2*time.Hour, failed, "", now),
+		testCheckpoint("web-3", "web", time.Hour, built, "web-1", now),
+	}
+
+	tests := []struct {
+		name      string
+		keep      int
+		olderThan time.Duration
+		failed    bool
+		want      []string
+	}{
+		{name: "nothing", keep: -1},
+		{name: "keep newest of each container", keep: 1, want: []string{"web-0", "web-2"}},
+		{name: "keep none", keep: 0, want: []string{"web-0", "web-1", "api-0", "web-2", "web-3"}},
+		{name: "older than", keep: -1, olderThan: 150 * time.Minute, want: []string{"web-0", "api-0"}},
+		{name: "failed", keep: -1, failed: true, want: []string{"web-2"}},
+		{name: "combined", keep: 2, olderThan: 150 * time.Minute, failed: true,
+			want: []string{"web-0", "api-0", "web-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, checkpoint := range prunedCheckpoints(checkpoints, tt.keep, tt.olderThan, tt.failed, now) {
+				got = append(got, checkpoint.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pruned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrunedCheckpointsKeepsParents(t *testing.T) {
+	now := time.Now()
+	built := checkpointrestorev1.CheckpointPhaseImageBuilt
+	// web-2 is incremental on web-1, itself incremental on web-0.
+	checkpoints := []checkpointrestorev1.Checkpoint{
+		testCheckpoint("web-0", "web", 3*time.Hour, built, "", now),
+		testCheckpoint("web-1", "web", 2*time.Hour, built, "web-0", now),
+		testCheckpoint("web-2", "web", time.Hour, built, "web-1", now),
+	}
+	if pruned := prunedCheckpoints(checkpoints, 1, 0, false, now); len(pruned) != 0 {
+		t.Errorf("pruned %s, the parents of a kept checkpoint must be kept", pruned[0].Name)
+	}
+	// The parents are only kept for the kept checkpoints.
+	if pruned := prunedCheckpoints(checkpoints, -1, 30*time.Minute, false, now); len(pruned) != len(checkpoints) {
+		t.Errorf("pruned %d checkpoints, want %d", len(pruned), len(checkpoints))
+	}
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/access"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
+)
+
+// restoreOptions are the options of the pod a checkpoint is restored in.
+type restoreOptions struct {
+	node               string
+	name               string
+	namespace          string
+	registry           registryOptions
+	pullSecret         string
+	verifyImage        bool
+	signaturePolicy    string
+	signaturePublicKey string
+	wait               bool
+	timeout            time.Duration
+
+	// verifier verifies the checkpoint image before the pod is created, the image is not verified when nil.
+	verifier imagebuilder.ImageVerifier
+	// requireDigest refuses the checkpoints without image digest, whose signature cannot be verified.
+	requireDigest bool
+}
+
+func (options *restoreOptions) addFlags(flags *flag.FlagSet) {
+	options.registry.addFlags(flags, "Registry of the checkpoint image, when the Checkpoint status does not "+
+		"record it")
+	flags.BoolVar(&options.verifyImage, "verify-image", true, "Verify the checkpoint image in the registry has "+
+		"the digest recorded in the Checkpoint before restoring it, as the manager does. Without it an image "+
+		"pushed again with the same tag can be restored")
+	flags.StringVar(&options.signaturePolicy, "signature-policy", "", "Trust policy, in the "+
+		"containers-policy.json format, the signature of the checkpoint image must satisfy. Requires verify-image")
+	flags.StringVar(&options.signaturePublicKey, "signature-public-key", "", "Public key whose sigstore "+
+		"signature the checkpoint image must have. Requires verify-image")
+	flags.StringVar(&options.pullSecret, "image-pull-secret", "kcr-registry-credentials", "Registry "+
+		"credentials Secret the restored pod pulls the checkpoint image with, when it exists in its namespace. "+
+		"It should match the namespace-registry-credentials-secret of the manager")
+}
+
+// setupVerifier sets up the verification of the checkpoint image from the flags.
+func (options *restoreOptions) setupVerifier() error {
+	policy, err := imagebuilder.NewSignaturePolicy(options.signaturePolicy, options.signaturePublicKey)
+	if err != nil {
+		return err
+	}
+	if !options.verifyImage {
+		if policy != nil {
+			return fmt.Errorf("signature-policy and signature-public-key require verify-image")
+		}
+		return nil
+	}
+	options.verifier = imagebuilder.RegistryImageVerifier{Policy: policy}
+	options.requireDigest = policy != nil
+	return nil
+}
+
+func runRestore(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	var options restoreOptions
+	flags := newFlagSet("restore", `Restore a checkpoint in a new pod, running the checkpoint image in place of the image of the
+checkpointed container. The pod is a copy of the checkpointed pod when it still exists and is restored in
+its namespace.
+
+Usage:
+  kubectl kcr restore <checkpoint> [--node node] [--to-namespace namespace] [--wait]`, &clientOptions)
+	options.addFlags(flags)
+	flags.StringVar(&options.node, "node", "", "Node to restore the checkpoint on, defaults to any node the "+
+		"scheduler picks")
+	flags.StringVar(&options.name, "name", "", "Name of the restored pod, defaults to a name generated from "+
+		"the checkpointed pod")
+	flags.StringVar(&options.namespace, "to-namespace", "", "Namespace to restore the checkpoint in, defaults "+
+		"to the namespace of the checkpointed pod")
+	flags.BoolVar(&options.wait, "wait", false, "Wait until the restored pod runs")
+	flags.DurationVar(&options.timeout, "timeout", 10*time.Minute, "How long to wait for the restored pod")
+	args, err := parseArgs(flags, args, 1, "a Checkpoint name")
+	if err != nil {
+		return err
+	}
+	if err := options.setupVerifier(); err != nil {
+		return err
+	}
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	var checkpoint checkpointrestorev1.Checkpoint
+	if err := k8sClient.Get(ctx, client.ObjectKey{Name: args[0], Namespace: namespace}, &checkpoint); err != nil {
+		return fmt.Errorf("failed to get Checkpoint %s/%s: %w", namespace, args[0], err)
+	}
+	pod, err := restorePod(ctx, k8sClient, &checkpoint, options)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(stdout, "pod/%s created from checkpoint %s\n", pod.Name, checkpoint.Name)
+	if !options.wait {
+		return nil
+	}
+	return waitForPod(ctx, k8sClient, pod, options.timeout, stdout)
+}
+
+// restorePod creates a pod running the image of the checkpoint, once the image is verified. Restoring a
+// checkpoint in another namespace than its own requires its namespace to grant it, as the manager does.
+func restorePod(
+	ctx context.Context, k8sClient client.Client, checkpoint *checkpointrestorev1.Checkpoint, options restoreOptions,
+) (*corev1.Pod, error) {
+	registry, image, imageDigest, err := checkpointImage(checkpoint, options.registry.url)
+	if err != nil {
+		return nil, err
+	}
+
+	podName := checkpoint.Labels["pod"]
+	podNamespace := checkpoint.Labels["pod-ns"]
+	if podNamespace == "" {
+		podNamespace = checkpoint.Namespace
+	}
+	containerName := checkpoint.Spec.ContainerName
+	if containerName == "" {
+		containerName = checkpoint.Labels["container"]
+	}
+	namespace := options.namespace
+	if namespace == "" {
+		namespace = podNamespace
+	}
+	allowed, err := access.Allowed(ctx, k8sClient, namespace, checkpointrestorev1.CheckpointAccessGrantCheckpointKind,
+		checkpoint.Namespace, checkpoint.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("namespace %s does not grant namespace %s access to Checkpoint %s, create a "+
+			"CheckpointAccessGrant", checkpoint.Namespace, namespace, checkpoint.Name)
+	}
+
+	if options.verifier != nil {
+		if imageDigest == "" && options.requireDigest {
+			return nil, fmt.Errorf("the image digest of Checkpoint %s is unknown, its signature cannot be verified",
+				checkpoint.Name)
+		}
+		if imageDigest != "" {
+			err := options.verifier.VerifyImage(ctx, options.registry.registryAuth(registry), image, imageDigest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to verify the image of Checkpoint %s: %w", checkpoint.Name, err)
+			}
+		}
+	}
+
+	// The checkpointed pod is only copied in its namespace, its volumes, config maps and service account are
+	// not found in other namespaces.
+	found := false
+	var source corev1.Pod
+	if namespace == podNamespace {
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: podName, Namespace: podNamespace}, &source)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get checkpointed pod %s/%s: %w", podNamespace, podName, err)
+		}
+		found = err == nil
+	}
+
+	pod := &corev1.Pod{}
+	if found {
+		// The restored pod keeps the labels of the checkpointed pod, so its services route to it, except the
+		// pod template hash that would let the ReplicaSet of the checkpointed pod adopt and delete it.
+		pod.Labels = source.Labels
+		delete(pod.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		pod.Spec = *source.Spec.DeepCopy()
+	} else {
+		// The checkpoint image holds the configuration of the container.
+		pod.Spec.Containers = []corev1.Container{{Name: containerName}}
+	}
+	if podName == "" {
+		podName = checkpoint.Name
+	}
+	pod.Namespace = namespace
+	pod.Name = options.name
+	if pod.Name == "" {
+		pod.GenerateName = podName + "-restore-"
+	}
+	pod.Annotations = map[string]string{
+		checkpointrestorev1.RestoredCheckpointAnnotation: access.RestoredCheckpointValue(
+			namespace, client.ObjectKeyFromObject(checkpoint)),
+		checkpointrestorev1.RestoredContainerAnnotation: containerName,
+		checkpointrestorev1.RestoreStatusAnnotation:     checkpointrestorev1.RestoreStatusRestoring,
+	}
+	pod.Spec.NodeName = options.node
+
+	restored := false
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == containerName {
+			pod.Spec.Containers[i].Image = registry + "/" + image
+			restored = true
+		}
+	}
+	if !restored {
+		return nil, fmt.Errorf("pod %s/%s has no container %s", podNamespace, podName, containerName)
+	}
+	// The checkpoint images pushed with the registry credentials of the namespace are pulled with them.
+	if options.pullSecret != "" && checkpoint.Spec.CheckpointRegistry == "" {
+		var secret corev1.Secret
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: options.pullSecret, Namespace: namespace}, &secret)
+		if err == nil {
+			imagebuilder.AddImagePullSecret(&pod.Spec, secret.Name)
+		} else if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get image pull Secret %s/%s, set image-pull-secret: %w", namespace,
+				options.pullSecret, err)
+		}
+	}
+
+	if err := k8sClient.Create(ctx, pod); err != nil {
+		return nil, fmt.Errorf("failed to create restored pod: %w", err)
+	}
+	return pod, nil
+}
+
+// checkpointImage returns the registry and the name of the image of the checkpoint, by digest when it is
+// recorded, as the manager restores failed pods, with the digest.
+func checkpointImage(
+	checkpoint *checkpointrestorev1.Checkpoint, registryURL string,
+) (string, string, digest.Digest, error) {
+	if checkpoint.Status.Phase != checkpointrestorev1.CheckpointPhaseImageBuilt {
+		return "", "", "", fmt.Errorf("the image of Checkpoint %s is not built, its phase is %q", checkpoint.Name,
+			checkpoint.Status.Phase)
+	}
+	registry := checkpoint.Status.Registry
+	if registry == "" {
+		registry = registryURL
+	}
+	if registry == "" {
+		return "", "", "", fmt.Errorf("the registry of Checkpoint %s is unknown, set registry-url", checkpoint.Name)
+	}
+	image := checkpoint.Status.RuntimeImage
+	if image == "" {
+		image = checkpoint.Status.CheckpointImage
+	}
+	if checkpoint.Status.ImageDigest == "" {
+		return registry, image, "", nil
+	}
+	imageDigest, err := digest.Parse(checkpoint.Status.ImageDigest)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid image digest of Checkpoint %s: %w", checkpoint.Name, err)
+	}
+	return registry, imagebuilder.DigestReference(image, imageDigest), imageDigest, nil
+}
+
+func waitForPod(ctx context.Context, k8sClient client.Client, pod *corev1.Pod, timeout time.Duration, stdout io.Writer) error {
+	progress := newProgress(stdout)
+	return wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod); err != nil {
+			return false, err
+		}
+		progress.phase("pod/"+pod.Name, string(pod.Status.Phase))
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return true, nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return false, fmt.Errorf("restored pod %s stopped in phase %s", pod.Name, pod.Status.Phase)
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
+)
+
+const testImageDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// testImageVerifier records the verified image and fails with err.
+type testImageVerifier struct {
+	err          error
+	registryAuth imagebuilder.RegistryAuth
+	image        string
+}
+
+func (v *testImageVerifier) VerifyImage(
+	ctx context.Context, registryAuth imagebuilder.RegistryAuth, imageName string, imageDigest digest.Digest,
+) error {
+	v.registryAuth = registryAuth
+	v.image = imageName
+	return v.err
+}
+
+// builtCheckpoint returns the built checkpoint of the app container of the web-0 pod of namespace team-a.
+func builtCheckpoint(imageDigest string) *checkpointrestorev1.Checkpoint {
+	return &checkpointrestorev1.Checkpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-0-team-a-1735689600",
+			Namespace: "team-a",
+			Labels:    map[string]string{"pod": "web-0", "pod-ns": "team-a", "container": "app"},
+		},
+		Spec: checkpointrestorev1.CheckpointSpec{ContainerName: "app"},
+		Status: checkpointrestorev1.CheckpointStatus{
+			Phase:        checkpointrestorev1.CheckpointPhaseImageBuilt,
+			Registry:     "registry.example.com/team-a",
+			RuntimeImage: "checkpoint-web-0:latest",
+			ImageDigest:  imageDigest,
+		},
+	}
+}
+
+// checkpointedPod returns the web-0 pod of namespace team-a, created by a Deployment.
+func checkpointedPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web-0",
+			Namespace: "team-a",
+			Labels:    map[string]string{"app": "web", appsv1.DefaultDeploymentUniqueLabelKey: "5d8f9"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node-1",
+			Containers: []corev1.Container{
+				{Name: "app", Image: "web:1.0"},
+				{Name: "sidecar", Image: "proxy:1.0"},
+			},
+		},
+	}
+}
+
+func TestRestorePod(t *testing.T) {
+	pullSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "kcr-registry-credentials", Namespace: "team-a"}}
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(checkpointedPod(), pullSecret).Build()
+	verifier := &testImageVerifier{}
+	options := restoreOptions{node: "node-2", name: "web-restored", pullSecret: pullSecret.Name, verifier: verifier}
+
+	checkpoint := builtCheckpoint(testImageDigest)
+	pod, err := restorePod(context.Background(), k8sClient, checkpoint, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantImage := "checkpoint-web-0@" + testImageDigest
+	if verifier.image != wantImage || verifier.registryAuth.URL != checkpoint.Status.Registry {
+		t.Errorf("verified %s/%s, want %s/%s", verifier.registryAuth.URL, verifier.image,
+			checkpoint.Status.Registry, wantImage)
+	}
+
+	var restored corev1.Pod
+	if err := k8sClient.Get(context.Background(), client.ObjectKeyFromObject(pod), &restored); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.Spec.Containers[0].Image; got != checkpoint.Status.Registry+"/"+wantImage {
+		t.Errorf("restored container runs %s", got)
+	}
+	if got := restored.Spec.Containers[1].Image; got != "proxy:1.0" {
+		t.Errorf("other container runs %s, want the image of the checkpointed pod", got)
+	}
+	if restored.Spec.NodeName != "node-2" {
+		t.Errorf("pod is restored on %q, want node-2", restored.Spec.NodeName)
+	}
+	if _, ok := restored.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok || restored.Labels["app"] != "web" {
+		t.Errorf("restored pod has labels %v, want those of the checkpointed pod without its template hash",
+			restored.Labels)
+	}
+	if got := restored.Annotations[checkpointrestorev1.RestoredCheckpointAnnotation]; got != checkpoint.Name {
+		t.Errorf("restored pod records the checkpoint %q, want %q", got, checkpoint.Name)
+	}
+	if got := restored.Annotations[checkpointrestorev1.RestoredContainerAnnotation]; got != "app" {
+		t.Errorf("restored pod records the container %q, want app", got)
+	}
+	if got := restored.Annotations[checkpointrestorev1.RestoreStatusAnnotation]; got !=
+		checkpointrestorev1.RestoreStatusRestoring {
+		t.Errorf("restored pod has restore status %q", got)
+	}
+	if len(restored.Spec.ImagePullSecrets) != 1 || restored.Spec.ImagePullSecrets[0].Name != pullSecret.Name {
+		t.Errorf("restored pod has image pull secrets %v, want %s", restored.Spec.ImagePullSecrets, pullSecret.Name)
+	}
+}
+
+func TestRestorePodFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		checkpoint func() *checkpointrestorev1.Checkpoint
+		options    restoreOptions
+		wantErr    string
+	}{
+		{
+			name: "image not built",
+			checkpoint: func() *checkpointrestorev1.Checkpoint {
+				checkpoint := builtCheckpoint(testImageDigest)
+				checkpoint.Status.Phase = checkpointrestorev1.CheckpointPhaseFailed
+				return checkpoint
+			},
+			wantErr: "is not built",
+		},
+		{
+			name:       "image not verified",
+			checkpoint: func() *checkpointrestorev1.Checkpoint { return builtCheckpoint(testImageDigest) },
+			options:    restoreOptions{verifier: &testImageVerifier{err: errors.New("digest mismatch")}},
+			wantErr:    "digest mismatch",
+		},
+		{
+			name:       "digest required",
+			checkpoint: func() *checkpointrestorev1.Checkpoint { return builtCheckpoint("") },
+			options:    restoreOptions{verifier: &testImageVerifier{}, requireDigest: true},
+			wantErr:    "digest of Checkpoint",
+		},
+		{
+			name:       "namespace not granted",
+			checkpoint: func() *checkpointrestorev1.Checkpoint { return builtCheckpoint(testImageDigest) },
+			options:    restoreOptions{namespace: "team-b"},
+			wantErr:    "CheckpointAccessGrant",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(checkpointedPod()).Build()
+			_, err := restorePod(context.Background(), k8sClient, tt.checkpoint(), tt.options)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("restore failed with %v, want %q", err, tt.wantErr)
+			}
+			var pods corev1.PodList
+			if err := k8sClient.List(context.Background(), &pods); err != nil {
+				t.Fatal(err)
+			}
+			if len(pods.Items) != 1 {
+				t.Errorf("%d pods exist, want only the checkpointed pod", len(pods.Items))
+			}
+		})
+	}
+}
+
+func TestRestorePodInAnotherNamespace(t *testing.T) {
+	grant := &checkpointrestorev1.CheckpointAccessGrant{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-b", Namespace: "team-a"},
+		Spec: checkpointrestorev1.CheckpointAccessGrantSpec{
+			From: []checkpointrestorev1.CheckpointAccessGrantFrom{{Namespace: "team-b"}},
+			To: []checkpointrestorev1.CheckpointAccessGrantTo{{
+				Kind: checkpointrestorev1.CheckpointAccessGrantCheckpointKind,
+			}},
+		},
+	}
+	k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(checkpointedPod(), grant).Build()
+
+	checkpoint := builtCheckpoint(testImageDigest)
+	pod, err := restorePod(context.Background(), k8sClient, checkpoint, restoreOptions{namespace: "team-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Namespace != "team-b" || !strings.HasPrefix(pod.Name, "web-0-restore-") {
+		t.Errorf("restored pod is %s/%s", pod.Namespace, pod.Name)
+	}
+	// The checkpointed pod is not copied in another namespace, only the checkpointed container is restored.
+	if len(pod.Spec.Containers) != 1 || pod.Spec.Containers[0].Name != "app" {
+		t.Errorf("restored pod has containers %v, want only app", pod.Spec.Containers)
+	}
+	want := "team-a/" + checkpoint.Name
+	if got := pod.Annotations[checkpointrestorev1.RestoredCheckpointAnnotation]; got != want {
+		t.Errorf("restored pod records the checkpoint %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+func runSchedule(ctx context.Context, args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "create" {
+		_, _ = fmt.Fprint(stdout, `Manage the checkpoint schedules.
+
+Usage:
+  kubectl kcr schedule create <name> --selector selector --schedule cron
+`)
+		if len(args) == 0 {
+			return fmt.Errorf("expected a schedule command")
+		}
+		return fmt.Errorf("unknown schedule command %q", args[0])
+	}
+	return runScheduleCreate(ctx, args[1:], stdout)
+}
+
+func runScheduleCreate(ctx context.Context, args []string, stdout io.Writer) error {
+	var clientOptions clientOptions
+	var selector, schedule, compression, registry string
+	var incremental bool
+	flags := newFlagSet("schedule create", `Create a CheckpointSchedule checkpointing the pods matching a selector.
+
+Usage:
+  kubectl kcr schedule create <name> --selector selector --schedule cron`, &clientOptions)
+	flags.StringVar(&selector, "selector", "", "Label selector of the pods to checkpoint, e.g. app=my-app")
+	flags.StringVar(&selector, "l", "", "Shorthand for selector")
+	flags.StringVar(&schedule, "schedule", "", "Cron schedule of the checkpoints, e.g. \"*/10 * * * *\"")
+	flags.BoolVar(&incremental, "incremental", false, "Only store the changes since the last checkpoint of "+
+		"each container")
+	flags.StringVar(&compression, "compression", "", "Compression of the checkpoint image layers, in the "+
+		"form algorithm[:level]")
+	flags.StringVar(&registry, "registry", "", "CheckpointRegistry to push the checkpoint images to, defaults "+
+		"to the registry of the namespace")
+	args, err := parseArgs(flags, args, 1, "a CheckpointSchedule name")
+	if err != nil {
+		return err
+	}
+	if selector == "" || schedule == "" {
+		return fmt.Errorf("selector and schedule are required")
+	}
+	labelSelector, err := metav1.ParseToLabelSelector(selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector: %w", err)
+	}
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	k8sClient, namespace, err := clientOptions.newClient()
+	if err != nil {
+		return err
+	}
+
+	checkpointSchedule := &checkpointrestorev1.CheckpointSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      args[0],
+			Namespace: namespace,
+		},
+		Spec: checkpointrestorev1.CheckpointScheduleSpec{
+			Selector:           *labelSelector,
+			Schedule:           schedule,
+			Incremental:        incremental,
+			Compression:        compression,
+			CheckpointRegistry: registry,
+		},
+	}
+	if err := k8sClient.Create(ctx, checkpointSchedule); err != nil {
+		return fmt.Errorf("failed to create CheckpointSchedule: %w", err)
+	}
+	_, err = fmt.Fprintf(stdout, "checkpointschedule/%s created\n", checkpointSchedule.Name)
+	return err
+}
@@ -17,16 +17,20 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -44,6 +48,9 @@ import (
 	controller "github.com/GianOrtiz/kcr/internal/controller/apps"
 	checkpointrestorecontroller "github.com/GianOrtiz/kcr/internal/controller/checkpoint-restore"
 	corecontroller "github.com/GianOrtiz/kcr/internal/controller/core"
+	kcrmetrics "github.com/GianOrtiz/kcr/internal/metrics"
+	"github.com/GianOrtiz/kcr/internal/tracing"
+	webhookcheckpointrestorev1 "github.com/GianOrtiz/kcr/internal/webhook/checkpoint-restore/v1"
 	"github.com/GianOrtiz/kcr/pkg/checkpoint"
 	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
 	// +kubebuilder:scaffold:imports
@@ -63,11 +70,6 @@ func init() {
 
 // nolint:gocyclo
 func main() {
-	if buildah.InitReexec() {
-		return
-	}
-	unshare.MaybeReexecUsingUserNamespace(false)
-
 	var metricsAddr string
 	var kubernetesAPIAddress string
 	var checkpointsDirectory string
@@ -75,6 +77,30 @@ func main() {
 	var registryAuthFile string
 	var registryUsername string
 	var registryPassword string
+	var registryCertsDirectory string
+	var registryInsecure bool
+	var signingKey string
+	var signingKeyPassphraseFile string
+	var encryptionRecipients string
+	var verifyCheckpointArchives bool
+	var registryCredentialsSecret string
+	var namespaceRegistryCredentialsSecret string
+	var allowedNamespaceRegistries string
+	var verifyCheckpointImages bool
+	var signaturePolicy string
+	var signaturePublicKey string
+	var enableCheckpointProcessing bool
+	var authorizeCheckpointRequests bool
+	var tracingEndpoint string
+	var tracingInsecure bool
+	var checkpointImageFormat string
+	var imageBuilderName string
+	var ociLayoutDirectory string
+	var streamChunkSize int
+	var buildWorkers int
+	var maxProcessingCheckpoints int
+	var processingCheckpointTimeout time.Duration
+	var layerCompression string
 	var metricsCertPath, metricsCertName, metricsCertKey string
 	var webhookCertPath, webhookCertName, webhookCertKey string
 	var enableLeaderElection bool
@@ -97,19 +123,90 @@ func main() {
 		"The directory where checkpoints will be stored",
 	)
 	flag.StringVar(&registryUrl, "registry-url", "localhost:5001", "Registry to use for pushing checkpoint images")
+	flag.StringVar(&checkpointImageFormat, "checkpoint-image-format", string(imagebuilder.ImageFormatOCI),
+		"Format of the checkpoint images: oci follows the checkpoint image specification and can be restored by "+
+			"CRI-O and containerd, cri-o only sets the annotations required by CRI-O")
+	flag.StringVar(&imageBuilderName, "image-builder", imagebuilder.ImageBuilderBuildah,
+		"Image builder used to build the checkpoint images: buildah requires root and a containers storage, "+
+			"oci writes OCI image layouts in pure Go and can run unprivileged, stream compresses and uploads the "+
+			"checkpoint archive straight to the registry without storing the image on disk")
+	flag.StringVar(&ociLayoutDirectory, "oci-layout-directory", filepath.Join(os.TempDir(), "kcr-images"),
+		"Directory where the oci image builder writes the image layouts before pushing them")
+	flag.IntVar(&streamChunkSize, "stream-chunk-size", imagebuilder.DefaultStreamChunkSize,
+		"Size in bytes of the chunks uploaded to the registry by the stream image builder")
+	flag.IntVar(&buildWorkers, "build-workers", 2,
+		"Number of checkpoint images built and pushed at the same time by the process")
+	flag.IntVar(&maxProcessingCheckpoints, "max-processing-checkpoints", 0,
+		"Number of checkpoints of the cluster whose image is being built from which the builds wait to start, "+
+			"0 for no limit")
+	flag.DurationVar(&processingCheckpointTimeout, "processing-checkpoint-timeout",
+		checkpointrestorecontroller.DefaultProcessingTimeout, "Time after which a checkpoint whose image is being "+
+			"built is no longer counted in max-processing-checkpoints, as its build was probably interrupted")
+	flag.StringVar(&layerCompression, "layer-compression", imagebuilder.CompressionGzip,
+		"Compression of the checkpoint image layers in the form algorithm[:level], the algorithm is one of none, "+
+			"gzip, zstd and zstd:chunked. Checkpoints and schedules may override it")
 	flag.StringVar(&registryAuthFile, "registry-auth-file", "", "Registry auth file to use for authentication")
 	flag.StringVar(
 		&registryUsername,
 		"registry-username",
-		"",
-		"Registry username to use for authentication requires registry-password",
+		os.Getenv("REGISTRY_USERNAME"),
+		"Registry username to use for authentication requires registry-password, defaults to the "+
+			"REGISTRY_USERNAME environment variable",
 	)
 	flag.StringVar(
 		&registryPassword,
 		"registry-password",
-		"",
-		"Registry password to use for authentication requires registry-username",
+		os.Getenv("REGISTRY_PASSWORD"),
+		"Registry password to use for authentication requires registry-username, defaults to the "+
+			"REGISTRY_PASSWORD environment variable. Prefer registry-credentials-secret, flags are visible "+
+			"in the process list",
 	)
+	flag.StringVar(&registryCredentialsSecret, "registry-credentials-secret", "",
+		"Secret of type kubernetes.io/dockerconfigjson, in the form namespace/name, with the credentials of the "+
+			"registry. It is read on every push, so rotated credentials are used without restarting")
+	flag.StringVar(&namespaceRegistryCredentialsSecret, "namespace-registry-credentials-secret",
+		"kcr-registry-credentials",
+		"Name of the kubernetes.io/dockerconfigjson Secret with the registry credentials of a namespace. When "+
+			"it exists in the namespace of a checkpoint it is used instead of registry-credentials-secret, and "+
+			"its registry key sets the registry and repository the checkpoint images of the namespace are pushed to")
+	flag.StringVar(&allowedNamespaceRegistries, "allowed-namespace-registries", "",
+		"Comma-separated registries, with an optional repository prefix, e.g. registry.example.com/tenants, the "+
+			"registry key of the namespace registry credentials Secrets may set. The key is rejected when empty, as "+
+			"anyone writing Secrets in a namespace could otherwise send its checkpoints to any host")
+	flag.StringVar(&registryCertsDirectory, "registry-certs-directory", "",
+		"Directory with the TLS certificates of the registry following the /etc/containers/certs.d layout: "+
+			"*.crt files are CA certificates, *.cert and *.key files are client certificates and keys")
+	flag.BoolVar(&registryInsecure, "registry-insecure", false,
+		"Disable the TLS verification of the registry and allow plain HTTP, only for development registries")
+	flag.StringVar(&signingKey, "signing-key", "",
+		"Sigstore private key, as generated by cosign generate-key-pair, to sign the pushed checkpoint images with. "+
+			"Mount it from a Secret, it is read on every signature. The images are not signed when empty")
+	flag.StringVar(&signingKeyPassphraseFile, "signing-key-passphrase-file", "",
+		"File with the passphrase of the signing-key")
+	flag.BoolVar(&verifyCheckpointArchives, "verify-checkpoint-archives", true,
+		"If set, the structure and integrity of a checkpoint archive are verified before its image is built")
+	flag.StringVar(&encryptionRecipients, "encryption-recipients", "",
+		"Comma-separated recipients to encrypt the checkpoint image layers for, as jwe:<public key file> or "+
+			"pkcs7:<certificate file>. The layers are not encrypted when empty")
+	flag.BoolVar(&verifyCheckpointImages, "verify-checkpoint-images", true,
+		"If set, the digest of a checkpoint image is verified in the registry before the checkpoint is restored")
+	flag.StringVar(&signaturePolicy, "signature-policy", "",
+		"Trust policy, in the containers-policy.json format, the signatures of the checkpoint images must satisfy "+
+			"before they are restored. Requires verify-checkpoint-images")
+	flag.StringVar(&signaturePublicKey, "signature-public-key", "",
+		"Sigstore public key the checkpoint images must be signed with before they are restored, a shorthand for "+
+			"a signature-policy requiring it. Requires verify-checkpoint-images")
+	flag.BoolVar(&enableCheckpointProcessing, "enable-checkpoint-processing", true,
+		"If set, the manager builds and pushes the checkpoint images itself. Disable it when the kcr-agent "+
+			"DaemonSet is deployed to process the checkpoints in the nodes where they were created.")
+	flag.BoolVar(&authorizeCheckpointRequests, "authorize-checkpoint-requests", true,
+		"If set, a CheckpointRequest is only processed when the user who created it, recorded by the admission "+
+			"webhook, can create pods/checkpoint in the namespace of the pod.")
+	flag.StringVar(&tracingEndpoint, "tracing-endpoint", "",
+		"The host:port of the OTLP gRPC collector the traces of the checkpoints are exported to. "+
+			"Tracing is disabled when empty")
+	flag.BoolVar(&tracingInsecure, "tracing-insecure", false,
+		"If set, the traces are exported to the tracing-endpoint without TLS")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
@@ -131,6 +228,15 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	// Only a manager processing the checkpoints builds images, the manager deployed with the kcr-agent runs
+	// unprivileged and cannot create the user namespace buildah needs. buildah runs parts of the build in
+	// children of the process, which are started without its flags and so parse the default buildah image
+	// builder and checkpoint processing. The other image builders never start any.
+	buildsWithBuildah := enableCheckpointProcessing && imageBuilderName == imagebuilder.ImageBuilderBuildah
+	if buildsWithBuildah && buildah.InitReexec() {
+		return
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
 	if (registryUsername != "" && registryPassword == "") || (registryUsername == "" && registryPassword != "") {
@@ -138,6 +244,64 @@ func main() {
 		os.Exit(1)
 	}
 
+	imageFormat, err := imagebuilder.ParseImageFormat(checkpointImageFormat)
+	if err != nil {
+		setupLog.Error(err, "invalid checkpoint-image-format")
+		os.Exit(1)
+	}
+
+	compression, err := imagebuilder.ParseCompression(layerCompression)
+	if err != nil {
+		setupLog.Error(err, "invalid layer-compression")
+		os.Exit(1)
+	}
+
+	var registrySecret types.NamespacedName
+	if registryCredentialsSecret != "" {
+		if registrySecret, err = imagebuilder.ParseSecretReference(registryCredentialsSecret); err != nil {
+			setupLog.Error(err, "invalid registry-credentials-secret")
+			os.Exit(1)
+		}
+	}
+
+	var imageSigner imagebuilder.ImageSigner
+	if signingKey != "" {
+		if imageSigner, err = imagebuilder.NewSigstoreImageSigner(signingKey, signingKeyPassphraseFile); err != nil {
+			setupLog.Error(err, "invalid signing-key")
+			os.Exit(1)
+		}
+	}
+
+	var encryption *imagebuilder.Encryption
+	if encryptionRecipients != "" {
+		if encryption, err = imagebuilder.NewEncryption(strings.Split(encryptionRecipients, ",")); err != nil {
+			setupLog.Error(err, "invalid encryption-recipients")
+			os.Exit(1)
+		}
+	}
+
+	policy, err := imagebuilder.NewSignaturePolicy(signaturePolicy, signaturePublicKey)
+	if err != nil {
+		setupLog.Error(err, "invalid checkpoint image signature policy")
+		os.Exit(1)
+	}
+	if policy != nil && !verifyCheckpointImages {
+		setupLog.Error(nil, "signature-policy and signature-public-key require verify-checkpoint-images")
+		os.Exit(1)
+	}
+
+	switch imageBuilderName {
+	case imagebuilder.ImageBuilderBuildah:
+		// buildah requires a user namespace when not running as root.
+		if buildsWithBuildah {
+			unshare.MaybeReexecUsingUserNamespace(false)
+		}
+	case imagebuilder.ImageBuilderOCI, imagebuilder.ImageBuilderStream:
+	default:
+		setupLog.Error(nil, "image-builder must be one of buildah, oci, stream", "image-builder", imageBuilderName)
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -227,6 +391,16 @@ func main() {
 		})
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Endpoint:    tracingEndpoint,
+		Insecure:    tracingInsecure,
+		ServiceName: "kcr-manager",
+	}, nil)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
@@ -252,8 +426,9 @@ func main() {
 	}
 
 	if err = (&controller.DeploymentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("deployment"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Deployment")
 		os.Exit(1)
@@ -275,57 +450,133 @@ func main() {
 		}
 	}
 	checkpointScheduleReconciler := checkpointrestorecontroller.NewCheckpointScheduleReconciler(
-		mgr.GetClient(), mgr.GetScheme())
+		mgr.GetClient(), mgr.GetScheme(), mgr.GetEventRecorderFor("checkpoint-restore-checkpointschedule"))
 	if err = checkpointScheduleReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CheckpointSchedule")
 		os.Exit(1)
 	}
 
-	registryIsUsingBasicAuth := registryUsername != "" && registryPassword != ""
-	registryAuth := imagebuilder.RegistryAuth{
-		URL: registryUrl,
+	registryAuth := imagebuilder.NewRegistryAuth(registryUrl, registryUsername, registryPassword, registryAuthFile)
+	registryAuth.CertsDirectory = registryCertsDirectory
+	registryAuth.Insecure = registryInsecure
+	registryResolver := imagebuilder.RegistryResolver{
+		Reader:              mgr.GetAPIReader(),
+		Default:             registryAuth,
+		Secret:              registrySecret,
+		NamespaceSecretName: namespaceRegistryCredentialsSecret,
+		AllowedRegistries:   strings.Split(allowedNamespaceRegistries, ","),
 	}
-	if registryIsUsingBasicAuth {
-		registryAuth.Basic = &imagebuilder.RegistryBasicAuth{
-			Username: registryUsername,
-			Password: registryPassword,
+
+	if enableCheckpointProcessing {
+		var imageBuilder imagebuilder.ImageBuilder
+		switch imageBuilderName {
+		case imagebuilder.ImageBuilderOCI:
+			imageBuilder, err = imagebuilder.NewOCIImageBuilder(imageFormat, ociLayoutDirectory)
+		case imagebuilder.ImageBuilderStream:
+			imageBuilder, err = imagebuilder.NewStreamingImageBuilder(imageFormat, streamChunkSize)
+		default:
+			imageBuilder, err = imagebuilder.NewBuildahImageBuilder(imageFormat)
+		}
+		if err != nil {
+			setupLog.Error(err, "unable to create image builder")
+			os.Exit(1)
 		}
-	} else {
-		registryAuth.AuthFile = &registryAuthFile
-	}
-	imageBuilder, err := imagebuilder.NewBuildahImageBuilder(registryAuth)
-	if err != nil {
-		setupLog.Error(err, "unable to create image builder")
-		os.Exit(1)
-	}
 
-	if err = (&checkpointrestorecontroller.CheckpointReconciler{
-		Client:               mgr.GetClient(),
-		Scheme:               mgr.GetScheme(),
-		ImageBuilder:         imageBuilder,
-		CheckpointsDirectory: checkpointsDirectory,
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Checkpoint")
-		os.Exit(1)
+		if err = (&checkpointrestorecontroller.CheckpointReconciler{
+			Client:               mgr.GetClient(),
+			Scheme:               mgr.GetScheme(),
+			ImageBuilder:         imageBuilder,
+			LayerCompression:     compression,
+			RegistryResolver:     registryResolver,
+			ImageSigner:          imageSigner,
+			Encryption:           encryption,
+			VerifyArchives:       verifyCheckpointArchives,
+			CheckpointsDirectory: checkpointsDirectory,
+			Recorder:             mgr.GetEventRecorderFor("checkpoint-restore-checkpoint"),
+			Builds: &checkpointrestorecontroller.BuildQueue{
+				Workers:           buildWorkers,
+				MaxProcessing:     maxProcessingCheckpoints,
+				ProcessingTimeout: processingCheckpointTimeout,
+			},
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Checkpoint")
+			os.Exit(1)
+		}
+	} else {
+		setupLog.Info("checkpoint processing is disabled, checkpoints are processed by the kcr-agent")
 	}
 	if err = (&checkpointrestorecontroller.CheckpointRequestReconciler{
-		Client:            mgr.GetClient(),
-		Scheme:            mgr.GetScheme(),
-		CheckpointService: checkpointService,
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		CheckpointService:   checkpointService,
+		AuthorizeRequesters: authorizeCheckpointRequests,
+		Recorder:            mgr.GetEventRecorderFor("checkpoint-restore-checkpointrequest"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CheckpointRequest")
 		os.Exit(1)
 	}
-	if err = (&corecontroller.PodReconciler{
-		Client:          mgr.GetClient(),
-		Scheme:          mgr.GetScheme(),
-		RegistryAuthURL: registryUrl,
-	}).SetupWithManager(mgr); err != nil {
+	podReconciler := &corecontroller.PodReconciler{
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		RegistryAuthURL:  registryUrl,
+		RegistryResolver: registryResolver,
+		Recorder:         mgr.GetEventRecorderFor("core-pod"),
+	}
+	if verifyCheckpointImages {
+		podReconciler.ImageVerifier = imagebuilder.RegistryImageVerifier{Policy: policy}
+		podReconciler.RequireImageDigest = policy != nil
+	}
+	if err = podReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Pod")
 		os.Exit(1)
 	}
+	podCloneReconciler := &checkpointrestorecontroller.PodCloneReconciler{
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		RegistryAuthURL:    registryUrl,
+		RegistryResolver:   registryResolver,
+		ImageVerifier:      podReconciler.ImageVerifier,
+		RequireImageDigest: podReconciler.RequireImageDigest,
+		Recorder:           mgr.GetEventRecorderFor("checkpoint-restore-podclone"),
+	}
+	if err = podCloneReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PodClone")
+		os.Exit(1)
+	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		// The CheckpointRequests the manager creates for CheckpointSchedules and PodClones carry the requester
+		// of their owner, which the webhooks trust only from the service account of the manager, the only
+		// user allowed to create the Checkpoints of archives.
+		var managerUsername string
+		namespace, serviceAccount := os.Getenv("POD_NAMESPACE"), os.Getenv("SERVICE_ACCOUNT_NAME")
+		if namespace != "" && serviceAccount != "" {
+			managerUsername = "system:serviceaccount:" + namespace + ":" + serviceAccount
+		}
+		if err = webhookcheckpointrestorev1.SetupCheckpointRequestWebhookWithManager(mgr, managerUsername); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CheckpointRequest")
+			os.Exit(1)
+		}
+		if err = webhookcheckpointrestorev1.SetupCheckpointScheduleWebhookWithManager(mgr, managerUsername); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CheckpointSchedule")
+			os.Exit(1)
+		}
+		if err = webhookcheckpointrestorev1.SetupPodCloneWebhookWithManager(mgr, managerUsername); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PodClone")
+			os.Exit(1)
+		}
+		if err = webhookcheckpointrestorev1.SetupCheckpointWebhookWithManager(mgr, managerUsername); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Checkpoint")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if err := kcrmetrics.RegisterCheckpointAgeCollector(mgr.GetClient()); err != nil {
+		setupLog.Error(err, "unable to register checkpoint metrics")
+		os.Exit(1)
+	}
+
 	if metricsCertWatcher != nil {
 		setupLog.Info("Adding metrics certificate watcher to manager")
 		if err := mgr.Add(metricsCertWatcher); err != nil {
@@ -356,4 +607,7 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "unable to export the remaining traces")
+	}
 }
@@ -23,8 +23,10 @@ import (
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -36,12 +38,15 @@ const CHECKPOINT_RESTORE_SCHEDULE_ANNOTATION = "kcr.io/checkpoint-restore-schedu
 type DeploymentReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// Recorder records the Events of the CheckpointSchedules on the Deployments.
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps,resources=deployments/finalizers,verbs=update
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointschedules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -80,12 +85,17 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	err = r.Get(ctx, client.ObjectKey{Namespace: deployment.Namespace, Name: deployment.Name}, &checkpointSchedule)
 	if err == nil {
 		// Update the CheckpointSchedule
+		scheduleChanged := checkpointSchedule.Spec.Schedule != checkpointRestoreScheduleAnnotation
 		checkpointSchedule.Spec.Schedule = checkpointRestoreScheduleAnnotation
 		checkpointSchedule.Spec.Selector = *deployment.Spec.Selector
 		if err := r.Update(ctx, &checkpointSchedule); err != nil {
 			log.Error(err, "failed to update CheckpointSchedule")
 			return ctrl.Result{Requeue: true}, err
 		}
+		if scheduleChanged {
+			r.Recorder.Eventf(&deployment, corev1.EventTypeNormal, checkpointrestorev1.EventReasonCheckpointScheduled,
+				"Updated CheckpointSchedule %s to schedule %q", checkpointSchedule.Name, checkpointRestoreScheduleAnnotation)
+		}
 
 		return ctrl.Result{}, nil
 	}
@@ -106,6 +116,8 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		log.Error(err, "failed to create CheckpointSchedule")
 		return ctrl.Result{Requeue: true}, err
 	}
+	r.Recorder.Eventf(&deployment, corev1.EventTypeNormal, checkpointrestorev1.EventReasonCheckpointScheduled,
+		"Created CheckpointSchedule %s with schedule %q", checkpointSchedule.Name, checkpointRestoreScheduleAnnotation)
 
 	if err := ctrl.SetControllerReference(&deployment, &checkpointSchedule, r.Scheme); err != nil {
 		log.Error(err, "failed to set controller reference for CheckpointSchedule")
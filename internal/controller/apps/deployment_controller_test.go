@@ -10,6 +10,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -74,8 +75,9 @@ var _ = Describe("Deployment Controller", func() {
 						Namespace: deploymentNamespace,
 					}
 					deploymentReconciler := DeploymentReconciler{
-						Client: k8sClient,
-						Scheme: k8sClient.Scheme(),
+						Client:   k8sClient,
+						Scheme:   k8sClient.Scheme(),
+						Recorder: &record.FakeRecorder{},
 					}
 					_, err := deploymentReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
 					Expect(err).NotTo(HaveOccurred())
@@ -0,0 +1,185 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpointrestore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+// processingRetryInterval is the time a queued build waits for the number of checkpoints processed in the
+// cluster to drop under the limit before it is tried again.
+const processingRetryInterval = 10 * time.Second
+
+// DefaultProcessingTimeout is the default time after which a checkpoint in the Processing phase is no longer
+// counted as being processed.
+const DefaultProcessingTimeout = time.Hour
+
+// BuildQueue builds the images of the checkpoints in a pool of workers, outside of the reconcile loop, so the
+// long builds and pushes do not block the reconciliation of the other checkpoints. The CheckpointReconciler
+// adds it to the manager, its workers run while the manager runs.
+type BuildQueue struct {
+	// Workers is the number of checkpoint images built at the same time by the process, which is the number
+	// of images built at the same time on its node for the kcr-agent. One image is built at a time when zero.
+	Workers int
+	// MaxProcessing is the number of checkpoints of the whole cluster in the Processing phase from which the
+	// queued builds wait to start, there is no limit when zero. The processes starting builds at the same
+	// time may exceed it.
+	MaxProcessing int
+	// ProcessingTimeout is the time since a checkpoint entered the Processing phase after which it is no
+	// longer counted in MaxProcessing, as the process building it was probably stopped with its node.
+	// DefaultProcessingTimeout is used when zero.
+	ProcessingTimeout time.Duration
+
+	reader client.Reader
+	build  func(ctx context.Context, key types.NamespacedName) error
+	queue  workqueue.TypedRateLimitingInterface[types.NamespacedName]
+
+	mutex sync.Mutex
+	// cancels cancel the builds in progress.
+	cancels map[types.NamespacedName]context.CancelFunc
+}
+
+// setup prepares the queue to build the queued checkpoints with build, the checkpoints being processed in the
+// cluster are listed with reader.
+func (q *BuildQueue) setup(reader client.Reader, build func(ctx context.Context, key types.NamespacedName) error) {
+	q.reader = reader
+	q.build = build
+	q.queue = workqueue.NewTypedRateLimitingQueueWithConfig(
+		workqueue.DefaultTypedControllerRateLimiter[types.NamespacedName](),
+		workqueue.TypedRateLimitingQueueConfig[types.NamespacedName]{Name: "checkpoint-build"},
+	)
+	q.cancels = map[types.NamespacedName]context.CancelFunc{}
+}
+
+// Start runs the workers until ctx is done, which cancels the builds in progress. The checkpoints whose build
+// was cancelled stay in the Processing phase and are built again when the process restarts.
+func (q *BuildQueue) Start(ctx context.Context) error {
+	var workers sync.WaitGroup
+	for range max(q.Workers, 1) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for q.processNext(ctx) {
+			}
+		}()
+	}
+	<-ctx.Done()
+	q.queue.ShutDown()
+	workers.Wait()
+	return nil
+}
+
+// Enqueue queues the build of the image of the checkpoint. A checkpoint already queued is only built once.
+func (q *BuildQueue) Enqueue(key types.NamespacedName) {
+	q.queue.Add(key)
+}
+
+// Building reports whether the image of the checkpoint is being built.
+func (q *BuildQueue) Building(key types.NamespacedName) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	_, ok := q.cancels[key]
+	return ok
+}
+
+// Cancel cancels the build of the image of the checkpoint, when it is being built.
+func (q *BuildQueue) Cancel(key types.NamespacedName) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if cancel, ok := q.cancels[key]; ok {
+		cancel()
+	}
+}
+
+// processNext builds the image of the next queued checkpoint. It returns false once the queue is shut down.
+func (q *BuildQueue) processNext(ctx context.Context) bool {
+	key, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(key)
+	logger := log.FromContext(ctx).WithValues("checkpoint", key)
+
+	if q.MaxProcessing > 0 {
+		processing, err := q.processing(ctx, key)
+		if err != nil {
+			logger.Error(err, "unable to count the checkpoints being processed")
+			q.queue.AddRateLimited(key)
+			return true
+		}
+		if processing >= q.MaxProcessing {
+			logger.V(1).Info("waiting for the checkpoints being processed in the cluster", "processing", processing)
+			q.queue.AddAfter(key, processingRetryInterval)
+			return true
+		}
+	}
+
+	buildCtx, cancel := context.WithCancel(log.IntoContext(ctx, logger))
+	q.mutex.Lock()
+	q.cancels[key] = cancel
+	q.mutex.Unlock()
+	err := q.build(buildCtx, key)
+	q.mutex.Lock()
+	delete(q.cancels, key)
+	q.mutex.Unlock()
+	cancel()
+
+	if err != nil {
+		logger.Error(err, "unable to build the checkpoint image")
+		q.queue.AddRateLimited(key)
+		return true
+	}
+	q.queue.Forget(key)
+	return true
+}
+
+// processing returns the number of checkpoints of the cluster which entered the Processing phase within the
+// ProcessingTimeout, besides the checkpoint of key, which is in the Processing phase when its build was
+// interrupted.
+func (q *BuildQueue) processing(ctx context.Context, key types.NamespacedName) (int, error) {
+	var checkpoints checkpointrestorev1.CheckpointList
+	if err := q.reader.List(ctx, &checkpoints); err != nil {
+		return 0, err
+	}
+	timeout := q.ProcessingTimeout
+	if timeout == 0 {
+		timeout = DefaultProcessingTimeout
+	}
+	since := time.Now().Add(-timeout)
+	processing := 0
+	for i := range checkpoints.Items {
+		checkpoint := &checkpoints.Items[i]
+		if checkpoint.Status.Phase != checkpointrestorev1.CheckpointPhaseProcessing ||
+			client.ObjectKeyFromObject(checkpoint) == key {
+			continue
+		}
+		// The checkpoints left in the Processing phase by a stopped process would block the builds forever.
+		if transition := checkpoint.Status.LastTransitionTime; transition != nil && transition.After(since) {
+			processing++
+		}
+	}
+	return processing, nil
+}
@@ -18,14 +18,36 @@ package checkpointrestore
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/internal/metrics"
+	"github.com/GianOrtiz/kcr/internal/tracing"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/archive"
 	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
 )
 
@@ -35,20 +57,48 @@ type CheckpointReconciler struct {
 	Scheme               *runtime.Scheme
 	ImageBuilder         imagebuilder.ImageBuilder
 	CheckpointsDirectory string
+	// NodeName restricts the reconciler to the checkpoints created on the given node. It is set by the
+	// kcr-agent, which runs on every node and has access to the local checkpoints directory. When empty
+	// every checkpoint is processed.
+	NodeName string
+	// LayerCompression is the compression of the checkpoint image layers when the Checkpoint does not
+	// set one.
+	LayerCompression imagebuilder.Compression
+	// RegistryResolver resolves the registry the checkpoint images of each namespace are pushed to.
+	RegistryResolver imagebuilder.RegistryResolver
+	// ImageSigner signs the pushed checkpoint images, they are not signed when nil.
+	ImageSigner imagebuilder.ImageSigner
+	// Encryption encrypts the checkpoint image layers, they are not encrypted when nil.
+	Encryption *imagebuilder.Encryption
+	// VerifyArchives verifies the integrity of the checkpoint archives before their images are built.
+	VerifyArchives bool
+	// Recorder records the Events of the checkpoint images on the Checkpoints.
+	Recorder record.EventRecorder
+	// Builds builds the checkpoint images in a pool of workers. The images are built in the reconcile loop
+	// when nil.
+	Builds *BuildQueue
+	// PushProgressInterval is the interval between the reports of the bytes pushed of a checkpoint image in
+	// its status, defaultPushProgressInterval when zero.
+	PushProgressInterval time.Duration
 }
 
+// defaultPushProgressInterval is the default interval between the reports of the push progress.
+const defaultPushProgressInterval = 5 * time.Second
+
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpoints,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpoints/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpoints/finalizers,verbs=update
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointregistries,verbs=get;list;watch
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointrequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get,resourceNames=kcr-registry-credentials
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get,namespace=system
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *CheckpointReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	const (
-		imageBuiltPhase = "ImageBuilt"
-		failedPhase     = "Failed"
-		processingPhase = "Processing"
-	)
 	log := log.FromContext(ctx)
 
 	var checkpoint checkpointrestorev1.Checkpoint
@@ -57,62 +107,637 @@ func (r *CheckpointReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			log.Error(err, "unable to fetch Checkpoint")
 			return ctrl.Result{}, err
 		}
+		// The image of a deleted checkpoint is not needed anymore.
+		r.cancelBuild(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+	if !checkpoint.DeletionTimestamp.IsZero() {
+		r.cancelBuild(req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
-	// Image is already processed, it should not be processed again.
-	if checkpoint.Status.Phase == imageBuiltPhase || checkpoint.Status.Phase == failedPhase {
+	if !r.needsBuild(&checkpoint) {
 		return ctrl.Result{}, nil
 	}
+	if r.Builds == nil {
+		return r.build(ctx, &checkpoint)
+	}
+	// A checkpoint in the Processing phase which is not being built was interrupted, e.g. by a restart of the
+	// process, and is built again.
+	if !r.Builds.Building(req.NamespacedName) {
+		r.Builds.Enqueue(req.NamespacedName)
+	}
+	return ctrl.Result{}, nil
+}
 
-	// Image build process is in processing phase, we can reeschedule this reconcile loop to check the status.
-	if checkpoint.Status.Phase == processingPhase {
-		return ctrl.Result{Requeue: true}, nil
+// needsBuild reports whether the image of the checkpoint must be built by this reconciler.
+func (r *CheckpointReconciler) needsBuild(checkpoint *checkpointrestorev1.Checkpoint) bool {
+	// The checkpoint archive lives in another node, the agent running on that node will process it.
+	if !r.isLocalCheckpoint(checkpoint) {
+		return false
 	}
 
-	checkpointFile := checkpoint.Spec.CheckpointData
-	checkpointFilePath := filepath.Join(r.CheckpointsDirectory, checkpointFile)
-	checkpointImage := "checkpoint-" + checkpoint.Name
-	if err := r.ImageBuilder.BuildFromCheckpoint(
-		checkpointFilePath, checkpoint.Spec.ContainerName, checkpointImage, ctx,
-	); err != nil {
-		log.Error(err, "unable to build image from checkpoint")
-		checkpoint.Status.Phase = failedPhase
-		checkpoint.Status.FailedReason = err.Error()
-		if err := r.Status().Update(ctx, &checkpoint); err != nil {
-			log.Error(err, "unable to update checkpoint status")
+	// Imported checkpoints have no archive in this cluster, their image was pushed when they were imported.
+	if _, imported := checkpoint.Annotations[checkpointrestorev1.ImportedCheckpointAnnotation]; imported {
+		return false
+	}
+
+	// Image is already processed, it should not be processed again.
+	return checkpoint.Status.Phase != checkpointrestorev1.CheckpointPhaseImageBuilt &&
+		checkpoint.Status.Phase != checkpointrestorev1.CheckpointPhaseFailed
+}
+
+// cancelBuild cancels the build of the image of the checkpoint, when it is being built by the build queue.
+func (r *CheckpointReconciler) cancelBuild(key types.NamespacedName) {
+	if r.Builds != nil {
+		r.Builds.Cancel(key)
+	}
+}
+
+// buildQueued builds the image of a checkpoint queued in the build queue.
+func (r *CheckpointReconciler) buildQueued(ctx context.Context, key types.NamespacedName) error {
+	var checkpoint checkpointrestorev1.Checkpoint
+	if err := r.Get(ctx, key, &checkpoint); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !checkpoint.DeletionTimestamp.IsZero() || !r.needsBuild(&checkpoint) {
+		return nil
+	}
+	_, err := r.build(ctx, &checkpoint)
+	return err
+}
+
+// build builds and pushes the image of the checkpoint. The checkpoint is set to the Processing phase while its
+// image is built, and the bytes of the image pushed are reported in its status.
+func (r *CheckpointReconciler) build(
+	ctx context.Context, checkpoint *checkpointrestorev1.Checkpoint,
+) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// The image build continues the trace of the CheckpointRequest that created the checkpoint.
+	ctx, span := tracing.Start(ctx, checkpoint, "checkpoint.build", trace.WithAttributes(
+		semconv.K8SNamespaceName(checkpoint.Namespace),
+		attribute.String("kcr.checkpoint", checkpoint.Name),
+		semconv.K8SNodeName(checkpoint.Spec.NodeName),
+	))
+	defer span.End()
+
+	// The update fails when the checkpoint changed since it was read, so a checkpoint read from a stale cache
+	// is not built twice.
+	checkpoint.Status.Phase = checkpointrestorev1.CheckpointPhaseProcessing
+	checkpoint.Status.LastTransitionTime = &metav1.Time{Time: time.Now()}
+	checkpoint.Status.PushedBytes = 0
+	setCondition(&checkpoint.Status.Conditions, checkpoint.Generation, checkpointrestorev1.ConditionReady,
+		metav1.ConditionFalse, checkpointrestorev1.ConditionReasonProcessing, "Building the checkpoint image")
+	if err := r.Status().Update(ctx, checkpoint); err != nil {
+		log.Error(err, "unable to update checkpoint status to Processing")
+		return ctrl.Result{}, err
+	}
+
+	// An image builder ignoring the parent would silently build a full checkpoint in place of the incremental one.
+	if checkpoint.Spec.ParentCheckpoint != nil && !imagebuilder.ReusesParentLayers(r.ImageBuilder) {
+		err := errors.New("the image builder does not build incremental checkpoints, use the oci or stream builder")
+		log.Error(err, "unable to build incremental checkpoint")
+		return r.fail(ctx, checkpoint, checkpointrestorev1.EventReasonImageBuildFailed, err)
+	}
+
+	checkpointFilePath, err := r.archivePath(ctx, checkpoint)
+	if err != nil {
+		if !errors.Is(err, errInvalidArchive) && !apierrors.IsNotFound(err) {
+			log.Error(err, "unable to get the CheckpointRequest of the checkpoint")
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, nil
+		log.Error(err, "invalid checkpoint archive")
+		return r.fail(ctx, checkpoint, checkpointrestorev1.EventReasonImageBuildFailed, err)
+	}
+	checkpointImage := "checkpoint-" + checkpoint.Name
+	if r.VerifyArchives {
+		_, verifySpan := tracing.Start(ctx, nil, "archive.verify")
+		verification, err := archive.Verify(checkpointFilePath)
+		tracing.End(verifySpan, err)
+		if err != nil {
+			log.Error(err, "checkpoint archive failed the verification")
+			setCondition(&checkpoint.Status.Conditions, checkpoint.Generation,
+				checkpointrestorev1.CheckpointArchiveVerified, metav1.ConditionFalse,
+				checkpointrestorev1.ConditionReasonInvalidArchive, err.Error())
+			return r.fail(ctx, checkpoint, checkpointrestorev1.EventReasonImageBuildFailed, err)
+		}
+		setCondition(&checkpoint.Status.Conditions, checkpoint.Generation,
+			checkpointrestorev1.CheckpointArchiveVerified, metav1.ConditionTrue,
+			checkpointrestorev1.ConditionReasonArchiveValid,
+			fmt.Sprintf("Checkpoint archive of %d bytes verified", verification.Size))
+		checkpoint.Status.ArchiveDigest = verification.Digest.String()
 	}
 
-	runtimeImageName := "checkpoint-" + checkpoint.Name + ":latest"
-	if err := r.ImageBuilder.PushToNodeRuntime(ctx, checkpointImage, runtimeImageName); err != nil {
+	registryAuth, runtimeImageName, err := r.imageDestination(ctx, checkpoint)
+	if err != nil {
+		log.Error(err, "unable to resolve the checkpoint image destination")
+		return r.fail(ctx, checkpoint, checkpointrestorev1.EventReasonImageBuildFailed, err)
+	}
+	inspection, err := archive.Inspect(checkpointFilePath)
+	if err != nil {
+		log.Error(err, "unable to inspect checkpoint archive, building image with partial metadata")
+	} else {
+		checkpoint.Status.Archive = archiveStatus(inspection)
+	}
+	metadata := r.checkpointMetadata(ctx, checkpoint, inspection, registryAuth.URL)
+	options, err := r.buildOptions(checkpoint)
+	if err != nil {
+		log.Error(err, "invalid checkpoint build options")
+		return r.fail(ctx, checkpoint, checkpointrestorev1.EventReasonImageBuildFailed, err)
+	}
+	buildFilePath, filteredFiles, err := r.filterArchive(checkpoint, checkpointFilePath)
+	if err != nil {
+		log.Error(err, "unable to filter checkpoint archive")
+		return r.fail(ctx, checkpoint, checkpointrestorev1.EventReasonImageBuildFailed, err)
+	}
+	if buildFilePath != checkpointFilePath {
+		// Some builders only read the archive when the image is pushed.
+		defer func() {
+			_ = os.Remove(buildFilePath)
+		}()
+	}
+	buildStart := time.Now()
+	buildCtx, buildSpan := tracing.Start(ctx, nil, "image.build", trace.WithAttributes(
+		attribute.String("kcr.image", checkpointImage),
+		attribute.String("kcr.compression", options.Compression.String()),
+	))
+	err = r.ImageBuilder.BuildFromCheckpoint(buildFilePath, metadata, options, checkpointImage, buildCtx)
+	tracing.End(buildSpan, err)
+	if err != nil {
+		log.Error(err, "unable to build image from checkpoint")
+		return r.fail(ctx, checkpoint, checkpointrestorev1.EventReasonImageBuildFailed, err)
+	}
+	metrics.ObserveCheckpointStage(checkpoint.Namespace, metrics.StageBuild, buildStart)
+	r.Recorder.Eventf(checkpoint, corev1.EventTypeNormal, checkpointrestorev1.EventReasonImageBuilt,
+		"Built image %s", checkpointImage)
+	setCondition(&checkpoint.Status.Conditions, checkpoint.Generation, checkpointrestorev1.CheckpointImageBuilt,
+		metav1.ConditionTrue, checkpointrestorev1.EventReasonImageBuilt, "Built image "+checkpointImage)
+
+	pushStart := time.Now()
+	pushCtx, pushSpan := tracing.Start(ctx, nil, "image.push", trace.WithAttributes(
+		attribute.String("kcr.registry", registryAuth.URL),
+		attribute.String("kcr.image", runtimeImageName),
+	))
+	progress := r.reportPushProgress(ctx, checkpoint)
+	pushedImage, err := r.ImageBuilder.PushToNodeRuntime(imagebuilder.WithPushProgress(pushCtx, progress.add),
+		checkpointImage, runtimeImageName, registryAuth)
+	progress.stop(checkpoint)
+	tracing.End(pushSpan, err)
+	if err != nil {
 		log.Error(err, "unable to push image from checkpoint")
-		checkpoint.Status.Phase = failedPhase
-		checkpoint.Status.FailedReason = err.Error()
-		if err := r.Status().Update(ctx, &checkpoint); err != nil {
-			log.Error(err, "unable to update checkpoint status")
-			return ctrl.Result{}, err
+		return r.fail(ctx, checkpoint, checkpointrestorev1.EventReasonImagePushFailed, err)
+	}
+
+	if r.ImageSigner != nil {
+		signCtx, signSpan := tracing.Start(ctx, nil, "image.sign")
+		err := r.ImageSigner.SignImage(signCtx, registryAuth, runtimeImageName, pushedImage.Digest)
+		tracing.End(signSpan, err)
+		if err != nil {
+			log.Error(err, "unable to sign checkpoint image")
+			return r.fail(ctx, checkpoint, checkpointrestorev1.EventReasonImagePushFailed, err)
 		}
-		return ctrl.Result{}, nil
+		checkpoint.Status.Signed = true
 	}
+	metrics.ObserveCheckpointStage(checkpoint.Namespace, metrics.StagePush, pushStart)
+	pushedMessage := fmt.Sprintf("Pushed image %s/%s@%s", registryAuth.URL, runtimeImageName, pushedImage.Digest)
+	setCondition(&checkpoint.Status.Conditions, checkpoint.Generation, checkpointrestorev1.CheckpointImagePushed,
+		metav1.ConditionTrue, checkpointrestorev1.EventReasonImagePushed, pushedMessage)
+	setCondition(&checkpoint.Status.Conditions, checkpoint.Generation, checkpointrestorev1.ConditionReady,
+		metav1.ConditionTrue, checkpointrestorev1.ConditionReasonCompleted, "Checkpoint image is available")
 
-	checkpoint.Status.Phase = imageBuiltPhase
+	checkpoint.Status.Phase = checkpointrestorev1.CheckpointPhaseImageBuilt
 	checkpoint.Status.CheckpointImage = checkpointImage
 	checkpoint.Status.RuntimeImage = runtimeImageName
-	if err := r.Status().Update(ctx, &checkpoint); err != nil {
+	checkpoint.Status.Registry = registryAuth.URL
+	checkpoint.Status.ImageDigest = pushedImage.Digest.String()
+	checkpoint.Status.Compression = options.Compression.String()
+	if options.Encryption != nil {
+		checkpoint.Status.EncryptionKeys = options.Encryption.KeyIDs
+	}
+	checkpoint.Status.CompressedSize = pushedImage.Size
+	checkpoint.Status.FilteredFiles = filteredFiles
+	if info, err := os.Stat(checkpointFilePath); err == nil {
+		checkpoint.Status.RawSize = info.Size()
+	}
+	if err := r.Status().Update(ctx, checkpoint); err != nil {
 		log.Error(err, "unable to update checkpoint status")
 		return ctrl.Result{}, err
 	}
+	metrics.CheckpointSucceeded(checkpoint.Namespace, scheduleName(checkpoint.Spec.CheckpointScheduleRef))
+	metrics.ObserveCheckpointSizes(checkpoint.Namespace, checkpoint.Status.RawSize, checkpoint.Status.CompressedSize)
+	r.Recorder.Event(checkpoint, corev1.EventTypeNormal, checkpointrestorev1.EventReasonImagePushed, pushedMessage)
 
 	return ctrl.Result{}, nil
 }
 
+// errInvalidArchive is returned for the checkpoints whose archive is not one of their checkpointed pod.
+var errInvalidArchive = errors.New("invalid checkpoint archive")
+
+// archivePath returns the path of the archive of the checkpoint in the checkpoints directory. The archive
+// must be a file of the directory named by the kubelet after the pod of the CheckpointRequest that created
+// the checkpoint, checkpoint-<pod>_<namespace>-<container>-<timestamp>.tar, so a Checkpoint never points to
+// a file out of the directory nor to the archive of another pod.
+func (r *CheckpointReconciler) archivePath(
+	ctx context.Context, checkpoint *checkpointrestorev1.Checkpoint,
+) (string, error) {
+	name := checkpoint.Spec.CheckpointData
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "", fmt.Errorf("%w: %q is not a file name", errInvalidArchive, name)
+	}
+	var checkpointRequest checkpointrestorev1.CheckpointRequest
+	if err := r.Get(ctx, types.NamespacedName{
+		Name:      checkpoint.Labels["checkpoint-request-name"],
+		Namespace: checkpoint.Namespace,
+	}, &checkpointRequest); err != nil {
+		return "", fmt.Errorf("failed to get the CheckpointRequest of the checkpoint: %w", err)
+	}
+	pod := checkpointRequest.Spec.PodReference
+	if !strings.HasPrefix(name, "checkpoint-"+pod.Name+"_"+pod.Namespace+"-") {
+		return "", fmt.Errorf("%w: %s is not an archive of the pod %s/%s", errInvalidArchive, name, pod.Namespace,
+			pod.Name)
+	}
+	return filepath.Join(r.CheckpointsDirectory, name), nil
+}
+
+// fail sets the checkpoint to the Failed phase with the error, sets the condition of the failed stage and the
+// Ready condition to False with the reason, records it in an Event with the reason and on the span of the
+// checkpoint, and counts it in the metrics. A cancelled build does not fail the checkpoint.
+func (r *CheckpointReconciler) fail(
+	ctx context.Context, checkpoint *checkpointrestorev1.Checkpoint, reason string, failure error,
+) (ctrl.Result, error) {
+	tracing.Fail(trace.SpanFromContext(ctx), failure)
+	if ctx.Err() != nil {
+		// The build was cancelled because the checkpoint was deleted or the process stops. The checkpoint stays
+		// in the Processing phase and is built again when the process restarts.
+		log.FromContext(ctx).Info("checkpoint image build cancelled", "error", failure.Error())
+		return ctrl.Result{}, nil
+	}
+	conditionType := checkpointrestorev1.CheckpointImageBuilt
+	if reason == checkpointrestorev1.EventReasonImagePushFailed {
+		conditionType = checkpointrestorev1.CheckpointImagePushed
+	}
+	checkpoint.Status.Phase = checkpointrestorev1.CheckpointPhaseFailed
+	checkpoint.Status.FailedReason = failure.Error()
+	setCondition(&checkpoint.Status.Conditions, checkpoint.Generation, conditionType, metav1.ConditionFalse, reason,
+		failure.Error())
+	setCondition(&checkpoint.Status.Conditions, checkpoint.Generation, checkpointrestorev1.ConditionReady,
+		metav1.ConditionFalse, reason, failure.Error())
+	r.Recorder.Event(checkpoint, corev1.EventTypeWarning, reason, failure.Error())
+	if err := r.Status().Update(ctx, checkpoint); err != nil {
+		log.FromContext(ctx).Error(err, "unable to update checkpoint status")
+		return ctrl.Result{}, err
+	}
+	metrics.CheckpointFailed(checkpoint.Namespace, scheduleName(checkpoint.Spec.CheckpointScheduleRef), reason)
+	return ctrl.Result{}, nil
+}
+
+// pushProgress reports the bytes pushed of the image of a checkpoint in its status while the image is pushed.
+type pushProgress struct {
+	pushed  atomic.Int64
+	stopped chan struct{}
+	done    chan struct{}
+	// reported is the checkpoint as patched by the last report.
+	reported *checkpointrestorev1.Checkpoint
+}
+
+// reportPushProgress reports the progress of the push of the image of the checkpoint until it is stopped. The
+// reports patch a copy of the checkpoint, so its status may be changed meanwhile.
+func (r *CheckpointReconciler) reportPushProgress(
+	ctx context.Context, checkpoint *checkpointrestorev1.Checkpoint,
+) *pushProgress {
+	interval := r.PushProgressInterval
+	if interval == 0 {
+		interval = defaultPushProgressInterval
+	}
+	progress := &pushProgress{
+		stopped:  make(chan struct{}),
+		done:     make(chan struct{}),
+		reported: checkpoint.DeepCopy(),
+	}
+	go func() {
+		defer close(progress.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progress.stopped:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			pushed := progress.pushed.Load()
+			if pushed == progress.reported.Status.PushedBytes {
+				continue
+			}
+			base := progress.reported.DeepCopy()
+			progress.reported.Status.PushedBytes = pushed
+			if err := r.Status().Patch(ctx, progress.reported, client.MergeFrom(base)); err != nil {
+				log.FromContext(ctx).Error(err, "unable to report the checkpoint push progress")
+			}
+		}
+	}()
+	return progress
+}
+
+// add counts the bytes pushed, it is the imagebuilder.PushProgress of the push.
+func (p *pushProgress) add(pushed int64) {
+	p.pushed.Add(pushed)
+}
+
+// stop stops the reports and records the bytes pushed in the status of the checkpoint. The checkpoint takes
+// the resource version of the last report, which only changed the bytes pushed, so its status can be updated.
+func (p *pushProgress) stop(checkpoint *checkpointrestorev1.Checkpoint) {
+	close(p.stopped)
+	<-p.done
+	checkpoint.ResourceVersion = p.reported.ResourceVersion
+	checkpoint.Status.PushedBytes = p.pushed.Load()
+}
+
+// imageDestination returns the registry the checkpoint image is pushed to and the name of the image in it.
+// The CheckpointRegistry referenced by the checkpoint describes both, otherwise the registry of the
+// checkpoint namespace is used with the default image name.
+func (r *CheckpointReconciler) imageDestination(
+	ctx context.Context, checkpoint *checkpointrestorev1.Checkpoint,
+) (imagebuilder.RegistryAuth, string, error) {
+	data := imagebuilder.ImageNameData{
+		Namespace:  checkpoint.Namespace,
+		Pod:        checkpoint.Labels["pod"],
+		Container:  checkpoint.Spec.ContainerName,
+		Checkpoint: checkpoint.Name,
+		Node:       checkpoint.Spec.NodeName,
+		Timestamp:  checkpoint.CreationTimestamp.Time,
+	}
+	if checkpoint.Spec.CheckpointScheduleRef != nil {
+		data.Schedule = checkpoint.Spec.CheckpointScheduleRef.Name
+	}
+	if checkpoint.Spec.CheckpointTimestamp != nil {
+		data.Timestamp = checkpoint.Spec.CheckpointTimestamp.Time
+	}
+
+	registryAuth, checkpointRegistry, err := ResolveCheckpointRegistry(ctx, r, r.RegistryResolver, checkpoint)
+	if err != nil {
+		return imagebuilder.RegistryAuth{}, "", err
+	}
+	if checkpointRegistry == nil {
+		imageName, err := imagebuilder.ImageName("", "", data)
+		return registryAuth, imageName, err
+	}
+	imageName, err := imagebuilder.ImageName(
+		checkpointRegistry.Spec.RepositoryTemplate, checkpointRegistry.Spec.TagTemplate, data)
+	return registryAuth, imageName, err
+}
+
+// ResolveCheckpointRegistry returns the registry of the checkpoint image, with its credentials, and the
+// CheckpointRegistry describing it. The CheckpointRegistry is nil when the checkpoint does not reference one
+// and the registry of its namespace is used.
+func ResolveCheckpointRegistry(
+	ctx context.Context,
+	reader client.Reader,
+	resolver imagebuilder.RegistryResolver,
+	checkpoint *checkpointrestorev1.Checkpoint,
+) (imagebuilder.RegistryAuth, *checkpointrestorev1.CheckpointRegistry, error) {
+	if checkpoint.Spec.CheckpointRegistry == "" {
+		registryAuth, err := resolver.Resolve(ctx, checkpoint.Namespace)
+		return registryAuth, nil, err
+	}
+
+	checkpointRegistry, err := getCheckpointRegistry(ctx, reader, checkpoint.Spec.CheckpointRegistry, checkpoint.Namespace)
+	if err != nil {
+		return imagebuilder.RegistryAuth{}, nil, err
+	}
+	var secret types.NamespacedName
+	if secretRef := checkpointRegistry.Spec.CredentialsSecretRef; secretRef != nil {
+		secret = types.NamespacedName{Name: secretRef.Name, Namespace: secretRef.Namespace}
+	}
+	registryAuth, err := resolver.ResolveRegistry(
+		ctx, checkpointRegistry.Spec.URL, secret, checkpointRegistry.Spec.Insecure)
+	if err != nil {
+		return imagebuilder.RegistryAuth{}, nil, err
+	}
+	return registryAuth, checkpointRegistry, nil
+}
+
+// errRegistryNotAllowed is returned for a CheckpointRegistry which does not allow the namespace of a checkpoint.
+var errRegistryNotAllowed = errors.New("namespace is not allowed")
+
+// getCheckpointRegistry returns the CheckpointRegistry, failing with errRegistryNotAllowed when it does not
+// allow the checkpoints of the namespace, as any namespace can reference the cluster CheckpointRegistries.
+func getCheckpointRegistry(
+	ctx context.Context, reader client.Reader, name, namespace string,
+) (*checkpointrestorev1.CheckpointRegistry, error) {
+	var checkpointRegistry checkpointrestorev1.CheckpointRegistry
+	if err := reader.Get(ctx, client.ObjectKey{Name: name}, &checkpointRegistry); err != nil {
+		return nil, fmt.Errorf("failed to get CheckpointRegistry %s: %w", name, err)
+	}
+	if slices.Contains(checkpointRegistry.Spec.AllowedNamespaces, namespace) {
+		return &checkpointRegistry, nil
+	}
+	if checkpointRegistry.Spec.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(checkpointRegistry.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector of CheckpointRegistry %s: %w", name, err)
+		}
+		var ns corev1.Namespace
+		if err := reader.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+			return nil, fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			return &checkpointRegistry, nil
+		}
+	}
+	return nil, fmt.Errorf("CheckpointRegistry %s does not allow namespace %s: %w", name, namespace,
+		errRegistryNotAllowed)
+}
+
+// checkpointMetadata collects the metadata of the checkpointed container, from the Checkpoint resource and
+// from the inspection of the checkpoint archive, when it succeeded, to be stored in the checkpoint image
+// pushed to registry.
+func (r *CheckpointReconciler) checkpointMetadata(
+	ctx context.Context, checkpoint *checkpointrestorev1.Checkpoint, inspection *archive.Inspection, registry string,
+) imagebuilder.CheckpointMetadata {
+	log := log.FromContext(ctx)
+
+	metadata := imagebuilder.CheckpointMetadata{
+		ContainerName: checkpoint.Spec.ContainerName,
+		PodName:       checkpoint.Labels["pod"],
+		PodNamespace:  checkpoint.Labels["pod-ns"],
+	}
+
+	if parent := checkpoint.Spec.ParentCheckpoint; parent != nil {
+		var parentCheckpoint checkpointrestorev1.Checkpoint
+		err := r.Get(ctx, client.ObjectKey{Name: parent.Name, Namespace: checkpoint.Namespace}, &parentCheckpoint)
+		if err != nil {
+			log.Error(err, "unable to get parent checkpoint, building a full image", "parent", parent.Name)
+		} else if parentCheckpoint.Status.Registry != registry {
+			// The layers of the parent can only be reused from the same registry.
+			log.Info("parent checkpoint image is in another registry, building a full image", "parent", parent.Name)
+		} else if parentCheckpoint.Status.ImageDigest != "" {
+			// The parent tag may have been pushed again since, its digest always refers to the parent image.
+			metadata.ParentImage = imagebuilder.DigestReference(
+				parentCheckpoint.Status.RuntimeImage, digest.Digest(parentCheckpoint.Status.ImageDigest))
+		} else {
+			metadata.ParentImage = parentCheckpoint.Status.RuntimeImage
+		}
+	}
+
+	if inspection != nil {
+		metadata.RuntimeName = inspection.Config.OCIRuntime
+		metadata.RootfsImageName = inspection.Config.RootfsImageName
+		metadata.RootfsImageRef = inspection.Config.RootfsImageRef
+		metadata.Engine = inspection.Engine()
+		metadata.CriuVersion = inspection.CRIUVersion
+	}
+
+	// The manager may build the image in another node, the versions are the ones of the checkpoint node.
+	if checkpoint.Spec.NodeName == "" {
+		return metadata
+	}
+	var node corev1.Node
+	if err := r.Get(ctx, client.ObjectKey{Name: checkpoint.Spec.NodeName}, &node); err != nil {
+		log.Error(err, "unable to get checkpoint node, the image has no kernel and engine versions",
+			"node", checkpoint.Spec.NodeName)
+		return metadata
+	}
+	metadata.KernelVersion = node.Status.NodeInfo.KernelVersion
+	engine, engineVersion := containerRuntime(node.Status.NodeInfo.ContainerRuntimeVersion)
+	if metadata.Engine == "" {
+		metadata.Engine = engine
+	}
+	if metadata.Engine == engine {
+		metadata.EngineVersion = engineVersion
+	}
+	return metadata
+}
+
+// containerRuntime returns the name and the version of the container runtime of a node, reported as
+// <name>://<version>, e.g. cri-o://1.30.1.
+func containerRuntime(runtimeVersion string) (string, string) {
+	name, version, found := strings.Cut(runtimeVersion, "://")
+	if !found {
+		return "", ""
+	}
+	return name, version
+}
+
+// maxStatusProcesses limits the processes listed in the checkpoint status, the process tree of a container
+// may be arbitrarily large.
+const maxStatusProcesses = 32
+
+// archiveStatus describes the checkpointed container and its CRIU dump from the inspection of the archive.
+func archiveStatus(inspection *archive.Inspection) *checkpointrestorev1.CheckpointArchive {
+	status := &checkpointrestorev1.CheckpointArchive{
+		Image:            inspection.Config.RootfsImageName,
+		ImageID:          inspection.Config.RootfsImageRef,
+		Engine:           inspection.Engine(),
+		Runtime:          inspection.Config.OCIRuntime,
+		CRIUImageVersion: int32(inspection.ImageVersion),
+	}
+	if !inspection.Config.CheckpointedAt.IsZero() {
+		checkpointedAt := metav1.NewTime(inspection.Config.CheckpointedAt)
+		status.CheckpointedAt = &checkpointedAt
+	}
+	if stats := inspection.DumpStatistics; stats != nil {
+		status.DumpStatistics = &checkpointrestorev1.CheckpointDumpStatistics{
+			FreezingTime:       metav1.Duration{Duration: stats.FreezingTime},
+			FrozenTime:         metav1.Duration{Duration: stats.FrozenTime},
+			MemdumpTime:        metav1.Duration{Duration: stats.MemdumpTime},
+			MemwriteTime:       metav1.Duration{Duration: stats.MemwriteTime},
+			PagesScanned:       int64(stats.PagesScanned),
+			PagesSkippedParent: int64(stats.PagesSkippedParent),
+			PagesWritten:       int64(stats.PagesWritten),
+		}
+	}
+	for _, mount := range inspection.Spec.Mounts {
+		status.Mounts = append(status.Mounts, checkpointrestorev1.CheckpointMount{
+			Destination: mount.Destination,
+			Type:        mount.Type,
+			Source:      mount.Source,
+		})
+	}
+	if len(inspection.Processes) > 0 {
+		processTree := &checkpointrestorev1.CheckpointProcessTree{ProcessCount: int32(len(inspection.Processes))}
+		for i, process := range inspection.Processes {
+			processTree.ThreadCount += int32(process.Threads)
+			if i < maxStatusProcesses {
+				processTree.Processes = append(processTree.Processes, checkpointrestorev1.CheckpointProcess{
+					PID:     int32(process.PID),
+					PPID:    int32(process.PPID),
+					Command: process.Command,
+				})
+			}
+		}
+		status.ProcessTree = processTree
+	}
+	return status
+}
+
+// buildOptions returns the options to build the checkpoint image.
+func (r *CheckpointReconciler) buildOptions(checkpoint *checkpointrestorev1.Checkpoint) (imagebuilder.BuildOptions, error) {
+	options := imagebuilder.BuildOptions{Compression: r.LayerCompression, Encryption: r.Encryption}
+	if checkpoint.Spec.Compression != "" {
+		compression, err := imagebuilder.ParseCompression(checkpoint.Spec.Compression)
+		if err != nil {
+			return imagebuilder.BuildOptions{}, err
+		}
+		options.Compression = compression
+	}
+	return options, nil
+}
+
+// filterArchive removes the data excluded by the checkpoint filter from a copy of the archive. It returns
+// the location of the archive to build the image from, which is a temporary file when it was filtered, and
+// the number of removed files.
+func (r *CheckpointReconciler) filterArchive(
+	checkpoint *checkpointrestorev1.Checkpoint, checkpointFilePath string,
+) (string, int, error) {
+	if checkpoint.Spec.Filter == nil {
+		return checkpointFilePath, 0, nil
+	}
+	filter := archive.Filter{
+		ExcludePaths:      checkpoint.Spec.Filter.ExcludePaths,
+		ExcludeFiles:      checkpoint.Spec.Filter.ExcludeFiles,
+		ExcludeRootfsDiff: checkpoint.Spec.Filter.ExcludeRootfsDiff,
+	}
+	if filter.IsEmpty() {
+		return checkpointFilePath, 0, nil
+	}
+
+	// The checkpoints directory of the kubelet is read-only for the agent.
+	file, err := os.CreateTemp("", "kcr-filtered-*.tar")
+	if err != nil {
+		return "", 0, err
+	}
+	_ = file.Close()
+	removed, err := archive.FilterArchive(checkpointFilePath, file.Name(), filter)
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", 0, fmt.Errorf("failed to filter checkpoint archive: %w", err)
+	}
+	return file.Name(), removed, nil
+}
+
+// isLocalCheckpoint reports whether the checkpoint archive is available to this reconciler.
+func (r *CheckpointReconciler) isLocalCheckpoint(checkpoint *checkpointrestorev1.Checkpoint) bool {
+	return r.NodeName == "" || checkpoint.Spec.NodeName == r.NodeName
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CheckpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Builds != nil {
+		r.Builds.setup(mgr.GetClient(), r.buildQueued)
+		if err := mgr.Add(r.Builds); err != nil {
+			return err
+		}
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&checkpointrestorev1.Checkpoint{}).
+		For(&checkpointrestorev1.Checkpoint{}, builder.WithPredicates(predicate.NewPredicateFuncs(
+			func(object client.Object) bool {
+				checkpoint, ok := object.(*checkpointrestorev1.Checkpoint)
+				return ok && r.isLocalCheckpoint(checkpoint)
+			},
+		))).
 		Named("checkpoint-restore-checkpoint").
 		Complete(r)
 }
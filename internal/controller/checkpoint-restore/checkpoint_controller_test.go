@@ -17,22 +17,45 @@ limitations under the License.
 package checkpointrestore
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
+	criucore "github.com/checkpoint-restore/go-criu/v7/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/inventory"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/pstree"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/stats"
+	"github.com/checkpoint-restore/go-criu/v7/magic"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/proto"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
 	"github.com/GianOrtiz/kcr/pkg/util"
 )
 
-const checkpointData = "/var/lib/kubelet/checkpoints/checkpoint-kcr-example-5b9845566-rhnj2_default-kcr-example-1744851420.tar"
+const (
+	checkpointPodName     = "kcr-example-5b9845566-rhnj2"
+	checkpointData        = "checkpoint-kcr-example-5b9845566-rhnj2_default-kcr-example-1744851420.tar"
+	checkpointRequestName = "test-checkpoint-request"
+)
 
 var _ = Describe("Checkpoint Controller", func() {
 	Context("When reconciling a resource", func() {
@@ -59,11 +82,28 @@ var _ = Describe("Checkpoint Controller", func() {
 				},
 			})).To(Succeed())
 
+			Expect(k8sClient.Create(ctx, &checkpointrestorev1.CheckpointRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      checkpointRequestName,
+					Namespace: namespace,
+				},
+				Spec: checkpointrestorev1.CheckpointRequestSpec{
+					PodReference: checkpointrestorev1.PodReference{
+						Name:      checkpointPodName,
+						Namespace: "default",
+					},
+					ContainerName: "kcr-example",
+				},
+			})).To(Succeed())
+
 			now := metav1.Now()
 			checkpoint = &checkpointrestorev1.Checkpoint{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      checkpointName,
 					Namespace: namespace,
+					Labels: map[string]string{
+						"checkpoint-request-name": checkpointRequestName,
+					},
 				},
 				Status: checkpointrestorev1.CheckpointStatus{
 					CheckpointImage:    "image-reference",
@@ -95,6 +135,7 @@ var _ = Describe("Checkpoint Controller", func() {
 				imageBuilder := mockImageBuilder{mockedResult: nil}
 				controllerReconciler := &CheckpointReconciler{
 					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
 					Scheme:       k8sClient.Scheme(),
 					ImageBuilder: &imageBuilder,
 				}
@@ -117,6 +158,7 @@ var _ = Describe("Checkpoint Controller", func() {
 				imageBuilder := mockImageBuilder{mockedResult: nil}
 				controllerReconciler := &CheckpointReconciler{
 					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
 					Scheme:       k8sClient.Scheme(),
 					ImageBuilder: &imageBuilder,
 				}
@@ -127,7 +169,7 @@ var _ = Describe("Checkpoint Controller", func() {
 
 				var updatedCheckpoint checkpointrestorev1.Checkpoint
 				Expect(k8sClient.Get(ctx, typeNamespacedName, &updatedCheckpoint)).To(Succeed())
-				Expect(updatedCheckpoint.Status.Phase).To(Equal("Failed"))
+				Expect(updatedCheckpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseFailed))
 
 				Expect(err).NotTo(HaveOccurred())
 				Expect(result.Requeue).To(BeFalse())
@@ -140,10 +182,11 @@ var _ = Describe("Checkpoint Controller", func() {
 				Expect(k8sClient.Status().Update(ctx, checkpoint)).To(Succeed())
 			})
 
-			It("should not change the phase and requeue for later", func() {
+			It("should build the image again when its build was interrupted", func() {
 				imageBuilder := mockImageBuilder{mockedResult: nil}
 				controllerReconciler := &CheckpointReconciler{
 					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
 					Scheme:       k8sClient.Scheme(),
 					ImageBuilder: &imageBuilder,
 				}
@@ -151,13 +194,12 @@ var _ = Describe("Checkpoint Controller", func() {
 				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 					NamespacedName: typeNamespacedName,
 				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Requeue).To(BeFalse())
 
 				var updatedCheckpoint checkpointrestorev1.Checkpoint
 				Expect(k8sClient.Get(ctx, typeNamespacedName, &updatedCheckpoint)).To(Succeed())
-				Expect(updatedCheckpoint.Status.Phase).To(Equal("Processing"))
-
-				Expect(err).NotTo(HaveOccurred())
-				Expect(result.Requeue).To(BeTrue())
+				Expect(updatedCheckpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
 			})
 		})
 
@@ -172,6 +214,7 @@ var _ = Describe("Checkpoint Controller", func() {
 				imageBuilder := mockImageBuilder{mockedResult: nil}
 				controllerReconciler := &CheckpointReconciler{
 					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
 					Scheme:       k8sClient.Scheme(),
 					ImageBuilder: &imageBuilder,
 				}
@@ -183,8 +226,573 @@ var _ = Describe("Checkpoint Controller", func() {
 
 				var checkpoint checkpointrestorev1.Checkpoint
 				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
-				Expect(checkpoint.Status.Phase).To(Equal("ImageBuilt"))
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
 				Expect(checkpoint.Status.CheckpointImage).To(Equal("checkpoint-" + checkpoint.Name))
+				for _, conditionType := range []string{
+					checkpointrestorev1.CheckpointImageBuilt,
+					checkpointrestorev1.CheckpointImagePushed,
+					checkpointrestorev1.ConditionReady,
+				} {
+					Expect(meta.IsStatusConditionTrue(checkpoint.Status.Conditions, conditionType)).To(BeTrue(),
+						conditionType)
+				}
+				Expect(meta.FindStatusCondition(checkpoint.Status.Conditions,
+					checkpointrestorev1.CheckpointArchiveVerified)).To(BeNil())
+			})
+
+			It("should report the bytes pushed in the status", func() {
+				imageBuilder := mockImageBuilder{pushedBytes: 4096}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
+				Expect(checkpoint.Status.PushedBytes).To(Equal(int64(4096)))
+			})
+
+			It("should build the image with the checkpoint compression and record its size and digest", func() {
+				checkpoint.Spec.Compression = "zstd:3"
+				Expect(k8sClient.Update(ctx, checkpoint)).To(Succeed())
+
+				imageBuilder := mockImageBuilder{mockedPushedImage: imagebuilder.PushedImage{
+					Digest: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+					Size:   1024,
+				}}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
+				Expect(checkpoint.Status.Compression).To(Equal("zstd:3"))
+				Expect(checkpoint.Status.CompressedSize).To(Equal(int64(1024)))
+				Expect(checkpoint.Status.ImageDigest).To(
+					Equal("sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+			})
+
+			It("should push the image with the registry credentials of the namespace", func() {
+				Expect(k8sClient.Create(ctx, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "kcr-registry-credentials",
+						Namespace: namespace,
+					},
+					Type: corev1.SecretTypeDockerConfigJson,
+					Data: map[string][]byte{
+						corev1.DockerConfigJsonKey: []byte(
+							`{"auths":{"registry.example.com":{"username":"tenant","password":"secret"}}}`,
+						),
+						imagebuilder.RegistrySecretRegistryKey: []byte("registry.example.com/tenant"),
+					},
+				})).To(Succeed())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+					RegistryResolver: imagebuilder.RegistryResolver{
+						Reader:              k8sClient,
+						Default:             imagebuilder.NewRegistryAuth("localhost:5000", "", "", ""),
+						NamespaceSecretName: "kcr-registry-credentials",
+						AllowedRegistries:   []string{"registry.example.com"},
+					},
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(imageBuilder.pushedRegistryAuth.URL).To(Equal("registry.example.com/tenant"))
+				Expect(imageBuilder.pushedRegistryAuth.Basic).To(Equal(&imagebuilder.RegistryBasicAuth{
+					Username: "tenant",
+					Password: "secret",
+				}))
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
+				Expect(checkpoint.Status.Registry).To(Equal("registry.example.com/tenant"))
+			})
+
+			It("should push the image to the CheckpointRegistry of the checkpoint", func() {
+				checkpointRegistry := &checkpointrestorev1.CheckpointRegistry{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "registry-" + namespace,
+					},
+					Spec: checkpointrestorev1.CheckpointRegistrySpec{
+						URL:                "registry.example.com/checkpoints",
+						RepositoryTemplate: "{{ .Namespace }}/{{ .Checkpoint }}",
+						TagTemplate:        "v1",
+						AllowedNamespaces:  []string{namespace},
+					},
+				}
+				Expect(k8sClient.Create(ctx, checkpointRegistry)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, checkpointRegistry)).To(Succeed())
+				})
+
+				checkpoint.Spec.CheckpointRegistry = checkpointRegistry.Name
+				Expect(k8sClient.Update(ctx, checkpoint)).To(Succeed())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+					RegistryResolver: imagebuilder.RegistryResolver{
+						Default: imagebuilder.NewRegistryAuth("localhost:5000", "", "", ""),
+					},
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(imageBuilder.pushedRegistryAuth.URL).To(Equal("registry.example.com/checkpoints"))
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
+				Expect(checkpoint.Status.Registry).To(Equal("registry.example.com/checkpoints"))
+				Expect(checkpoint.Status.RuntimeImage).To(Equal(namespace + "/" + checkpointName + ":v1"))
+			})
+
+			It("should fail the checkpoint when its CheckpointRegistry does not allow its namespace", func() {
+				checkpointRegistry := &checkpointrestorev1.CheckpointRegistry{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "registry-" + namespace,
+					},
+					Spec: checkpointrestorev1.CheckpointRegistrySpec{
+						URL:               "registry.example.com/team-b",
+						AllowedNamespaces: []string{"team-b"},
+						NamespaceSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{"team": "b"},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, checkpointRegistry)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, checkpointRegistry)).To(Succeed())
+				})
+
+				checkpoint.Spec.CheckpointRegistry = checkpointRegistry.Name
+				Expect(k8sClient.Update(ctx, checkpoint)).To(Succeed())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(imageBuilder.pushedRegistryAuth.URL).To(BeEmpty())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseFailed))
+			})
+
+			It("should fail the checkpoint when its CheckpointRegistry does not exist", func() {
+				checkpoint.Spec.CheckpointRegistry = "missing-registry"
+				Expect(k8sClient.Update(ctx, checkpoint)).To(Succeed())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseFailed))
+			})
+
+			It("should sign the pushed image", func() {
+				imageBuilder := mockImageBuilder{mockedPushedImage: imagebuilder.PushedImage{
+					Digest: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+				}}
+				imageSigner := mockImageSigner{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+					ImageSigner:  &imageSigner,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(imageSigner.signedImage).To(Equal("checkpoint-" + checkpointName +
+					":latest@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
+				Expect(checkpoint.Status.Signed).To(BeTrue())
+			})
+
+			It("should fail the checkpoint when the image can not be signed", func() {
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+					ImageSigner:  &mockImageSigner{mockedResult: fmt.Errorf("mocked error")},
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseFailed))
+				Expect(checkpoint.Status.Signed).To(BeFalse())
+				Expect(meta.IsStatusConditionTrue(checkpoint.Status.Conditions,
+					checkpointrestorev1.CheckpointImageBuilt)).To(BeTrue())
+				Expect(meta.IsStatusConditionFalse(checkpoint.Status.Conditions,
+					checkpointrestorev1.CheckpointImagePushed)).To(BeTrue())
+				ready := meta.FindStatusCondition(checkpoint.Status.Conditions, checkpointrestorev1.ConditionReady)
+				Expect(ready).NotTo(BeNil())
+				Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+				Expect(ready.Reason).To(Equal(checkpointrestorev1.EventReasonImagePushFailed))
+			})
+
+			It("should encrypt the image for the recipients", func() {
+				privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+				Expect(err).NotTo(HaveOccurred())
+				publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+				Expect(err).NotTo(HaveOccurred())
+				publicKeyFile := filepath.Join(GinkgoT().TempDir(), "kcr.pub")
+				Expect(os.WriteFile(publicKeyFile,
+					pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0o600)).To(Succeed())
+				encryption, err := imagebuilder.NewEncryption([]string{"jwe:" + publicKeyFile})
+				Expect(err).NotTo(HaveOccurred())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+					Encryption:   encryption,
+				}
+
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(imageBuilder.builtOptions.Encryption).To(Equal(encryption))
+
+				keyID, err := imagebuilder.KeyID(&privateKey.PublicKey)
+				Expect(err).NotTo(HaveOccurred())
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
+				Expect(checkpoint.Status.EncryptionKeys).To(Equal([]string{keyID}))
+			})
+
+			It("should remove the filtered files from the checkpoint archive", func() {
+				checkpointsDirectory := writeCheckpointArchive(map[string][]byte{
+					"rootfs-diff.tar": tarContent(map[string][]byte{
+						"app/data":                            []byte("data"),
+						"etc/app/token":                       []byte("data"),
+						"var/run/secrets/kubernetes.io/token": []byte("data"),
+					}),
+				})
+
+				checkpoint.Spec.Filter = &checkpointrestorev1.CheckpointFilter{
+					ExcludePaths: []string{"/var/run/secrets"},
+					ExcludeFiles: []string{"/etc/app/*"},
+				}
+				Expect(k8sClient.Update(ctx, checkpoint)).To(Succeed())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:               k8sClient,
+					Recorder:             &record.FakeRecorder{},
+					Scheme:               k8sClient.Scheme(),
+					ImageBuilder:         &imageBuilder,
+					CheckpointsDirectory: checkpointsDirectory,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
+				Expect(checkpoint.Status.FilteredFiles).To(Equal(2))
+				Expect(filepath.Join(checkpointsDirectory, checkpointData)).To(BeAnExistingFile())
+			})
+
+			It("should verify the checkpoint archive before building the image", func() {
+				checkpointsDirectory := writeCheckpointArchive(validArchiveEntries())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:               k8sClient,
+					Recorder:             &record.FakeRecorder{},
+					Scheme:               k8sClient.Scheme(),
+					ImageBuilder:         &imageBuilder,
+					CheckpointsDirectory: checkpointsDirectory,
+					VerifyArchives:       true,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
+				Expect(checkpoint.Status.ArchiveDigest).To(HavePrefix("sha256:"))
+				Expect(meta.IsStatusConditionTrue(checkpoint.Status.Conditions,
+					checkpointrestorev1.CheckpointArchiveVerified)).To(BeTrue())
+			})
+
+			It("should fail the checkpoint when the archive is truncated", func() {
+				checkpointsDirectory := writeCheckpointArchive(validArchiveEntries())
+				archivePath := filepath.Join(checkpointsDirectory, checkpointData)
+				info, err := os.Stat(archivePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.Truncate(archivePath, info.Size()/2)).To(Succeed())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:               k8sClient,
+					Recorder:             &record.FakeRecorder{},
+					Scheme:               k8sClient.Scheme(),
+					ImageBuilder:         &imageBuilder,
+					CheckpointsDirectory: checkpointsDirectory,
+					VerifyArchives:       true,
+				}
+
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseFailed))
+				Expect(meta.IsStatusConditionFalse(checkpoint.Status.Conditions,
+					checkpointrestorev1.CheckpointArchiveVerified)).To(BeTrue())
+			})
+
+			It("should record the checkpoint archive metadata in the status", func() {
+				entries := validArchiveEntries()
+				entries["config.dump"] = []byte(`{"id":"container","rootfsImageName":"docker.io/library/redis:7",` +
+					`"rootfsImageRef":"7c2a","runtime":"crun","checkpointedTime":"2025-04-17T01:57:00Z"}`)
+				entries["spec.dump"] = []byte(`{"ociVersion":"1.0.0","annotations":{"io.container.manager":"cri-o"},` +
+					`"mounts":[{"destination":"/data","type":"bind","source":"/var/lib/kubelet/pods/data"}]}`)
+				entries["stats-dump"] = criuImage("STATS", &stats.StatsEntry{Dump: &stats.DumpStatsEntry{
+					FreezingTime:       proto.Uint32(1500),
+					FrozenTime:         proto.Uint32(250000),
+					MemdumpTime:        proto.Uint32(100000),
+					MemwriteTime:       proto.Uint32(80000),
+					PagesScanned:       proto.Uint64(4096),
+					PagesSkippedParent: proto.Uint64(0),
+					PagesWritten:       proto.Uint64(1024),
+					PagesLazy:          proto.Uint64(0),
+				}})
+				entries["checkpoint/pstree.img"] = criuImage("PSTREE",
+					&pstree.PstreeEntry{Pid: proto.Uint32(1), Ppid: proto.Uint32(0), Pgid: proto.Uint32(1),
+						Sid: proto.Uint32(1), Threads: []uint32{1, 7}},
+					&pstree.PstreeEntry{Pid: proto.Uint32(8), Ppid: proto.Uint32(1), Pgid: proto.Uint32(1),
+						Sid: proto.Uint32(1), Threads: []uint32{8}},
+				)
+				entries["checkpoint/core-1.img"] = coreImage("redis-server")
+				entries["checkpoint/core-8.img"] = coreImage("sh")
+				checkpointsDirectory := writeCheckpointArchive(entries)
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:               k8sClient,
+					Recorder:             &record.FakeRecorder{},
+					Scheme:               k8sClient.Scheme(),
+					ImageBuilder:         &imageBuilder,
+					CheckpointsDirectory: checkpointsDirectory,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseImageBuilt))
+				archive := checkpoint.Status.Archive
+				Expect(archive).NotTo(BeNil())
+				Expect(archive.Image).To(Equal("docker.io/library/redis:7"))
+				Expect(archive.ImageID).To(Equal("7c2a"))
+				Expect(archive.Engine).To(Equal("cri-o"))
+				Expect(archive.Runtime).To(Equal("crun"))
+				Expect(archive.CheckpointedAt.Time).To(BeTemporally("==", time.Date(2025, 4, 17, 1, 57, 0, 0, time.UTC)))
+				Expect(archive.CRIUImageVersion).To(Equal(int32(2)))
+				Expect(archive.DumpStatistics).NotTo(BeNil())
+				Expect(archive.DumpStatistics.FrozenTime.Duration).To(Equal(250 * time.Millisecond))
+				Expect(archive.DumpStatistics.PagesWritten).To(Equal(int64(1024)))
+				Expect(archive.Mounts).To(Equal([]checkpointrestorev1.CheckpointMount{
+					{Destination: "/data", Type: "bind", Source: "/var/lib/kubelet/pods/data"},
+				}))
+				Expect(archive.ProcessTree).NotTo(BeNil())
+				Expect(archive.ProcessTree.ProcessCount).To(Equal(int32(2)))
+				Expect(archive.ProcessTree.ThreadCount).To(Equal(int32(3)))
+				Expect(archive.ProcessTree.Processes).To(Equal([]checkpointrestorev1.CheckpointProcess{
+					{PID: 1, PPID: 0, Command: "redis-server"},
+					{PID: 8, PPID: 1, Command: "sh"},
+				}))
+			})
+
+			It("should describe the checkpoint node and the CRIU release in the image metadata", func() {
+				node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-" + util.RandStringRunes(5)}}
+				Expect(k8sClient.Create(ctx, node)).To(Succeed())
+				node.Status.NodeInfo.KernelVersion = "6.8.0-40-generic"
+				node.Status.NodeInfo.ContainerRuntimeVersion = "cri-o://1.30.1"
+				Expect(k8sClient.Status().Update(ctx, node)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, node)).To(Succeed())
+				})
+
+				entries := validArchiveEntries()
+				entries["spec.dump"] = []byte(`{"ociVersion":"1.0.0","annotations":{"io.container.manager":"cri-o"}}`)
+				entries["checkpoint/dump.log"] = []byte("(00.000000) Version: 3.19 (gitid v3.19)\n" +
+					"(00.000010) Running on node\n")
+				checkpointsDirectory := writeCheckpointArchive(entries)
+				checkpoint.Spec.NodeName = node.Name
+				Expect(k8sClient.Update(ctx, checkpoint)).To(Succeed())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:               k8sClient,
+					Recorder:             &record.FakeRecorder{},
+					Scheme:               k8sClient.Scheme(),
+					ImageBuilder:         &imageBuilder,
+					CheckpointsDirectory: checkpointsDirectory,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(imageBuilder.builtMetadata.Engine).To(Equal("cri-o"))
+				Expect(imageBuilder.builtMetadata.EngineVersion).To(Equal("1.30.1"))
+				Expect(imageBuilder.builtMetadata.KernelVersion).To(Equal("6.8.0-40-generic"))
+				Expect(imageBuilder.builtMetadata.CriuVersion).To(Equal("3.19"))
+			})
+
+			It("should ignore the resource when it was created in another node", func() {
+				imageBuilder := mockImageBuilder{mockedResult: nil}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+					NodeName:     "another-node",
+				}
+
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Requeue).To(BeFalse())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseCreated))
+			})
+
+			It("should ignore the resource when it was imported", func() {
+				checkpoint.Annotations = map[string]string{
+					checkpointrestorev1.ImportedCheckpointAnnotation: "production/test-checkpoint",
+				}
+				Expect(k8sClient.Update(ctx, checkpoint)).To(Succeed())
+
+				imageBuilder := mockImageBuilder{mockedResult: nil}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+				}
+
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Requeue).To(BeFalse())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseCreated))
+			})
+
+			It("should fail an incremental checkpoint when the image builder ignores the parent image", func() {
+				checkpoint.Spec.ParentCheckpoint = &corev1.LocalObjectReference{Name: "parent-checkpoint"}
+				Expect(k8sClient.Update(ctx, checkpoint)).To(Succeed())
+
+				imageBuilder := mockImageBuilder{}
+				controllerReconciler := &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: &imageBuilder,
+				}
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				var checkpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseFailed))
+				Expect(imageBuilder.builtMetadata).To(BeZero())
 			})
 
 			It("should fail to reconcile the resource when the image builder fails", func() {
@@ -192,6 +800,7 @@ var _ = Describe("Checkpoint Controller", func() {
 				imageBuilder := mockImageBuilder{mockedResult: fmt.Errorf("mocked error")}
 				controllerReconciler := &CheckpointReconciler{
 					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
 					Scheme:       k8sClient.Scheme(),
 					ImageBuilder: &imageBuilder,
 				}
@@ -203,8 +812,220 @@ var _ = Describe("Checkpoint Controller", func() {
 
 				var checkpoint checkpointrestorev1.Checkpoint
 				Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
-				Expect(checkpoint.Status.Phase).To(Equal("Failed"))
+				Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseFailed))
+			})
+
+			DescribeTable("should fail the checkpoint without building an archive out of its checkpointed pod",
+				func(archive string) {
+					checkpoint.Spec.CheckpointData = archive
+					Expect(k8sClient.Update(ctx, checkpoint)).To(Succeed())
+
+					imageBuilder := mockImageBuilder{}
+					controllerReconciler := &CheckpointReconciler{
+						Client:               k8sClient,
+						Recorder:             &record.FakeRecorder{},
+						Scheme:               k8sClient.Scheme(),
+						ImageBuilder:         &imageBuilder,
+						CheckpointsDirectory: GinkgoT().TempDir(),
+					}
+
+					_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+						NamespacedName: typeNamespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					var checkpoint checkpointrestorev1.Checkpoint
+					Expect(k8sClient.Get(ctx, typeNamespacedName, &checkpoint)).To(Succeed())
+					Expect(checkpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseFailed))
+					Expect(imageBuilder.builtMetadata).To(BeZero())
+				},
+				Entry("out of the checkpoints directory", "../"+checkpointData),
+				Entry("with an absolute path", "/var/lib/kubelet/checkpoints/"+checkpointData),
+				Entry("of another pod", "checkpoint-other-pod_default-kcr-example-1744851420.tar"),
+				Entry("of a pod with the same name in another namespace",
+					"checkpoint-"+checkpointPodName+"_tenant-kcr-example-1744851420.tar"),
+			)
+		})
+
+		Describe("when the images are built in the build queue", func() {
+			var (
+				imageBuilder         *mockImageBuilder
+				controllerReconciler *CheckpointReconciler
+				stopBuilds           context.CancelFunc
+			)
+
+			BeforeEach(func() {
+				imageBuilder = &mockImageBuilder{pushStarted: make(chan struct{})}
+				controllerReconciler = &CheckpointReconciler{
+					Client:       k8sClient,
+					Recorder:     &record.FakeRecorder{},
+					Scheme:       k8sClient.Scheme(),
+					ImageBuilder: imageBuilder,
+					Builds:       &BuildQueue{Workers: 1},
+				}
+			})
+
+			startBuilds := func() {
+				controllerReconciler.Builds.setup(k8sClient, controllerReconciler.buildQueued)
+				var buildsCtx context.Context
+				buildsCtx, stopBuilds = context.WithCancel(ctx)
+				go func() {
+					defer GinkgoRecover()
+					Expect(controllerReconciler.Builds.Start(buildsCtx)).To(Succeed())
+				}()
+			}
+
+			AfterEach(func() {
+				stopBuilds()
+			})
+
+			It("should set the Processing phase and cancel the build when the checkpoint is deleted", func() {
+				startBuilds()
+
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Requeue).To(BeFalse())
+				Eventually(imageBuilder.pushStarted).Should(BeClosed())
+
+				var updatedCheckpoint checkpointrestorev1.Checkpoint
+				Expect(k8sClient.Get(ctx, typeNamespacedName, &updatedCheckpoint)).To(Succeed())
+				Expect(updatedCheckpoint.Status.Phase).To(Equal(checkpointrestorev1.CheckpointPhaseProcessing))
+				ready := meta.FindStatusCondition(updatedCheckpoint.Status.Conditions,
+					checkpointrestorev1.ConditionReady)
+				Expect(ready).NotTo(BeNil())
+				Expect(ready.Reason).To(Equal(checkpointrestorev1.ConditionReasonProcessing))
+				Expect(controllerReconciler.Builds.Building(typeNamespacedName)).To(BeTrue())
+
+				By("Deleting the checkpoint being built")
+				Expect(k8sClient.Delete(ctx, &updatedCheckpoint)).To(Succeed())
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(func() bool {
+					return controllerReconciler.Builds.Building(typeNamespacedName)
+				}).Should(BeFalse())
+			})
+
+			It("should wait for the checkpoints being processed in the cluster", func() {
+				processing := &checkpointrestorev1.Checkpoint{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "processing-checkpoint",
+						Namespace: namespace,
+					},
+					Spec: checkpointrestorev1.CheckpointSpec{
+						CheckpointData: checkpointData,
+					},
+				}
+				Expect(k8sClient.Create(ctx, processing)).To(Succeed())
+				processing.Status.Phase = checkpointrestorev1.CheckpointPhaseProcessing
+				processing.Status.LastTransitionTime = &metav1.Time{Time: time.Now()}
+				Expect(k8sClient.Status().Update(ctx, processing)).To(Succeed())
+				controllerReconciler.Builds.MaxProcessing = 1
+				startBuilds()
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Consistently(func() checkpointrestorev1.CheckpointPhase {
+					var updatedCheckpoint checkpointrestorev1.Checkpoint
+					Expect(k8sClient.Get(ctx, typeNamespacedName, &updatedCheckpoint)).To(Succeed())
+					return updatedCheckpoint.Status.Phase
+				}, 2*time.Second).Should(Equal(checkpointrestorev1.CheckpointPhaseCreated))
+			})
+
+			It("should not wait for the checkpoints processed for longer than the processing timeout", func() {
+				stale := &checkpointrestorev1.Checkpoint{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "stale-checkpoint",
+						Namespace: namespace,
+					},
+					Spec: checkpointrestorev1.CheckpointSpec{
+						CheckpointData: checkpointData,
+					},
+				}
+				Expect(k8sClient.Create(ctx, stale)).To(Succeed())
+				stale.Status.Phase = checkpointrestorev1.CheckpointPhaseProcessing
+				stale.Status.LastTransitionTime = &metav1.Time{Time: time.Now().Add(-2 * time.Hour)}
+				Expect(k8sClient.Status().Update(ctx, stale)).To(Succeed())
+				controllerReconciler.Builds.MaxProcessing = 1
+				controllerReconciler.Builds.ProcessingTimeout = time.Hour
+				startBuilds()
+
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(imageBuilder.pushStarted).Should(BeClosed())
 			})
 		})
 	})
 })
+
+// validArchiveEntries returns the entries of a checkpoint archive passing the verification.
+func validArchiveEntries() map[string][]byte {
+	return map[string][]byte{
+		"config.dump":              []byte(`{"id":"container"}`),
+		"spec.dump":                []byte(`{"ociVersion":"1.0.0"}`),
+		"checkpoint/inventory.img": criuImage("INVENTORY", &inventory.InventoryEntry{ImgVersion: proto.Uint32(2)}),
+		"checkpoint/pages-1.img":   make([]byte, 64*1024),
+		"rootfs-diff.tar":          tarContent(map[string][]byte{"app/data": []byte("data")}),
+	}
+}
+
+// writeCheckpointArchive writes the checkpoint archive of the test checkpoint with the given entries in a
+// temporary directory, returning the directory.
+func writeCheckpointArchive(entries map[string][]byte) string {
+	checkpointsDirectory := GinkgoT().TempDir()
+	archivePath := filepath.Join(checkpointsDirectory, checkpointData)
+	Expect(os.WriteFile(archivePath, tarContent(entries), 0o600)).To(Succeed())
+	return checkpointsDirectory
+}
+
+// criuImage returns a CRIU image file of the given type with the given entries.
+func criuImage(imageType string, entries ...proto.Message) []byte {
+	magics := magic.LoadMagic()
+	content := binary.LittleEndian.AppendUint32(nil, uint32(magics.ByName["IMG_COMMON"]))
+	if imageType == "STATS" {
+		content = binary.LittleEndian.AppendUint32(nil, uint32(magics.ByName["IMG_SERVICE"]))
+	}
+	content = binary.LittleEndian.AppendUint32(content, uint32(magics.ByName[imageType]))
+	for _, entry := range entries {
+		payload, err := proto.Marshal(entry)
+		Expect(err).NotTo(HaveOccurred())
+		content = binary.LittleEndian.AppendUint32(content, uint32(len(payload)))
+		content = append(content, payload...)
+	}
+	return content
+}
+
+// coreImage returns the CRIU core image of a process with the given command name.
+func coreImage(command string) []byte {
+	return criuImage("CORE", &criucore.CoreEntry{
+		Mtype: criucore.CoreEntry_X86_64.Enum(),
+		Tc: &criucore.TaskCoreEntry{
+			TaskState:   proto.Uint32(1),
+			ExitCode:    proto.Uint32(0),
+			Personality: proto.Uint32(0),
+			Flags:       proto.Uint32(0),
+			BlkSigset:   proto.Uint64(0),
+			Comm:        proto.String(command),
+		},
+	})
+}
+
+// tarContent returns a tar file with the given entries.
+func tarContent(entries map[string][]byte) []byte {
+	content := &bytes.Buffer{}
+	writer := tar.NewWriter(content)
+	for name, data := range entries {
+		Expect(writer.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data))})).To(Succeed())
+		_, err := writer.Write(data)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(writer.Close()).To(Succeed())
+	return content.Bytes()
+}
@@ -18,19 +18,29 @@ package checkpointrestore
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"path/filepath"
 
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/internal/metrics"
+	"github.com/GianOrtiz/kcr/internal/tracing"
 	"github.com/GianOrtiz/kcr/pkg/checkpoint"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/access"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -39,24 +49,29 @@ type CheckpointRequestReconciler struct {
 	client.Client
 	Scheme            *runtime.Scheme
 	CheckpointService checkpoint.CheckpointService
+	// Recorder records the Events of the checkpoints on the requests, their schedules and the pods.
+	Recorder record.EventRecorder
+	// AuthorizeRequesters requires the user who created the request, recorded by the admission webhook, to
+	// have the pods/checkpoint permission in the namespace of the pod.
+	AuthorizeRequesters bool
 }
 
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointrequests,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointrequests/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointrequests/finalizers,verbs=update
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpoints,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointaccessgrants,verbs=get;list;watch
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointregistries,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=nodes/proxy,verbs=get;create;post
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods/checkpoint,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	const (
-		failedPhase     = "Failed"
-		completedPhase  = "Completed"
-		inProgressPhase = "InProgress"
-	)
-
 	log := log.FromContext(ctx)
 
 	// Fetch the CheckpointRequest
@@ -70,41 +85,120 @@ func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	}
 
 	// If it's already completed or failed, no need to process it again
-	inCompletedPhase := checkpointRequest.Status.Phase == completedPhase
-	inFailedPhase := checkpointRequest.Status.Phase == failedPhase
+	inCompletedPhase := checkpointRequest.Status.Phase == checkpointrestorev1.CheckpointRequestPhaseCompleted
+	inFailedPhase := checkpointRequest.Status.Phase == checkpointrestorev1.CheckpointRequestPhaseFailed
 	if inCompletedPhase || inFailedPhase {
 		return ctrl.Result{}, nil
 	}
 
 	// If it's not in Pending phase, and not Completed or Failed, it must be InProgress
 	// We'll just requeue it for later processing to avoid race conditions
-	if checkpointRequest.Status.Phase == inProgressPhase {
+	if checkpointRequest.Status.Phase == checkpointrestorev1.CheckpointRequestPhaseInProgress {
 		// Requeue after a short period
 		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 	}
 
+	// The checkpoint continues the trace of its trigger, when it was started by a schedule or a clone.
+	ctx, span := tracing.Start(ctx, &checkpointRequest, "checkpointrequest.reconcile", trace.WithAttributes(
+		semconv.K8SNamespaceName(req.Namespace),
+		attribute.String("kcr.checkpointrequest", req.Name),
+		semconv.K8SPodName(checkpointRequest.Spec.PodReference.Name),
+		semconv.K8SContainerName(checkpointRequest.Spec.ContainerName),
+	))
+	defer span.End()
+
 	// Update the request to InProgress and set the start time
-	checkpointRequest.Status.Phase = inProgressPhase
+	checkpointRequest.Status.Phase = checkpointrestorev1.CheckpointRequestPhaseInProgress
 	checkpointRequest.Status.StartTime = &metav1.Time{Time: time.Now()}
+	setCondition(&checkpointRequest.Status.Conditions, checkpointRequest.Generation, checkpointrestorev1.ConditionReady,
+		metav1.ConditionFalse, checkpointrestorev1.ConditionReasonPending, "Checkpointing the pod")
 	if err := r.Status().Update(ctx, &checkpointRequest); err != nil {
 		log.Error(err, "failed to update CheckpointRequest status to InProgress")
 		return ctrl.Result{}, err
 	}
+	if scheduleRef := checkpointRequest.Spec.CheckpointScheduleRef; scheduleRef != nil {
+		metrics.ObserveScheduleLag(req.Namespace, scheduleRef.Name, checkpointRequest.CreationTimestamp.Time)
+	}
 
 	// Get the pod information
 	podName := checkpointRequest.Spec.PodReference.Name
 	podNamespace := checkpointRequest.Spec.PodReference.Namespace
 	containerName := checkpointRequest.Spec.ContainerName
 
+	// The Checkpoint is created in the namespace of the request, so checkpointing the pod of another
+	// namespace requires that namespace to grant it.
+	allowed, err := access.Allowed(ctx, r, req.Namespace, checkpointrestorev1.CheckpointAccessGrantPodKind,
+		podNamespace, podName)
+	if err != nil {
+		log.Error(err, "failed to check the access to the pod", "pod", podName, "namespace", podNamespace)
+		return ctrl.Result{}, err
+	}
+	if !allowed {
+		log.Info("checkpoint of pod not granted", "pod", podName, "namespace", podNamespace)
+
+		// Update the request to Failed
+		r.fail(ctx, &checkpointRequest, nil, checkpointrestorev1.CheckpointRequestPodFound,
+			checkpointrestorev1.ConditionReasonAccessNotGranted, fmt.Sprintf(
+				"Namespace %s does not grant namespace %s to checkpoint pod %s, create a CheckpointAccessGrant",
+				podNamespace, req.Namespace, podName))
+		if updateErr := r.Status().Update(ctx, &checkpointRequest); updateErr != nil {
+			log.Error(updateErr, "failed to update CheckpointRequest status to Failed")
+			return ctrl.Result{}, updateErr
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// The operator checkpoints the pod with its own permissions, so the user who requested the checkpoint must
+	// be allowed to checkpoint the pod.
+	if r.AuthorizeRequesters {
+		authorized, message, err := r.authorizeRequester(ctx, &checkpointRequest)
+		if err != nil {
+			log.Error(err, "failed to authorize the requester", "pod", podName, "namespace", podNamespace)
+			return ctrl.Result{}, err
+		}
+		if !authorized {
+			log.Info("checkpoint of pod not authorized", "pod", podName, "namespace", podNamespace)
+
+			// Update the request to Failed
+			r.fail(ctx, &checkpointRequest, nil, checkpointrestorev1.CheckpointRequestPodFound,
+				checkpointrestorev1.ConditionReasonNotAuthorized, message)
+			if updateErr := r.Status().Update(ctx, &checkpointRequest); updateErr != nil {
+				log.Error(updateErr, "failed to update CheckpointRequest status to Failed")
+				return ctrl.Result{}, updateErr
+			}
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// Any namespace can reference the cluster CheckpointRegistries, the checkpoint is only taken when its
+	// registry allows the namespace.
+	if registryName := checkpointRequest.Spec.CheckpointRegistry; registryName != "" {
+		if _, err := getCheckpointRegistry(ctx, r, registryName, req.Namespace); err != nil {
+			if !errors.Is(err, errRegistryNotAllowed) && !apierrors.IsNotFound(err) {
+				log.Error(err, "failed to get CheckpointRegistry", "checkpointRegistry", registryName)
+				return ctrl.Result{}, err
+			}
+			log.Info("checkpoint registry not allowed", "checkpointRegistry", registryName)
+
+			// Update the request to Failed
+			r.fail(ctx, &checkpointRequest, nil, checkpointrestorev1.CheckpointRequestPodFound,
+				checkpointrestorev1.ConditionReasonRegistryNotAllowed, err.Error())
+			if updateErr := r.Status().Update(ctx, &checkpointRequest); updateErr != nil {
+				log.Error(updateErr, "failed to update CheckpointRequest status to Failed")
+				return ctrl.Result{}, updateErr
+			}
+			return ctrl.Result{}, nil
+		}
+	}
+
 	// Get the pod to obtain node information
 	var pod corev1.Pod
 	if err := r.Get(ctx, client.ObjectKey{Name: podName, Namespace: podNamespace}, &pod); err != nil {
 		log.Error(err, "failed to get pod", "pod", podName, "namespace", podNamespace)
 
 		// Update the request to Failed
-		checkpointRequest.Status.Phase = failedPhase
-		checkpointRequest.Status.CompletionTime = &metav1.Time{Time: time.Now()}
-		checkpointRequest.Status.Message = fmt.Sprintf("Failed to get pod: %v", err)
+		r.fail(ctx, &checkpointRequest, nil, checkpointrestorev1.CheckpointRequestPodFound,
+			checkpointrestorev1.ConditionReasonPodNotFound, fmt.Sprintf("Failed to get pod: %v", err))
 		if updateErr := r.Status().Update(ctx, &checkpointRequest); updateErr != nil {
 			log.Error(updateErr, "failed to update CheckpointRequest status to Failed")
 		}
@@ -113,15 +207,23 @@ func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	}
 
 	nodeName := pod.Spec.NodeName
+	setCondition(&checkpointRequest.Status.Conditions, checkpointRequest.Generation,
+		checkpointrestorev1.CheckpointRequestPodFound, metav1.ConditionTrue, checkpointrestorev1.ConditionReasonPodFound,
+		fmt.Sprintf("Pod %s/%s runs on node %s", podNamespace, podName, nodeName))
 	log.Info("checkpointing pod", "nodeName", nodeName, "pod", podName, "namespace", podNamespace, "container", containerName)
-	checkpointFilePath, err := r.CheckpointService.Checkpoint(nodeName, podName, podNamespace, containerName, ctx)
+	r.recordEvent(&checkpointRequest, &pod, corev1.EventTypeNormal, checkpointrestorev1.EventReasonCheckpointStarted,
+		fmt.Sprintf("Checkpointing container %s of pod %s/%s", containerName, podNamespace, podName))
+	checkpointStart := time.Now()
+	kubeletCtx, kubeletSpan := tracing.Start(ctx, nil, "kubelet.checkpoint",
+		trace.WithAttributes(semconv.K8SNodeName(nodeName)))
+	checkpointFilePath, err := r.CheckpointService.Checkpoint(nodeName, podName, podNamespace, containerName, kubeletCtx)
+	tracing.End(kubeletSpan, err)
 	if err != nil {
 		log.Error(err, "failed to checkpoint pod")
 
 		// Update the request to Failed
-		checkpointRequest.Status.Phase = failedPhase
-		checkpointRequest.Status.CompletionTime = &metav1.Time{Time: time.Now()}
-		checkpointRequest.Status.Message = fmt.Sprintf("Failed to checkpoint pod: %v", err)
+		r.fail(ctx, &checkpointRequest, &pod, checkpointrestorev1.CheckpointRequestCheckpointed,
+			checkpointrestorev1.EventReasonCheckpointFailed, fmt.Sprintf("Failed to checkpoint pod: %v", err))
 		if updateErr := r.Status().Update(ctx, &checkpointRequest); updateErr != nil {
 			log.Error(updateErr, "failed to update CheckpointRequest status to Failed")
 		}
@@ -129,6 +231,7 @@ func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return ctrl.Result{}, err
 	}
 	log.Info("checkpoint completed", "pod", podName)
+	metrics.ObserveCheckpointStage(req.Namespace, metrics.StageKubelet, checkpointStart)
 
 	checkpointFile := filepath.Base(checkpointFilePath)
 	// Create a Checkpoint resource
@@ -152,9 +255,10 @@ func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Re
 			CheckpointID:        checkpointID,
 			NodeName:            pod.Spec.NodeName,
 			ContainerName:       containerName,
+			CheckpointRegistry:  checkpointRequest.Spec.CheckpointRegistry,
 		},
 		Status: checkpointrestorev1.CheckpointStatus{
-			Phase: "Created",
+			Phase: checkpointrestorev1.CheckpointPhaseCreated,
 		},
 	}
 
@@ -169,6 +273,8 @@ func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Re
 			Namespace: checkpointRequest.Spec.CheckpointScheduleRef.Namespace,
 		}, &checkpointSchedule); err == nil {
 			checkpoint.Spec.Schedule = checkpointSchedule.Spec.Schedule
+			checkpoint.Spec.Compression = checkpointSchedule.Spec.Compression
+			checkpoint.Spec.Filter = checkpointSchedule.Spec.Filter.DeepCopy()
 			checkpoint.Spec.Selector = &metav1.LabelSelector{
 				MatchLabels:      checkpointSchedule.Spec.Selector.MatchLabels,
 				MatchExpressions: checkpointSchedule.Spec.Selector.MatchExpressions,
@@ -178,14 +284,24 @@ func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		}
 	}
 
+	// Chain the checkpoint to the last checkpoint image of the container, so the new image only adds the
+	// files that changed since then.
+	if checkpointRequest.Spec.Incremental {
+		parent, err := r.lastBuiltCheckpoint(ctx, req.Namespace, podName, podNamespace, containerName)
+		if err != nil {
+			log.Error(err, "failed to find the parent checkpoint, creating a full checkpoint")
+		} else if parent != nil {
+			checkpoint.Spec.ParentCheckpoint = &corev1.LocalObjectReference{Name: parent.Name}
+		}
+	}
+
 	// Set the controller reference to the CheckpointRequest
 	if err := ctrl.SetControllerReference(&checkpointRequest, checkpoint, r.Scheme); err != nil {
 		log.Error(err, "failed to set controller reference for Checkpoint")
 
 		// Update the request to Failed
-		checkpointRequest.Status.Phase = failedPhase
-		checkpointRequest.Status.CompletionTime = &metav1.Time{Time: time.Now()}
-		checkpointRequest.Status.Message = fmt.Sprintf("Failed to set controller reference: %v", err)
+		r.fail(ctx, &checkpointRequest, &pod, checkpointrestorev1.CheckpointRequestCheckpointed,
+			checkpointrestorev1.EventReasonCheckpointFailed, fmt.Sprintf("Failed to set controller reference: %v", err))
 		if updateErr := r.Status().Update(ctx, &checkpointRequest); updateErr != nil {
 			log.Error(updateErr, "failed to update CheckpointRequest status to Failed")
 		}
@@ -193,14 +309,14 @@ func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return ctrl.Result{}, err
 	}
 
-	// Create the Checkpoint resource
+	// Create the Checkpoint resource, its image build continues the trace of the request
+	tracing.Inject(ctx, checkpoint)
 	if err := r.Create(ctx, checkpoint); err != nil {
 		log.Error(err, "failed to create Checkpoint resource")
 
 		// Update the request to Failed
-		checkpointRequest.Status.Phase = failedPhase
-		checkpointRequest.Status.CompletionTime = &metav1.Time{Time: time.Now()}
-		checkpointRequest.Status.Message = fmt.Sprintf("Failed to create Checkpoint resource: %v", err)
+		r.fail(ctx, &checkpointRequest, &pod, checkpointrestorev1.CheckpointRequestCheckpointed,
+			checkpointrestorev1.EventReasonCheckpointFailed, fmt.Sprintf("Failed to create Checkpoint resource: %v", err))
 		if updateErr := r.Status().Update(ctx, &checkpointRequest); updateErr != nil {
 			log.Error(updateErr, "failed to update CheckpointRequest status to Failed")
 		}
@@ -208,11 +324,20 @@ func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Re
 		return ctrl.Result{}, err
 	}
 	log.Info("created checkpoint resource", "checkpoint", checkpoint.Name)
+	message := fmt.Sprintf("Checkpointed container %s of pod %s/%s in Checkpoint %s", containerName, podNamespace,
+		podName, checkpoint.Name)
+	r.recordEvent(&checkpointRequest, &pod, corev1.EventTypeNormal, checkpointrestorev1.EventReasonCheckpointSucceeded,
+		message)
 
 	// Update the request to Completed
-	checkpointRequest.Status.Phase = completedPhase
+	checkpointRequest.Status.Phase = checkpointrestorev1.CheckpointRequestPhaseCompleted
 	checkpointRequest.Status.CompletionTime = &metav1.Time{Time: time.Now()}
 	checkpointRequest.Status.Message = "Checkpoint created successfully"
+	setCondition(&checkpointRequest.Status.Conditions, checkpointRequest.Generation,
+		checkpointrestorev1.CheckpointRequestCheckpointed, metav1.ConditionTrue,
+		checkpointrestorev1.EventReasonCheckpointSucceeded, message)
+	setCondition(&checkpointRequest.Status.Conditions, checkpointRequest.Generation, checkpointrestorev1.ConditionReady,
+		metav1.ConditionTrue, checkpointrestorev1.ConditionReasonCompleted, "Checkpoint created successfully")
 	checkpointRequest.Status.Checkpoint = &corev1.ObjectReference{
 		Kind:       "Checkpoint",
 		Name:       checkpoint.Name,
@@ -229,6 +354,145 @@ func (r *CheckpointRequestReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	return ctrl.Result{}, nil
 }
 
+// authorizeRequester returns whether the requester of the CheckpointRequest may checkpoint its pod, and the
+// message to fail the request with when it may not.
+func (r *CheckpointRequestReconciler) authorizeRequester(
+	ctx context.Context, checkpointRequest *checkpointrestorev1.CheckpointRequest,
+) (bool, string, error) {
+	podName := checkpointRequest.Spec.PodReference.Name
+	podNamespace := checkpointRequest.Spec.PodReference.Namespace
+
+	requester, ok, err := access.Requester(checkpointRequest)
+	if err != nil {
+		return false, fmt.Sprintf("Invalid requester: %v", err), nil
+	}
+	if !ok {
+		return false, fmt.Sprintf("The request has no %s annotation, it must be created through the admission webhook",
+			checkpointrestorev1.RequesterAnnotation), nil
+	}
+	allowed, reason, err := access.CanCheckpoint(ctx, r.Client, requester, podNamespace, podName)
+	if err != nil {
+		return false, "", err
+	}
+	if !allowed {
+		message := fmt.Sprintf("User %s cannot create %s/%s of pod %s in namespace %s", requester.Username,
+			access.CheckpointResource, access.CheckpointSubresource, podName, podNamespace)
+		if reason != "" {
+			message += ": " + reason
+		}
+		return false, message, nil
+	}
+	return true, "", nil
+}
+
+// recordEvent records the event on the CheckpointRequest, on its CheckpointSchedule and on the pod, when it
+// was found.
+func (r *CheckpointRequestReconciler) recordEvent(
+	checkpointRequest *checkpointrestorev1.CheckpointRequest, pod *corev1.Pod, eventtype, reason, message string,
+) {
+	r.Recorder.Event(checkpointRequest, eventtype, reason, message)
+	if scheduleRef := checkpointRequest.Spec.CheckpointScheduleRef; scheduleRef != nil {
+		scheduleRef = scheduleRef.DeepCopy()
+		if scheduleRef.APIVersion == "" {
+			scheduleRef.APIVersion = checkpointrestorev1.GroupVersion.String()
+		}
+		r.Recorder.Event(scheduleRef, eventtype, reason, message)
+	}
+	if pod != nil {
+		r.Recorder.Event(pod, eventtype, reason, message)
+	}
+}
+
+// fail sets the request to the Failed phase with the message, sets the condition of the failed stage and the
+// Ready condition to False with the reason, and records the failure. The caller updates the status.
+func (r *CheckpointRequestReconciler) fail(
+	ctx context.Context,
+	checkpointRequest *checkpointrestorev1.CheckpointRequest,
+	pod *corev1.Pod,
+	conditionType, reason, message string,
+) {
+	checkpointRequest.Status.Phase = checkpointrestorev1.CheckpointRequestPhaseFailed
+	checkpointRequest.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	checkpointRequest.Status.Message = message
+	setCondition(&checkpointRequest.Status.Conditions, checkpointRequest.Generation, conditionType,
+		metav1.ConditionFalse, reason, message)
+	setCondition(&checkpointRequest.Status.Conditions, checkpointRequest.Generation, checkpointrestorev1.ConditionReady,
+		metav1.ConditionFalse, reason, message)
+	r.recordFailure(ctx, checkpointRequest, pod, message)
+}
+
+// recordFailure records the failure of the checkpoint in a Warning Event, on the span of the request and in
+// the metrics.
+func (r *CheckpointRequestReconciler) recordFailure(
+	ctx context.Context, checkpointRequest *checkpointrestorev1.CheckpointRequest, pod *corev1.Pod, message string,
+) {
+	reason := checkpointrestorev1.EventReasonCheckpointFailed
+	r.recordEvent(checkpointRequest, pod, corev1.EventTypeWarning, reason, message)
+	tracing.Fail(trace.SpanFromContext(ctx), errors.New(message))
+	metrics.CheckpointFailed(checkpointRequest.Namespace, scheduleName(checkpointRequest.Spec.CheckpointScheduleRef),
+		reason)
+}
+
+// setCondition sets the condition of the type in conditions, observing the generation of its object.
+func setCondition(
+	conditions *[]metav1.Condition, generation int64, conditionType string, status metav1.ConditionStatus,
+	reason, message string,
+) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// scheduleName returns the name of the CheckpointSchedule of the reference, empty when there is none.
+func scheduleName(scheduleRef *corev1.ObjectReference) string {
+	if scheduleRef == nil {
+		return ""
+	}
+	return scheduleRef.Name
+}
+
+// requesterAnnotations returns the annotations of a CheckpointRequest created for the owner, which carry the
+// requester of the owner so that the request is authorized against the user who created the owner.
+func requesterAnnotations(owner client.Object) map[string]string {
+	requester, ok := owner.GetAnnotations()[checkpointrestorev1.RequesterAnnotation]
+	if !ok {
+		return nil
+	}
+	return map[string]string{checkpointrestorev1.RequesterAnnotation: requester}
+}
+
+// lastBuiltCheckpoint returns the most recent checkpoint of the container with a built image, or nil when
+// the container has none.
+func (r *CheckpointRequestReconciler) lastBuiltCheckpoint(
+	ctx context.Context, namespace, podName, podNamespace, containerName string,
+) (*checkpointrestorev1.Checkpoint, error) {
+	var checkpoints checkpointrestorev1.CheckpointList
+	if err := r.List(ctx, &checkpoints, client.InNamespace(namespace), client.MatchingLabels{
+		"pod":       podName,
+		"pod-ns":    podNamespace,
+		"container": containerName,
+	}); err != nil {
+		return nil, err
+	}
+
+	var last *checkpointrestorev1.Checkpoint
+	for i := range checkpoints.Items {
+		checkpoint := &checkpoints.Items[i]
+		if checkpoint.Status.Phase != checkpointrestorev1.CheckpointPhaseImageBuilt ||
+			checkpoint.Spec.CheckpointTimestamp == nil {
+			continue
+		}
+		if last == nil || last.Spec.CheckpointTimestamp.Before(checkpoint.Spec.CheckpointTimestamp) {
+			last = checkpoint
+		}
+	}
+	return last, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CheckpointRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
@@ -22,14 +22,23 @@ import (
 	"time"
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/internal/tracing"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/access"
 	"github.com/GianOrtiz/kcr/pkg/util"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -48,6 +57,7 @@ var _ = Describe("CheckpointRequest Controller", func() {
 			pod               *corev1.Pod
 			namespace         string
 			checkpointService *mockCheckpointService
+			recorder          *record.FakeRecorder
 		)
 
 		BeforeEach(func() {
@@ -88,10 +98,12 @@ var _ = Describe("CheckpointRequest Controller", func() {
 			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
 
 			// Create our test controller with the fake client and our mock service
+			recorder = record.NewFakeRecorder(20)
 			controller = &CheckpointRequestReconciler{
 				Client:            k8sClient,
 				Scheme:            s,
 				CheckpointService: checkpointService,
+				Recorder:          recorder,
 			}
 		})
 
@@ -129,7 +141,7 @@ var _ = Describe("CheckpointRequest Controller", func() {
 				// Check that the request status was not updated
 				updatedRequest := &checkpointrestorev1.CheckpointRequest{}
 				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: requestName, Namespace: namespace}, updatedRequest)).To(Succeed())
-				Expect(updatedRequest.Status.Phase).To(Equal("Completed"))
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseCompleted))
 			})
 		})
 
@@ -166,7 +178,7 @@ var _ = Describe("CheckpointRequest Controller", func() {
 				// Check that the request status was not updated
 				updatedRequest := &checkpointrestorev1.CheckpointRequest{}
 				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: requestName, Namespace: namespace}, updatedRequest)).To(Succeed())
-				Expect(updatedRequest.Status.Phase).To(Equal("Failed"))
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseFailed))
 			})
 		})
 
@@ -203,7 +215,7 @@ var _ = Describe("CheckpointRequest Controller", func() {
 				// Check that the request status was not updated
 				updatedRequest := &checkpointrestorev1.CheckpointRequest{}
 				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: requestName, Namespace: namespace}, updatedRequest)).To(Succeed())
-				Expect(updatedRequest.Status.Phase).To(Equal("InProgress"))
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseInProgress))
 			})
 		})
 
@@ -236,7 +248,17 @@ var _ = Describe("CheckpointRequest Controller", func() {
 				// Check that the request status was updated
 				updatedRequest := &checkpointrestorev1.CheckpointRequest{}
 				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: requestName, Namespace: namespace}, updatedRequest)).To(Succeed())
-				Expect(updatedRequest.Status.Phase).To(Equal("Completed"))
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseCompleted))
+				for _, conditionType := range []string{
+					checkpointrestorev1.CheckpointRequestPodFound,
+					checkpointrestorev1.CheckpointRequestCheckpointed,
+					checkpointrestorev1.ConditionReady,
+				} {
+					condition := meta.FindStatusCondition(updatedRequest.Status.Conditions, conditionType)
+					Expect(condition).NotTo(BeNil(), conditionType)
+					Expect(condition.Status).To(Equal(metav1.ConditionTrue), conditionType)
+					Expect(condition.ObservedGeneration).To(Equal(updatedRequest.Generation), conditionType)
+				}
 
 				// Check that a Checkpoint was created
 				checkpointList := &checkpointrestorev1.CheckpointList{}
@@ -248,6 +270,386 @@ var _ = Describe("CheckpointRequest Controller", func() {
 				})).To(Succeed())
 				Expect(checkpointList.Items).To(HaveLen(1))
 				Expect(checkpointList.Items[0].ObjectMeta.OwnerReferences[0].Name).To(Equal(requestName))
+
+				// Check that the checkpoint was reported on the request
+				Expect(recorder.Events).To(Receive(ContainSubstring(checkpointrestorev1.EventReasonCheckpointStarted)))
+				Expect(recorder.Events).To(Receive(ContainSubstring(checkpointrestorev1.EventReasonCheckpointStarted)))
+				Expect(recorder.Events).To(Receive(ContainSubstring(checkpointrestorev1.EventReasonCheckpointSucceeded)))
+			})
+		})
+
+		Describe("When the CheckpointRegistry of the request does not allow its namespace", func() {
+			const registryName = "team-b-registry"
+
+			BeforeEach(func() {
+				checkpointRegistry := &checkpointrestorev1.CheckpointRegistry{
+					ObjectMeta: metav1.ObjectMeta{Name: registryName},
+					Spec: checkpointrestorev1.CheckpointRegistrySpec{
+						URL:               "registry.example.com/team-b",
+						AllowedNamespaces: []string{"team-b"},
+					},
+				}
+				Expect(k8sClient.Create(ctx, checkpointRegistry)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, checkpointRegistry)).To(Succeed())
+				})
+			})
+
+			It("should fail without checkpointing the pod", func() {
+				checkpointRequest := checkpointrestorev1.CheckpointRequest{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      requestName,
+						Namespace: namespace,
+					},
+					Spec: checkpointrestorev1.CheckpointRequestSpec{
+						PodReference: checkpointrestorev1.PodReference{
+							Name:      podName,
+							Namespace: namespace,
+						},
+						ContainerName:      containerName,
+						CheckpointRegistry: registryName,
+					},
+				}
+				Expect(k8sClient.Create(ctx, &checkpointRequest)).To(Succeed())
+
+				_, err := controller.Reconcile(ctx, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      requestName,
+						Namespace: namespace,
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				updatedRequest := &checkpointrestorev1.CheckpointRequest{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: requestName, Namespace: namespace},
+					updatedRequest)).To(Succeed())
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseFailed))
+				podFound := meta.FindStatusCondition(updatedRequest.Status.Conditions,
+					checkpointrestorev1.CheckpointRequestPodFound)
+				Expect(podFound).NotTo(BeNil())
+				Expect(podFound.Reason).To(Equal(checkpointrestorev1.ConditionReasonRegistryNotAllowed))
+
+				checkpointList := &checkpointrestorev1.CheckpointList{}
+				Expect(k8sClient.List(ctx, checkpointList, client.InNamespace(namespace))).To(Succeed())
+				Expect(checkpointList.Items).To(BeEmpty())
+			})
+		})
+
+		Describe("When the CheckpointRequest carries a trace context", func() {
+			const (
+				traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+				parentSpanID = "00f067aa0ba902b7"
+			)
+			var exporter *tracetest.InMemoryExporter
+
+			BeforeEach(func() {
+				exporter = tracetest.NewInMemoryExporter()
+				shutdown, err := tracing.Setup(ctx, tracing.Options{ServiceName: "kcr-test"}, exporter)
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(otel.SetTracerProvider, noop.NewTracerProvider())
+				DeferCleanup(shutdown)
+			})
+
+			It("should continue the trace in its spans and in the Checkpoint", func() {
+				checkpointRequest := checkpointrestorev1.CheckpointRequest{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      requestName,
+						Namespace: namespace,
+						Annotations: map[string]string{
+							checkpointrestorev1.TraceContextAnnotation: "00-" + traceID + "-" + parentSpanID + "-01",
+						},
+					},
+					Spec: checkpointrestorev1.CheckpointRequestSpec{
+						PodReference: checkpointrestorev1.PodReference{
+							Name:      podName,
+							Namespace: namespace,
+						},
+						ContainerName: containerName,
+					},
+				}
+				Expect(k8sClient.Create(ctx, &checkpointRequest)).To(Succeed())
+
+				_, err := controller.Reconcile(ctx, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      requestName,
+						Namespace: namespace,
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				spans := map[string]tracetest.SpanStub{}
+				for _, span := range exporter.GetSpans() {
+					Expect(span.SpanContext.TraceID().String()).To(Equal(traceID))
+					spans[span.Name] = span
+				}
+				Expect(spans).To(HaveKey("checkpointrequest.reconcile"))
+				Expect(spans).To(HaveKey("kubelet.checkpoint"))
+				requestSpan := spans["checkpointrequest.reconcile"]
+				Expect(requestSpan.Parent.SpanID().String()).To(Equal(parentSpanID))
+				Expect(spans["kubelet.checkpoint"].Parent.SpanID()).To(Equal(requestSpan.SpanContext.SpanID()))
+
+				checkpointList := &checkpointrestorev1.CheckpointList{}
+				Expect(k8sClient.List(ctx, checkpointList, client.InNamespace(namespace))).To(Succeed())
+				Expect(checkpointList.Items).To(HaveLen(1))
+				Expect(checkpointList.Items[0].Annotations).To(HaveKeyWithValue(checkpointrestorev1.TraceContextAnnotation,
+					"00-"+traceID+"-"+requestSpan.SpanContext.SpanID().String()+"-01"))
+			})
+		})
+
+		Describe("When the pod is in another namespace", func() {
+			var requestNamespace string
+
+			BeforeEach(func() {
+				requestNamespace = "ns-" + util.RandStringRunes(5)
+				Expect(k8sClient.Create(ctx, &corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: requestNamespace,
+					},
+				})).To(Succeed())
+				Expect(k8sClient.Create(ctx, &checkpointrestorev1.CheckpointRequest{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      requestName,
+						Namespace: requestNamespace,
+					},
+					Spec: checkpointrestorev1.CheckpointRequestSpec{
+						PodReference: checkpointrestorev1.PodReference{
+							Name:      podName,
+							Namespace: namespace,
+						},
+						ContainerName: containerName,
+					},
+				})).To(Succeed())
+			})
+
+			It("should fail when the namespace of the pod does not grant it", func() {
+				_, err := controller.Reconcile(ctx, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      requestName,
+						Namespace: requestNamespace,
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				updatedRequest := &checkpointrestorev1.CheckpointRequest{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: requestName, Namespace: requestNamespace},
+					updatedRequest)).To(Succeed())
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseFailed))
+				Expect(updatedRequest.Status.Message).To(ContainSubstring("CheckpointAccessGrant"))
+				podFound := meta.FindStatusCondition(updatedRequest.Status.Conditions,
+					checkpointrestorev1.CheckpointRequestPodFound)
+				Expect(podFound).NotTo(BeNil())
+				Expect(podFound.Status).To(Equal(metav1.ConditionFalse))
+				Expect(podFound.Reason).To(Equal(checkpointrestorev1.ConditionReasonAccessNotGranted))
+				Expect(meta.IsStatusConditionFalse(updatedRequest.Status.Conditions,
+					checkpointrestorev1.ConditionReady)).To(BeTrue())
+			})
+
+			It("should create the Checkpoint in the namespace of the request when granted", func() {
+				Expect(k8sClient.Create(ctx, &checkpointrestorev1.CheckpointAccessGrant{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "grant",
+						Namespace: namespace,
+					},
+					Spec: checkpointrestorev1.CheckpointAccessGrantSpec{
+						From: []checkpointrestorev1.CheckpointAccessGrantFrom{{Namespace: requestNamespace}},
+						To: []checkpointrestorev1.CheckpointAccessGrantTo{{
+							Kind: checkpointrestorev1.CheckpointAccessGrantPodKind,
+							Name: podName,
+						}},
+					},
+				})).To(Succeed())
+
+				_, err := controller.Reconcile(ctx, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      requestName,
+						Namespace: requestNamespace,
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				updatedRequest := &checkpointrestorev1.CheckpointRequest{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: requestName, Namespace: requestNamespace},
+					updatedRequest)).To(Succeed())
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseCompleted))
+				Expect(updatedRequest.Status.Checkpoint.Namespace).To(Equal(requestNamespace))
+
+				checkpoint := &checkpointrestorev1.Checkpoint{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{
+					Name:      updatedRequest.Status.Checkpoint.Name,
+					Namespace: requestNamespace,
+				}, checkpoint)).To(Succeed())
+				Expect(checkpoint.Labels).To(HaveKeyWithValue("pod-ns", namespace))
+			})
+		})
+
+		Describe("When the requesters are authorized", func() {
+			const requesterName = "requester"
+
+			BeforeEach(func() {
+				controller.AuthorizeRequesters = true
+			})
+
+			createRequest := func(annotations map[string]string) {
+				Expect(k8sClient.Create(ctx, &checkpointrestorev1.CheckpointRequest{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        requestName,
+						Namespace:   namespace,
+						Annotations: annotations,
+					},
+					Spec: checkpointrestorev1.CheckpointRequestSpec{
+						PodReference: checkpointrestorev1.PodReference{
+							Name:      podName,
+							Namespace: namespace,
+						},
+						ContainerName: containerName,
+					},
+				})).To(Succeed())
+			}
+
+			requesterAnnotations := func() map[string]string {
+				requester, err := access.RequesterValue(authenticationv1.UserInfo{
+					Username: requesterName,
+					Groups:   []string{"system:authenticated"},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				return map[string]string{checkpointrestorev1.RequesterAnnotation: requester}
+			}
+
+			reconcileRequest := func() *checkpointrestorev1.CheckpointRequest {
+				_, err := controller.Reconcile(ctx, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      requestName,
+						Namespace: namespace,
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				updatedRequest := &checkpointrestorev1.CheckpointRequest{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: requestName, Namespace: namespace},
+					updatedRequest)).To(Succeed())
+				return updatedRequest
+			}
+
+			It("should fail when the request has no requester", func() {
+				createRequest(nil)
+
+				updatedRequest := reconcileRequest()
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseFailed))
+				Expect(updatedRequest.Status.Message).To(ContainSubstring(checkpointrestorev1.RequesterAnnotation))
+			})
+
+			It("should fail when the requester cannot checkpoint the pod", func() {
+				createRequest(requesterAnnotations())
+
+				updatedRequest := reconcileRequest()
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseFailed))
+				Expect(updatedRequest.Status.Message).To(ContainSubstring("pods/checkpoint"))
+				Expect(updatedRequest.Status.Message).To(ContainSubstring(requesterName))
+			})
+
+			It("should create a Checkpoint when the requester can checkpoint the pod", func() {
+				Expect(k8sClient.Create(ctx, &rbacv1.Role{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "pod-checkpointer",
+						Namespace: namespace,
+					},
+					Rules: []rbacv1.PolicyRule{{
+						APIGroups: []string{""},
+						Resources: []string{"pods/checkpoint"},
+						Verbs:     []string{"create"},
+					}},
+				})).To(Succeed())
+				Expect(k8sClient.Create(ctx, &rbacv1.RoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "pod-checkpointer",
+						Namespace: namespace,
+					},
+					RoleRef: rbacv1.RoleRef{
+						APIGroup: rbacv1.GroupName,
+						Kind:     "Role",
+						Name:     "pod-checkpointer",
+					},
+					Subjects: []rbacv1.Subject{{
+						APIGroup: rbacv1.GroupName,
+						Kind:     rbacv1.UserKind,
+						Name:     requesterName,
+					}},
+				})).To(Succeed())
+				createRequest(requesterAnnotations())
+
+				// The RBAC authorizer sees the role binding once its informers observe it.
+				Eventually(func(g Gomega) {
+					allowed, _, err := access.CanCheckpoint(ctx, k8sClient, authenticationv1.UserInfo{
+						Username: requesterName,
+					}, namespace, podName)
+					g.Expect(err).ToNot(HaveOccurred())
+					g.Expect(allowed).To(BeTrue())
+				}).Should(Succeed())
+
+				updatedRequest := reconcileRequest()
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseCompleted))
+			})
+		})
+
+		Describe("When the CheckpointRequest is incremental", func() {
+			const previousCheckpointName = "previous-checkpoint"
+
+			BeforeEach(func() {
+				previousCheckpoint := &checkpointrestorev1.Checkpoint{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      previousCheckpointName,
+						Namespace: namespace,
+						Labels: map[string]string{
+							"pod":       podName,
+							"pod-ns":    namespace,
+							"container": containerName,
+						},
+					},
+					Spec: checkpointrestorev1.CheckpointSpec{
+						CheckpointTimestamp: &metav1.Time{Time: time.Now().Add(-time.Hour)},
+						ContainerName:       containerName,
+					},
+				}
+				Expect(k8sClient.Create(ctx, previousCheckpoint)).To(Succeed())
+				previousCheckpoint.Status.Phase = "ImageBuilt"
+				Expect(k8sClient.Status().Update(ctx, previousCheckpoint)).To(Succeed())
+			})
+
+			It("should create a Checkpoint with the last built checkpoint as parent", func() {
+				checkpointRequest := checkpointrestorev1.CheckpointRequest{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      requestName,
+						Namespace: namespace,
+					},
+					Spec: checkpointrestorev1.CheckpointRequestSpec{
+						PodReference: checkpointrestorev1.PodReference{
+							Name:      podName,
+							Namespace: namespace,
+						},
+						ContainerName: containerName,
+						Incremental:   true,
+					},
+				}
+				Expect(k8sClient.Create(ctx, &checkpointRequest)).To(Succeed())
+
+				_, err := controller.Reconcile(ctx, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Name:      requestName,
+						Namespace: namespace,
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				checkpointList := &checkpointrestorev1.CheckpointList{}
+				Expect(k8sClient.List(ctx, checkpointList, &client.ListOptions{
+					Namespace: namespace,
+					LabelSelector: labels.SelectorFromSet(map[string]string{
+						"checkpoint-request-name": requestName,
+					}),
+				})).To(Succeed())
+				Expect(checkpointList.Items).To(HaveLen(1))
+				Expect(checkpointList.Items[0].Spec.ParentCheckpoint).NotTo(BeNil())
+				Expect(checkpointList.Items[0].Spec.ParentCheckpoint.Name).To(Equal(previousCheckpointName))
 			})
 		})
 
@@ -284,7 +686,15 @@ var _ = Describe("CheckpointRequest Controller", func() {
 				// Check that the request status was updated
 				updatedRequest := &checkpointrestorev1.CheckpointRequest{}
 				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: requestName, Namespace: namespace}, updatedRequest)).To(Succeed())
-				Expect(updatedRequest.Status.Phase).To(Equal("Failed"))
+				Expect(updatedRequest.Status.Phase).To(Equal(checkpointrestorev1.CheckpointRequestPhaseFailed))
+				ready := meta.FindStatusCondition(updatedRequest.Status.Conditions, checkpointrestorev1.ConditionReady)
+				Expect(ready).NotTo(BeNil())
+				Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+				Expect(ready.Reason).To(Equal(checkpointrestorev1.EventReasonCheckpointFailed))
+				Expect(meta.IsStatusConditionTrue(updatedRequest.Status.Conditions,
+					checkpointrestorev1.CheckpointRequestPodFound)).To(BeTrue())
+				Expect(meta.IsStatusConditionFalse(updatedRequest.Status.Conditions,
+					checkpointrestorev1.CheckpointRequestCheckpointed)).To(BeTrue())
 
 				// Check that a Checkpoint was not created
 				checkpointList := &checkpointrestorev1.CheckpointList{}
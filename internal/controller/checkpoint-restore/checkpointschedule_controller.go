@@ -21,6 +21,7 @@ import (
 
 	"github.com/robfig/cron/v3"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -33,13 +34,18 @@ type CheckpointScheduleReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	CronJobs map[string]*cron.Cron
+	// Recorder records the Events of the checkpoints requested by the schedules.
+	Recorder record.EventRecorder
 }
 
-func NewCheckpointScheduleReconciler(client client.Client, scheme *runtime.Scheme) *CheckpointScheduleReconciler {
+func NewCheckpointScheduleReconciler(
+	client client.Client, scheme *runtime.Scheme, recorder record.EventRecorder,
+) *CheckpointScheduleReconciler {
 	return &CheckpointScheduleReconciler{
 		Client:   client,
 		Scheme:   scheme,
 		CronJobs: make(map[string]*cron.Cron),
+		Recorder: recorder,
 	}
 }
 
@@ -47,6 +53,9 @@ func NewCheckpointScheduleReconciler(client client.Client, scheme *runtime.Schem
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointschedules/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointschedules/finalizers,verbs=update
 // +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointrequests,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointregistries,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -23,6 +23,7 @@ import (
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -73,7 +74,7 @@ var _ = Describe("CheckpointSchedule Controller", func() {
 
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
-			controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme())
+			controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme(), &record.FakeRecorder{})
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: typeNamespacedName,
@@ -86,7 +87,7 @@ var _ = Describe("CheckpointSchedule Controller", func() {
 
 		It("should update the cron job when the schedule changes", func() {
 			By("Reconciling the created resource")
-			controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme())
+			controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme(), &record.FakeRecorder{})
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: typeNamespacedName,
@@ -5,19 +5,32 @@ import (
 	"fmt"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/labels"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/internal/tracing"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func (r *CheckpointScheduleReconciler) CronJob(ctx context.Context, req ctrl.Request) error {
+func (r *CheckpointScheduleReconciler) CronJob(ctx context.Context, req ctrl.Request) (err error) {
 	log := log.FromContext(ctx)
 
+	// Every run of the schedule starts the trace of the checkpoint it requests.
+	ctx, span := tracing.Start(ctx, nil, "checkpointschedule.run", trace.WithNewRoot(), trace.WithAttributes(
+		semconv.K8SNamespaceName(req.Namespace),
+		attribute.String("kcr.checkpointschedule", req.Name),
+	))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	var currentSchedule checkpointrestorev1.CheckpointSchedule
 	if err := r.Get(ctx, req.NamespacedName, &currentSchedule); err != nil {
 		log.Error(err, "failed to get current schedule")
@@ -25,6 +38,16 @@ func (r *CheckpointScheduleReconciler) CronJob(ctx context.Context, req ctrl.Req
 		return err
 	}
 
+	// Nothing is checkpointed when the CheckpointRegistry of the schedule does not allow its namespace.
+	if registryName := currentSchedule.Spec.CheckpointRegistry; registryName != "" {
+		if _, err := getCheckpointRegistry(ctx, r, registryName, req.Namespace); err != nil {
+			log.Error(err, "failed to get CheckpointRegistry", "checkpointRegistry", registryName)
+			r.Recorder.Event(&currentSchedule, corev1.EventTypeWarning, checkpointrestorev1.EventReasonCheckpointFailed,
+				err.Error())
+			return err
+		}
+	}
+
 	// Get pods matching selector
 	var podList corev1.PodList
 	if err := r.List(ctx, &podList, &client.ListOptions{
@@ -38,12 +61,15 @@ func (r *CheckpointScheduleReconciler) CronJob(ctx context.Context, req ctrl.Req
 
 	if len(podList.Items) == 0 {
 		log.Info("no pods found matching selector", "selector", currentSchedule.Spec.Selector)
+		r.Recorder.Event(&currentSchedule, corev1.EventTypeWarning, checkpointrestorev1.EventReasonCheckpointFailed,
+			"No pods found matching the selector")
 		err := fmt.Errorf("no pods found matching selector")
 		return err
 	}
 
 	pod := podList.Items[0]
 	log.Info("creating checkpoint request for pod", "pod", pod.Name)
+	span.SetAttributes(semconv.K8SPodName(pod.Name))
 
 	// Create a CheckpointRequest resource
 	checkpointRequest := &checkpointrestorev1.CheckpointRequest{
@@ -56,6 +82,7 @@ func (r *CheckpointScheduleReconciler) CronJob(ctx context.Context, req ctrl.Req
 				"pod-ns":        pod.Namespace,
 				"schedule-name": currentSchedule.Name,
 			},
+			Annotations: requesterAnnotations(&currentSchedule),
 		},
 		Spec: checkpointrestorev1.CheckpointRequestSpec{
 			PodReference: checkpointrestorev1.PodReference{
@@ -70,9 +97,11 @@ func (r *CheckpointScheduleReconciler) CronJob(ctx context.Context, req ctrl.Req
 				UID:        currentSchedule.UID,
 				APIVersion: currentSchedule.APIVersion,
 			},
+			Incremental:        currentSchedule.Spec.Incremental,
+			CheckpointRegistry: currentSchedule.Spec.CheckpointRegistry,
 		},
 		Status: checkpointrestorev1.CheckpointRequestStatus{
-			Phase: "Pending",
+			Phase: checkpointrestorev1.CheckpointRequestPhasePending,
 		},
 	}
 
@@ -83,13 +112,18 @@ func (r *CheckpointScheduleReconciler) CronJob(ctx context.Context, req ctrl.Req
 		return err
 	}
 
-	// Create the CheckpointRequest resource
+	// Create the CheckpointRequest resource, its checkpoint continues the trace of the run
+	tracing.Inject(ctx, checkpointRequest)
 	if err := r.Create(ctx, checkpointRequest); err != nil {
 		log.Error(err, "failed to create CheckpointRequest resource")
+		r.Recorder.Eventf(&currentSchedule, corev1.EventTypeWarning, checkpointrestorev1.EventReasonCheckpointFailed,
+			"Failed to create CheckpointRequest for pod %s: %v", pod.Name, err)
 		err = fmt.Errorf("failed to create CheckpointRequest resource: %v", err)
 		return err
 	}
 	log.Info("created checkpoint request", "checkpointRequest", checkpointRequest.Name)
+	r.Recorder.Eventf(&currentSchedule, corev1.EventTypeNormal, checkpointrestorev1.EventReasonCheckpointStarted,
+		"Created CheckpointRequest %s for pod %s", checkpointRequest.Name, pod.Name)
 
 	// Update the CheckpointSchedule status with the last run time
 	currentSchedule.Status.LastRunTime = &metav1.Time{Time: time.Now()}
@@ -4,11 +4,16 @@ import (
 	"context"
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/internal/tracing"
 	"github.com/GianOrtiz/kcr/pkg/util"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
@@ -50,7 +55,7 @@ var _ = Describe("CheckpointSchedule CronJob", func() {
 
 		Describe("when the schedule was deleted", func() {
 			It("should do nothing", func() {
-				controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme())
+				controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme(), &record.FakeRecorder{})
 				Expect(controllerReconciler.CronJob(ctx, reconcile.Request{
 					NamespacedName: typeNamespacedName,
 				})).ToNot(Succeed())
@@ -76,7 +81,7 @@ var _ = Describe("CheckpointSchedule CronJob", func() {
 
 			Describe("when there are no Pods referenced by the schedule selector", func() {
 				It("should do nothing", func() {
-					controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme())
+					controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme(), &record.FakeRecorder{})
 					Expect(controllerReconciler.CronJob(ctx, reconcile.Request{
 						NamespacedName: typeNamespacedName,
 					})).ToNot(Succeed())
@@ -106,7 +111,7 @@ var _ = Describe("CheckpointSchedule CronJob", func() {
 				})
 
 				It("should create a new CheckpointRequest", func() {
-					controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme())
+					controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme(), &record.FakeRecorder{})
 					Expect(controllerReconciler.CronJob(ctx, reconcile.Request{
 						NamespacedName: typeNamespacedName,
 					})).To(Succeed())
@@ -120,7 +125,7 @@ var _ = Describe("CheckpointSchedule CronJob", func() {
 				})
 
 				It("should update last run time", func() {
-					controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme())
+					controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme(), &record.FakeRecorder{})
 					Expect(controllerReconciler.CronJob(ctx, reconcile.Request{
 						NamespacedName: typeNamespacedName,
 					})).To(Succeed())
@@ -129,6 +134,33 @@ var _ = Describe("CheckpointSchedule CronJob", func() {
 					Expect(k8sClient.Get(ctx, typeNamespacedName, &updatedCheckpointSchedule)).To(Succeed())
 					Expect(updatedCheckpointSchedule.Status.LastRunTime).ToNot(BeNil())
 				})
+
+				It("should start the trace of the CheckpointRequest", func() {
+					exporter := tracetest.NewInMemoryExporter()
+					shutdown, err := tracing.Setup(ctx, tracing.Options{ServiceName: "kcr-test"}, exporter)
+					Expect(err).NotTo(HaveOccurred())
+					DeferCleanup(otel.SetTracerProvider, noop.NewTracerProvider())
+					DeferCleanup(shutdown)
+
+					controllerReconciler := NewCheckpointScheduleReconciler(k8sClient, k8sClient.Scheme(), &record.FakeRecorder{})
+					Expect(controllerReconciler.CronJob(ctx, reconcile.Request{
+						NamespacedName: typeNamespacedName,
+					})).To(Succeed())
+
+					spans := exporter.GetSpans()
+					Expect(spans).To(HaveLen(1))
+					Expect(spans[0].Name).To(Equal("checkpointschedule.run"))
+					Expect(spans[0].Parent.IsValid()).To(BeFalse())
+
+					var checkpointRequests checkpointrestorev1.CheckpointRequestList
+					Expect(k8sClient.List(ctx, &checkpointRequests, &client.ListOptions{
+						Namespace: namespace,
+					})).To(Succeed())
+					Expect(checkpointRequests.Items).To(HaveLen(1))
+					Expect(checkpointRequests.Items[0].Annotations).To(HaveKeyWithValue(
+						checkpointrestorev1.TraceContextAnnotation,
+						ContainSubstring(spans[0].SpanContext.SpanID().String())))
+				})
 			})
 		})
 	})
@@ -0,0 +1,462 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpointrestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/internal/metrics"
+	"github.com/GianOrtiz/kcr/internal/tracing"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
+)
+
+// PodCloneReconciler reconciles a PodClone object
+type PodCloneReconciler struct {
+	client.Client
+	Scheme          *runtime.Scheme
+	RegistryAuthURL string
+	// RegistryResolver resolves the credentials of the registries the checkpoint images were pushed to.
+	RegistryResolver imagebuilder.RegistryResolver
+	// ImageVerifier verifies the checkpoint image has the digest recorded in the Checkpoint before the
+	// clones are restored from it. The verification is skipped when nil.
+	ImageVerifier imagebuilder.ImageVerifier
+	// RequireImageDigest refuses to restore the checkpoints without a recorded image digest, which cannot be
+	// verified. It is set when the signatures of the images are verified.
+	RequireImageDigest bool
+	// Recorder records the Events of the clones on the PodClones, the clone pods and the checkpoints.
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=podclones,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=podclones/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=podclones/finalizers,verbs=update
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointrequests,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpoints,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// A PodClone creates a CheckpointRequest of the pod, waits for the image of its Checkpoint and creates the
+// clones running the image. The kubelet leaves the checkpointed container running, so the pod keeps
+// serving while it is cloned.
+func (r *PodCloneReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var podClone checkpointrestorev1.PodClone
+	if err := r.Get(ctx, req.NamespacedName, &podClone); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to fetch PodClone")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if podClone.Status.Phase == checkpointrestorev1.PodClonePhaseCompleted ||
+		podClone.Status.Phase == checkpointrestorev1.PodClonePhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, client.ObjectKey{Name: podClone.Spec.PodName, Namespace: podClone.Namespace}, &pod); err != nil {
+		log.Error(err, "failed to get pod", "pod", podClone.Spec.PodName)
+		return ctrl.Result{}, r.fail(ctx, &podClone, checkpointrestorev1.EventReasonCheckpointFailed,
+			fmt.Sprintf("Failed to get pod: %v", err))
+	}
+	containerName := podClone.Spec.ContainerName
+	if containerName == "" && len(pod.Spec.Containers) > 0 {
+		containerName = pod.Spec.Containers[0].Name
+	}
+
+	if podClone.Status.CheckpointRequest == "" {
+		return r.requestCheckpoint(ctx, &podClone, containerName)
+	}
+
+	var checkpointRequest checkpointrestorev1.CheckpointRequest
+	if err := r.Get(ctx, client.ObjectKey{
+		Name:      podClone.Status.CheckpointRequest,
+		Namespace: podClone.Namespace,
+	}, &checkpointRequest); err != nil {
+		log.Error(err, "failed to get CheckpointRequest", "checkpointRequest", podClone.Status.CheckpointRequest)
+		return ctrl.Result{}, r.fail(ctx, &podClone, checkpointrestorev1.EventReasonCheckpointFailed,
+			fmt.Sprintf("Failed to get CheckpointRequest: %v", err))
+	}
+	switch checkpointRequest.Status.Phase {
+	case checkpointrestorev1.CheckpointRequestPhaseFailed:
+		return ctrl.Result{}, r.fail(ctx, &podClone, checkpointrestorev1.EventReasonCheckpointFailed,
+			fmt.Sprintf("CheckpointRequest %s failed: %s", checkpointRequest.Name, checkpointRequest.Status.Message))
+	case checkpointrestorev1.CheckpointRequestPhaseCompleted:
+	default:
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	if checkpointRequest.Status.Checkpoint == nil {
+		return ctrl.Result{}, r.fail(ctx, &podClone, checkpointrestorev1.EventReasonCheckpointFailed,
+			fmt.Sprintf("CheckpointRequest %s completed without a Checkpoint", checkpointRequest.Name))
+	}
+
+	// The clones are created once the image of the checkpoint is in the registry.
+	var checkpoint checkpointrestorev1.Checkpoint
+	if err := r.Get(ctx, client.ObjectKey{
+		Name:      checkpointRequest.Status.Checkpoint.Name,
+		Namespace: checkpointRequest.Status.Checkpoint.Namespace,
+	}, &checkpoint); err != nil {
+		log.Error(err, "failed to get Checkpoint", "checkpoint", checkpointRequest.Status.Checkpoint.Name)
+		return ctrl.Result{}, r.fail(ctx, &podClone, checkpointrestorev1.EventReasonCheckpointFailed,
+			fmt.Sprintf("Failed to get Checkpoint: %v", err))
+	}
+	podClone.Status.Checkpoint = checkpointRequest.Status.Checkpoint
+	switch checkpoint.Status.Phase {
+	case checkpointrestorev1.CheckpointPhaseFailed:
+		return ctrl.Result{}, r.fail(ctx, &podClone, checkpointrestorev1.EventReasonCheckpointFailed,
+			fmt.Sprintf("Failed to build checkpoint image: %s", checkpoint.Status.FailedReason))
+	case checkpointrestorev1.CheckpointPhaseImageBuilt:
+	default:
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	image, err := r.checkpointImage(ctx, &checkpoint)
+	if err != nil {
+		log.Error(err, "unable to resolve checkpoint image", "checkpoint", checkpoint.Name)
+		return ctrl.Result{}, r.fail(ctx, &podClone, checkpointrestorev1.EventReasonRestoreFailed,
+			fmt.Sprintf("Failed to resolve checkpoint image: %v", err))
+	}
+
+	// The checkpoint image pushed with the registry credentials of the namespace is pulled with them.
+	var pullSecret string
+	if checkpoint.Spec.CheckpointRegistry == "" {
+		if pullSecret, err = r.RegistryResolver.PullSecret(ctx, podClone.Namespace); err != nil {
+			log.Error(err, "failed to get registry credentials Secret")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if podClone.Spec.IsolateNetwork {
+		if err := r.isolateNetwork(ctx, &podClone); err != nil {
+			log.Error(err, "failed to create NetworkPolicy")
+			return ctrl.Result{}, err
+		}
+	}
+
+	podLabels, err := r.cloneLabels(ctx, &podClone, &pod)
+	if err != nil {
+		log.Error(err, "failed to list Services")
+		return ctrl.Result{}, err
+	}
+
+	clones := make([]string, 0, podClone.Spec.Replicas)
+	for i := range podClone.Spec.Replicas {
+		clone, err := r.clonePod(&podClone, &pod, podLabels, containerName, image, pullSecret, checkpoint.Name, i)
+		if err != nil {
+			return ctrl.Result{}, r.fail(ctx, &podClone, checkpointrestorev1.EventReasonRestoreFailed, err.Error())
+		}
+		if err := r.Create(ctx, clone); err != nil {
+			if !apierrors.IsAlreadyExists(err) {
+				log.Error(err, "failed to create clone", "pod", clone.Name)
+				return ctrl.Result{}, err
+			}
+			var existing corev1.Pod
+			if err := r.Get(ctx, client.ObjectKeyFromObject(clone), &existing); err != nil {
+				return ctrl.Result{}, err
+			}
+			if !metav1.IsControlledBy(&existing, &podClone) {
+				return ctrl.Result{}, r.fail(ctx, &podClone, checkpointrestorev1.EventReasonRestoreFailed,
+					fmt.Sprintf("Pod %s already exists", clone.Name))
+			}
+		} else {
+			r.Recorder.Eventf(clone, corev1.EventTypeNormal, checkpointrestorev1.EventReasonRestoreTriggered,
+				"Restoring container %s from Checkpoint %s", containerName, checkpoint.Name)
+		}
+		clones = append(clones, clone.Name)
+	}
+	log.Info("cloned pod", "pod", pod.Name, "clones", clones, "checkpoint", checkpoint.Name)
+	message := fmt.Sprintf("Restoring container %s in clones %s from Checkpoint %s", containerName,
+		strings.Join(clones, ", "), checkpoint.Name)
+	r.Recorder.Event(&podClone, corev1.EventTypeNormal, checkpointrestorev1.EventReasonRestoreTriggered, message)
+	r.Recorder.Event(&checkpoint, corev1.EventTypeNormal, checkpointrestorev1.EventReasonRestoreTriggered, message)
+
+	podClone.Status.Phase = checkpointrestorev1.PodClonePhaseCompleted
+	podClone.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	podClone.Status.Clones = clones
+	podClone.Status.Message = fmt.Sprintf("Pod cloned from checkpoint %s", checkpoint.Name)
+	if err := r.Status().Update(ctx, &podClone); err != nil {
+		log.Error(err, "failed to update PodClone status to Completed")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// requestCheckpoint creates the CheckpointRequest of the container of the pod to clone.
+func (r *PodCloneReconciler) requestCheckpoint(
+	ctx context.Context, podClone *checkpointrestorev1.PodClone, containerName string,
+) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// The clone starts the trace of the checkpoint it requests.
+	ctx, span := tracing.Start(ctx, nil, "podclone.checkpoint", trace.WithNewRoot(), trace.WithAttributes(
+		semconv.K8SNamespaceName(podClone.Namespace),
+		attribute.String("kcr.podclone", podClone.Name),
+		semconv.K8SPodName(podClone.Spec.PodName),
+	))
+	defer span.End()
+
+	checkpointRequest := &checkpointrestorev1.CheckpointRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        podClone.Name,
+			Namespace:   podClone.Namespace,
+			Annotations: requesterAnnotations(podClone),
+		},
+		Spec: checkpointrestorev1.CheckpointRequestSpec{
+			PodReference: checkpointrestorev1.PodReference{
+				Name:      podClone.Spec.PodName,
+				Namespace: podClone.Namespace,
+			},
+			ContainerName:      containerName,
+			CheckpointRegistry: podClone.Spec.CheckpointRegistry,
+		},
+	}
+	if err := ctrl.SetControllerReference(podClone, checkpointRequest, r.Scheme); err != nil {
+		log.Error(err, "failed to set controller reference for CheckpointRequest")
+		return ctrl.Result{}, r.fail(ctx, podClone, checkpointrestorev1.EventReasonCheckpointFailed,
+			fmt.Sprintf("Failed to set controller reference: %v", err))
+	}
+	tracing.Inject(ctx, checkpointRequest)
+	if err := r.Create(ctx, checkpointRequest); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			log.Error(err, "failed to create CheckpointRequest")
+			tracing.Fail(span, err)
+			return ctrl.Result{}, err
+		}
+		// The request was created by a previous reconciliation whose status update failed, unless it
+		// belongs to someone else.
+		var existing checkpointrestorev1.CheckpointRequest
+		if err := r.Get(ctx, client.ObjectKeyFromObject(checkpointRequest), &existing); err != nil {
+			return ctrl.Result{}, err
+		}
+		if !metav1.IsControlledBy(&existing, podClone) {
+			return ctrl.Result{}, r.fail(ctx, podClone, checkpointrestorev1.EventReasonCheckpointFailed,
+				fmt.Sprintf("CheckpointRequest %s already exists", checkpointRequest.Name))
+		}
+	}
+	log.Info("created checkpoint request", "checkpointRequest", checkpointRequest.Name)
+	r.Recorder.Eventf(podClone, corev1.EventTypeNormal, checkpointrestorev1.EventReasonCheckpointStarted,
+		"Created CheckpointRequest %s for pod %s", checkpointRequest.Name, podClone.Spec.PodName)
+
+	podClone.Status.Phase = checkpointrestorev1.PodClonePhaseCheckpointing
+	podClone.Status.StartTime = &metav1.Time{Time: time.Now()}
+	podClone.Status.CheckpointRequest = checkpointRequest.Name
+	podClone.Status.Message = "Checkpointing pod"
+	if err := r.Status().Update(ctx, podClone); err != nil {
+		log.Error(err, "failed to update PodClone status to Checkpointing")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+}
+
+// checkpointImage returns the reference of the checkpoint image the clones run, by digest when it is
+// recorded, as the PodReconciler restores failed pods.
+func (r *PodCloneReconciler) checkpointImage(
+	ctx context.Context, checkpoint *checkpointrestorev1.Checkpoint,
+) (string, error) {
+	registry := checkpoint.Status.Registry
+	if registry == "" {
+		registry = r.RegistryAuthURL
+	}
+	image := checkpoint.Status.RuntimeImage
+	if image == "" {
+		image = checkpoint.Status.CheckpointImage
+	}
+	if checkpoint.Status.ImageDigest == "" {
+		if r.RequireImageDigest {
+			return "", errors.New("checkpoint image digest is unknown, the image signature cannot be verified")
+		}
+		return registry + "/" + image, nil
+	}
+
+	imageDigest, err := digest.Parse(checkpoint.Status.ImageDigest)
+	if err != nil {
+		return "", fmt.Errorf("invalid checkpoint image digest: %w", err)
+	}
+	image = imagebuilder.DigestReference(image, imageDigest)
+	if r.ImageVerifier != nil {
+		registryAuth, _, err := ResolveCheckpointRegistry(ctx, r, r.RegistryResolver, checkpoint)
+		if err != nil {
+			return "", err
+		}
+		registryAuth.URL = registry
+		if err := r.ImageVerifier.VerifyImage(ctx, registryAuth, image, imageDigest); err != nil {
+			return "", err
+		}
+	}
+	return registry + "/" + image, nil
+}
+
+// isolateNetwork creates the NetworkPolicy denying all the traffic of the clones.
+func (r *PodCloneReconciler) isolateNetwork(ctx context.Context, podClone *checkpointrestorev1.PodClone) error {
+	networkPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podClone.Name + "-isolation",
+			Namespace: podClone.Namespace,
+			Labels:    map[string]string{checkpointrestorev1.PodCloneLabel: podClone.Name},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{checkpointrestorev1.PodCloneLabel: podClone.Name},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		},
+	}
+	if err := ctrl.SetControllerReference(podClone, networkPolicy, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, networkPolicy); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// cloneLabels returns the labels of the clones: the labels of the pod without the pod template hash, which
+// would let the ReplicaSet of the pod adopt and delete the clones, and optionally without the labels the
+// Services of the namespace select the pod with.
+func (r *PodCloneReconciler) cloneLabels(
+	ctx context.Context, podClone *checkpointrestorev1.PodClone, pod *corev1.Pod,
+) (map[string]string, error) {
+	podLabels := map[string]string{}
+	for key, value := range pod.Labels {
+		podLabels[key] = value
+	}
+	delete(podLabels, appsv1.DefaultDeploymentUniqueLabelKey)
+
+	if podClone.Spec.StripServiceLabels {
+		var services corev1.ServiceList
+		if err := r.List(ctx, &services, client.InNamespace(pod.Namespace)); err != nil {
+			return nil, err
+		}
+		for _, service := range services.Items {
+			if len(service.Spec.Selector) == 0 {
+				continue
+			}
+			if !labels.SelectorFromSet(service.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			for key := range service.Spec.Selector {
+				delete(podLabels, key)
+			}
+		}
+	}
+
+	podLabels[checkpointrestorev1.PodCloneLabel] = podClone.Name
+	return podLabels, nil
+}
+
+// clonePod returns the index-th clone of the pod, running the checkpoint image in place of the image of the
+// checkpointed container, pulled with the pullSecret when it is not empty.
+func (r *PodCloneReconciler) clonePod(
+	podClone *checkpointrestorev1.PodClone,
+	pod *corev1.Pod,
+	podLabels map[string]string,
+	containerName, image, pullSecret, checkpointName string,
+	index int32,
+) (*corev1.Pod, error) {
+	clone := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", podClone.Name, index),
+			Namespace: podClone.Namespace,
+			Labels:    podLabels,
+			Annotations: map[string]string{
+				checkpointrestorev1.RestoredCheckpointAnnotation: checkpointName,
+				checkpointrestorev1.RestoredContainerAnnotation:  containerName,
+				checkpointrestorev1.RestoreStatusAnnotation:      checkpointrestorev1.RestoreStatusRestoring,
+			},
+		},
+		Spec: *pod.Spec.DeepCopy(),
+	}
+	// The clones are scheduled on any node, the checkpoint image is pulled from the registry.
+	clone.Spec.NodeName = ""
+	clone.Spec.EphemeralContainers = nil
+
+	restored := false
+	for i := range clone.Spec.Containers {
+		if clone.Spec.Containers[i].Name == containerName {
+			clone.Spec.Containers[i].Image = image
+			restored = true
+		}
+	}
+	if !restored {
+		return nil, fmt.Errorf("pod %s has no container %s", pod.Name, containerName)
+	}
+	if pullSecret != "" {
+		imagebuilder.AddImagePullSecret(&clone.Spec, pullSecret)
+	}
+
+	if err := ctrl.SetControllerReference(podClone, clone, r.Scheme); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// fail sets the PodClone to the Failed phase with the message, and fails the span of ctx when it has one.
+func (r *PodCloneReconciler) fail(
+	ctx context.Context, podClone *checkpointrestorev1.PodClone, reason, message string,
+) error {
+	podClone.Status.Phase = checkpointrestorev1.PodClonePhaseFailed
+	podClone.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+	podClone.Status.Message = message
+	r.Recorder.Event(podClone, corev1.EventTypeWarning, reason, message)
+	tracing.Fail(trace.SpanFromContext(ctx), errors.New(message))
+	if err := r.Status().Update(ctx, podClone); err != nil {
+		log.FromContext(ctx).Error(err, "failed to update PodClone status to Failed")
+		return err
+	}
+	// The failed checkpoints are counted by the CheckpointRequests.
+	if reason == checkpointrestorev1.EventReasonRestoreFailed {
+		metrics.RestoreFailed(podClone.Namespace)
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PodCloneReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&checkpointrestorev1.PodClone{}).
+		Owns(&checkpointrestorev1.CheckpointRequest{}).
+		Named("checkpoint-restore-podclone").
+		Complete(r)
+}
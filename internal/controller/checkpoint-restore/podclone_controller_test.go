@@ -0,0 +1,228 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpointrestore
+
+import (
+	"context"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/util"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("PodClone Controller", func() {
+	const (
+		cloneName     = "test-clone"
+		podName       = "test-pod"
+		containerName = "test-container"
+	)
+
+	Context("When reconciling a PodClone", func() {
+		var (
+			controller *PodCloneReconciler
+			ctx        context.Context
+			namespace  string
+			podClone   *checkpointrestorev1.PodClone
+		)
+
+		reconcileClone := func() {
+			_, err := controller.Reconcile(ctx, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: cloneName, Namespace: namespace},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(podClone), podClone)).To(Succeed())
+		}
+
+		// completeCheckpointRequest completes the CheckpointRequest of the PodClone with a Checkpoint in
+		// the phase.
+		completeCheckpointRequest := func(phase checkpointrestorev1.CheckpointPhase) {
+			checkpoint := &checkpointrestorev1.Checkpoint{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-checkpoint",
+					Namespace: namespace,
+				},
+				Spec: checkpointrestorev1.CheckpointSpec{
+					CheckpointID:  "test-checkpoint",
+					ContainerName: containerName,
+				},
+			}
+			Expect(k8sClient.Create(ctx, checkpoint)).To(Succeed())
+			checkpoint.Status = checkpointrestorev1.CheckpointStatus{
+				Phase:        phase,
+				Registry:     "registry.example.com",
+				RuntimeImage: "checkpoint-test:latest",
+				ImageDigest:  digest.FromString("checkpoint").String(),
+			}
+			Expect(k8sClient.Status().Update(ctx, checkpoint)).To(Succeed())
+
+			var checkpointRequest checkpointrestorev1.CheckpointRequest
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      podClone.Status.CheckpointRequest,
+				Namespace: namespace,
+			}, &checkpointRequest)).To(Succeed())
+			checkpointRequest.Status.Phase = "Completed"
+			checkpointRequest.Status.Checkpoint = &corev1.ObjectReference{
+				Kind:      "Checkpoint",
+				Name:      checkpoint.Name,
+				Namespace: namespace,
+			}
+			Expect(k8sClient.Status().Update(ctx, &checkpointRequest)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			namespace = "ns-" + util.RandStringRunes(5)
+			Expect(k8sClient.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: namespace,
+				},
+			})).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      podName,
+					Namespace: namespace,
+					Labels: map[string]string{
+						"app":               "web",
+						"tier":              "frontend",
+						"pod-template-hash": "abc123",
+					},
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "test-node",
+					Containers: []corev1.Container{
+						{
+							Name:  containerName,
+							Image: "test-image",
+						},
+					},
+				},
+			})).To(Succeed())
+
+			podClone = &checkpointrestorev1.PodClone{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      cloneName,
+					Namespace: namespace,
+				},
+				Spec: checkpointrestorev1.PodCloneSpec{
+					PodName:  podName,
+					Replicas: 2,
+				},
+			}
+
+			controller = &PodCloneReconciler{
+				Client:   k8sClient,
+				Scheme:   scheme.Scheme,
+				Recorder: &record.FakeRecorder{},
+			}
+		})
+
+		It("should request a checkpoint of the pod", func() {
+			Expect(k8sClient.Create(ctx, podClone)).To(Succeed())
+
+			reconcileClone()
+			Expect(podClone.Status.Phase).To(Equal(checkpointrestorev1.PodClonePhaseCheckpointing))
+			Expect(podClone.Status.CheckpointRequest).To(Equal(cloneName))
+
+			var checkpointRequest checkpointrestorev1.CheckpointRequest
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: cloneName, Namespace: namespace},
+				&checkpointRequest)).To(Succeed())
+			Expect(checkpointRequest.Spec.PodReference.Name).To(Equal(podName))
+			Expect(checkpointRequest.Spec.ContainerName).To(Equal(containerName))
+			Expect(metav1.IsControlledBy(&checkpointRequest, podClone)).To(BeTrue())
+		})
+
+		It("should fail when the pod does not exist", func() {
+			podClone.Spec.PodName = "missing-pod"
+			Expect(k8sClient.Create(ctx, podClone)).To(Succeed())
+
+			reconcileClone()
+			Expect(podClone.Status.Phase).To(Equal(checkpointrestorev1.PodClonePhaseFailed))
+			Expect(podClone.Status.Message).To(ContainSubstring("Failed to get pod"))
+		})
+
+		It("should wait for the image of the checkpoint", func() {
+			Expect(k8sClient.Create(ctx, podClone)).To(Succeed())
+			reconcileClone()
+			completeCheckpointRequest("Processing")
+
+			reconcileClone()
+			Expect(podClone.Status.Phase).To(Equal(checkpointrestorev1.PodClonePhaseCheckpointing))
+			var pods corev1.PodList
+			Expect(k8sClient.List(ctx, &pods, client.InNamespace(namespace),
+				client.MatchingLabels{checkpointrestorev1.PodCloneLabel: cloneName})).To(Succeed())
+			Expect(pods.Items).To(BeEmpty())
+		})
+
+		It("should start the clones from the checkpoint image", func() {
+			podClone.Spec.StripServiceLabels = true
+			podClone.Spec.IsolateNetwork = true
+			Expect(k8sClient.Create(ctx, podClone)).To(Succeed())
+			Expect(k8sClient.Create(ctx, &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "web",
+					Namespace: namespace,
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{"app": "web"},
+					Ports:    []corev1.ServicePort{{Port: 80}},
+				},
+			})).To(Succeed())
+			reconcileClone()
+			completeCheckpointRequest("ImageBuilt")
+
+			reconcileClone()
+			Expect(podClone.Status.Phase).To(Equal(checkpointrestorev1.PodClonePhaseCompleted))
+			Expect(podClone.Status.Clones).To(Equal([]string{cloneName + "-0", cloneName + "-1"}))
+
+			for _, name := range podClone.Status.Clones {
+				var clone corev1.Pod
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &clone)).To(Succeed())
+				Expect(clone.Spec.Containers[0].Image).To(Equal("registry.example.com/checkpoint-test@" +
+					digest.FromString("checkpoint").String()))
+				Expect(clone.Spec.NodeName).To(BeEmpty())
+				Expect(clone.Labels).To(Equal(map[string]string{
+					"tier":                            "frontend",
+					checkpointrestorev1.PodCloneLabel: cloneName,
+				}))
+				Expect(clone.Annotations[checkpointrestorev1.RestoredCheckpointAnnotation]).To(Equal("test-checkpoint"))
+				Expect(clone.Annotations[checkpointrestorev1.RestoredContainerAnnotation]).To(
+					Equal(clone.Spec.Containers[0].Name))
+				Expect(metav1.IsControlledBy(&clone, podClone)).To(BeTrue())
+			}
+
+			var networkPolicy networkingv1.NetworkPolicy
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: cloneName + "-isolation", Namespace: namespace},
+				&networkPolicy)).To(Succeed())
+			Expect(networkPolicy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{
+				checkpointrestorev1.PodCloneLabel: cloneName,
+			}))
+			Expect(networkPolicy.Spec.Ingress).To(BeEmpty())
+			Expect(networkPolicy.Spec.Egress).To(BeEmpty())
+		})
+	})
+})
@@ -24,6 +24,7 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
 
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
@@ -33,6 +34,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
 	corev1 "k8s.io/api/core/v1"
 	// +kubebuilder:scaffold:imports
 )
@@ -66,14 +68,56 @@ func (m *mockCheckpointService) Checkpoint(podNode, podID, podNamespace, contain
 
 // Mock implementation of ImageBuilder.
 type mockImageBuilder struct {
-	mockedResult error
+	mockedResult      error
+	mockedPushedImage imagebuilder.PushedImage
+	// pushedRegistryAuth is the registry of the last pushed image.
+	pushedRegistryAuth imagebuilder.RegistryAuth
+	// builtOptions are the options of the last built image.
+	builtOptions imagebuilder.BuildOptions
+	// builtMetadata is the metadata of the last built image.
+	builtMetadata imagebuilder.CheckpointMetadata
+	// pushedBytes are reported as the progress of the pushes.
+	pushedBytes int64
+	// pushStarted is closed when a push starts, which then blocks until its context is done.
+	pushStarted chan struct{}
 }
 
-func (m *mockImageBuilder) BuildFromCheckpoint(checkpointLocation, containerName, imageName string, ctx context.Context) error {
+func (m *mockImageBuilder) BuildFromCheckpoint(
+	checkpointLocation string,
+	metadata imagebuilder.CheckpointMetadata,
+	options imagebuilder.BuildOptions,
+	imageName string,
+	ctx context.Context,
+) error {
+	m.builtOptions = options
+	m.builtMetadata = metadata
 	return m.mockedResult
 }
 
-func (m *mockImageBuilder) PushToNodeRuntime(ctx context.Context, localImageName string, runtimeImageName string) error {
+func (m *mockImageBuilder) PushToNodeRuntime(
+	ctx context.Context, localImageName string, runtimeImageName string, registryAuth imagebuilder.RegistryAuth,
+) (imagebuilder.PushedImage, error) {
+	m.pushedRegistryAuth = registryAuth
+	imagebuilder.ReportPushProgress(ctx, m.pushedBytes)
+	if m.pushStarted != nil {
+		close(m.pushStarted)
+		<-ctx.Done()
+		return imagebuilder.PushedImage{}, ctx.Err()
+	}
+	return m.mockedPushedImage, m.mockedResult
+}
+
+// Mock implementation of ImageSigner.
+type mockImageSigner struct {
+	mockedResult error
+	// signedImage is the last signed image.
+	signedImage string
+}
+
+func (m *mockImageSigner) SignImage(
+	ctx context.Context, registryAuth imagebuilder.RegistryAuth, imageName string, imageDigest digest.Digest,
+) error {
+	m.signedImage = imageName + "@" + imageDigest.String()
 	return m.mockedResult
 }
 
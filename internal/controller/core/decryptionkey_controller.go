@@ -0,0 +1,264 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/access"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// DefaultDecryptionKeysTimeout is the default time since a restore started after which the decryption keys of
+// a pod whose restored container does not run are removed.
+const DefaultDecryptionKeysTimeout = 10 * time.Minute
+
+// DecryptionKeyReconciler provides the container runtime of its node with the private keys of the encrypted
+// checkpoint images while they are restored. The keys are written to the runtime decryption keys directory
+// when a pod of the node is restored from an encrypted checkpoint, and removed once the restored container
+// runs, the restore failed or it takes longer than KeysTimeout, so the node only holds them while they are
+// needed.
+type DecryptionKeyReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// NodeName is the node whose pods are reconciled.
+	NodeName string
+	// SecretReader reads the decryption keys Secret, which is not cached.
+	SecretReader client.Reader
+	// Secret holds the private keys in PEM format, any key name is accepted.
+	Secret types.NamespacedName
+	// KeysDirectory is the directory the container runtime reads the decryption keys from.
+	KeysDirectory string
+	// KeysTimeout is the time since the restore of a pod started after which its keys are removed, even
+	// though its restored container does not run, as when its image cannot be pulled.
+	// DefaultDecryptionKeysTimeout is used when zero.
+	KeysTimeout time.Duration
+}
+
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpoints,verbs=get;list;watch
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointaccessgrants,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get,namespace=system
+
+// Reconcile writes or removes the decryption keys of the checkpoint the pod is restored from.
+func (r *DecryptionKeyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var pod corev1.Pod
+	if err := r.Get(ctx, req.NamespacedName, &pod); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to fetch Pod")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.removeKeys(req.NamespacedName)
+	}
+
+	checkpointName, ok := access.RestoredCheckpoint(&pod)
+	if !ok {
+		return ctrl.Result{}, r.removeKeys(req.NamespacedName)
+	}
+	// The keys of the checkpoints of other namespaces are only provided when they grant the namespace of
+	// the pod, any pod could be annotated with them otherwise.
+	allowed, err := access.Allowed(ctx, r, pod.Namespace, checkpointrestorev1.CheckpointAccessGrantCheckpointKind,
+		checkpointName.Namespace, checkpointName.Name)
+	if err != nil {
+		log.Error(err, "unable to check the access to the Checkpoint", "checkpoint", checkpointName)
+		return ctrl.Result{}, err
+	}
+	if !allowed {
+		log.Info("Checkpoint not granted to the namespace of the pod, not providing its keys",
+			"checkpoint", checkpointName)
+		return ctrl.Result{}, r.removeKeys(req.NamespacedName)
+	}
+	var checkpoint checkpointrestorev1.Checkpoint
+	if err := r.Get(ctx, checkpointName, &checkpoint); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to fetch Checkpoint", "checkpoint", checkpointName)
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.removeKeys(req.NamespacedName)
+	}
+
+	if len(checkpoint.Status.EncryptionKeys) == 0 || restoredContainerRunning(&pod) {
+		return ctrl.Result{}, r.removeKeys(req.NamespacedName)
+	}
+	// The keys are only needed while the pod is restored, not once the restore failed or when it takes too
+	// long, as when the image cannot be pulled.
+	remaining := time.Until(r.keysDeadline(&pod))
+	if pod.Annotations[checkpointrestorev1.RestoreStatusAnnotation] != checkpointrestorev1.RestoreStatusRestoring ||
+		remaining <= 0 {
+		log.Info("Pod is not being restored, removing the decryption keys", "checkpoint", checkpointName)
+		return ctrl.Result{}, r.removeKeys(req.NamespacedName)
+	}
+
+	if err := r.writeKeys(ctx, req.NamespacedName, checkpoint.Status.EncryptionKeys); err != nil {
+		log.Error(err, "unable to provide decryption keys", "checkpoint", checkpointName)
+		return ctrl.Result{}, err
+	}
+	log.Info("Provided checkpoint decryption keys to the container runtime", "checkpoint", checkpointName)
+	return ctrl.Result{RequeueAfter: remaining}, nil
+}
+
+// keysDeadline returns when the keys of the pod are removed though its restored container does not run.
+func (r *DecryptionKeyReconciler) keysDeadline(pod *corev1.Pod) time.Time {
+	timeout := r.KeysTimeout
+	if timeout <= 0 {
+		timeout = DefaultDecryptionKeysTimeout
+	}
+	started := pod.CreationTimestamp.Time
+	if container, ok := access.RestoredContainer(pod); ok {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == container.Name {
+				started = restoreStarted(pod, status)
+			}
+		}
+	}
+	return started.Add(timeout)
+}
+
+// sweepKeys removes the decryption keys left in the keys directory by a previous run for the pods which
+// were deleted or are no longer restored meanwhile, the pods which still exist are reconciled anyway.
+func (r *DecryptionKeyReconciler) sweepKeys(ctx context.Context) error {
+	log := log.FromContext(ctx)
+
+	keyPaths, err := filepath.Glob(filepath.Join(r.KeysDirectory, "*kcr_*_*_*.pem"))
+	if err != nil {
+		return err
+	}
+	pods := map[types.NamespacedName]bool{}
+	for _, keyPath := range keyPaths {
+		name := filepath.Base(keyPath)
+		// The keys interrupted while being written are never renamed.
+		if strings.HasPrefix(name, ".") {
+			if err := os.Remove(keyPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		// Namespaces and pod names have no underscores, the key file names are never ambiguous.
+		parts := strings.SplitN(strings.TrimPrefix(name, "kcr_"), "_", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		pods[types.NamespacedName{Namespace: parts[0], Name: parts[1]}] = true
+	}
+	for pod := range pods {
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: pod}); err != nil {
+			log.Error(err, "unable to remove the decryption keys left for the pod", "pod", pod)
+		}
+	}
+	return nil
+}
+
+// writeKeys writes the private keys of the Secret matching the key IDs to the keys directory.
+func (r *DecryptionKeyReconciler) writeKeys(ctx context.Context, pod types.NamespacedName, keyIDs []string) error {
+	var secret corev1.Secret
+	if err := r.SecretReader.Get(ctx, r.Secret, &secret); err != nil {
+		return fmt.Errorf("failed to get decryption keys Secret %s: %w", r.Secret, err)
+	}
+
+	found := false
+	for _, privateKey := range secret.Data {
+		keyID, err := imagebuilder.PrivateKeyID(privateKey)
+		if err != nil || !slices.Contains(keyIDs, keyID) {
+			continue
+		}
+		found = true
+
+		// The runtime may read the directory at any time, the key is only visible once fully written.
+		keyPath := filepath.Join(r.KeysDirectory, keyFilePrefix(pod)+strings.TrimPrefix(keyID, "sha256:")+".pem")
+		temporaryPath := filepath.Join(r.KeysDirectory, "."+filepath.Base(keyPath))
+		if err := os.WriteFile(temporaryPath, privateKey, 0o600); err != nil {
+			return err
+		}
+		if err := os.Rename(temporaryPath, keyPath); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("no decryption key in Secret %s matches the checkpoint keys %v", r.Secret, keyIDs)
+	}
+	return nil
+}
+
+// removeKeys removes the decryption keys written for the pod.
+func (r *DecryptionKeyReconciler) removeKeys(pod types.NamespacedName) error {
+	keyPaths, err := filepath.Glob(filepath.Join(r.KeysDirectory, keyFilePrefix(pod)+"*.pem"))
+	if err != nil {
+		return err
+	}
+	for _, keyPath := range keyPaths {
+		if err := os.Remove(keyPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyFilePrefix is the prefix of the names of the decryption key files of the pod.
+func keyFilePrefix(pod types.NamespacedName) string {
+	return "kcr_" + pod.Namespace + "_" + pod.Name + "_"
+}
+
+// restoredContainerRunning reports whether the restored container runs the checkpoint image, at which
+// point the runtime already decrypted it.
+func restoredContainerRunning(pod *corev1.Pod) bool {
+	container, ok := access.RestoredContainer(pod)
+	if !ok {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container.Name {
+			return status.State.Running != nil && status.Image == container.Image
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DecryptionKeyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := os.MkdirAll(r.KeysDirectory, 0o700); err != nil {
+		return fmt.Errorf("failed to create decryption keys directory %s: %w", r.KeysDirectory, err)
+	}
+	// The keys of the pods deleted while the agent did not run are never reconciled.
+	if err := mgr.Add(manager.RunnableFunc(r.sweepKeys)); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Pod{}).
+		WithEventFilter(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			pod, ok := object.(*corev1.Pod)
+			return ok && pod.Spec.NodeName == r.NodeName
+		})).
+		Named("core-decryptionkey").
+		Complete(r)
+}
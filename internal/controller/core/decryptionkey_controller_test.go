@@ -0,0 +1,234 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"time"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
+	"github.com/GianOrtiz/kcr/pkg/util"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("DecryptionKey Controller", func() {
+	const (
+		podName        = "test-pod"
+		containerName  = "test-container"
+		checkpointName = "test-checkpoint"
+		restoredImage  = "registry.example.com/checkpoint-test-checkpoint@sha256:" +
+			"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	)
+
+	Context("When a pod is restored from an encrypted checkpoint", func() {
+		var (
+			ctx            context.Context
+			namespace      string
+			namespacedName types.NamespacedName
+			privateKey     []byte
+			keysDirectory  string
+			controller     *DecryptionKeyReconciler
+		)
+
+		keyFiles := func() []string {
+			files, err := filepath.Glob(filepath.Join(keysDirectory, "*.pem"))
+			Expect(err).NotTo(HaveOccurred())
+			return files
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			namespace = "ns-" + util.RandStringRunes(5)
+			Expect(k8sClient.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: namespace},
+			})).To(Succeed())
+
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			privateKey = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+			keyID, err := imagebuilder.KeyID(&key.PublicKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "kcr-decryption-keys", Namespace: namespace},
+				Data:       map[string][]byte{"kcr.key": privateKey},
+			})).To(Succeed())
+
+			checkpoint := checkpointrestorev1.Checkpoint{
+				ObjectMeta: metav1.ObjectMeta{Name: checkpointName, Namespace: namespace},
+			}
+			Expect(k8sClient.Create(ctx, &checkpoint)).To(Succeed())
+			checkpoint.Status.Phase = "ImageBuilt"
+			checkpoint.Status.EncryptionKeys = []string{keyID}
+			Expect(k8sClient.Status().Update(ctx, &checkpoint)).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      podName,
+					Namespace: namespace,
+					Annotations: map[string]string{
+						checkpointrestorev1.RestoredCheckpointAnnotation: checkpointName,
+						checkpointrestorev1.RestoreStatusAnnotation:      checkpointrestorev1.RestoreStatusRestoring,
+					},
+				},
+				Spec: corev1.PodSpec{
+					NodeName:   "test-node",
+					Containers: []corev1.Container{{Name: containerName, Image: restoredImage}},
+				},
+			})).To(Succeed())
+			namespacedName = types.NamespacedName{Name: podName, Namespace: namespace}
+
+			keysDirectory = GinkgoT().TempDir()
+			controller = &DecryptionKeyReconciler{
+				Client:        k8sClient,
+				NodeName:      "test-node",
+				SecretReader:  k8sClient,
+				Secret:        types.NamespacedName{Name: "kcr-decryption-keys", Namespace: namespace},
+				KeysDirectory: keysDirectory,
+			}
+		})
+
+		It("should provide the decryption key to the container runtime", func() {
+			_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			files := keyFiles()
+			Expect(files).To(HaveLen(1))
+			content, err := os.ReadFile(files[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(content).To(Equal(privateKey))
+			info, err := os.Stat(files[0])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+		})
+
+		It("should remove the decryption key once the restored container runs", func() {
+			_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keyFiles()).To(HaveLen(1))
+
+			var pod corev1.Pod
+			Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  containerName,
+				Image: restoredImage,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			}}
+			Expect(k8sClient.Status().Update(ctx, &pod)).To(Succeed())
+
+			_, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keyFiles()).To(BeEmpty())
+		})
+
+		It("should remove the decryption key when the pod is deleted", func() {
+			_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keyFiles()).To(HaveLen(1))
+
+			Expect(k8sClient.Delete(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: podName, Namespace: namespace},
+			}, client.GracePeriodSeconds(0))).To(Succeed())
+
+			_, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keyFiles()).To(BeEmpty())
+		})
+
+		It("should remove the decryption key once the restore failed", func() {
+			_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keyFiles()).To(HaveLen(1))
+
+			var pod corev1.Pod
+			Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+			pod.Annotations[checkpointrestorev1.RestoreStatusAnnotation] = checkpointrestorev1.RestoreStatusFailed
+			Expect(k8sClient.Update(ctx, &pod)).To(Succeed())
+
+			_, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keyFiles()).To(BeEmpty())
+		})
+
+		It("should remove the decryption key when the restore takes longer than the timeout", func() {
+			result, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keyFiles()).To(HaveLen(1))
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			var pod corev1.Pod
+			Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  containerName,
+				Image: restoredImage,
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Reason:     "Error",
+					FinishedAt: metav1.NewTime(time.Now().Add(-time.Hour)),
+				}},
+			}}
+			Expect(k8sClient.Status().Update(ctx, &pod)).To(Succeed())
+
+			_, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(keyFiles()).To(BeEmpty())
+		})
+
+		It("should remove the decryption keys left for deleted pods at startup", func() {
+			leftKey := filepath.Join(keysDirectory, keyFilePrefix(types.NamespacedName{
+				Namespace: namespace, Name: "deleted-pod",
+			})+"0000.pem")
+			Expect(os.WriteFile(leftKey, privateKey, 0o600)).To(Succeed())
+			partialKey := filepath.Join(keysDirectory, ".kcr_"+namespace+"_deleted-pod_1111.pem")
+			Expect(os.WriteFile(partialKey, privateKey, 0o600)).To(Succeed())
+			_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(controller.sweepKeys(ctx)).To(Succeed())
+			Expect(leftKey).NotTo(BeAnExistingFile())
+			Expect(partialKey).NotTo(BeAnExistingFile())
+			Expect(keyFiles()).To(HaveLen(1))
+		})
+
+		It("should fail when no key of the Secret matches the checkpoint", func() {
+			var checkpoint checkpointrestorev1.Checkpoint
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: checkpointName, Namespace: namespace},
+				&checkpoint)).To(Succeed())
+			checkpoint.Status.EncryptionKeys = []string{"sha256:0000"}
+			Expect(k8sClient.Status().Update(ctx, &checkpoint)).To(Succeed())
+
+			_, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName})
+			Expect(err).To(HaveOccurred())
+			Expect(keyFiles()).To(BeEmpty())
+		})
+	})
+})
@@ -18,10 +18,20 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	checkpointrestore "github.com/GianOrtiz/kcr/internal/controller/checkpoint-restore"
+	"github.com/GianOrtiz/kcr/internal/metrics"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/access"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
+	"github.com/opencontainers/go-digest"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -32,11 +42,26 @@ type PodReconciler struct {
 	client.Client
 	Scheme          *runtime.Scheme
 	RegistryAuthURL string
+	// RegistryResolver resolves the credentials of the registries the checkpoint images were pushed to.
+	RegistryResolver imagebuilder.RegistryResolver
+	// ImageVerifier verifies the checkpoint image has the digest recorded in the Checkpoint before it is
+	// restored. The verification is skipped when nil.
+	ImageVerifier imagebuilder.ImageVerifier
+	// RequireImageDigest refuses to restore the checkpoints without a recorded image digest, which cannot be
+	// verified. It is set when the signatures of the images are verified.
+	RequireImageDigest bool
+	// Recorder records the Events of the restores on the pods and on their checkpoints.
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=pods/finalizers,verbs=update
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointregistries,verbs=get;list;watch
+// +kubebuilder:rbac:groups=checkpoint-restore.kcr.io,resources=checkpointaccessgrants,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get,resourceNames=kcr-registry-credentials
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get,namespace=system
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -49,6 +74,15 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// The pod is being restored, report once its container was restored or failed to.
+	if pod.Annotations[checkpointrestorev1.RestoreStatusAnnotation] == checkpointrestorev1.RestoreStatusRestoring {
+		if err := r.reportRestore(ctx, &pod); err != nil {
+			log.Error(err, "unable to update Pod restore status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
 	isCrashing := false
 	for _, containerStatus := range pod.Status.ContainerStatuses {
 		if containerStatus.State.Terminated != nil && (containerStatus.State.Terminated.Reason == "Error") {
@@ -69,32 +103,279 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 		return ctrl.Result{}, err
 	}
 
-	if len(checkpoints.Items) == 0 {
-		log.Info("No Checkpoints found")
-		return ctrl.Result{}, nil
+	// Checkpoints created by CheckpointRequests of other namespaces are restored when their namespace grants
+	// the namespace of the pod.
+	granted, err := r.grantedCheckpoints(ctx, &pod)
+	if err != nil {
+		log.Error(err, "unable to list Checkpoints of other namespaces")
+		return ctrl.Result{}, err
 	}
+	checkpoints.Items = append(checkpoints.Items, granted...)
 
+	// Only the checkpoints whose image was built are restored, the newer ones may still be building or have
+	// failed.
 	var newestCheckpoint *checkpointrestorev1.Checkpoint
-	for _, checkpoint := range checkpoints.Items {
-		if newestCheckpoint == nil {
-			newestCheckpoint = &checkpoint
-		} else {
-			if newestCheckpoint.ObjectMeta.CreationTimestamp.Before(&checkpoint.ObjectMeta.CreationTimestamp) {
-				newestCheckpoint = &checkpoint
-			}
+	for i, checkpoint := range checkpoints.Items {
+		if checkpoint.Status.Phase != checkpointrestorev1.CheckpointPhaseImageBuilt {
+			continue
+		}
+		if newestCheckpoint == nil || newestCheckpoint.CreationTimestamp.Before(&checkpoint.CreationTimestamp) {
+			newestCheckpoint = &checkpoints.Items[i]
 		}
 	}
+	if newestCheckpoint == nil {
+		log.Info("No built Checkpoints found")
+		return ctrl.Result{}, nil
+	}
 
-	pod.Spec.Containers[0].Image = r.RegistryAuthURL + "/" + newestCheckpoint.Status.CheckpointImage
+	// Checkpoints record the registry they were pushed to, which depends on the registry of their namespace.
+	registry := newestCheckpoint.Status.Registry
+	if registry == "" {
+		registry = r.RegistryAuthURL
+	}
+	// The runtime image is the name the checkpoint image was pushed with, which depends on the naming of
+	// its CheckpointRegistry.
+	image := newestCheckpoint.Status.RuntimeImage
+	if image == "" {
+		image = newestCheckpoint.Status.CheckpointImage
+	}
+	// Tags can be pushed again, the image is restored by digest so it is always the checkpointed one.
+	// Checkpoints built before the digest was recorded are still restored by tag.
+	var imageDigest digest.Digest
+	if newestCheckpoint.Status.ImageDigest != "" {
+		imageDigest, err = digest.Parse(newestCheckpoint.Status.ImageDigest)
+		if err != nil {
+			log.Error(err, "invalid checkpoint image digest", "checkpoint", newestCheckpoint.Name)
+			r.recordRestoreEvent(&pod, newestCheckpoint, corev1.EventTypeWarning,
+				checkpointrestorev1.EventReasonRestoreFailed, fmt.Sprintf("Invalid checkpoint image digest: %v", err))
+			metrics.RestoreFailed(pod.Namespace)
+			return ctrl.Result{}, nil
+		}
+		image = imagebuilder.DigestReference(image, imageDigest)
+	} else if r.RequireImageDigest {
+		log.Info("checkpoint image digest is unknown, not restoring", "checkpoint", newestCheckpoint.Name)
+		r.recordRestoreEvent(&pod, newestCheckpoint, corev1.EventTypeWarning, checkpointrestorev1.EventReasonRestoreFailed,
+			"Checkpoint image digest is unknown, the image signature cannot be verified")
+		metrics.RestoreFailed(pod.Namespace)
+		return ctrl.Result{}, nil
+	}
+	restoreImage := registry + "/" + image
+	restoredCheckpoint := access.RestoredCheckpointValue(pod.Namespace, client.ObjectKeyFromObject(newestCheckpoint))
+	// The checkpointed container is restored, the checkpoints created before its name was recorded were taken
+	// of the first container.
+	containerIndex := 0
+	if containerName := newestCheckpoint.Spec.ContainerName; containerName != "" {
+		containerIndex = slices.IndexFunc(pod.Spec.Containers, func(container corev1.Container) bool {
+			return container.Name == containerName
+		})
+		if containerIndex < 0 {
+			log.Info("Pod has no checkpointed container, not restoring", "checkpoint", restoredCheckpoint,
+				"container", containerName)
+			return ctrl.Result{}, nil
+		}
+	}
+	container := &pod.Spec.Containers[containerIndex]
+	// The container already failed to restore from the newest checkpoint, restoring it again fails the same.
+	if container.Image == restoreImage &&
+		pod.Annotations[checkpointrestorev1.RestoreStatusAnnotation] == checkpointrestorev1.RestoreStatusFailed {
+		log.Info("Pod failed to restore from the newest checkpoint, not restoring", "checkpoint", restoredCheckpoint)
+		return ctrl.Result{}, nil
+	}
+	if imageDigest != "" {
+		if err := r.verifyImage(ctx, newestCheckpoint, registry, image, imageDigest); err != nil {
+			log.Error(err, "unable to verify checkpoint image, not restoring", "checkpoint", newestCheckpoint.Name)
+			r.recordRestoreEvent(&pod, newestCheckpoint, corev1.EventTypeWarning,
+				checkpointrestorev1.EventReasonRestoreFailed, fmt.Sprintf("Failed to verify checkpoint image: %v", err))
+			// The image is not verified again, the failed restore is counted once. The registry may not be
+			// reachable yet otherwise, the verification is retried and only counted once it fails for good.
+			if errors.Is(err, imagebuilder.ErrImageNotVerified) {
+				metrics.RestoreFailed(pod.Namespace)
+				return ctrl.Result{}, nil
+			}
+			return ctrl.Result{}, err
+		}
+	}
+	container.Image = restoreImage
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[checkpointrestorev1.RestoredCheckpointAnnotation] = restoredCheckpoint
+	pod.Annotations[checkpointrestorev1.RestoredContainerAnnotation] = container.Name
+	pod.Annotations[checkpointrestorev1.RestoreStatusAnnotation] = checkpointrestorev1.RestoreStatusRestoring
 	if err := r.Update(ctx, &pod); err != nil {
 		log.Error(err, "unable to update Pod")
 		return ctrl.Result{}, err
 	}
+	r.recordRestoreEvent(&pod, newestCheckpoint, corev1.EventTypeNormal, checkpointrestorev1.EventReasonRestoreTriggered,
+		fmt.Sprintf("Restoring container %s from Checkpoint %s", container.Name, restoredCheckpoint))
 
-	log.Info("Successfully updated pod with checkpoint image", "pod", pod.Name, "image", newestCheckpoint.Status.CheckpointImage)
+	log.Info("Successfully updated pod with checkpoint image", "pod", pod.Name, "image", image)
 	return ctrl.Result{}, nil
 }
 
+// reportRestore records whether the container of the pod being restored runs or failed to restore, and sets
+// the restore status of the pod accordingly. Nothing is reported while the container is still being restored.
+func (r *PodReconciler) reportRestore(ctx context.Context, pod *corev1.Pod) error {
+	checkpointName, _ := access.RestoredCheckpoint(pod)
+	container, _ := access.RestoredContainer(pod)
+	containerName := container.Name
+
+	status, eventtype, reason := checkpointrestorev1.RestoreStatusRestored, corev1.EventTypeNormal,
+		checkpointrestorev1.EventReasonRestoreSucceeded
+	message := fmt.Sprintf("Restored container %s from Checkpoint %s", containerName,
+		access.RestoredCheckpointValue(pod.Namespace, checkpointName))
+	if !restoredContainerRunning(pod) {
+		failure, failed := restoreFailure(pod)
+		if !failed {
+			return nil
+		}
+		status, eventtype, reason = checkpointrestorev1.RestoreStatusFailed, corev1.EventTypeWarning,
+			checkpointrestorev1.EventReasonRestoreFailed
+		message = fmt.Sprintf("Failed to restore container %s from Checkpoint %s: %s", containerName,
+			access.RestoredCheckpointValue(pod.Namespace, checkpointName), failure)
+	}
+
+	pod.Annotations[checkpointrestorev1.RestoreStatusAnnotation] = status
+	if err := r.Update(ctx, pod); err != nil {
+		return err
+	}
+	if status == checkpointrestorev1.RestoreStatusRestored {
+		metrics.RestoreSucceeded(pod.Namespace, restoreDuration(pod))
+	} else {
+		metrics.RestoreFailed(pod.Namespace)
+	}
+	checkpoint := &checkpointrestorev1.Checkpoint{}
+	if err := r.Get(ctx, checkpointName, checkpoint); err != nil {
+		// The checkpoint may have been deleted since, the event is only recorded on the pod.
+		checkpoint = nil
+	}
+	r.recordRestoreEvent(pod, checkpoint, eventtype, reason, message)
+	return nil
+}
+
+// restoreDuration returns the time the restored container of the pod took to run since its restore started.
+func restoreDuration(pod *corev1.Pod) time.Duration {
+	container, ok := access.RestoredContainer(pod)
+	if !ok {
+		return 0
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != container.Name || status.State.Running == nil {
+			continue
+		}
+		if duration := status.State.Running.StartedAt.Sub(restoreStarted(pod, status)); duration > 0 {
+			return duration
+		}
+	}
+	return 0
+}
+
+// restoreStarted returns when the restore of the container with the status started, at the failure of the
+// previous container or, for the pods created restored, at the creation of the pod.
+func restoreStarted(pod *corev1.Pod, status corev1.ContainerStatus) time.Time {
+	if terminated := status.LastTerminationState.Terminated; terminated != nil && !terminated.FinishedAt.IsZero() {
+		return terminated.FinishedAt.Time
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// restoreFailureReasons are the reasons of the waiting containers which cannot be created from their
+// checkpoint image.
+var restoreFailureReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerError":       true,
+	"CreateContainerConfigError": true,
+	"RunContainerError":          true,
+}
+
+// restoreFailure returns why the container of the pod could not be restored from the checkpoint image, and
+// false while it may still be restored.
+func restoreFailure(pod *corev1.Pod) (string, bool) {
+	container, ok := access.RestoredContainer(pod)
+	if !ok {
+		return "the restored container is not in the pod", true
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != container.Name {
+			continue
+		}
+		if waiting := status.State.Waiting; waiting != nil && restoreFailureReasons[waiting.Reason] {
+			return waiting.Reason + ": " + waiting.Message, true
+		}
+		// The restored container failed once it ran, the status refers to the previous container otherwise.
+		if status.Image != container.Image {
+			return "", false
+		}
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason == "CrashLoopBackOff" {
+			return waiting.Reason + ": " + waiting.Message, true
+		}
+		if terminated := status.State.Terminated; terminated != nil && terminated.Reason == "Error" {
+			return fmt.Sprintf("container exited with code %d", terminated.ExitCode), true
+		}
+	}
+	return "", false
+}
+
+// recordRestoreEvent records the event on the pod and on the checkpoint it is restored from, when known.
+func (r *PodReconciler) recordRestoreEvent(
+	pod *corev1.Pod, checkpoint *checkpointrestorev1.Checkpoint, eventtype, reason, message string,
+) {
+	r.Recorder.Event(pod, eventtype, reason, message)
+	if checkpoint != nil {
+		r.Recorder.Event(checkpoint, eventtype, reason, fmt.Sprintf("%s in pod %s/%s", message, pod.Namespace, pod.Name))
+	}
+}
+
+// grantedCheckpoints returns the checkpoints of the pod in other namespaces than its own which grant the
+// namespace of the pod access to them. The namespace of the pod must grant the namespace of the checkpoint
+// to checkpoint the pod too, so no other namespace can have its checkpoints restored in the pod.
+func (r *PodReconciler) grantedCheckpoints(ctx context.Context, pod *corev1.Pod) ([]checkpointrestorev1.Checkpoint, error) {
+	var checkpoints checkpointrestorev1.CheckpointList
+	if err := r.List(ctx, &checkpoints, client.MatchingLabels{"pod": pod.Name, "pod-ns": pod.Namespace}); err != nil {
+		return nil, err
+	}
+	var granted []checkpointrestorev1.Checkpoint
+	for _, checkpoint := range checkpoints.Items {
+		if checkpoint.Namespace == pod.Namespace {
+			continue
+		}
+		allowed, err := access.Allowed(ctx, r, pod.Namespace, checkpointrestorev1.CheckpointAccessGrantCheckpointKind,
+			checkpoint.Namespace, checkpoint.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		allowed, err = access.Allowed(ctx, r, checkpoint.Namespace, checkpointrestorev1.CheckpointAccessGrantPodKind,
+			pod.Namespace, pod.Name)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			granted = append(granted, checkpoint)
+		}
+	}
+	return granted, nil
+}
+
+// verifyImage verifies the checkpoint image in the registry has the digest recorded in the Checkpoint.
+func (r *PodReconciler) verifyImage(
+	ctx context.Context, checkpoint *checkpointrestorev1.Checkpoint, registry, image string, imageDigest digest.Digest,
+) error {
+	if r.ImageVerifier == nil {
+		return nil
+	}
+	registryAuth, _, err := checkpointrestore.ResolveCheckpointRegistry(ctx, r, r.RegistryResolver, checkpoint)
+	if err != nil {
+		return err
+	}
+	registryAuth.URL = registry
+	return r.ImageVerifier.VerifyImage(ctx, registryAuth, image, imageDigest)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *PodReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
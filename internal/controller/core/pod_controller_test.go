@@ -18,14 +18,19 @@ package core
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
 	"github.com/GianOrtiz/kcr/pkg/util"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -43,6 +48,7 @@ var _ = Describe("Pod Controller", func() {
 	Context("When reconciling a resource", func() {
 		var (
 			podController  *PodReconciler
+			recorder       *record.FakeRecorder
 			ctx            context.Context
 			namespace      string
 			namespacedName types.NamespacedName
@@ -84,9 +90,11 @@ var _ = Describe("Pod Controller", func() {
 			}
 
 			// Create our test controller
+			recorder = record.NewFakeRecorder(10)
 			podController = &PodReconciler{
 				Client:          k8sClient,
 				RegistryAuthURL: registryAuthUrl,
+				Recorder:        recorder,
 			}
 		})
 
@@ -174,8 +182,307 @@ var _ = Describe("Pod Controller", func() {
 					var pod corev1.Pod
 					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
 					Expect(pod.Spec.Containers[0].Image).To(Equal(registryAuthUrl + "/kcr.io/checkpoint/test-checkpoint"))
+					Expect(pod.Annotations).To(HaveKeyWithValue(checkpointrestorev1.RestoredContainerAnnotation,
+						containerName))
+				})
+
+				It("should not restore the Pod without image digest when the signatures are verified", func() {
+					podController.ImageVerifier = &mockImageVerifier{}
+					podController.RequireImageDigest = true
+
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(recorder.Events).To(Receive(ContainSubstring(checkpointrestorev1.EventReasonRestoreFailed)))
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Spec.Containers[0].Image).To(Equal(containerImage))
+					Expect(pod.Annotations).NotTo(HaveKey(checkpointrestorev1.RestoreStatusAnnotation))
+				})
+
+				setRestoredContainerState := func(state corev1.ContainerState) {
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+						Name:  containerName,
+						Image: pod.Spec.Containers[0].Image,
+						State: state,
+					}}
+					Expect(k8sClient.Status().Update(ctx, &pod)).To(Succeed())
+				}
+
+				It("should record the restore and report when the restored container runs", func() {
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(recorder.Events).To(Receive(ContainSubstring(checkpointrestorev1.EventReasonRestoreTriggered)))
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Annotations).To(HaveKeyWithValue(checkpointrestorev1.RestoreStatusAnnotation,
+						checkpointrestorev1.RestoreStatusRestoring))
+
+					setRestoredContainerState(corev1.ContainerState{Running: &corev1.ContainerStateRunning{}})
+					_, err = podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Annotations).To(HaveKeyWithValue(checkpointrestorev1.RestoreStatusAnnotation,
+						checkpointrestorev1.RestoreStatusRestored))
+					Eventually(recorder.Events).Should(Receive(ContainSubstring(
+						checkpointrestorev1.EventReasonRestoreSucceeded)))
+				})
+
+				It("should report the restore failed and not restore the Pod again", func() {
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					setRestoredContainerState(corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1},
+					})
+					_, err = podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Annotations).To(HaveKeyWithValue(checkpointrestorev1.RestoreStatusAnnotation,
+						checkpointrestorev1.RestoreStatusFailed))
+					Eventually(recorder.Events).Should(Receive(ContainSubstring(
+						checkpointrestorev1.EventReasonRestoreFailed)))
+
+					_, err = podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Annotations).To(HaveKeyWithValue(checkpointrestorev1.RestoreStatusAnnotation,
+						checkpointrestorev1.RestoreStatusFailed))
+				})
+			})
+
+			Describe("When a newer checkpoint of the Pod is still being built", func() {
+				BeforeEach(func() {
+					for _, checkpoint := range []checkpointrestorev1.Checkpoint{
+						{
+							ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "built-checkpoint"},
+							Status: checkpointrestorev1.CheckpointStatus{
+								CheckpointImage: "kcr.io/checkpoint/built-checkpoint",
+								Phase:           checkpointrestorev1.CheckpointPhaseImageBuilt,
+							},
+						},
+						{
+							ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "building-checkpoint"},
+							Status: checkpointrestorev1.CheckpointStatus{
+								Phase: checkpointrestorev1.CheckpointPhaseProcessing,
+							},
+						},
+					} {
+						checkpoint.Labels = map[string]string{"pod": podName}
+						checkpoint.Spec = checkpointrestorev1.CheckpointSpec{Schedule: "* * * * *"}
+						status := checkpoint.Status
+						Expect(k8sClient.Create(ctx, &checkpoint)).To(Succeed())
+						checkpoint.Status = status
+						Expect(k8sClient.Status().Update(ctx, &checkpoint)).To(Succeed())
+						// The creation timestamps have a precision of a second.
+						time.Sleep(time.Second)
+					}
+				})
+
+				It("should restore the Pod using the newest built checkpoint image", func() {
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Spec.Containers[0].Image).To(Equal(registryAuthUrl + "/kcr.io/checkpoint/built-checkpoint"))
+				})
+			})
+
+			Describe("When the checkpoint of the Pod is in another namespace", func() {
+				var checkpointNamespace string
+
+				// grant creates a CheckpointAccessGrant in namespace granting the access to the kind.
+				grant := func(namespace, fromNamespace, kind string) {
+					Expect(k8sClient.Create(ctx, &checkpointrestorev1.CheckpointAccessGrant{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "grant",
+							Namespace: namespace,
+						},
+						Spec: checkpointrestorev1.CheckpointAccessGrantSpec{
+							From: []checkpointrestorev1.CheckpointAccessGrantFrom{{Namespace: fromNamespace}},
+							To:   []checkpointrestorev1.CheckpointAccessGrantTo{{Kind: kind}},
+						},
+					})).To(Succeed())
+				}
+
+				BeforeEach(func() {
+					checkpointNamespace = "ns-" + util.RandStringRunes(5)
+					Expect(k8sClient.Create(ctx, &corev1.Namespace{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: checkpointNamespace,
+						},
+					})).To(Succeed())
+					checkpoint := checkpointrestorev1.Checkpoint{
+						ObjectMeta: metav1.ObjectMeta{
+							Namespace: checkpointNamespace,
+							Name:      "test-checkpoint",
+							Labels: map[string]string{
+								"pod":    podName,
+								"pod-ns": namespace,
+							},
+						},
+					}
+					Expect(k8sClient.Create(ctx, &checkpoint)).To(Succeed())
+					checkpoint.Status.CheckpointImage = "kcr.io/checkpoint/test-checkpoint"
+					checkpoint.Status.Phase = "ImageBuilt"
+					Expect(k8sClient.Status().Update(ctx, &checkpoint)).To(Succeed())
+				})
+
+				It("should not restore the Pod when the namespace of the checkpoint does not grant it", func() {
+					grant(namespace, checkpointNamespace, checkpointrestorev1.CheckpointAccessGrantPodKind)
+
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Spec.Containers[0].Image).To(Equal(containerImage))
+				})
+
+				It("should not restore the Pod when its namespace does not grant the checkpoint", func() {
+					grant(checkpointNamespace, namespace, checkpointrestorev1.CheckpointAccessGrantCheckpointKind)
+
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Spec.Containers[0].Image).To(Equal(containerImage))
+				})
+
+				It("should restore the Pod when both namespaces grant it", func() {
+					grant(namespace, checkpointNamespace, checkpointrestorev1.CheckpointAccessGrantPodKind)
+					grant(checkpointNamespace, namespace, checkpointrestorev1.CheckpointAccessGrantCheckpointKind)
+
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Spec.Containers[0].Image).To(Equal(registryAuthUrl + "/kcr.io/checkpoint/test-checkpoint"))
+					Expect(pod.Annotations).To(HaveKeyWithValue(checkpointrestorev1.RestoredCheckpointAnnotation,
+						checkpointNamespace+"/test-checkpoint"))
+				})
+			})
+
+			Describe("When the latest checkpoint records its image digest", func() {
+				const imageDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+				BeforeEach(func() {
+					checkpoint := checkpointrestorev1.Checkpoint{
+						ObjectMeta: metav1.ObjectMeta{
+							Namespace: namespace,
+							Name:      "test-checkpoint",
+							Labels: map[string]string{
+								"pod": podName,
+							},
+						},
+					}
+					Expect(k8sClient.Create(ctx, &checkpoint)).To(Succeed())
+					checkpoint.Status.CheckpointImage = "checkpoint-test-checkpoint"
+					checkpoint.Status.RuntimeImage = "checkpoint-test-checkpoint:latest"
+					checkpoint.Status.ImageDigest = imageDigest
+					checkpoint.Status.Phase = "ImageBuilt"
+					Expect(k8sClient.Status().Update(ctx, &checkpoint)).To(Succeed())
+				})
+
+				It("should restore the Pod from the verified image digest", func() {
+					imageVerifier := &mockImageVerifier{}
+					podController.ImageVerifier = imageVerifier
+
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(imageVerifier.verifiedImage).To(Equal("checkpoint-test-checkpoint@" + imageDigest))
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Spec.Containers[0].Image).To(
+						Equal(registryAuthUrl + "/checkpoint-test-checkpoint@" + imageDigest))
+					Expect(pod.Annotations).To(
+						HaveKeyWithValue(checkpointrestorev1.RestoredCheckpointAnnotation, "test-checkpoint"))
+				})
+
+				It("should not restore the Pod when the image digest does not match", func() {
+					podController.ImageVerifier = &mockImageVerifier{
+						mockedResult: fmt.Errorf("%w: digest mismatch", imagebuilder.ErrImageNotVerified),
+					}
+
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(recorder.Events).To(Receive(ContainSubstring(checkpointrestorev1.EventReasonRestoreFailed)))
+					Expect(failedRestores(namespace)).To(Equal(1.0))
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Spec.Containers[0].Image).To(Equal(containerImage))
+				})
+
+				It("should retry the restore when the image cannot be verified yet", func() {
+					podController.ImageVerifier = &mockImageVerifier{mockedResult: fmt.Errorf("registry unavailable")}
+
+					_, err := podController.Reconcile(ctx, reconcile.Request{
+						NamespacedName: namespacedName,
+					})
+					Expect(err).To(HaveOccurred())
+					Expect(failedRestores(namespace)).To(BeZero())
+
+					var pod corev1.Pod
+					Expect(k8sClient.Get(ctx, namespacedName, &pod)).To(Succeed())
+					Expect(pod.Spec.Containers[0].Image).To(Equal(containerImage))
 				})
 			})
 		})
 	})
 })
+
+// failedRestores returns the failed restores counted in the namespace.
+func failedRestores(namespace string) float64 {
+	families, err := ctrlmetrics.Registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != "kcr_restores_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["namespace"] == namespace && labels["result"] == "failed" {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
@@ -24,6 +24,7 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -35,6 +36,7 @@ import (
 
 	// +kubebuilder:scaffold:imports
 	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/imagebuilder"
 )
 
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
@@ -54,6 +56,20 @@ func TestControllers(t *testing.T) {
 	RunSpecs(t, "Controller Suite")
 }
 
+// Mock implementation of ImageVerifier.
+type mockImageVerifier struct {
+	mockedResult error
+	// verifiedImage is the last verified image.
+	verifiedImage string
+}
+
+func (m *mockImageVerifier) VerifyImage(
+	ctx context.Context, registryAuth imagebuilder.RegistryAuth, imageName string, imageDigest digest.Digest,
+) error {
+	m.verifiedImage = imageName
+	return m.mockedResult
+}
+
 var _ = BeforeSuite(func() {
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
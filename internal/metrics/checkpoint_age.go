@@ -0,0 +1,124 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+// listTimeout bounds the time a scrape waits for the checkpoints to be listed.
+const listTimeout = 5 * time.Second
+
+var newestCheckpointAge = prometheus.NewDesc(
+	"kcr_newest_checkpoint_age_seconds",
+	"Age of the newest checkpoint with a built image of each workload, +Inf when none of its checkpoints has "+
+		"an image. The workload is the CheckpointSchedule of the scheduled checkpoints and the Pod otherwise.",
+	[]string{"namespace", "workload_kind", "workload"}, nil,
+)
+
+// workload identifies the workload a checkpoint was created for.
+type workload struct {
+	namespace string
+	kind      string
+	name      string
+}
+
+// checkpointAgeCollector computes the age of the newest usable checkpoint of each workload when the metrics
+// are scraped, so the age keeps growing when no checkpoint is created.
+type checkpointAgeCollector struct {
+	reader client.Reader
+	// now returns the time the ages are computed at.
+	now func() time.Time
+}
+
+// RegisterCheckpointAgeCollector registers the collector of the age of the newest checkpoint of the
+// workloads, which lists the checkpoints with the reader on every scrape.
+func RegisterCheckpointAgeCollector(reader client.Reader) error {
+	return ctrlmetrics.Registry.Register(&checkpointAgeCollector{reader: reader, now: time.Now})
+}
+
+// Describe implements prometheus.Collector.
+func (c *checkpointAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- newestCheckpointAge
+}
+
+// Collect implements prometheus.Collector.
+func (c *checkpointAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	var checkpointList checkpointrestorev1.CheckpointList
+	if err := c.reader.List(ctx, &checkpointList); err != nil {
+		// Failing the metric would fail the whole scrape, the ages are only missing from this one.
+		log.Log.WithName("metrics").Error(err, "unable to list Checkpoints")
+		return
+	}
+
+	now := c.now()
+	ages := map[workload]float64{}
+	for _, checkpoint := range checkpointList.Items {
+		key, ok := checkpointWorkload(&checkpoint)
+		if !ok {
+			continue
+		}
+		age, found := ages[key]
+		if !found {
+			age = math.Inf(1)
+		}
+		if checkpoint.Status.Phase == checkpointrestorev1.CheckpointPhaseImageBuilt {
+			created := checkpoint.CreationTimestamp.Time
+			if checkpoint.Spec.CheckpointTimestamp != nil {
+				created = checkpoint.Spec.CheckpointTimestamp.Time
+			}
+			age = math.Min(age, now.Sub(created).Seconds())
+		}
+		ages[key] = age
+	}
+	for key, age := range ages {
+		ch <- prometheus.MustNewConstMetric(newestCheckpointAge, prometheus.GaugeValue, age,
+			key.namespace, key.kind, key.name)
+	}
+}
+
+// checkpointWorkload returns the workload of the checkpoint, and false when it is unknown.
+func checkpointWorkload(checkpoint *checkpointrestorev1.Checkpoint) (workload, bool) {
+	if ref := checkpoint.Spec.CheckpointScheduleRef; ref != nil {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = checkpoint.Namespace
+		}
+		return workload{namespace: namespace, kind: "CheckpointSchedule", name: ref.Name}, true
+	}
+	pod, ok := checkpoint.Labels["pod"]
+	if !ok {
+		return workload{}, false
+	}
+	namespace, ok := checkpoint.Labels["pod-ns"]
+	if !ok {
+		namespace = checkpoint.Namespace
+	}
+	return workload{namespace: namespace, kind: "Pod", name: pod}, true
+}
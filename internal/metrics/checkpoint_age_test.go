@@ -0,0 +1,135 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+// testNow is the time the test ages are computed at.
+var testNow = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+const newestCheckpointAgeHeader = `# HELP kcr_newest_checkpoint_age_seconds Age of the newest checkpoint with a built image of each ` +
+	`workload, +Inf when none of its checkpoints has an image. The workload is the CheckpointSchedule of the ` +
+	`scheduled checkpoints and the Pod otherwise.
+# TYPE kcr_newest_checkpoint_age_seconds gauge`
+
+// testCheckpoint returns a checkpoint created age before testNow in the phase.
+func testCheckpoint(name string, age time.Duration, phase checkpointrestorev1.CheckpointPhase) *checkpointrestorev1.Checkpoint {
+	return &checkpointrestorev1.Checkpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "team-a",
+			CreationTimestamp: metav1.NewTime(testNow.Add(-age)),
+		},
+		Status: checkpointrestorev1.CheckpointStatus{Phase: phase},
+	}
+}
+
+// scheduled sets the CheckpointSchedule of the checkpoint.
+func scheduled(checkpoint *checkpointrestorev1.Checkpoint, schedule string) *checkpointrestorev1.Checkpoint {
+	checkpoint.Spec.CheckpointScheduleRef = &corev1.ObjectReference{Name: schedule}
+	return checkpoint
+}
+
+// ofPod sets the labels of the checkpoint of a pod of the namespace.
+func ofPod(checkpoint *checkpointrestorev1.Checkpoint, namespace, pod string) *checkpointrestorev1.Checkpoint {
+	checkpoint.Labels = map[string]string{"pod": pod, "pod-ns": namespace}
+	return checkpoint
+}
+
+func TestCheckpointAgeCollector(t *testing.T) {
+	built := checkpointrestorev1.CheckpointPhaseImageBuilt
+	timestamped := testCheckpoint("timestamped", time.Hour, built)
+	checkpointTime := metav1.NewTime(testNow.Add(-30 * time.Second))
+	timestamped.Spec.CheckpointTimestamp = &checkpointTime
+
+	tests := []struct {
+		name        string
+		checkpoints []*checkpointrestorev1.Checkpoint
+		want        string
+	}{
+		{
+			name: "newest built checkpoint of each workload",
+			checkpoints: []*checkpointrestorev1.Checkpoint{
+				scheduled(testCheckpoint("web-1", 10*time.Minute, built), "web"),
+				scheduled(testCheckpoint("web-2", 2*time.Minute, built), "web"),
+				scheduled(testCheckpoint("web-3", time.Minute, checkpointrestorev1.CheckpointPhaseProcessing), "web"),
+				ofPod(testCheckpoint("db-0", 5*time.Minute, built), "team-b", "db-0"),
+			},
+			want: `
+kcr_newest_checkpoint_age_seconds{namespace="team-a",workload="web",workload_kind="CheckpointSchedule"} 120
+kcr_newest_checkpoint_age_seconds{namespace="team-b",workload="db-0",workload_kind="Pod"} 300
+`,
+		},
+		{
+			name: "workload without built checkpoint",
+			checkpoints: []*checkpointrestorev1.Checkpoint{
+				scheduled(testCheckpoint("web-1", time.Minute, checkpointrestorev1.CheckpointPhaseFailed), "web"),
+			},
+			want: `
+kcr_newest_checkpoint_age_seconds{namespace="team-a",workload="web",workload_kind="CheckpointSchedule"} +Inf
+`,
+		},
+		{
+			name:        "checkpoint timestamp",
+			checkpoints: []*checkpointrestorev1.Checkpoint{ofPod(timestamped, "team-a", "web-0")},
+			want: `
+kcr_newest_checkpoint_age_seconds{namespace="team-a",workload="web-0",workload_kind="Pod"} 30
+`,
+		},
+		{
+			name:        "checkpoint of an unknown workload",
+			checkpoints: []*checkpointrestorev1.Checkpoint{testCheckpoint("unknown", time.Minute, built)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			if err := checkpointrestorev1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			var objects []client.Object
+			for _, checkpoint := range tt.checkpoints {
+				objects = append(objects, checkpoint)
+			}
+			collector := &checkpointAgeCollector{
+				reader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+				now:    func() time.Time { return testNow },
+			}
+
+			want := ""
+			if tt.want != "" {
+				want = newestCheckpointAgeHeader + tt.want
+			}
+			if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics defines the Prometheus metrics of the checkpoints and restores. They are registered in the
+// registry of controller-runtime, served on the metrics endpoint of the manager and of the agents.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+const (
+	// StageKubelet is the checkpoint of the container by the kubelet.
+	StageKubelet = "kubelet"
+	// StageBuild is the build of the checkpoint image from the checkpoint archive.
+	StageBuild = "build"
+	// StagePush is the push of the checkpoint image to its registry, and its signature.
+	StagePush = "push"
+
+	// ResultSucceeded and ResultFailed are the results of the checkpoints and restores.
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+)
+
+var (
+	checkpointStageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "kcr_checkpoint_stage_duration_seconds",
+		Help: "Duration of the successful stages of the checkpoints: the kubelet checkpoint, the image build " +
+			"and the image push.",
+		// From 0.5 seconds to about 17 minutes.
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"namespace", "stage"})
+
+	checkpointArchiveSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "kcr_checkpoint_archive_size_bytes",
+		Help: "Size of the checkpoint archives written by the kubelet.",
+		// From 1 MiB to 256 GiB.
+		Buckets: prometheus.ExponentialBuckets(1<<20, 4, 10),
+	}, []string{"namespace"})
+
+	checkpointImageSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kcr_checkpoint_image_size_bytes",
+		Help:    "Size of the checkpoint image layers pushed to the registry.",
+		Buckets: prometheus.ExponentialBuckets(1<<20, 4, 10),
+	}, []string{"namespace"})
+
+	checkpoints = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kcr_checkpoints_total",
+		Help: "Number of checkpoints by result. The reason is the reason of the Event of the last transition " +
+			"of the checkpoint.",
+	}, []string{"namespace", "schedule", "result", "reason"})
+
+	restores = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kcr_restores_total",
+		Help: "Number of containers restored from a checkpoint by result.",
+	}, []string{"namespace", "result"})
+
+	restoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "kcr_restore_duration_seconds",
+		Help: "Time to run a container restored from a checkpoint, from the failure of the previous container " +
+			"or the creation of the restored pod.",
+		// From 0.5 seconds to about 17 minutes.
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"namespace"})
+
+	scheduleLag = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "kcr_checkpoint_schedule_lag_seconds",
+		Help: "Delay between the creation of the CheckpointRequest of a scheduled checkpoint and the start " +
+			"of the checkpoint.",
+		// From 0.1 seconds to about 7 minutes.
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 13),
+	}, []string{"namespace", "schedule"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		checkpointStageDuration,
+		checkpointArchiveSize,
+		checkpointImageSize,
+		checkpoints,
+		restores,
+		restoreDuration,
+		scheduleLag,
+	)
+}
+
+// ObserveCheckpointStage records the duration of a successful stage of a checkpoint started at start.
+func ObserveCheckpointStage(namespace, stage string, start time.Time) {
+	checkpointStageDuration.WithLabelValues(namespace, stage).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCheckpointSizes records the size of the archive and of the image of a checkpoint, the sizes which
+// are not known are not recorded.
+func ObserveCheckpointSizes(namespace string, archiveSize, imageSize int64) {
+	if archiveSize > 0 {
+		checkpointArchiveSize.WithLabelValues(namespace).Observe(float64(archiveSize))
+	}
+	if imageSize > 0 {
+		checkpointImageSize.WithLabelValues(namespace).Observe(float64(imageSize))
+	}
+}
+
+// CheckpointSucceeded counts a checkpoint whose image was pushed. The schedule is empty for the checkpoints
+// which were not scheduled.
+func CheckpointSucceeded(namespace, schedule string) {
+	checkpoints.WithLabelValues(namespace, schedule, ResultSucceeded, checkpointrestorev1.EventReasonImagePushed).Inc()
+}
+
+// CheckpointFailed counts a checkpoint which failed with the reason. The schedule is empty for the
+// checkpoints which were not scheduled.
+func CheckpointFailed(namespace, schedule, reason string) {
+	checkpoints.WithLabelValues(namespace, schedule, ResultFailed, reason).Inc()
+}
+
+// RestoreSucceeded counts a container restored from a checkpoint, which took duration to run.
+func RestoreSucceeded(namespace string, duration time.Duration) {
+	restores.WithLabelValues(namespace, ResultSucceeded).Inc()
+	restoreDuration.WithLabelValues(namespace).Observe(duration.Seconds())
+}
+
+// RestoreFailed counts a container which could not be restored from a checkpoint.
+func RestoreFailed(namespace string) {
+	restores.WithLabelValues(namespace, ResultFailed).Inc()
+}
+
+// ObserveScheduleLag records the lag of a scheduled checkpoint whose CheckpointRequest was created at
+// created.
+func ObserveScheduleLag(namespace, schedule string, created time.Time) {
+	scheduleLag.WithLabelValues(namespace, schedule).Observe(time.Since(created).Seconds())
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+func TestCheckpointCounters(t *testing.T) {
+	checkpoints.Reset()
+	t.Cleanup(checkpoints.Reset)
+
+	CheckpointSucceeded("team-a", "web")
+	CheckpointSucceeded("team-a", "web")
+	CheckpointFailed("team-a", "web", checkpointrestorev1.EventReasonImageBuildFailed)
+	CheckpointFailed("team-b", "", checkpointrestorev1.EventReasonImageBuildFailed)
+
+	want := `
+# HELP kcr_checkpoints_total Number of checkpoints by result. The reason is the reason of the Event of the last ` +
+		`transition of the checkpoint.
+# TYPE kcr_checkpoints_total counter
+kcr_checkpoints_total{namespace="team-a",reason="` + checkpointrestorev1.EventReasonImagePushed +
+		`",result="succeeded",schedule="web"} 2
+kcr_checkpoints_total{namespace="team-a",reason="` + checkpointrestorev1.EventReasonImageBuildFailed +
+		`",result="failed",schedule="web"} 1
+kcr_checkpoints_total{namespace="team-b",reason="` + checkpointrestorev1.EventReasonImageBuildFailed +
+		`",result="failed",schedule=""} 1
+`
+	if err := testutil.CollectAndCompare(checkpoints, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRestoreCounters(t *testing.T) {
+	restores.Reset()
+	restoreDuration.Reset()
+	t.Cleanup(func() {
+		restores.Reset()
+		restoreDuration.Reset()
+	})
+
+	RestoreSucceeded("team-a", 3*time.Second)
+	RestoreFailed("team-a")
+	RestoreFailed("team-a")
+
+	want := `
+# HELP kcr_restores_total Number of containers restored from a checkpoint by result.
+# TYPE kcr_restores_total counter
+kcr_restores_total{namespace="team-a",result="failed"} 2
+kcr_restores_total{namespace="team-a",result="succeeded"} 1
+`
+	if err := testutil.CollectAndCompare(restores, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if count := testutil.CollectAndCount(restoreDuration); count != 1 {
+		t.Errorf("restore durations have %d series, want 1", count)
+	}
+}
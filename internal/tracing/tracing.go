@@ -0,0 +1,145 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing traces the checkpoints with OpenTelemetry. A trace starts when a checkpoint is triggered
+// and its context is carried from a resource to the next in the checkpointrestorev1.TraceContextAnnotation,
+// so the spans of the manager and of the agents of every stage of a checkpoint belong to the same trace.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+// tracerName is the name of the tracer of the spans of kcr.
+const tracerName = "github.com/GianOrtiz/kcr"
+
+// traceParentHeader is the key of the W3C trace context propagated in the annotation.
+const traceParentHeader = "traceparent"
+
+// propagator encodes the span contexts in the annotations.
+var propagator = propagation.TraceContext{}
+
+// Options configure the export of the spans.
+type Options struct {
+	// Endpoint is the host:port of the OTLP gRPC collector the spans are exported to. The spans are not
+	// exported when empty.
+	Endpoint string
+	// Insecure exports the spans without TLS.
+	Insecure bool
+	// ServiceName is the name of the service the spans are exported for, e.g. kcr-manager.
+	ServiceName string
+}
+
+// Setup exports the spans in batches to the OTLP collector of the options or, when exporter is not nil, as
+// they end to the exporter, e.g. an in-memory exporter in the tests. It returns the function exporting the
+// remaining spans and stopping the export on shutdown. The spans are not recorded when there is neither an
+// endpoint nor an exporter.
+func Setup(
+	ctx context.Context, options Options, exporter sdktrace.SpanExporter,
+) (func(context.Context) error, error) {
+	var processor sdktrace.SpanProcessor
+	switch {
+	case exporter != nil:
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	case options.Endpoint != "":
+		exporterOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(options.Endpoint)}
+		if options.Insecure {
+			exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+		}
+		otlpExporter, err := otlptracegrpc.New(ctx, exporterOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+		processor = sdktrace.NewBatchSpanProcessor(otlpExporter)
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(options.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of a stage of a checkpoint. When ctx has no span, the span continues the trace of
+// the TraceContextAnnotation of the object, and starts a new trace when the object has none.
+func Start(
+	ctx context.Context, obj client.Object, name string, attributes ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	if obj != nil && !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = Extract(ctx, obj)
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, attributes...)
+}
+
+// Extract returns ctx with the remote span context of the TraceContextAnnotation of the object, or ctx
+// when the object has none.
+func Extract(ctx context.Context, obj client.Object) context.Context {
+	traceParent, ok := obj.GetAnnotations()[checkpointrestorev1.TraceContextAnnotation]
+	if !ok {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{traceParentHeader: traceParent})
+}
+
+// Inject sets the TraceContextAnnotation of the object to the span context of ctx, so the stages processing
+// the object continue its trace. Nothing is set when ctx has no span context, as when tracing is disabled
+// and the trace was not started by another component.
+func Inject(ctx context.Context, obj client.Object) {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	traceParent, ok := carrier[traceParentHeader]
+	if !ok {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[checkpointrestorev1.TraceContextAnnotation] = traceParent
+	obj.SetAnnotations(annotations)
+}
+
+// Fail records the error on the span and sets its status to error.
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span of a stage, failed with err when it is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		Fail(span, err)
+	}
+	span.End()
+}
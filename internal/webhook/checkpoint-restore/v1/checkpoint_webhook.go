@@ -0,0 +1,116 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+// log is for logging in this package.
+var checkpointlog = logf.Log.WithName("checkpoint-resource")
+
+// SetupCheckpointWebhookWithManager registers the webhook for Checkpoint in the manager. managerUsername is the
+// user of the controller manager.
+func SetupCheckpointWebhookWithManager(mgr ctrl.Manager, managerUsername string) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&checkpointrestorev1.Checkpoint{}).
+		WithValidator(&CheckpointCustomValidator{managerUsername: managerUsername}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-checkpoint-restore-kcr-io-v1-checkpoint,mutating=false,failurePolicy=fail,sideEffects=None,groups=checkpoint-restore.kcr.io,resources=checkpoints,verbs=create;update,versions=v1,name=vcheckpoint-v1.kb.io,admissionReviewVersions=v1
+
+// CheckpointCustomValidator only lets the controller manager create the Checkpoints with a checkpoint archive.
+// The agents build the image of the archive a Checkpoint points to with their own permissions, so a user
+// able to create Checkpoints could otherwise have the archive of any pod of a node pushed to its registry.
+// Users only create the imported Checkpoints, which have no archive.
+type CheckpointCustomValidator struct {
+	// managerUsername is the user of the controller manager, no other user creates Checkpoints with an
+	// archive when empty.
+	managerUsername string
+}
+
+var _ webhook.CustomValidator = &CheckpointCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type Checkpoint.
+func (v *CheckpointCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	checkpoint, ok := obj.(*checkpointrestorev1.Checkpoint)
+	if !ok {
+		return nil, fmt.Errorf("expected a Checkpoint object but got %T", obj)
+	}
+	checkpointlog.Info("Validation for Checkpoint upon creation", "name", checkpoint.GetName())
+
+	isManager, err := v.isManager(ctx)
+	if err != nil || isManager {
+		return nil, err
+	}
+	if _, imported := checkpoint.Annotations[checkpointrestorev1.ImportedCheckpointAnnotation]; !imported {
+		return nil, errors.New("only the controller manager creates Checkpoints, create a CheckpointRequest instead")
+	}
+	if checkpoint.Spec.CheckpointData != "" || checkpoint.Spec.NodeName != "" {
+		return nil, errors.New("imported Checkpoints cannot set spec.checkpointData nor spec.nodeName")
+	}
+	return nil, nil
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type Checkpoint.
+func (v *CheckpointCustomValidator) ValidateUpdate(
+	ctx context.Context, oldObj, newObj runtime.Object,
+) (admission.Warnings, error) {
+	checkpoint, ok := newObj.(*checkpointrestorev1.Checkpoint)
+	if !ok {
+		return nil, fmt.Errorf("expected a Checkpoint object for the newObj but got %T", newObj)
+	}
+	oldCheckpoint, ok := oldObj.(*checkpointrestorev1.Checkpoint)
+	if !ok {
+		return nil, fmt.Errorf("expected a Checkpoint object for the oldObj but got %T", oldObj)
+	}
+	checkpointlog.Info("Validation for Checkpoint upon update", "name", checkpoint.GetName())
+
+	isManager, err := v.isManager(ctx)
+	if err != nil || isManager {
+		return nil, err
+	}
+	if checkpoint.Spec.CheckpointData != oldCheckpoint.Spec.CheckpointData ||
+		checkpoint.Spec.NodeName != oldCheckpoint.Spec.NodeName {
+		return nil, errors.New("only the controller manager changes spec.checkpointData and spec.nodeName")
+	}
+	return nil, nil
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type Checkpoint.
+func (v *CheckpointCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// isManager reports whether the admission request in the context is made by the controller manager.
+func (v *CheckpointCustomValidator) isManager(ctx context.Context) (bool, error) {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the admission request: %w", err)
+	}
+	return v.managerUsername != "" && req.UserInfo.Username == v.managerUsername, nil
+}
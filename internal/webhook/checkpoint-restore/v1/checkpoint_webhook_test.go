@@ -0,0 +1,111 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+var _ = Describe("Checkpoint Webhook", func() {
+	const managerUsername = "system:serviceaccount:kcr-system:kcr-controller-manager"
+
+	var (
+		obj       *checkpointrestorev1.Checkpoint
+		validator CheckpointCustomValidator
+	)
+
+	BeforeEach(func() {
+		obj = &checkpointrestorev1.Checkpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-checkpoint",
+				Namespace: "default",
+			},
+			Spec: checkpointrestorev1.CheckpointSpec{
+				CheckpointData: "checkpoint-web-0_default-app-1744851420.tar",
+				NodeName:       "node-1",
+			},
+		}
+		validator = CheckpointCustomValidator{managerUsername: managerUsername}
+	})
+
+	admissionContext := func(operation admissionv1.Operation, username string) context.Context {
+		return admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: operation,
+				UserInfo:  authenticationv1.UserInfo{Username: username},
+			},
+		})
+	}
+
+	Context("When creating a Checkpoint", func() {
+		It("Should allow the controller manager", func() {
+			_, err := validator.ValidateCreate(admissionContext(admissionv1.Create, managerUsername), obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny other users", func() {
+			_, err := validator.ValidateCreate(admissionContext(admissionv1.Create, "alice"), obj)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should deny every user when the controller manager is unknown", func() {
+			validator = CheckpointCustomValidator{}
+			_, err := validator.ValidateCreate(admissionContext(admissionv1.Create, ""), obj)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should allow users to import a Checkpoint without archive", func() {
+			obj.Annotations = map[string]string{checkpointrestorev1.ImportedCheckpointAnnotation: "prod/web-0"}
+			_, err := validator.ValidateCreate(admissionContext(admissionv1.Create, "alice"), obj)
+			Expect(err).To(HaveOccurred())
+
+			obj.Spec.CheckpointData = ""
+			obj.Spec.NodeName = ""
+			_, err = validator.ValidateCreate(admissionContext(admissionv1.Create, "alice"), obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When updating a Checkpoint", func() {
+		It("Should only let the controller manager change its archive", func() {
+			newObj := obj.DeepCopy()
+			newObj.Spec.CheckpointData = "../../etc/shadow"
+
+			_, err := validator.ValidateUpdate(admissionContext(admissionv1.Update, "alice"), obj, newObj)
+			Expect(err).To(HaveOccurred())
+			_, err = validator.ValidateUpdate(admissionContext(admissionv1.Update, managerUsername), obj, newObj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should let users change its labels", func() {
+			newObj := obj.DeepCopy()
+			newObj.Labels = map[string]string{"team": "a"}
+
+			_, err := validator.ValidateUpdate(admissionContext(admissionv1.Update, "alice"), obj, newObj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,61 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+// log is for logging in this package.
+var checkpointrequestlog = logf.Log.WithName("checkpointrequest-resource")
+
+// SetupCheckpointRequestWebhookWithManager registers the webhook for CheckpointRequest in the manager. managerUsername is
+// the user of the controller manager.
+func SetupCheckpointRequestWebhookWithManager(mgr ctrl.Manager, managerUsername string) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&checkpointrestorev1.CheckpointRequest{}).
+		WithDefaulter(&CheckpointRequestCustomDefaulter{recorder: requesterRecorder{managerUsername: managerUsername}}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-checkpoint-restore-kcr-io-v1-checkpointrequest,mutating=true,failurePolicy=fail,sideEffects=None,groups=checkpoint-restore.kcr.io,resources=checkpointrequests,verbs=create;update,versions=v1,name=mcheckpointrequest-v1.kb.io,admissionReviewVersions=v1
+
+// CheckpointRequestCustomDefaulter records the user who creates a CheckpointRequest in its
+// checkpointrestorev1.RequesterAnnotation.
+type CheckpointRequestCustomDefaulter struct {
+	recorder requesterRecorder
+}
+
+var _ webhook.CustomDefaulter = &CheckpointRequestCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind CheckpointRequest.
+func (d *CheckpointRequestCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	checkpointrequest, ok := obj.(*checkpointrestorev1.CheckpointRequest)
+	if !ok {
+		return fmt.Errorf("expected an CheckpointRequest object but got %T", obj)
+	}
+	checkpointrequestlog.Info("Defaulting for CheckpointRequest", "name", checkpointrequest.GetName())
+
+	return d.recorder.record(ctx, checkpointrequest)
+}
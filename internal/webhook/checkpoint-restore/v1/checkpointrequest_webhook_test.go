@@ -0,0 +1,127 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/access"
+)
+
+var _ = Describe("CheckpointRequest Webhook", func() {
+	const managerUsername = "system:serviceaccount:kcr-system:kcr-controller-manager"
+
+	var (
+		obj       *checkpointrestorev1.CheckpointRequest
+		defaulter CheckpointRequestCustomDefaulter
+		user      authenticationv1.UserInfo
+	)
+
+	BeforeEach(func() {
+		obj = &checkpointrestorev1.CheckpointRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-request",
+				Namespace: "default",
+			},
+		}
+		defaulter = CheckpointRequestCustomDefaulter{recorder: requesterRecorder{managerUsername: managerUsername}}
+		user = authenticationv1.UserInfo{
+			Username: "alice",
+			UID:      "alice-uid",
+			Groups:   []string{"developers", "system:authenticated"},
+		}
+	})
+
+	admissionContext := func(operation admissionv1.Operation, user authenticationv1.UserInfo,
+		oldObj runtime.Object) context.Context {
+		req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: operation,
+			UserInfo:  user,
+		}}
+		if oldObj != nil {
+			raw, err := json.Marshal(oldObj)
+			Expect(err).NotTo(HaveOccurred())
+			req.OldObject = runtime.RawExtension{Raw: raw}
+		}
+		return admission.NewContextWithRequest(context.Background(), req)
+	}
+
+	requester := func(obj *checkpointrestorev1.CheckpointRequest) authenticationv1.UserInfo {
+		requester, ok, err := access.Requester(obj)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		return requester
+	}
+
+	Context("When creating a CheckpointRequest", func() {
+		It("Should record the user who creates it", func() {
+			Expect(defaulter.Default(admissionContext(admissionv1.Create, user, nil), obj)).To(Succeed())
+			Expect(requester(obj)).To(Equal(user))
+		})
+
+		It("Should replace the requester set by a user", func() {
+			obj.Annotations = map[string]string{
+				checkpointrestorev1.RequesterAnnotation: `{"username":"cluster-admin"}`,
+			}
+			Expect(defaulter.Default(admissionContext(admissionv1.Create, user, nil), obj)).To(Succeed())
+			Expect(requester(obj)).To(Equal(user))
+		})
+
+		It("Should keep the requester set by the controller manager", func() {
+			value, err := access.RequesterValue(user)
+			Expect(err).NotTo(HaveOccurred())
+			obj.Annotations = map[string]string{checkpointrestorev1.RequesterAnnotation: value}
+
+			manager := authenticationv1.UserInfo{Username: managerUsername}
+			Expect(defaulter.Default(admissionContext(admissionv1.Create, manager, nil), obj)).To(Succeed())
+			Expect(requester(obj)).To(Equal(user))
+		})
+	})
+
+	Context("When updating a CheckpointRequest", func() {
+		It("Should keep the requester it was created with", func() {
+			oldObj := obj.DeepCopy()
+			Expect(defaulter.Default(admissionContext(admissionv1.Create, user, nil), oldObj)).To(Succeed())
+
+			obj.Annotations = map[string]string{
+				checkpointrestorev1.RequesterAnnotation: `{"username":"cluster-admin"}`,
+			}
+			other := authenticationv1.UserInfo{Username: "bob"}
+			Expect(defaulter.Default(admissionContext(admissionv1.Update, other, oldObj), obj)).To(Succeed())
+			Expect(requester(obj)).To(Equal(user))
+		})
+
+		It("Should not add a requester to a CheckpointRequest created without one", func() {
+			oldObj := obj.DeepCopy()
+			obj.Annotations = map[string]string{
+				checkpointrestorev1.RequesterAnnotation: `{"username":"cluster-admin"}`,
+			}
+			Expect(defaulter.Default(admissionContext(admissionv1.Update, user, oldObj), obj)).To(Succeed())
+			Expect(obj.Annotations).NotTo(HaveKey(checkpointrestorev1.RequesterAnnotation))
+		})
+	})
+})
@@ -0,0 +1,81 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/access"
+)
+
+// requesterRecorder records the user who creates an object in its checkpointrestorev1.RequesterAnnotation,
+// which the CheckpointRequest reconciler authorizes the checkpoints of pods against.
+type requesterRecorder struct {
+	// managerUsername is the user of the controller manager, which creates the CheckpointRequests of the
+	// CheckpointSchedules and PodClones with the requester of their owner already recorded.
+	managerUsername string
+}
+
+// record sets the requester of the object from the admission request in the context. The requester cannot
+// be changed by an update, and only the controller manager can set it on create.
+func (r requesterRecorder) record(ctx context.Context, obj client.Object) error {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the admission request: %w", err)
+	}
+
+	annotations := obj.GetAnnotations()
+	switch req.Operation {
+	case admissionv1.Create:
+		if _, ok := annotations[checkpointrestorev1.RequesterAnnotation]; ok &&
+			r.managerUsername != "" && req.UserInfo.Username == r.managerUsername {
+			return nil
+		}
+		requester, err := access.RequesterValue(req.UserInfo)
+		if err != nil {
+			return err
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[checkpointrestorev1.RequesterAnnotation] = requester
+	case admissionv1.Update:
+		var old metav1.PartialObjectMetadata
+		if err := json.Unmarshal(req.OldObject.Raw, &old); err != nil {
+			return fmt.Errorf("failed to decode the old object: %w", err)
+		}
+		requester, ok := old.Annotations[checkpointrestorev1.RequesterAnnotation]
+		if !ok {
+			delete(annotations, checkpointrestorev1.RequesterAnnotation)
+			break
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[checkpointrestorev1.RequesterAnnotation] = requester
+	}
+	obj.SetAnnotations(annotations)
+	return nil
+}
@@ -0,0 +1,100 @@
+// Package access decides whether a namespace may use the pods and the checkpoints of another namespace.
+//
+// A Checkpoint lives in the namespace of the CheckpointRequest that created it, which may differ from the
+// namespace of the checkpointed pod. A namespace always accesses its own pods and checkpoints, and accesses
+// the ones of another namespace only when a CheckpointAccessGrant of that namespace grants it.
+//
+// Besides the namespace, the user who requested a checkpoint must be allowed to checkpoint the pod, since
+// the operator checkpoints it with its own cluster-wide permissions.
+package access
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+// Allowed returns whether namespace may access the resource of the kind, a
+// checkpointrestorev1.CheckpointAccessGrant kind, named name in resourceNamespace.
+func Allowed(ctx context.Context, reader client.Reader, namespace, kind, resourceNamespace, name string) (bool, error) {
+	if namespace == resourceNamespace {
+		return true, nil
+	}
+	var grantList checkpointrestorev1.CheckpointAccessGrantList
+	if err := reader.List(ctx, &grantList, client.InNamespace(resourceNamespace)); err != nil {
+		return false, fmt.Errorf("failed to list CheckpointAccessGrants of namespace %s: %w", resourceNamespace, err)
+	}
+	for i := range grantList.Items {
+		if grants(&grantList.Items[i], namespace, kind, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// grants returns whether the grant gives namespace access to the resource of the kind named name.
+func grants(grant *checkpointrestorev1.CheckpointAccessGrant, namespace, kind, name string) bool {
+	from := false
+	for _, grantFrom := range grant.Spec.From {
+		if grantFrom.Namespace == namespace {
+			from = true
+			break
+		}
+	}
+	if !from {
+		return false
+	}
+	for _, to := range grant.Spec.To {
+		if to.Kind == kind && (to.Name == "" || to.Name == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RestoredCheckpoint returns the Checkpoint the pod is restored from, read from its
+// checkpointrestorev1.RestoredCheckpointAnnotation, and false when the pod is not restored from a checkpoint.
+func RestoredCheckpoint(pod *corev1.Pod) (types.NamespacedName, bool) {
+	value, ok := pod.Annotations[checkpointrestorev1.RestoredCheckpointAnnotation]
+	if !ok || value == "" {
+		return types.NamespacedName{}, false
+	}
+	if namespace, name, found := strings.Cut(value, "/"); found {
+		return types.NamespacedName{Namespace: namespace, Name: name}, true
+	}
+	return types.NamespacedName{Namespace: pod.Namespace, Name: value}, true
+}
+
+// RestoredContainer returns the container of the pod restored from the checkpoint image, named by its
+// checkpointrestorev1.RestoredContainerAnnotation, and false when the pod has no such container. The pods
+// restored before the annotation was set restored their first container.
+func RestoredContainer(pod *corev1.Pod) (corev1.Container, bool) {
+	name, ok := pod.Annotations[checkpointrestorev1.RestoredContainerAnnotation]
+	if !ok {
+		if len(pod.Spec.Containers) == 0 {
+			return corev1.Container{}, false
+		}
+		return pod.Spec.Containers[0], true
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == name {
+			return container, true
+		}
+	}
+	return corev1.Container{}, false
+}
+
+// RestoredCheckpointValue returns the checkpointrestorev1.RestoredCheckpointAnnotation of a pod of
+// podNamespace restored from the checkpoint.
+func RestoredCheckpointValue(podNamespace string, checkpoint types.NamespacedName) string {
+	if checkpoint.Namespace == podNamespace {
+		return checkpoint.Name
+	}
+	return checkpoint.String()
+}
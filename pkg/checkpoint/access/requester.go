@@ -0,0 +1,76 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	checkpointrestorev1 "github.com/GianOrtiz/kcr/api/checkpoint-restore/v1"
+)
+
+const (
+	// CheckpointResource and CheckpointSubresource form the pods/checkpoint permission a user needs in the
+	// namespace of a pod to checkpoint it. It is not a subresource served by the API server, RBAC grants it
+	// like any other.
+	CheckpointResource    = "pods"
+	CheckpointSubresource = "checkpoint"
+)
+
+// Requester returns the user recorded in the checkpointrestorev1.RequesterAnnotation of the object, and
+// false when the object has none.
+func Requester(obj client.Object) (authenticationv1.UserInfo, bool, error) {
+	value, ok := obj.GetAnnotations()[checkpointrestorev1.RequesterAnnotation]
+	if !ok || value == "" {
+		return authenticationv1.UserInfo{}, false, nil
+	}
+	var user authenticationv1.UserInfo
+	if err := json.Unmarshal([]byte(value), &user); err != nil {
+		return authenticationv1.UserInfo{}, false, fmt.Errorf("failed to parse the requester annotation: %w", err)
+	}
+	return user, true, nil
+}
+
+// RequesterValue returns the checkpointrestorev1.RequesterAnnotation of an object created by the user.
+func RequesterValue(user authenticationv1.UserInfo) (string, error) {
+	value, err := json.Marshal(user)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the requester: %w", err)
+	}
+	return string(value), nil
+}
+
+// CanCheckpoint returns whether the user may checkpoint the pod named name in namespace, asking the API
+// server with a SubjectAccessReview for the pods/checkpoint permission. When the user may not, it returns
+// the reason given by the authorizer.
+func CanCheckpoint(
+	ctx context.Context, c client.Client, user authenticationv1.UserInfo, namespace, name string,
+) (bool, string, error) {
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        "create",
+				Resource:    CheckpointResource,
+				Subresource: CheckpointSubresource,
+				Name:        name,
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+		},
+	}
+	if len(user.Extra) > 0 {
+		review.Spec.Extra = make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+		for key, value := range user.Extra {
+			review.Spec.Extra[key] = authorizationv1.ExtraValue(value)
+		}
+	}
+	if err := c.Create(ctx, review); err != nil {
+		return false, "", fmt.Errorf("failed to review the access of %s: %w", user.Username, err)
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
@@ -0,0 +1,146 @@
+// Package archive reads the checkpoint archives written by the kubelet checkpoint API.
+//
+// The archive is a tar file, optionally gzip compressed, created by the container engine with the CRIU
+// images in the checkpoint directory and the engine metadata in the root of the archive.
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// ConfigDumpFile is the container engine configuration of the checkpointed container.
+	ConfigDumpFile = "config.dump"
+	// SpecDumpFile is the OCI runtime specification of the checkpointed container.
+	SpecDumpFile = "spec.dump"
+
+	// containerManagerAnnotation is set by the container engine in the runtime specification.
+	containerManagerAnnotation = "io.container.manager"
+)
+
+// ContainerConfig is the content of the config.dump file.
+type ContainerConfig struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	RootfsImage     string    `json:"rootfsImage,omitempty"`
+	RootfsImageRef  string    `json:"rootfsImageRef,omitempty"`
+	RootfsImageName string    `json:"rootfsImageName,omitempty"`
+	OCIRuntime      string    `json:"runtime,omitempty"`
+	CreatedTime     time.Time `json:"createdTime"`
+	CheckpointedAt  time.Time `json:"checkpointedTime"`
+	RestoredAt      time.Time `json:"restoredTime"`
+	Restored        bool      `json:"restored"`
+}
+
+// Metadata is the information about the checkpointed container stored in the archive.
+type Metadata struct {
+	Config ContainerConfig
+	Spec   specs.Spec
+}
+
+// Engine returns the container engine that created the checkpoint, e.g. cri-o.
+func (m *Metadata) Engine() string {
+	return m.Spec.Annotations[containerManagerAnnotation]
+}
+
+// ReadMetadata reads the container configuration and runtime specification from the archive at location.
+func ReadMetadata(location string) (*Metadata, error) {
+	var (
+		metadata    Metadata
+		foundConfig bool
+		foundSpec   bool
+	)
+	err := walk(location, func(header *tar.Header, content io.Reader) (bool, error) {
+		switch entryName(header.Name) {
+		case ConfigDumpFile:
+			if err := json.NewDecoder(content).Decode(&metadata.Config); err != nil {
+				return false, fmt.Errorf("failed to decode %s: %w", ConfigDumpFile, err)
+			}
+			foundConfig = true
+		case SpecDumpFile:
+			if err := json.NewDecoder(content).Decode(&metadata.Spec); err != nil {
+				return false, fmt.Errorf("failed to decode %s: %w", SpecDumpFile, err)
+			}
+			foundSpec = true
+		}
+		return foundConfig && foundSpec, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !foundConfig {
+		return nil, fmt.Errorf("%s not found in checkpoint archive", ConfigDumpFile)
+	}
+	if !foundSpec {
+		return nil, fmt.Errorf("%s not found in checkpoint archive", SpecDumpFile)
+	}
+
+	return &metadata, nil
+}
+
+// walk calls fn for every entry of the archive at location until fn returns true or an error.
+func walk(location string, fn func(header *tar.Header, content io.Reader) (bool, error)) error {
+	file, err := os.Open(location)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader, err := Decompress(file)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read checkpoint archive: %w", err)
+		}
+
+		done, err := fn(header, tarReader)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// Decompress returns the tar stream of the checkpoint archive read from reader, decompressed when the
+// archive is gzip compressed.
+func Decompress(archive io.Reader) (io.Reader, error) {
+	reader := bufio.NewReader(archive)
+	magic, err := reader.Peek(2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint archive: %w", err)
+	}
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(reader)
+	}
+	return reader, nil
+}
+
+// entryName normalizes the name of an archive entry, removing the leading "./" or "/" added by some tools.
+func entryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
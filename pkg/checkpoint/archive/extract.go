@@ -0,0 +1,41 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Extract writes the files of the archive at location to directory, which must exist. Only the regular
+// files and the directories are extracted, with permissions restricted to the current user as the archive
+// holds the memory of the checkpointed processes.
+func Extract(location, directory string) error {
+	return walk(location, func(header *tar.Header, content io.Reader) (bool, error) {
+		name := entryName(header.Name)
+		if name == "" {
+			return false, nil
+		}
+		// entryName cleans the name from the root, so it never points outside of the directory.
+		target := filepath.Join(directory, filepath.FromSlash(name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return false, os.MkdirAll(target, 0o700)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+				return false, err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+			if err != nil {
+				return false, err
+			}
+			if _, err := io.Copy(file, content); err != nil {
+				_ = file.Close()
+				return false, fmt.Errorf("failed to extract %s: %w", name, err)
+			}
+			return false, file.Close()
+		}
+		return false, nil
+	})
+}
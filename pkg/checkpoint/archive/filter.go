@@ -0,0 +1,303 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/mnt"
+)
+
+const (
+	// RootfsDiffFile holds the changes of the container root file system since it was created.
+	RootfsDiffFile = "rootfs-diff.tar"
+	// DeletedFilesFile lists the files of the container image deleted by the container.
+	DeletedFilesFile = "deleted.files"
+
+	// mountpointsPrefix starts the names of the CRIU images of the mounts of the container, one per mount
+	// namespace.
+	mountpointsPrefix = CheckpointDirectory + "/mountpoints-"
+	// tmpfsPrefix starts the names of the CRIU images holding the files of the tmpfs mounted in the
+	// container, gzip compressed tar files named after the device of the tmpfs, or after its mount with
+	// older CRIU releases.
+	tmpfsPrefix = CheckpointDirectory + "/tmpfs-"
+)
+
+// Filter describes the data removed from a checkpoint archive before its image is built. The memory of
+// the process is never changed, only the files of the container root file system and of the tmpfs mounted
+// in the container are. The volumes bind mounted in the container, like secrets, are never in the archive.
+type Filter struct {
+	// ExcludePaths are directories of the container file system, like a tmpfs holding tokens, whose files
+	// are removed from the root file system diff and from the tmpfs dumped by CRIU.
+	ExcludePaths []string
+	// ExcludeFiles are patterns, in the syntax of path.Match, of files of the container file system
+	// removed from the root file system diff and from the tmpfs dumped by CRIU, e.g. /root/.aws/*.
+	ExcludeFiles []string
+	// ExcludeRootfsDiff removes the whole root file system diff, the container is restored on top of its
+	// image without the files it changed.
+	ExcludeRootfsDiff bool
+}
+
+// IsEmpty reports whether the filter does not remove anything.
+func (f Filter) IsEmpty() bool {
+	return len(f.ExcludePaths) == 0 && len(f.ExcludeFiles) == 0 && !f.ExcludeRootfsDiff
+}
+
+// Validate checks the filter patterns are valid.
+func (f Filter) Validate() error {
+	for _, pattern := range f.ExcludeFiles {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// excludes reports whether the file of the container file system at name is removed by the filter.
+func (f Filter) excludes(name string) bool {
+	name = "/" + entryName(name)
+	for _, excludedPath := range f.ExcludePaths {
+		excludedPath = path.Clean("/" + excludedPath)
+		if name == excludedPath || strings.HasPrefix(name, strings.TrimSuffix(excludedPath, "/")+"/") {
+			return true
+		}
+	}
+	for _, pattern := range f.ExcludeFiles {
+		// A matching directory excludes everything below it.
+		for dir := name; dir != "/"; dir = path.Dir(dir) {
+			if matched, _ := path.Match(pattern, dir); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tmpfsMount is a mount of a tmpfs in the container, the files below root in the tmpfs are at mountpoint in
+// the container file system.
+type tmpfsMount struct {
+	mountpoint string
+	root       string
+}
+
+// tmpfsExcludes reports whether the file at name in the tmpfs mounted at mounts is removed by the filter,
+// which is when it is removed at any of its mount points. The root of the tmpfs is always kept.
+func (f Filter) tmpfsExcludes(mounts []tmpfsMount, name string) bool {
+	name = "/" + entryName(name)
+	if name == "/" {
+		return false
+	}
+	for _, mount := range mounts {
+		relative, found := strings.CutPrefix(name, strings.TrimSuffix(mount.root, "/")+"/")
+		if !found {
+			continue
+		}
+		if f.excludes(path.Join(mount.mountpoint, relative)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readTmpfsMounts returns the mounts in the container of the tmpfs whose files CRIU dumped in the archive
+// at location, by the name of their image.
+func readTmpfsMounts(location string) (map[string][]tmpfsMount, error) {
+	images := map[string][]tmpfsMount{}
+	err := walk(location, func(header *tar.Header, content io.Reader) (bool, error) {
+		name := entryName(header.Name)
+		if !strings.HasPrefix(name, mountpointsPrefix) || !strings.HasSuffix(name, ".img") {
+			return false, nil
+		}
+		entries, err := readCRIUImage(content, "MNTS", &mnt.MntEntry{})
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for _, entry := range entries {
+			mount := entry.(*mnt.MntEntry)
+			fstype := mnt.Fstype(mount.GetFstype())
+			if (fstype != mnt.Fstype_TMPFS && fstype != mnt.Fstype_DEVTMPFS) || mount.GetExtMount() {
+				continue
+			}
+			// The mount points are relative to the root of the mount namespace, the container file system.
+			tmpfs := tmpfsMount{
+				mountpoint: path.Clean("/" + strings.TrimPrefix(mount.GetMountpoint(), ".")),
+				root:       path.Clean("/" + mount.GetRoot()),
+			}
+			for _, image := range []string{
+				fmt.Sprintf("%sdev-%d.tar.gz.img", tmpfsPrefix, mount.GetRootDev()),
+				fmt.Sprintf("%s%d.tar.gz.img", tmpfsPrefix, mount.GetMntId()),
+			} {
+				images[image] = append(images[image], tmpfs)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// FilterArchive writes the archive at source to destination, as an uncompressed tar file, without the data
+// removed by the filter. It returns the number of removed files. It fails when the archive holds a tmpfs
+// whose mount in the container is unknown, since its files could not be filtered.
+func FilterArchive(source, destination string, filter Filter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	filtersPaths := len(filter.ExcludePaths) > 0 || len(filter.ExcludeFiles) > 0
+	var tmpfsMounts map[string][]tmpfsMount
+	if filtersPaths {
+		var err error
+		if tmpfsMounts, err = readTmpfsMounts(source); err != nil {
+			return 0, err
+		}
+	}
+
+	file, err := os.Create(destination)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	removed := 0
+	writer := tar.NewWriter(file)
+	// writeFiltered writes the entry with its tar content filtered.
+	writeFiltered := func(header *tar.Header, content io.Reader, compressed bool, excludes func(string) bool) error {
+		filtered, err := filterTar(entryName(header.Name), content, compressed, excludes, destination)
+		if err != nil {
+			return err
+		}
+		removed += filtered.removed
+		defer func() {
+			_ = filtered.file.Close()
+			_ = os.Remove(filtered.file.Name())
+		}()
+		filteredHeader := *header
+		filteredHeader.Size = filtered.size
+		if err := writer.WriteHeader(&filteredHeader); err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, filtered.file)
+		return err
+	}
+	err = walk(source, func(header *tar.Header, content io.Reader) (bool, error) {
+		name := entryName(header.Name)
+		switch {
+		case name == RootfsDiffFile:
+			if filter.ExcludeRootfsDiff {
+				removed++
+				return false, nil
+			}
+			return false, writeFiltered(header, content, false, filter.excludes)
+		case name == DeletedFilesFile:
+			if filter.ExcludeRootfsDiff {
+				removed++
+				return false, nil
+			}
+		case filtersPaths && strings.HasPrefix(name, tmpfsPrefix) && strings.HasSuffix(name, ".tar.gz.img"):
+			mounts, ok := tmpfsMounts[name]
+			if !ok {
+				return false, fmt.Errorf("mount of the tmpfs dumped in %s not found, its files cannot be filtered", name)
+			}
+			return false, writeFiltered(header, content, true, func(name string) bool {
+				return filter.tmpfsExcludes(mounts, name)
+			})
+		}
+
+		if err := writer.WriteHeader(header); err != nil {
+			return false, err
+		}
+		_, err := io.Copy(writer, content)
+		return false, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return removed, file.Close()
+}
+
+// filteredTar is a tar file of the archive without the files removed by a filter.
+type filteredTar struct {
+	file    *os.File
+	size    int64
+	removed int
+}
+
+// filterTar writes the tar file named name of the archive, gzip compressed when compressed, without the
+// files removed by excludes to a temporary file next to destination. Its size must be known before it is
+// added to the archive.
+func filterTar(
+	name string, content io.Reader, compressed bool, excludes func(string) bool, destination string,
+) (*filteredTar, error) {
+	file, err := os.CreateTemp(filepath.Dir(destination), ".filtered-")
+	if err != nil {
+		return nil, err
+	}
+	filtered := &filteredTar{file: file}
+	fail := func(err error) (*filteredTar, error) {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+
+	var output io.Writer = file
+	var compressor *gzip.Writer
+	if compressed {
+		decompressed, err := gzip.NewReader(content)
+		if err != nil {
+			return fail(fmt.Errorf("failed to read %s: %w", name, err))
+		}
+		content = decompressed
+		compressor = gzip.NewWriter(file)
+		output = compressor
+	}
+	reader := tar.NewReader(content)
+	writer := tar.NewWriter(output)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fail(fmt.Errorf("failed to read %s: %w", name, err))
+		}
+		if excludes(header.Name) {
+			filtered.removed++
+			continue
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			return fail(err)
+		}
+		if _, err := io.Copy(writer, reader); err != nil {
+			return fail(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fail(err)
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return fail(err)
+		}
+	}
+
+	if filtered.size, err = file.Seek(0, io.SeekCurrent); err != nil {
+		return fail(err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return filtered, nil
+}
@@ -0,0 +1,241 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/mnt"
+	"google.golang.org/protobuf/proto"
+)
+
+// testEntry is a regular file of a test tar file.
+type testEntry struct {
+	name    string
+	content []byte
+}
+
+// tarFile returns the tar file of the entries, the names ending with a slash are directories.
+func tarFile(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var content bytes.Buffer
+	writer := tar.NewWriter(&content)
+	for _, entry := range entries {
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: entry.name, Mode: 0o600, Size: int64(len(entry.content))}
+		if strings.HasSuffix(entry.name, "/") {
+			header.Typeflag, header.Mode = tar.TypeDir, 0o700
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(entry.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return content.Bytes()
+}
+
+// gzipped returns the gzip compressed content.
+func gzipped(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+// mountpointsImage returns the CRIU image of the mounts.
+func mountpointsImage(t *testing.T, mounts ...*mnt.MntEntry) []byte {
+	t.Helper()
+	var image bytes.Buffer
+	for _, magic := range []string{"IMG_COMMON", "MNTS"} {
+		_ = binary.Write(&image, binary.LittleEndian, uint32(criuMagic.ByName[magic]))
+	}
+	for _, mount := range mounts {
+		payload, err := proto.Marshal(mount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = binary.Write(&image, binary.LittleEndian, uint32(len(payload)))
+		image.Write(payload)
+	}
+	return image.Bytes()
+}
+
+// tmpfsMountEntry returns the CRIU mount entry of a tmpfs of the device mounted at mountpoint.
+func tmpfsMountEntry(mntID, rootDev uint32, mountpoint string, external bool) *mnt.MntEntry {
+	return &mnt.MntEntry{
+		Fstype:      proto.Uint32(uint32(mnt.Fstype_TMPFS)),
+		MntId:       proto.Uint32(mntID),
+		RootDev:     proto.Uint32(rootDev),
+		ParentMntId: proto.Uint32(1),
+		Flags:       proto.Uint32(0),
+		Root:        proto.String("/"),
+		Mountpoint:  proto.String(mountpoint),
+		Source:      proto.String("tmpfs"),
+		Options:     proto.String("size=65536k"),
+		ExtMount:    proto.Bool(external),
+	}
+}
+
+// tarNames returns the names of the entries of the tar content.
+func tarNames(t *testing.T, content io.Reader) []string {
+	t.Helper()
+	var names []string
+	reader := tar.NewReader(content)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+}
+
+// filterTestArchive writes the entries as a checkpoint archive and filters it, returning the number of
+// removed files and the filtered archive entries by name.
+func filterTestArchive(t *testing.T, filter Filter, entries ...testEntry) (int, map[string][]byte) {
+	t.Helper()
+	directory := t.TempDir()
+	source := filepath.Join(directory, "checkpoint.tar")
+	if err := os.WriteFile(source, tarFile(t, entries...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	destination := filepath.Join(directory, "filtered.tar")
+	removed, err := FilterArchive(source, destination, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filtered := map[string][]byte{}
+	err = walk(destination, func(header *tar.Header, content io.Reader) (bool, error) {
+		data, err := io.ReadAll(content)
+		filtered[header.Name] = data
+		return false, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(directory, ".filtered-*")); len(files) > 0 {
+		t.Errorf("temporary files %v were not removed", files)
+	}
+	return removed, filtered
+}
+
+func TestFilterArchiveRootfsDiff(t *testing.T) {
+	rootfsDiff := tarFile(t,
+		testEntry{name: "etc/app.conf", content: []byte("conf")},
+		testEntry{name: "var/run/secrets/token", content: []byte("token")},
+		testEntry{name: "root/.aws/credentials", content: []byte("credentials")},
+		testEntry{name: "root/.bashrc", content: []byte("bashrc")},
+	)
+	removed, filtered := filterTestArchive(t,
+		Filter{ExcludePaths: []string{"/var/run/secrets/"}, ExcludeFiles: []string{"/root/.aws"}},
+		testEntry{name: ConfigDumpFile, content: []byte("{}")},
+		testEntry{name: RootfsDiffFile, content: rootfsDiff},
+		testEntry{name: DeletedFilesFile, content: []byte("[]")},
+	)
+
+	if removed != 2 {
+		t.Errorf("removed %d files, want 2", removed)
+	}
+	want := []string{"etc/app.conf", "root/.bashrc"}
+	if got := tarNames(t, bytes.NewReader(filtered[RootfsDiffFile])); !reflect.DeepEqual(got, want) {
+		t.Errorf("root file system diff has %v, want %v", got, want)
+	}
+	if string(filtered[ConfigDumpFile]) != "{}" || string(filtered[DeletedFilesFile]) != "[]" {
+		t.Errorf("other entries were changed: %v", filtered)
+	}
+}
+
+func TestFilterArchiveExcludeRootfsDiff(t *testing.T) {
+	removed, filtered := filterTestArchive(t, Filter{ExcludeRootfsDiff: true},
+		testEntry{name: ConfigDumpFile, content: []byte("{}")},
+		testEntry{name: RootfsDiffFile, content: tarFile(t, testEntry{name: "etc/app.conf"})},
+		testEntry{name: DeletedFilesFile, content: []byte("[]")},
+	)
+	if removed != 2 {
+		t.Errorf("removed %d files, want 2", removed)
+	}
+	if len(filtered) != 1 || filtered[ConfigDumpFile] == nil {
+		t.Errorf("filtered archive has %d entries, want only %s", len(filtered), ConfigDumpFile)
+	}
+}
+
+func TestFilterArchiveTmpfs(t *testing.T) {
+	tmpfs := gzipped(t, tarFile(t,
+		testEntry{name: "./"},
+		testEntry{name: "./token", content: []byte("token")},
+		testEntry{name: "./cache/data", content: []byte("data")},
+	))
+	mountpoints := mountpointsImage(t,
+		tmpfsMountEntry(10, 42, "./run/tokens", false),
+		tmpfsMountEntry(11, 43, "./var/run/secrets", true),
+	)
+	removed, filtered := filterTestArchive(t, Filter{ExcludePaths: []string{"/run/tokens/token"}},
+		testEntry{name: "checkpoint/mountpoints-13.img", content: mountpoints},
+		testEntry{name: "checkpoint/tmpfs-dev-42.tar.gz.img", content: tmpfs},
+	)
+
+	if removed != 1 {
+		t.Errorf("removed %d files, want 1", removed)
+	}
+	decompressed, err := gzip.NewReader(bytes.NewReader(filtered["checkpoint/tmpfs-dev-42.tar.gz.img"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"./", "./cache/data"}
+	if got := tarNames(t, decompressed); !reflect.DeepEqual(got, want) {
+		t.Errorf("tmpfs image has %v, want %v", got, want)
+	}
+}
+
+func TestFilterArchiveUnknownTmpfs(t *testing.T) {
+	directory := t.TempDir()
+	source := filepath.Join(directory, "checkpoint.tar")
+	content := tarFile(t, testEntry{
+		name:    "checkpoint/tmpfs-dev-42.tar.gz.img",
+		content: gzipped(t, tarFile(t, testEntry{name: "./token"})),
+	})
+	if err := os.WriteFile(source, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files of a tmpfs whose mount point is unknown cannot be filtered.
+	filter := Filter{ExcludePaths: []string{"/run/tokens"}}
+	if _, err := FilterArchive(source, filepath.Join(directory, "filtered.tar"), filter); err == nil {
+		t.Error("filtered an archive with a tmpfs of unknown mount point")
+	}
+	// Nothing is filtered from it when only the root file system diff is removed.
+	filter = Filter{ExcludeRootfsDiff: true}
+	if _, err := FilterArchive(source, filepath.Join(directory, "filtered.tar"), filter); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFilterArchiveInvalidPattern(t *testing.T) {
+	directory := t.TempDir()
+	if _, err := FilterArchive(filepath.Join(directory, "checkpoint.tar"), filepath.Join(directory, "filtered.tar"),
+		Filter{ExcludeFiles: []string{"["}}); err == nil {
+		t.Error("filtered the archive with an invalid pattern")
+	}
+}
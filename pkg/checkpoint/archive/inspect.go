@@ -0,0 +1,252 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	criucore "github.com/checkpoint-restore/go-criu/v7/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/inventory"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/pstree"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/stats"
+	"github.com/checkpoint-restore/go-criu/v7/magic"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// StatsDumpFile holds the statistics CRIU collected while dumping the container.
+	StatsDumpFile = "stats-dump"
+	// DumpLogFile is the log of the CRIU dump, which some container engines include in the archive, in its
+	// root or in the checkpoint directory.
+	DumpLogFile = "dump.log"
+
+	pstreeFile = CheckpointDirectory + "/pstree.img"
+	corePrefix = CheckpointDirectory + "/core-"
+
+	// maxCRIUEntrySize limits the memory used to decode an entry of a corrupted CRIU image.
+	maxCRIUEntrySize = 16 << 20
+	// maxDumpLogLines limits the lines of the dump log searched for the CRIU version, which CRIU logs first.
+	maxDumpLogLines = 32
+)
+
+// criuMagic maps the names of the CRIU image types to the magic numbers starting their files.
+var criuMagic = magic.LoadMagic()
+
+// Inspection is the information about the checkpointed container and its CRIU dump stored in the archive.
+type Inspection struct {
+	Metadata
+	// ImageVersion is the version of the CRIU image format of the dump.
+	ImageVersion uint32
+	// CRIUVersion is the release of CRIU that dumped the container, e.g. 3.19, read from the dump log. It is
+	// empty when the archive has no dump log.
+	CRIUVersion string
+	// DumpStatistics are the statistics of the dump, nil when the archive has no stats-dump file.
+	DumpStatistics *DumpStatistics
+	// Processes are the processes of the dump ordered by PID, empty when the archive has no process tree.
+	Processes []Process
+}
+
+// DumpStatistics are the statistics CRIU collected while dumping the container.
+type DumpStatistics struct {
+	// FreezingTime is the time spent freezing the processes.
+	FreezingTime time.Duration
+	// FrozenTime is the time the processes were frozen, from the freeze to the end of the dump.
+	FrozenTime time.Duration
+	// MemdumpTime is the time spent collecting the memory pages.
+	MemdumpTime time.Duration
+	// MemwriteTime is the time spent writing the memory pages.
+	MemwriteTime time.Duration
+	// PagesScanned is the number of memory pages of the processes.
+	PagesScanned uint64
+	// PagesSkippedParent is the number of memory pages unchanged since the parent checkpoint.
+	PagesSkippedParent uint64
+	// PagesWritten is the number of memory pages written to the dump.
+	PagesWritten uint64
+}
+
+// Process is a process of the dump.
+type Process struct {
+	PID     uint32
+	PPID    uint32
+	Threads int
+	// Command is the command name of the process, as in /proc/<pid>/comm.
+	Command string
+}
+
+// Inspect reads the metadata of the container engine and the CRIU dump information from the archive at
+// location. Only the config.dump and spec.dump files are required, the information of the other files is
+// left empty when they are missing.
+func Inspect(location string) (*Inspection, error) {
+	var (
+		inspection  Inspection
+		foundConfig bool
+		foundSpec   bool
+		commands    = map[uint32]string{}
+	)
+	err := walk(location, func(header *tar.Header, content io.Reader) (bool, error) {
+		name := entryName(header.Name)
+		switch {
+		case name == ConfigDumpFile:
+			if err := json.NewDecoder(content).Decode(&inspection.Config); err != nil {
+				return false, fmt.Errorf("failed to decode %s: %w", ConfigDumpFile, err)
+			}
+			foundConfig = true
+		case name == SpecDumpFile:
+			if err := json.NewDecoder(content).Decode(&inspection.Spec); err != nil {
+				return false, fmt.Errorf("failed to decode %s: %w", SpecDumpFile, err)
+			}
+			foundSpec = true
+		case name == StatsDumpFile:
+			entries, err := readCRIUImage(content, "STATS", &stats.StatsEntry{})
+			if err != nil {
+				return false, fmt.Errorf("failed to decode %s: %w", StatsDumpFile, err)
+			}
+			if len(entries) > 0 {
+				if dump := entries[0].(*stats.StatsEntry).GetDump(); dump != nil {
+					inspection.DumpStatistics = dumpStatistics(dump)
+				}
+			}
+		case name == DumpLogFile || name == CheckpointDirectory+"/"+DumpLogFile:
+			inspection.CRIUVersion = criuVersion(content)
+		case name == inventoryFile:
+			entries, err := readCRIUImage(content, "INVENTORY", &inventory.InventoryEntry{})
+			if err != nil {
+				return false, fmt.Errorf("failed to decode %s: %w", inventoryFile, err)
+			}
+			if len(entries) > 0 {
+				inspection.ImageVersion = entries[0].(*inventory.InventoryEntry).GetImgVersion()
+			}
+		case name == pstreeFile:
+			entries, err := readCRIUImage(content, "PSTREE", &pstree.PstreeEntry{})
+			if err != nil {
+				return false, fmt.Errorf("failed to decode %s: %w", pstreeFile, err)
+			}
+			for _, entry := range entries {
+				process := entry.(*pstree.PstreeEntry)
+				inspection.Processes = append(inspection.Processes, Process{
+					PID:     process.GetPid(),
+					PPID:    process.GetPpid(),
+					Threads: len(process.GetThreads()),
+				})
+			}
+		case strings.HasPrefix(name, corePrefix) && path.Ext(name) == ".img":
+			// The core file of every thread is named after its ID, the one of the main thread after the PID.
+			pid, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, corePrefix), ".img"), 10, 32)
+			if err != nil {
+				return false, nil
+			}
+			entries, err := readCRIUImage(content, "CORE", &criucore.CoreEntry{})
+			if err != nil {
+				return false, fmt.Errorf("failed to decode %s: %w", name, err)
+			}
+			if len(entries) > 0 {
+				commands[uint32(pid)] = entries[0].(*criucore.CoreEntry).GetTc().GetComm()
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !foundConfig {
+		return nil, fmt.Errorf("%s not found in checkpoint archive", ConfigDumpFile)
+	}
+	if !foundSpec {
+		return nil, fmt.Errorf("%s not found in checkpoint archive", SpecDumpFile)
+	}
+
+	for i := range inspection.Processes {
+		inspection.Processes[i].Command = commands[inspection.Processes[i].PID]
+	}
+	sort.Slice(inspection.Processes, func(i, j int) bool {
+		return inspection.Processes[i].PID < inspection.Processes[j].PID
+	})
+	return &inspection, nil
+}
+
+// criuVersion returns the CRIU release of a dump log, logged by CRIU when it starts as
+// "(00.000000) Version: 3.19 (gitid v3.19)", and an empty string when it is not found.
+func criuVersion(content io.Reader) string {
+	scanner := bufio.NewScanner(content)
+	for i := 0; i < maxDumpLogLines && scanner.Scan(); i++ {
+		_, version, found := strings.Cut(scanner.Text(), "Version: ")
+		if !found {
+			continue
+		}
+		if fields := strings.Fields(version); len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// readCRIUImage decodes the entries of a CRIU image file of the given type. The file starts with the magic
+// numbers of its type, followed by every entry as a protobuf message prefixed with its size.
+func readCRIUImage(content io.Reader, imageType string, entryType proto.Message) ([]proto.Message, error) {
+	value, err := readUint32(content)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(value) == criuMagic.ByName["IMG_COMMON"] || uint64(value) == criuMagic.ByName["IMG_SERVICE"] {
+		if value, err = readUint32(content); err != nil {
+			return nil, err
+		}
+	}
+	if uint64(value) != criuMagic.ByName[imageType] {
+		return nil, fmt.Errorf("unexpected CRIU image magic 0x%x, expected a %s image", value, imageType)
+	}
+
+	var entries []proto.Message
+	for {
+		size, err := readUint32(content)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if size > maxCRIUEntrySize {
+			return nil, fmt.Errorf("CRIU image entry of %d bytes is too large", size)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(content, payload); err != nil {
+			return nil, err
+		}
+		entry := entryType.ProtoReflect().New().Interface()
+		if err := proto.Unmarshal(payload, entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func readUint32(reader io.Reader) (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(reader, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+// dumpStatistics converts the CRIU dump statistics, whose times are in microseconds.
+func dumpStatistics(dump *stats.DumpStatsEntry) *DumpStatistics {
+	return &DumpStatistics{
+		FreezingTime:       time.Duration(dump.GetFreezingTime()) * time.Microsecond,
+		FrozenTime:         time.Duration(dump.GetFrozenTime()) * time.Microsecond,
+		MemdumpTime:        time.Duration(dump.GetMemdumpTime()) * time.Microsecond,
+		MemwriteTime:       time.Duration(dump.GetMemwriteTime()) * time.Microsecond,
+		PagesScanned:       dump.GetPagesScanned(),
+		PagesSkippedParent: dump.GetPagesSkippedParent(),
+		PagesWritten:       dump.GetPagesWritten(),
+	}
+}
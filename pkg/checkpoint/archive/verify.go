@@ -0,0 +1,164 @@
+package archive
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// CheckpointDirectory holds the CRIU images of the checkpointed process.
+	CheckpointDirectory = "checkpoint"
+
+	// inventoryFile is written by CRIU in every dump, an archive without it has no usable CRIU images.
+	inventoryFile = CheckpointDirectory + "/inventory.img"
+
+	// endOfArchiveSize is the size of the end-of-archive marker, two zero blocks, closing every tar file.
+	endOfArchiveSize = 2 * 512
+)
+
+// Verification describes a checkpoint archive that passed the verification.
+type Verification struct {
+	// Digest is the sha256 digest of the archive file.
+	Digest digest.Digest
+	// Size is the size of the archive file in bytes.
+	Size int64
+}
+
+// Verify reads the whole archive at location and checks it has the structure written by the container
+// engine: the config.dump and spec.dump metadata, the CRIU images in the checkpoint directory and, when
+// present, a readable rootfs-diff.tar. A truncated or corrupted archive fails the verification instead of
+// producing an image that only fails when it is restored.
+func Verify(location string) (Verification, error) {
+	file, err := os.Open(location)
+	if err != nil {
+		return Verification{}, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	digester := digest.SHA256.Digester()
+	counter := &countingReader{reader: io.TeeReader(file, digester.Hash())}
+	reader, err := Decompress(counter)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	// The tar reader stops at the end of the file as it does at the end-of-archive marker, so an archive cut
+	// between two entries is only told apart by the zeros following the last entry.
+	stream := &zerosReader{reader: reader}
+	var entriesEnd int64
+	found := map[string]bool{}
+	tarReader := tar.NewReader(stream)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Verification{}, archiveError(err)
+		}
+
+		name := entryName(header.Name)
+		switch name {
+		case ConfigDumpFile, SpecDumpFile:
+			content, err := io.ReadAll(tarReader)
+			if err != nil {
+				return Verification{}, archiveError(err)
+			}
+			if !json.Valid(content) {
+				return Verification{}, fmt.Errorf("invalid %s in checkpoint archive: not a JSON document", name)
+			}
+		case RootfsDiffFile:
+			if err := verifyTar(tarReader); err != nil {
+				return Verification{}, fmt.Errorf("invalid %s in checkpoint archive: %w", RootfsDiffFile, err)
+			}
+		}
+		if _, err := io.Copy(io.Discard, tarReader); err != nil {
+			return Verification{}, archiveError(err)
+		}
+		entriesEnd = stream.read
+		found[name] = true
+	}
+	// The last entry is followed by its zero padding and the end-of-archive marker.
+	if trailer := stream.read - entriesEnd; trailer < endOfArchiveSize || stream.zeros < trailer {
+		return Verification{}, fmt.Errorf("checkpoint archive is truncated: no end-of-archive marker")
+	}
+	// Read up to the end of the file, so a gzip archive checks its checksum and the digest covers the whole
+	// file, including the tar padding.
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return Verification{}, archiveError(err)
+	}
+
+	for _, required := range []string{ConfigDumpFile, SpecDumpFile, inventoryFile} {
+		if !found[required] {
+			return Verification{}, fmt.Errorf("%s not found in checkpoint archive", required)
+		}
+	}
+	return Verification{Digest: digester.Digest(), Size: counter.read}, nil
+}
+
+// verifyTar reads every entry of a nested tar file.
+func verifyTar(reader io.Reader) error {
+	tarReader := tar.NewReader(reader)
+	for {
+		_, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err == nil {
+			_, err = io.Copy(io.Discard, tarReader)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// archiveError describes an error reading the archive, an unexpected end of file means the archive was
+// not fully written.
+func archiveError(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) || strings.Contains(err.Error(), "unexpected EOF") {
+		return fmt.Errorf("checkpoint archive is truncated: %w", err)
+	}
+	return fmt.Errorf("failed to read checkpoint archive: %w", err)
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// zerosReader counts the bytes read from the underlying reader and the zeros read last.
+type zerosReader struct {
+	reader io.Reader
+	read   int64
+	zeros  int64
+}
+
+func (r *zerosReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	for i := n - 1; i >= 0; i-- {
+		if p[i] != 0 {
+			r.zeros = int64(n - i - 1)
+			return n, err
+		}
+	}
+	r.zeros += int64(n)
+	return n, err
+}
@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// verifiedEntries returns the entries of a checkpoint archive passing the verification.
+func verifiedEntries() []testEntry {
+	return []testEntry{
+		{name: ConfigDumpFile, content: []byte(`{"id":"0123"}`)},
+		{name: SpecDumpFile, content: []byte(`{"ociVersion":"1.0.2"}`)},
+		{name: CheckpointDirectory + "/"},
+		{name: inventoryFile, content: []byte("inventory")},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	archive := tarFile(t, verifiedEntries()...)
+	// tar.Writer ends the archive with the end-of-archive marker only, without padding it to a record.
+	cutBetweenEntries := archive[:len(archive)-endOfArchiveSize]
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr string
+	}{
+		{name: "tar archive", content: archive},
+		{name: "gzip archive", content: gzipped(t, archive)},
+		{name: "archive with record padding", content: append(append([]byte{}, archive...), make([]byte, 8192)...)},
+		{name: "archive cut between entries", content: cutBetweenEntries, wantErr: "truncated"},
+		{name: "gzip archive cut between entries", content: gzipped(t, cutBetweenEntries), wantErr: "truncated"},
+		{name: "archive cut in an entry", content: archive[:len(archive)-endOfArchiveSize-100], wantErr: "truncated"},
+		{name: "gzip archive cut", content: gzipped(t, archive)[:100], wantErr: "truncated"},
+		{
+			name:    "archive without inventory",
+			content: tarFile(t, verifiedEntries()[:3]...),
+			wantErr: inventoryFile + " not found",
+		},
+		{
+			name: "archive with invalid config",
+			content: tarFile(t, append(verifiedEntries()[1:],
+				testEntry{name: ConfigDumpFile, content: []byte("{")})...),
+			wantErr: "invalid " + ConfigDumpFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location := filepath.Join(t.TempDir(), "checkpoint.tar")
+			if err := os.WriteFile(location, tt.content, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			verification, err := Verify(location)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verification.Digest != digest.FromBytes(tt.content) {
+				t.Errorf("Verify() digest = %s, want %s", verification.Digest, digest.FromBytes(tt.content))
+			}
+			if verification.Size != int64(len(tt.content)) {
+				t.Errorf("Verify() size = %d, want %d", verification.Size, len(tt.content))
+			}
+		})
+	}
+}
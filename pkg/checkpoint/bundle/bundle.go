@@ -0,0 +1,243 @@
+// Package bundle writes and reads checkpoint bundles, self-contained tar files holding a Checkpoint, its
+// image and their checksums, to move a checkpoint between clusters or keep it outside of the registry.
+//
+// A bundle holds the manifest in bundle.json, the Checkpoint object in checkpoint.yaml, the checkpoint
+// image as an OCI layout in the image directory and, as its last entry, the sha256 checksum of every other
+// file in SHA256SUMS, in the format of sha256sum.
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// ManifestFile describes the bundle.
+	ManifestFile = "bundle.json"
+	// CheckpointFile holds the exported Checkpoint object in YAML.
+	CheckpointFile = "checkpoint.yaml"
+	// ImageDirectory holds the checkpoint image as an OCI layout.
+	ImageDirectory = "image"
+	// ChecksumsFile holds the checksums of the other files of the bundle.
+	ChecksumsFile = "SHA256SUMS"
+
+	// Version is the version of the bundle format.
+	Version = 1
+)
+
+// Manifest describes a bundle.
+type Manifest struct {
+	Version int `json:"version"`
+	// ExportedAt is when the bundle was written.
+	ExportedAt time.Time `json:"exportedAt"`
+	// Checkpoint is the namespace and the name of the exported Checkpoint.
+	Checkpoint string `json:"checkpoint"`
+	// Registry is the registry the checkpoint image was exported from.
+	Registry string `json:"registry,omitempty"`
+	// Image is the name of the checkpoint image, relative to the registry, and of the image in the OCI layout.
+	Image string `json:"image"`
+	// ImageDigest is the digest of the manifest of the checkpoint image.
+	ImageDigest digest.Digest `json:"imageDigest,omitempty"`
+}
+
+// WriteManifest writes the manifest of the bundle to directory.
+func WriteManifest(directory string, manifest Manifest) error {
+	manifest.Version = Version
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(directory, ManifestFile), content, 0o600)
+}
+
+// Write writes the regular files of directory, which holds the manifest, the checkpoint and the image of
+// the bundle, to w as a bundle.
+func Write(w io.Writer, directory string) error {
+	var names []string
+	err := filepath.WalkDir(directory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		name, err := filepath.Rel(directory, filePath)
+		if err != nil {
+			return err
+		}
+		if name = filepath.ToSlash(name); name != ChecksumsFile {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	writer := tar.NewWriter(w)
+	var checksums strings.Builder
+	for _, name := range names {
+		checksum, err := writeFile(writer, filepath.Join(directory, filepath.FromSlash(name)), name)
+		if err != nil {
+			return fmt.Errorf("failed to write %s to the bundle: %w", name, err)
+		}
+		_, _ = fmt.Fprintf(&checksums, "%s  %s\n", checksum.Encoded(), name)
+	}
+
+	// The checksums are the last entry, so they can be verified while the bundle is read.
+	content := []byte(checksums.String())
+	if err := writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     ChecksumsFile,
+		Mode:     0o644,
+		Size:     int64(len(content)),
+		ModTime:  time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := writer.Write(content); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// writeFile writes the file at filePath to writer with the given name, returning its checksum.
+func writeFile(writer *tar.Writer, filePath, name string) (digest.Digest, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if err := writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+	}); err != nil {
+		return "", err
+	}
+	digester := digest.SHA256.Digester()
+	if _, err := io.Copy(io.MultiWriter(writer, digester.Hash()), file); err != nil {
+		return "", err
+	}
+	return digester.Digest(), nil
+}
+
+// Read extracts the bundle read from r to directory, which must exist, and returns its manifest. Every
+// file is checked against the checksums of the bundle, a bundle with a missing, an unexpected or a
+// modified file fails.
+func Read(r io.Reader, directory string) (*Manifest, error) {
+	checksums := map[string]digest.Digest{}
+	var expected map[string]digest.Digest
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Cleaning the name from the root keeps every file inside of the directory.
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		if name == ChecksumsFile {
+			if expected, err = readChecksums(reader); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if expected != nil {
+			return nil, fmt.Errorf("invalid bundle: %s follows the checksums", name)
+		}
+		if checksums[name], err = extractFile(reader, filepath.Join(directory, filepath.FromSlash(name))); err != nil {
+			return nil, fmt.Errorf("failed to extract %s from the bundle: %w", name, err)
+		}
+	}
+
+	if expected == nil {
+		return nil, fmt.Errorf("invalid bundle: missing %s", ChecksumsFile)
+	}
+	for name, checksum := range expected {
+		actual, ok := checksums[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid bundle: missing %s", name)
+		}
+		if actual != checksum {
+			return nil, fmt.Errorf("invalid bundle: checksum mismatch for %s", name)
+		}
+	}
+	for name := range checksums {
+		if _, ok := expected[name]; !ok {
+			return nil, fmt.Errorf("invalid bundle: unexpected file %s", name)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(directory, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid bundle: failed to decode %s: %w", ManifestFile, err)
+	}
+	if manifest.Version != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// extractFile writes content to filePath, returning its checksum.
+func extractFile(content io.Reader, filePath string) (digest.Digest, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o700); err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	digester := digest.SHA256.Digester()
+	if _, err := io.Copy(io.MultiWriter(file, digester.Hash()), content); err != nil {
+		_ = file.Close()
+		return "", err
+	}
+	return digester.Digest(), file.Close()
+}
+
+// readChecksums reads the checksums of the files of the bundle, in the format of sha256sum.
+func readChecksums(content io.Reader) (map[string]digest.Digest, error) {
+	checksums := map[string]digest.Digest{}
+	scanner := bufio.NewScanner(content)
+	for scanner.Scan() {
+		encoded, name, ok := strings.Cut(scanner.Text(), "  ")
+		checksum := digest.NewDigestFromEncoded(digest.SHA256, encoded)
+		if !ok || checksum.Validate() != nil {
+			return nil, fmt.Errorf("invalid bundle: malformed %s line %q", ChecksumsFile, scanner.Text())
+		}
+		checksums[name] = checksum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ChecksumsFile, err)
+	}
+	return checksums, nil
+}
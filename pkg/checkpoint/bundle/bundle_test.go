@@ -0,0 +1,229 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// testEntry is a file of a test bundle.
+type testEntry struct {
+	name    string
+	content []byte
+}
+
+// testManifest returns the content of the manifest of a test bundle.
+func testManifest() []byte {
+	return []byte(`{"version":1,"checkpoint":"team-a/web-0","image":"checkpoint-web-0:latest"}`)
+}
+
+// tarBundle returns a bundle with the entries, followed by the checksums of the checksummed entries in the
+// format of sha256sum.
+func tarBundle(t *testing.T, entries []testEntry, checksummed []testEntry) []byte {
+	t.Helper()
+	var checksums strings.Builder
+	for _, entry := range checksummed {
+		_, _ = fmt.Fprintf(&checksums, "%s  %s\n", digest.FromBytes(entry.content).Encoded(), entry.name)
+	}
+	entries = append(entries, testEntry{name: ChecksumsFile, content: []byte(checksums.String())})
+
+	var content bytes.Buffer
+	writer := tar.NewWriter(&content)
+	for _, entry := range entries {
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: entry.name, Mode: 0o644, Size: int64(len(entry.content))}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(entry.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return content.Bytes()
+}
+
+func TestWriteRead(t *testing.T) {
+	directory := t.TempDir()
+	manifest := Manifest{
+		ExportedAt:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Checkpoint:  "team-a/web-0",
+		Registry:    "registry.example.com/team-a",
+		Image:       "checkpoint-web-0:latest",
+		ImageDigest: digest.FromString("manifest"),
+	}
+	if err := WriteManifest(directory, manifest); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		CheckpointFile:                          []byte("kind: Checkpoint\n"),
+		ImageDirectory + "/oci-layout":          []byte(`{"imageLayoutVersion":"1.0.0"}`),
+		ImageDirectory + "/blobs/sha256/layer":  bytes.Repeat([]byte("pages"), 1024),
+		ImageDirectory + "/blobs/sha256/config": []byte("{}"),
+	}
+	for name, content := range files {
+		filePath := filepath.Join(directory, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var bundle bytes.Buffer
+	if err := Write(&bundle, directory); err != nil {
+		t.Fatal(err)
+	}
+
+	extracted := t.TempDir()
+	got, err := Read(&bundle, extracted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Version = Version
+	if !reflect.DeepEqual(*got, manifest) {
+		t.Errorf("Read() manifest = %+v, want %+v", *got, manifest)
+	}
+	for name, want := range files {
+		content, err := os.ReadFile(filepath.Join(extracted, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(content, want) {
+			t.Errorf("%s was extracted with %q, want %q", name, content, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(extracted, ChecksumsFile)); err == nil {
+		t.Errorf("%s was extracted", ChecksumsFile)
+	}
+}
+
+func TestRead(t *testing.T) {
+	manifest := testEntry{name: ManifestFile, content: testManifest()}
+	checkpoint := testEntry{name: CheckpointFile, content: []byte("kind: Checkpoint\n")}
+	tampered := testEntry{name: CheckpointFile, content: []byte("kind: Pod\n")}
+
+	tests := []struct {
+		name    string
+		bundle  func(t *testing.T) []byte
+		wantErr string
+	}{
+		{
+			name: "valid bundle",
+			bundle: func(t *testing.T) []byte {
+				return tarBundle(t, []testEntry{manifest, checkpoint}, []testEntry{manifest, checkpoint})
+			},
+		},
+		{
+			name: "tampered file",
+			bundle: func(t *testing.T) []byte {
+				return tarBundle(t, []testEntry{manifest, tampered}, []testEntry{manifest, checkpoint})
+			},
+			wantErr: "checksum mismatch for " + CheckpointFile,
+		},
+		{
+			name: "tampered checksum",
+			bundle: func(t *testing.T) []byte {
+				return tarBundle(t, []testEntry{manifest, checkpoint}, []testEntry{manifest, tampered})
+			},
+			wantErr: "checksum mismatch for " + CheckpointFile,
+		},
+		{
+			name: "missing file",
+			bundle: func(t *testing.T) []byte {
+				return tarBundle(t, []testEntry{manifest}, []testEntry{manifest, checkpoint})
+			},
+			wantErr: "missing " + CheckpointFile,
+		},
+		{
+			name: "unexpected file",
+			bundle: func(t *testing.T) []byte {
+				return tarBundle(t, []testEntry{manifest, checkpoint}, []testEntry{manifest})
+			},
+			wantErr: "unexpected file " + CheckpointFile,
+		},
+		{
+			name: "file after the checksums",
+			bundle: func(t *testing.T) []byte {
+				bundle := tarBundle(t, []testEntry{manifest}, []testEntry{manifest})
+				// Replace the end-of-archive marker by another entry.
+				var content bytes.Buffer
+				content.Write(bundle[:len(bundle)-1024])
+				writer := tar.NewWriter(&content)
+				_ = writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: CheckpointFile, Mode: 0o644})
+				_ = writer.Close()
+				return content.Bytes()
+			},
+			wantErr: CheckpointFile + " follows the checksums",
+		},
+		{
+			name: "malformed checksums",
+			bundle: func(t *testing.T) []byte {
+				return tarBundle(t, []testEntry{manifest, {name: ChecksumsFile, content: []byte("checksum")}}, nil)
+			},
+			wantErr: "malformed " + ChecksumsFile,
+		},
+		{
+			name: "unsupported version",
+			bundle: func(t *testing.T) []byte {
+				manifest := testEntry{name: ManifestFile, content: []byte(`{"version":2}`)}
+				return tarBundle(t, []testEntry{manifest}, []testEntry{manifest})
+			},
+			wantErr: "unsupported bundle version 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := Read(bytes.NewReader(tt.bundle(t)), t.TempDir())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Read() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.Checkpoint != "team-a/web-0" {
+				t.Errorf("Read() manifest = %+v", manifest)
+			}
+		})
+	}
+}
+
+func TestReadPathTraversal(t *testing.T) {
+	manifest := testEntry{name: ManifestFile, content: testManifest()}
+	for _, name := range []string{"../outside", "image/../../outside", "/outside"} {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			directory := filepath.Join(parent, "bundle")
+			if err := os.Mkdir(directory, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			outside := testEntry{name: name, content: []byte("outside")}
+
+			_, err := Read(bytes.NewReader(tarBundle(t, []testEntry{manifest, outside},
+				[]testEntry{manifest, outside})), directory)
+			if err == nil {
+				t.Errorf("Read() accepted the entry %s", name)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "outside")); err == nil {
+				t.Errorf("entry %s was extracted outside of the directory", name)
+			}
+			// The entry is cleaned from the root of the directory.
+			if _, err := os.Stat(filepath.Join(directory, "outside")); err != nil {
+				t.Errorf("entry %s was not extracted to the directory: %v", name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+// Package forensics analyzes the CRIU images of a checkpoint archive offline, to investigate the state of
+// the checkpointed container without restoring it.
+//
+// The analysis reads the archive extracted to a directory, see archive.Extract. The CRIU images are decoded
+// with go-criu, which caches some images globally, so a process must only analyze a single checkpoint.
+package forensics
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/checkpoint-restore/go-criu/v7/crit"
+
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/archive"
+)
+
+// memoryChunkSize is the size of the memory read at once when a memory region is dumped.
+const memoryChunkSize = 1024 * 1024
+
+// Report is the result of the analysis of a checkpoint.
+type Report struct {
+	Container Container `json:"container"`
+	// Processes are the processes of the container ordered by PID.
+	Processes []*Process `json:"processes"`
+	// RootfsChanges are the changes of the container root file system, nil when the archive has none.
+	RootfsChanges *RootfsChanges `json:"rootfsChanges,omitempty"`
+	// Warnings describe the parts of the checkpoint that could not be analyzed.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Container describes the checkpointed container.
+type Container struct {
+	Name           string    `json:"name"`
+	Image          string    `json:"image,omitempty"`
+	ImageID        string    `json:"imageID,omitempty"`
+	Engine         string    `json:"engine,omitempty"`
+	Runtime        string    `json:"runtime,omitempty"`
+	CheckpointedAt time.Time `json:"checkpointedAt,omitempty"`
+	// Environment is the environment the container was created with.
+	Environment []string `json:"environment,omitempty"`
+}
+
+// Process is a process of the checkpointed container.
+type Process struct {
+	PID     uint32 `json:"pid"`
+	PPID    uint32 `json:"ppid"`
+	PGID    uint32 `json:"pgid"`
+	SID     uint32 `json:"sid"`
+	Command string `json:"command"`
+	// Arguments are the command line arguments, read from the memory of the process.
+	Arguments []string `json:"arguments,omitempty"`
+	// Environment is the environment of the process, read from its memory.
+	Environment []string       `json:"environment,omitempty"`
+	Files       []*crit.File   `json:"files,omitempty"`
+	Sockets     []*crit.Socket `json:"sockets,omitempty"`
+	Memory      *Memory        `json:"memory,omitempty"`
+}
+
+// Memory summarizes the memory of a process.
+type Memory struct {
+	// Executable is the path of the executable of the process.
+	Executable string `json:"executable,omitempty"`
+	// MappedSize is the size of all the memory mappings in bytes.
+	MappedSize uint64 `json:"mappedSize"`
+	// DumpedSize is the size of the memory pages stored in the checkpoint in bytes.
+	DumpedSize uint64     `json:"dumpedSize"`
+	Mappings   []*Mapping `json:"mappings,omitempty"`
+}
+
+// Mapping is a memory mapping of a process.
+type Mapping struct {
+	// Start and End are the addresses of the mapping in hexadecimal.
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	Size       uint64 `json:"size"`
+	Protection string `json:"protection"`
+	// Resource is the file or the kernel resource backing the mapping, empty for anonymous memory.
+	Resource string `json:"resource,omitempty"`
+}
+
+// RootfsChanges are the changes of the container root file system since it was created.
+type RootfsChanges struct {
+	// Changed are the files created or modified by the container.
+	Changed []string `json:"changed,omitempty"`
+	// Deleted are the files of the image deleted by the container.
+	Deleted []string `json:"deleted,omitempty"`
+}
+
+// Analyze analyzes the checkpoint archive extracted to directory. The memory pages are read with pageSize,
+// detected from the CRIU images when zero. The parts of the checkpoint that cannot be read are reported as
+// warnings, only missing container metadata fails the analysis.
+func Analyze(directory string, pageSize int) (*Report, error) {
+	report := &Report{}
+	if err := readContainer(directory, &report.Container); err != nil {
+		return nil, err
+	}
+	warn := func(section string, err error) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %v", section, err))
+	}
+
+	imagesDirectory := filepath.Join(directory, archive.CheckpointDirectory)
+	critter := crit.New(nil, nil, imagesDirectory, false, false)
+	psTree, err := critter.ExplorePs()
+	if err != nil {
+		warn("processes", err)
+	}
+	processes := map[uint32]*Process{}
+	if psTree != nil {
+		addProcesses(psTree, 0, processes)
+	}
+	for _, process := range processes {
+		report.Processes = append(report.Processes, process)
+	}
+	sort.Slice(report.Processes, func(i, j int) bool {
+		return report.Processes[i].PID < report.Processes[j].PID
+	})
+
+	if fds, err := critter.ExploreFds(); err != nil {
+		warn("open files", err)
+	} else {
+		for _, fd := range fds {
+			if process, ok := processes[fd.PId]; ok {
+				process.Files = fd.Files
+			}
+		}
+	}
+	if sks, err := critter.ExploreSk(); err != nil {
+		warn("sockets", err)
+	} else {
+		for _, sk := range sks {
+			if process, ok := processes[sk.PId]; ok {
+				process.Sockets = sk.Sockets
+			}
+		}
+	}
+	if memMaps, err := critter.ExploreMems(); err != nil {
+		warn("memory mappings", err)
+	} else {
+		for _, memMap := range memMaps {
+			if process, ok := processes[memMap.PId]; ok {
+				process.Memory = memorySummary(memMap)
+			}
+		}
+	}
+	for _, process := range report.Processes {
+		if err := readProcessMemory(imagesDirectory, process, pageSize); err != nil {
+			warn(fmt.Sprintf("memory of process %d", process.PID), err)
+		}
+	}
+
+	if report.RootfsChanges, err = readRootfsChanges(directory); err != nil {
+		warn("root file system changes", err)
+	}
+	return report, nil
+}
+
+// DumpMemory writes the memory of the process with the given PID between the start and end addresses to w,
+// reading the memory pages with pageSize, detected from the CRIU images when zero. Pages missing from the
+// checkpoint, because they were never touched by the process, are written as zeros.
+func DumpMemory(directory string, pid uint32, start, end uint64, pageSize int, w io.Writer) error {
+	if end <= start {
+		return fmt.Errorf("invalid memory region %x-%x", start, end)
+	}
+	reader, _, err := memoryReader(filepath.Join(directory, archive.CheckpointDirectory), pid, pageSize)
+	if err != nil {
+		return fmt.Errorf("failed to read the memory of process %d: %w", pid, err)
+	}
+	for address := start; address < end; address += memoryChunkSize {
+		chunkEnd := min(address+memoryChunkSize, end)
+		content, err := reader.GetMemPages(address, chunkEnd)
+		if err != nil {
+			return fmt.Errorf("failed to read the memory of process %d at %x: %w", pid, address, err)
+		}
+		if _, err := w.Write(content.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readContainer reads the description of the container from the container engine metadata.
+func readContainer(directory string, container *Container) error {
+	var metadata archive.Metadata
+	if err := readJSON(filepath.Join(directory, archive.ConfigDumpFile), &metadata.Config); err != nil {
+		return err
+	}
+	if err := readJSON(filepath.Join(directory, archive.SpecDumpFile), &metadata.Spec); err != nil {
+		return err
+	}
+	container.Name = metadata.Config.Name
+	container.Image = metadata.Config.RootfsImageName
+	container.ImageID = metadata.Config.RootfsImageRef
+	container.Engine = metadata.Engine()
+	container.Runtime = metadata.Config.OCIRuntime
+	container.CheckpointedAt = metadata.Config.CheckpointedAt
+	if metadata.Spec.Process != nil {
+		container.Environment = metadata.Spec.Process.Env
+	}
+	return nil
+}
+
+// addProcesses adds the process of the tree and its children to processes.
+func addProcesses(psTree *crit.PsTree, ppid uint32, processes map[uint32]*Process) {
+	processes[psTree.PID] = &Process{
+		PID:     psTree.PID,
+		PPID:    ppid,
+		PGID:    psTree.PgID,
+		SID:     psTree.SID,
+		Command: psTree.Comm,
+	}
+	for _, child := range psTree.Children {
+		addProcesses(child, psTree.PID, processes)
+	}
+}
+
+// memorySummary summarizes the memory mappings of a process.
+func memorySummary(memMap *crit.MemMap) *Memory {
+	memory := &Memory{Executable: memMap.Exe}
+	for _, mem := range memMap.Mems {
+		start, _ := strconv.ParseUint(mem.Start, 16, 64)
+		end, _ := strconv.ParseUint(mem.End, 16, 64)
+		mapping := &Mapping{
+			Start:      mem.Start,
+			End:        mem.End,
+			Size:       end - start,
+			Protection: mem.Protection,
+			Resource:   strings.TrimSpace(mem.Resource),
+		}
+		memory.MappedSize += mapping.Size
+		memory.Mappings = append(memory.Mappings, mapping)
+	}
+	return memory
+}
+
+// memoryReader returns the reader of the memory of the process with the given PID and its page size. The
+// page size of the node that checkpointed the container may differ from the page size of this one, so when
+// pageSize is zero it is detected from the pages image, which holds every page listed in the pagemap.
+func memoryReader(imagesDirectory string, pid uint32, pageSize int) (*crit.MemoryReader, int, error) {
+	reader, err := crit.NewMemoryReader(imagesDirectory, pid, pageSize)
+	if err != nil || pageSize != 0 {
+		return reader, pageSize, err
+	}
+
+	var pages int64
+	for _, entry := range reader.GetPagemapEntries() {
+		pages += int64(entry.GetNrPages())
+	}
+	if pages == 0 {
+		return reader, os.Getpagesize(), nil
+	}
+	info, err := os.Stat(filepath.Join(imagesDirectory, fmt.Sprintf("pages-%d.img", reader.GetPagesID())))
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size() == 0 || info.Size()%pages != 0 {
+		return nil, 0, fmt.Errorf("failed to detect the page size: %d pages in %d bytes", pages, info.Size())
+	}
+	pageSize = int(info.Size() / pages)
+	if reader, err = crit.NewMemoryReader(imagesDirectory, pid, pageSize); err != nil {
+		return nil, 0, fmt.Errorf("failed to detect the page size: %w", err)
+	}
+	return reader, pageSize, nil
+}
+
+// readProcessMemory reads the arguments, the environment and the size of the dumped memory of the process.
+func readProcessMemory(imagesDirectory string, process *Process, pageSize int) error {
+	reader, pageSize, err := memoryReader(imagesDirectory, process.PID, pageSize)
+	if err != nil {
+		return err
+	}
+	if process.Memory != nil {
+		for _, entry := range reader.GetPagemapEntries() {
+			process.Memory.DumpedSize += uint64(entry.GetNrPages()) * uint64(pageSize)
+		}
+	}
+
+	arguments, err := reader.GetPsArgs()
+	if err != nil {
+		return err
+	}
+	process.Arguments = splitNullTerminated(arguments.Bytes())
+	environment, err := reader.GetPsEnvVars()
+	if err != nil {
+		return err
+	}
+	process.Environment = splitNullTerminated(environment.Bytes())
+	return nil
+}
+
+// splitNullTerminated splits a list of null terminated strings, like the arguments of a process.
+func splitNullTerminated(content []byte) []string {
+	var values []string
+	for _, value := range bytes.Split(content, []byte{0}) {
+		if len(value) > 0 {
+			values = append(values, string(value))
+		}
+	}
+	return values
+}
+
+// readRootfsChanges lists the files of the root file system diff and the deleted files.
+func readRootfsChanges(directory string) (*RootfsChanges, error) {
+	changes := &RootfsChanges{}
+	file, err := os.Open(filepath.Join(directory, archive.RootfsDiffFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		defer func() {
+			_ = file.Close()
+		}()
+		reader := tar.NewReader(file)
+		for {
+			header, err := reader.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", archive.RootfsDiffFile, err)
+			}
+			if header.Typeflag != tar.TypeDir {
+				changes.Changed = append(changes.Changed, "/"+strings.TrimPrefix(header.Name, "/"))
+			}
+		}
+	}
+
+	sort.Strings(changes.Changed)
+
+	err = readJSON(filepath.Join(directory, archive.DeletedFilesFile), &changes.Deleted)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if len(changes.Changed) == 0 && len(changes.Deleted) == 0 {
+		return nil, nil
+	}
+	return changes, nil
+}
+
+func readJSON(path string, value any) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, value); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package forensics
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	criucore "github.com/checkpoint-restore/go-criu/v7/crit/images/criu-core"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/fdinfo"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/fown"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/mm"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/pagemap"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/pstree"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/regfile"
+	"github.com/checkpoint-restore/go-criu/v7/crit/images/vma"
+	"github.com/checkpoint-restore/go-criu/v7/magic"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/archive"
+)
+
+// testMemoryAddress is the address of the memory pages of the test processes, aligned to every page size.
+const testMemoryAddress = 0x10000
+
+// criuImage returns a CRIU image file of the given type with the given entries.
+func criuImage(t *testing.T, imageType string, entries ...proto.Message) []byte {
+	t.Helper()
+	magics := magic.LoadMagic()
+	content := binary.LittleEndian.AppendUint32(nil, uint32(magics.ByName["IMG_COMMON"]))
+	content = binary.LittleEndian.AppendUint32(content, uint32(magics.ByName[imageType]))
+	for _, entry := range entries {
+		payload, err := proto.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = binary.LittleEndian.AppendUint32(content, uint32(len(payload)))
+		content = append(content, payload...)
+	}
+	return content
+}
+
+// tarContent returns a tar file with the given entries.
+func tarContent(t *testing.T, entries map[string][]byte) []byte {
+	t.Helper()
+	content := &bytes.Buffer{}
+	writer := tar.NewWriter(content)
+	for name, data := range entries {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return content.Bytes()
+}
+
+// testProcess is a process of a test checkpoint, its arguments are stored in its first memory page and its
+// environment in the second.
+type testProcess struct {
+	pid         uint32
+	ppid        uint32
+	command     string
+	arguments   string
+	environment string
+}
+
+// testCheckpointEntries returns the entries of an extracted checkpoint archive with the processes, whose
+// memory pages have the given size.
+func testCheckpointEntries(t *testing.T, pageSize int, processes ...testProcess) map[string][]byte {
+	t.Helper()
+	entries := map[string][]byte{
+		archive.ConfigDumpFile: []byte(`{"id":"0123","name":"app","rootfsImageName":"docker.io/library/app:1.0",` +
+			`"runtime":"runc","checkpointedTime":"2025-01-01T00:00:00Z"}`),
+		archive.SpecDumpFile:     []byte(`{"ociVersion":"1.0.2","process":{"env":["PATH=/bin"]}}`),
+		archive.RootfsDiffFile:   tarContent(t, map[string][]byte{"etc/app.conf": []byte("port=80")}),
+		archive.DeletedFilesFile: []byte(`["/tmp/lock"]`),
+		// The files are cached by go-criu for the whole process, every test checkpoint must have the same.
+		"checkpoint/files.img": criuImage(t, "FILES", &fdinfo.FileEntry{
+			Type: fdinfo.FdTypes_REG.Enum(),
+			Id:   proto.Uint32(1),
+			Reg: &regfile.RegFileEntry{
+				Id:    proto.Uint32(1),
+				Flags: proto.Uint32(0),
+				Pos:   proto.Uint64(0),
+				Fown: &fown.FownEntry{
+					Uid: proto.Uint32(0), Euid: proto.Uint32(0), Signum: proto.Uint32(0),
+					PidType: proto.Uint32(0), Pid: proto.Uint32(0),
+				},
+				Name: proto.String("/usr/bin/app"),
+			},
+		}),
+	}
+
+	var psTree []proto.Message
+	for _, process := range processes {
+		psTree = append(psTree, &pstree.PstreeEntry{
+			Pid:  proto.Uint32(process.pid),
+			Ppid: proto.Uint32(process.ppid),
+			Pgid: proto.Uint32(process.pid),
+			Sid:  proto.Uint32(1),
+		})
+		entries[fmt.Sprintf("checkpoint/core-%d.img", process.pid)] = criuImage(t, "CORE", &criucore.CoreEntry{
+			Mtype: criucore.CoreEntry_X86_64.Enum(),
+			Tc: &criucore.TaskCoreEntry{
+				TaskState:   proto.Uint32(1),
+				ExitCode:    proto.Uint32(0),
+				Personality: proto.Uint32(0),
+				Flags:       proto.Uint32(0),
+				BlkSigset:   proto.Uint64(0),
+				Comm:        proto.String(process.command),
+			},
+		})
+
+		pages := make([]byte, 2*pageSize)
+		copy(pages, process.arguments)
+		copy(pages[pageSize:], process.environment)
+		entries[fmt.Sprintf("checkpoint/pages-%d.img", process.pid)] = pages
+		entries[fmt.Sprintf("checkpoint/pagemap-%d.img", process.pid)] = criuImage(t, "PAGEMAP",
+			&pagemap.PagemapHead{PagesId: proto.Uint32(process.pid)},
+			&pagemap.PagemapEntry{Vaddr: proto.Uint64(testMemoryAddress), NrPages: proto.Uint32(2)},
+		)
+		entries[fmt.Sprintf("checkpoint/mm-%d.img", process.pid)] = criuImage(t, "MM", &mm.MmEntry{
+			MmStartCode:  proto.Uint64(0),
+			MmEndCode:    proto.Uint64(0),
+			MmStartData:  proto.Uint64(0),
+			MmEndData:    proto.Uint64(0),
+			MmStartStack: proto.Uint64(0),
+			MmStartBrk:   proto.Uint64(0),
+			MmBrk:        proto.Uint64(0),
+			MmArgStart:   proto.Uint64(testMemoryAddress),
+			MmArgEnd:     proto.Uint64(testMemoryAddress + uint64(len(process.arguments))),
+			MmEnvStart:   proto.Uint64(testMemoryAddress + uint64(pageSize)),
+			MmEnvEnd:     proto.Uint64(testMemoryAddress + uint64(pageSize+len(process.environment))),
+			ExeFileId:    proto.Uint32(1),
+			Vmas: []*vma.VmaEntry{{
+				Start:  proto.Uint64(testMemoryAddress),
+				End:    proto.Uint64(testMemoryAddress + uint64(4*pageSize)),
+				Pgoff:  proto.Uint64(0),
+				Shmid:  proto.Uint64(0),
+				Prot:   proto.Uint32(3),
+				Flags:  proto.Uint32(0),
+				Status: proto.Uint32(1),
+				Fd:     proto.Int64(-1),
+			}},
+		})
+	}
+	entries["checkpoint/pstree.img"] = criuImage(t, "PSTREE", psTree...)
+	return entries
+}
+
+// writeCheckpointDirectory writes the entries of an extracted checkpoint archive, returning its directory.
+func writeCheckpointDirectory(t *testing.T, entries map[string][]byte) string {
+	t.Helper()
+	directory := t.TempDir()
+	for name, content := range entries {
+		path := filepath.Join(directory, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return directory
+}
+
+// testProcesses are the processes of the test checkpoints, a shell and the application it started.
+var testProcesses = []testProcess{
+	{pid: 1, command: "sh", arguments: "sh\x00-c\x00app\x00", environment: "HOME=/\x00"},
+	{pid: 7, ppid: 1, command: "app", arguments: "app\x00--port=80\x00", environment: "HOME=/\x00PORT=80\x00"},
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       map[string][]byte
+		pageSize      int
+		wantDumped    uint64
+		wantErr       bool
+		wantWarnings  []string
+		wantProcesses bool
+	}{
+		{
+			name:          "checkpoint with 4 KiB pages",
+			entries:       testCheckpointEntries(t, 4096, testProcesses...),
+			wantDumped:    2 * 4096,
+			wantProcesses: true,
+		},
+		{
+			name:          "checkpoint with 64 KiB pages",
+			entries:       testCheckpointEntries(t, 64*1024, testProcesses...),
+			wantDumped:    2 * 64 * 1024,
+			wantProcesses: true,
+		},
+		{
+			name:          "checkpoint with the page size set",
+			entries:       testCheckpointEntries(t, 16*1024, testProcesses...),
+			pageSize:      16 * 1024,
+			wantDumped:    2 * 16 * 1024,
+			wantProcesses: true,
+		},
+		{
+			name: "checkpoint without CRIU images",
+			entries: map[string][]byte{
+				archive.ConfigDumpFile: []byte(`{"id":"0123","name":"app"}`),
+				archive.SpecDumpFile:   []byte(`{"ociVersion":"1.0.2"}`),
+			},
+			wantWarnings: []string{"processes: ", "open files: ", "sockets: ", "memory mappings: "},
+		},
+		{
+			name:    "checkpoint without config",
+			entries: map[string][]byte{archive.SpecDumpFile: []byte(`{"ociVersion":"1.0.2"}`)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Analyze(writeCheckpointDirectory(t, tt.entries), tt.pageSize)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Analyze() succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Container.Name != "app" {
+				t.Errorf("container is %q, want app", report.Container.Name)
+			}
+
+			var warnings []string
+			for _, warning := range report.Warnings {
+				if !strings.HasPrefix(warning, "open files: ") && !strings.HasPrefix(warning, "sockets: ") {
+					warnings = append(warnings, warning)
+				}
+			}
+			if !tt.wantProcesses {
+				if len(report.Processes) != 0 {
+					t.Errorf("report has %d processes, want none", len(report.Processes))
+				}
+				for _, prefix := range tt.wantWarnings {
+					if !containsPrefix(report.Warnings, prefix) {
+						t.Errorf("warnings %q do not report %q", report.Warnings, prefix)
+					}
+				}
+				return
+			}
+			// The test checkpoints have no file descriptors nor sockets.
+			if len(warnings) > 0 {
+				t.Errorf("report has warnings %q", warnings)
+			}
+
+			if len(report.Processes) != len(testProcesses) {
+				t.Fatalf("report has %d processes, want %d", len(report.Processes), len(testProcesses))
+			}
+			for i, process := range report.Processes {
+				want := testProcesses[i]
+				if process.PID != want.pid || process.PPID != want.ppid || process.Command != want.command {
+					t.Errorf("process %d is %d %d %s, want %d %d %s", i, process.PID, process.PPID,
+						process.Command, want.pid, want.ppid, want.command)
+				}
+				if got := strings.Join(process.Arguments, "\x00") + "\x00"; got != want.arguments {
+					t.Errorf("process %d has arguments %q, want %q", process.PID, got, want.arguments)
+				}
+				if got := strings.Join(process.Environment, "\x00") + "\x00"; got != want.environment {
+					t.Errorf("process %d has environment %q, want %q", process.PID, got, want.environment)
+				}
+				if process.Memory == nil {
+					t.Fatalf("process %d has no memory", process.PID)
+				}
+				if process.Memory.DumpedSize != tt.wantDumped {
+					t.Errorf("process %d dumped %d bytes, want %d", process.PID, process.Memory.DumpedSize,
+						tt.wantDumped)
+				}
+				if process.Memory.Executable != "/usr/bin/app" {
+					t.Errorf("process %d runs %q, want /usr/bin/app", process.PID, process.Memory.Executable)
+				}
+			}
+
+			wantChanges := &RootfsChanges{Changed: []string{"/etc/app.conf"}, Deleted: []string{"/tmp/lock"}}
+			if !reflect.DeepEqual(report.RootfsChanges, wantChanges) {
+				t.Errorf("root file system changes are %+v, want %+v", report.RootfsChanges, wantChanges)
+			}
+		})
+	}
+}
+
+func TestAnalyzeUndetectablePageSize(t *testing.T) {
+	entries := testCheckpointEntries(t, 4096, testProcesses...)
+	entries["checkpoint/pages-7.img"] = entries["checkpoint/pages-7.img"][:4096+100]
+
+	report, err := Analyze(writeCheckpointDirectory(t, entries), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsPrefix(report.Warnings, "memory of process 7: failed to detect the page size") {
+		t.Errorf("warnings %q do not report the page size of process 7", report.Warnings)
+	}
+}
+
+func TestDumpMemory(t *testing.T) {
+	const pageSize = 16 * 1024
+	directory := writeCheckpointDirectory(t, testCheckpointEntries(t, pageSize, testProcesses...))
+	app := testProcesses[1]
+
+	tests := []struct {
+		name     string
+		pid      uint32
+		start    uint64
+		end      uint64
+		pageSize int
+		want     []byte
+		wantErr  bool
+	}{
+		{
+			name:  "arguments",
+			pid:   app.pid,
+			start: testMemoryAddress,
+			end:   testMemoryAddress + uint64(len(app.arguments)),
+			want:  []byte(app.arguments),
+		},
+		{
+			name:  "across pages",
+			pid:   app.pid,
+			start: testMemoryAddress + pageSize - 2,
+			end:   testMemoryAddress + pageSize + 4,
+			want:  []byte("\x00\x00HOME"),
+		},
+		{
+			name:     "page size set",
+			pid:      app.pid,
+			start:    testMemoryAddress + pageSize,
+			end:      testMemoryAddress + pageSize + uint64(len(app.environment)),
+			pageSize: pageSize,
+			want:     []byte(app.environment),
+		},
+		{
+			name:  "pages not dumped",
+			pid:   app.pid,
+			start: testMemoryAddress + 2*pageSize,
+			end:   testMemoryAddress + 2*pageSize + 16,
+			want:  make([]byte, 16),
+		},
+		{name: "empty region", pid: app.pid, start: testMemoryAddress, end: testMemoryAddress, wantErr: true},
+		{name: "unknown process", pid: 42, start: testMemoryAddress, end: testMemoryAddress + 16, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var memory bytes.Buffer
+			err := DumpMemory(directory, tt.pid, tt.start, tt.end, tt.pageSize, &memory)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("DumpMemory() succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(memory.Bytes(), tt.want) {
+				t.Errorf("DumpMemory() = %q, want %q", memory.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func containsPrefix(values []string, prefix string) bool {
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package imagebuilder
+
+const (
+	// CRIOCheckpointNameAnnotation is the annotation CRI-O uses to identify checkpoint images.
+	CRIOCheckpointNameAnnotation = "io.kubernetes.cri-o.annotations.checkpoint.name"
+
+	// Annotations of the checkpoint image specification.
+	CheckpointNameAnnotation            = "org.criu.checkpoint.container.name"
+	CheckpointPodNameAnnotation         = "org.criu.checkpoint.pod.name"
+	CheckpointPodNamespaceAnnotation    = "org.criu.checkpoint.pod.namespace"
+	CheckpointRuntimeNameAnnotation     = "org.criu.checkpoint.runtime.name"
+	CheckpointRootfsImageNameAnnotation = "org.criu.checkpoint.rootfsImageName"
+	CheckpointRootfsImageRefAnnotation  = "org.criu.checkpoint.rootfsImageRef"
+	CheckpointEngineAnnotation          = "org.criu.checkpoint.engine.name"
+	CheckpointEngineVersionAnnotation   = "org.criu.checkpoint.engine.version"
+	CheckpointCriuVersionAnnotation     = "org.criu.checkpoint.criu.version"
+	CheckpointKernelVersionAnnotation   = "org.criu.checkpoint.kernel.version"
+
+	// CheckpointParentImageAnnotation is the image of the previous checkpoint of the container, the
+	// parent of an incremental checkpoint image.
+	CheckpointParentImageAnnotation = "io.kcr.checkpoint.parent"
+)
+
+// checkpointAnnotations returns the annotations of the checkpoint image in the given format.
+func checkpointAnnotations(format ImageFormat, metadata CheckpointMetadata) map[string]string {
+	annotations := map[string]string{
+		CRIOCheckpointNameAnnotation: metadata.ContainerName,
+	}
+	if format != ImageFormatOCI {
+		return annotations
+	}
+	for annotation, value := range map[string]string{
+		CheckpointNameAnnotation:            metadata.ContainerName,
+		CheckpointPodNameAnnotation:         metadata.PodName,
+		CheckpointPodNamespaceAnnotation:    metadata.PodNamespace,
+		CheckpointRuntimeNameAnnotation:     metadata.RuntimeName,
+		CheckpointRootfsImageNameAnnotation: metadata.RootfsImageName,
+		CheckpointRootfsImageRefAnnotation:  metadata.RootfsImageRef,
+		CheckpointEngineAnnotation:          metadata.Engine,
+		CheckpointEngineVersionAnnotation:   metadata.EngineVersion,
+		CheckpointCriuVersionAnnotation:     metadata.CriuVersion,
+		CheckpointKernelVersionAnnotation:   metadata.KernelVersion,
+		CheckpointParentImageAnnotation:     metadata.ParentImage,
+	} {
+		if value != "" {
+			annotations[annotation] = value
+		}
+	}
+	return annotations
+}
@@ -0,0 +1,73 @@
+package imagebuilder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckpointAnnotations(t *testing.T) {
+	metadata := CheckpointMetadata{
+		ContainerName:   "app",
+		PodName:         "web-0",
+		PodNamespace:    "default",
+		RuntimeName:     "runc",
+		RootfsImageName: "docker.io/library/nginx:latest",
+		RootfsImageRef:  "sha256:0123",
+		Engine:          "cri-o",
+		EngineVersion:   "1.30.1",
+		CriuVersion:     "3.19",
+		KernelVersion:   "6.8.0-40-generic",
+		ParentImage:     "checkpoint-web-0@sha256:4567",
+	}
+
+	tests := []struct {
+		name     string
+		format   ImageFormat
+		metadata CheckpointMetadata
+		want     map[string]string
+	}{
+		{
+			name:     "cri-o format only names the checkpoint",
+			format:   ImageFormatCRIO,
+			metadata: metadata,
+			want:     map[string]string{CRIOCheckpointNameAnnotation: "app"},
+		},
+		{
+			name:     "oci format follows the checkpoint image specification",
+			format:   ImageFormatOCI,
+			metadata: metadata,
+			want: map[string]string{
+				CRIOCheckpointNameAnnotation:        "app",
+				CheckpointNameAnnotation:            "app",
+				CheckpointPodNameAnnotation:         "web-0",
+				CheckpointPodNamespaceAnnotation:    "default",
+				CheckpointRuntimeNameAnnotation:     "runc",
+				CheckpointRootfsImageNameAnnotation: "docker.io/library/nginx:latest",
+				CheckpointRootfsImageRefAnnotation:  "sha256:0123",
+				CheckpointEngineAnnotation:          "cri-o",
+				CheckpointEngineVersionAnnotation:   "1.30.1",
+				CheckpointCriuVersionAnnotation:     "3.19",
+				CheckpointKernelVersionAnnotation:   "6.8.0-40-generic",
+				CheckpointParentImageAnnotation:     "checkpoint-web-0@sha256:4567",
+			},
+		},
+		{
+			name:     "oci format leaves out the unknown values",
+			format:   ImageFormatOCI,
+			metadata: CheckpointMetadata{ContainerName: "app", PodName: "web-0"},
+			want: map[string]string{
+				CRIOCheckpointNameAnnotation: "app",
+				CheckpointNameAnnotation:     "app",
+				CheckpointPodNameAnnotation:  "web-0",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := checkpointAnnotations(test.format, test.metadata)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("checkpointAnnotations() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -4,21 +4,31 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"runtime"
+	"sync"
 
 	"github.com/containers/buildah"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
 	is "github.com/containers/image/v5/storage"
 	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 type BuildahImageBuilder struct {
-	buildStore   storage.Store
-	registryAuth RegistryAuth
+	buildStore  storage.Store
+	imageFormat ImageFormat
+
+	// The layers are stored uncompressed in the store and compressed, and encrypted, when pushed, the build
+	// options of every built image are kept until it is pushed.
+	mutex   sync.Mutex
+	options map[string]BuildOptions
 }
 
-func NewBuildahImageBuilder(registryAuth RegistryAuth) (ImageBuilder, error) {
+func NewBuildahImageBuilder(imageFormat ImageFormat) (ImageBuilder, error) {
 	buildStorageOptions, err := storage.DefaultStoreOptions()
 	if err != nil {
 		return nil, err
@@ -27,17 +37,26 @@ func NewBuildahImageBuilder(registryAuth RegistryAuth) (ImageBuilder, error) {
 	if err != nil {
 		return nil, err
 	}
-	return BuildahImageBuilder{
-		buildStore:   buildStore,
-		registryAuth: registryAuth,
+	return &BuildahImageBuilder{
+		buildStore:  buildStore,
+		imageFormat: imageFormat,
+		options:     make(map[string]BuildOptions),
 	}, nil
 }
 
-func (b BuildahImageBuilder) BuildFromCheckpoint(
-	checkpointLocation, containerName, imageName string, ctx context.Context,
+func (b *BuildahImageBuilder) BuildFromCheckpoint(
+	checkpointLocation string, metadata CheckpointMetadata, options BuildOptions, imageName string, ctx context.Context,
 ) error {
 	log := log.FromContext(ctx)
 
+	// Uncompressed layers are pushed as they are stored, which leaves no room to encrypt them.
+	if options.Compression.algorithm() == CompressionNone && options.Encryption != nil {
+		return fmt.Errorf("the buildah image builder can not encrypt uncompressed layers")
+	}
+	if err := options.validate(); err != nil {
+		return err
+	}
+
 	builderOptions := buildah.BuilderOptions{
 		FromImage: "scratch",
 	}
@@ -53,7 +72,13 @@ func (b BuildahImageBuilder) BuildFromCheckpoint(
 	if err != nil {
 		return err
 	}
-	builder.SetAnnotation("io.kubernetes.cri-o.annotations.checkpoint.name", containerName)
+	for annotation, value := range checkpointAnnotations(b.imageFormat, metadata) {
+		builder.SetAnnotation(annotation, value)
+	}
+	if b.imageFormat == ImageFormatOCI {
+		builder.SetOS(runtime.GOOS)
+		builder.SetArchitecture(runtime.GOARCH)
+	}
 	log.Info("Successfully added the checkpoint file to the builder")
 
 	imageRef, err := is.Transport.ParseStoreReference(b.buildStore, buildahImageName)
@@ -61,52 +86,119 @@ func (b BuildahImageBuilder) BuildFromCheckpoint(
 		return err
 	}
 
-	_, _, _, err = builder.Commit(ctx, imageRef, buildah.CommitOptions{})
-	return err
+	if _, _, _, err = builder.Commit(ctx, imageRef, buildah.CommitOptions{}); err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.options[imageName] = options
+	return nil
 }
 
-func (b BuildahImageBuilder) PushToNodeRuntime(
-	ctx context.Context, localImageName string, runtimeImageName string,
-) error {
+func (b *BuildahImageBuilder) PushToNodeRuntime(
+	ctx context.Context, localImageName string, runtimeImageName string, registryAuth RegistryAuth,
+) (PushedImage, error) {
 	logger := log.FromContext(ctx)
-	destinationSpec := "docker://" + b.registryAuth.URL + "/" + runtimeImageName
+	destinationSpec := "docker://" + registryAuth.URL + "/" + runtimeImageName
 	imageReference, err := alltransports.ParseImageName(destinationSpec)
 	if err != nil {
 		logger.Error(err, "Failed to parse destination spec", "destination", destinationSpec)
-		return fmt.Errorf("failed to parse destination spec %s: %w", destinationSpec, err)
+		return PushedImage{}, fmt.Errorf("failed to parse destination spec %s: %w", destinationSpec, err)
 	}
 
 	_, err = is.Transport.ParseStoreReference(b.buildStore, localImageName)
 	if err != nil {
 		logger.Error(err, "Local image not found in store, cannot push", "imageName", localImageName)
-		return fmt.Errorf("local image %s not found for push: %w", localImageName, err)
+		return PushedImage{}, fmt.Errorf("local image %s not found for push: %w", localImageName, err)
 	}
 
-	systemContext := types.SystemContext{
-		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	b.mutex.Lock()
+	buildOptions := b.options[localImageName]
+	delete(b.options, localImageName)
+	b.mutex.Unlock()
+	compression := buildOptions.Compression
+	compressionFormat, err := compression.compressionFormat()
+	if err != nil {
+		return PushedImage{}, err
 	}
-	if b.registryAuth.Basic != nil {
-		systemContext.DockerAuthConfig = &types.DockerAuthConfig{
-			Username: b.registryAuth.Basic.Username,
-			Password: b.registryAuth.Basic.Password,
-		}
-	} else if b.registryAuth.AuthFile != nil {
-		systemContext.AuthFilePath = *b.registryAuth.AuthFile
+
+	// containers/image compresses the layers pushed to a registry, unless it must keep their digests. The
+	// layers are stored uncompressed, so an uncompressed image is copied from the store as it is.
+	if compressionFormat == nil {
+		return b.pushUncompressed(ctx, localImageName, imageReference, registryAuth)
 	}
 
+	systemContext := registryAuth.systemContext()
 	options := buildah.PushOptions{
-		Store:         b.buildStore,
-		ReportWriter:  os.Stderr,
-		SystemContext: &systemContext,
+		Store:                  b.buildStore,
+		ReportWriter:           os.Stderr,
+		SystemContext:          systemContext,
+		CompressionFormat:      compressionFormat,
+		CompressionLevel:       compression.Level,
+		ForceCompressionFormat: true,
+	}
+	if buildOptions.Encryption != nil {
+		// Only OCI manifests describe encrypted layers.
+		options.ManifestType = imgspecv1.MediaTypeImageManifest
+		options.OciEncryptConfig = buildOptions.Encryption.encryptConfig()
+		options.OciEncryptLayers = &[]int{}
 	}
 
-	_, _, err = buildah.Push(ctx, localImageName, imageReference, options)
+	_, manifestDigest, err := buildah.Push(ctx, localImageName, imageReference, options)
 	if err != nil {
 		logger.Error(err, "Failed to push image to node runtime", "imageName", localImageName, "destination", destinationSpec)
-		return fmt.Errorf("failed to push image %s to %s: %w", localImageName, destinationSpec, err)
+		return PushedImage{}, fmt.Errorf("failed to push image %s to %s: %w", localImageName, destinationSpec, err)
 	}
 
-	logger.Info("Successfully pushed image to local runtime", "imageName", localImageName, "destination", destinationSpec)
+	logger.Info("Successfully pushed image to local runtime",
+		"imageName", localImageName, "destination", destinationSpec, "digest", manifestDigest)
 
-	return nil
+	digestReference, err := reference.WithDigest(reference.TrimNamed(imageReference.DockerReference()), manifestDigest)
+	if err != nil {
+		return PushedImage{}, err
+	}
+	pushedReference, err := docker.NewReference(digestReference)
+	if err != nil {
+		return PushedImage{}, err
+	}
+	return b.pushedImage(ctx, pushedReference, systemContext)
+}
+
+// pushUncompressed pushes the image with the layers stored in the store, without compressing them.
+func (b *BuildahImageBuilder) pushUncompressed(
+	ctx context.Context, localImageName string, destination types.ImageReference, registryAuth RegistryAuth,
+) (PushedImage, error) {
+	logger := log.FromContext(ctx)
+
+	source, err := is.Transport.ParseStoreReference(b.buildStore, "localhost/"+localImageName)
+	if err != nil {
+		return PushedImage{}, fmt.Errorf("local image %s not found for push: %w", localImageName, err)
+	}
+	manifest, err := copyImage(ctx, registryAuth, destination, source, false)
+	if err != nil {
+		logger.Error(err, "Failed to push image to node runtime", "imageName", localImageName)
+		return PushedImage{}, fmt.Errorf("failed to push image %s: %w", localImageName, err)
+	}
+	logger.Info("Successfully pushed uncompressed image to local runtime", "imageName", localImageName)
+	return pushedImageFromManifest(manifest)
+}
+
+// pushedImage reads the manifest of the pushed image from the registry, buildah does not return it.
+func (b *BuildahImageBuilder) pushedImage(
+	ctx context.Context, imageReference types.ImageReference, systemContext *types.SystemContext,
+) (PushedImage, error) {
+	source, err := imageReference.NewImageSource(ctx, systemContext)
+	if err != nil {
+		return PushedImage{}, err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	manifest, _, err := source.GetManifest(ctx, nil)
+	if err != nil {
+		return PushedImage{}, fmt.Errorf("failed to get manifest of pushed image: %w", err)
+	}
+	return pushedImageFromManifest(manifest)
 }
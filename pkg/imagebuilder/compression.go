@@ -0,0 +1,120 @@
+package imagebuilder
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/containers/image/v5/pkg/compression"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Compression algorithms of the checkpoint image layers.
+const (
+	CompressionNone        = "none"
+	CompressionGzip        = "gzip"
+	CompressionZstd        = "zstd"
+	CompressionZstdChunked = "zstd:chunked"
+)
+
+// Compression is the compression of the checkpoint image layers. The zero value compresses the layers with
+// gzip at the default level.
+type Compression struct {
+	// Algorithm is the compression algorithm, one of none, gzip, zstd and zstd:chunked.
+	Algorithm string
+	// Level is the compression level, the algorithm default when nil.
+	Level *int
+}
+
+// ParseCompression parses a compression in the form algorithm[:level], e.g. gzip:9 or zstd:chunked.
+func ParseCompression(value string) (Compression, error) {
+	algorithm := value
+	var level *int
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		if parsedLevel, err := strconv.Atoi(value[i+1:]); err == nil {
+			algorithm = value[:i]
+			level = &parsedLevel
+		}
+	}
+
+	var minLevel, maxLevel int
+	switch algorithm {
+	case CompressionNone:
+		if level != nil {
+			return Compression{}, fmt.Errorf("compression %q does not accept a level", algorithm)
+		}
+	case CompressionGzip:
+		minLevel, maxLevel = 1, 9
+	case CompressionZstd, CompressionZstdChunked:
+		minLevel, maxLevel = 1, 22
+	default:
+		return Compression{}, fmt.Errorf("unknown compression %q, must be one of %s, %s, %s, %s",
+			value, CompressionNone, CompressionGzip, CompressionZstd, CompressionZstdChunked)
+	}
+	if level != nil && (*level < minLevel || *level > maxLevel) {
+		return Compression{}, fmt.Errorf("invalid %s compression level %d, must be between %d and %d",
+			algorithm, *level, minLevel, maxLevel)
+	}
+	return Compression{Algorithm: algorithm, Level: level}, nil
+}
+
+func (c Compression) String() string {
+	if c.Level == nil {
+		return c.algorithm()
+	}
+	return fmt.Sprintf("%s:%d", c.algorithm(), *c.Level)
+}
+
+func (c Compression) algorithm() string {
+	if c.Algorithm == "" {
+		return CompressionGzip
+	}
+	return c.Algorithm
+}
+
+// mediaType returns the media type of the layers compressed with c.
+func (c Compression) mediaType() string {
+	switch c.algorithm() {
+	case CompressionNone:
+		return imgspecv1.MediaTypeImageLayer
+	case CompressionZstd, CompressionZstdChunked:
+		return imgspecv1.MediaTypeImageLayerZstd
+	default:
+		return imgspecv1.MediaTypeImageLayerGzip
+	}
+}
+
+// compressionFormat returns the containers/image compression algorithm, or nil when the layers are not
+// compressed.
+func (c Compression) compressionFormat() (*compression.Algorithm, error) {
+	if c.algorithm() == CompressionNone {
+		return nil, nil
+	}
+	algorithm, err := compression.AlgorithmByName(c.algorithm())
+	if err != nil {
+		return nil, err
+	}
+	return &algorithm, nil
+}
+
+// compressor returns a writer compressing into w. Algorithms storing metadata about the layer, like the
+// table of contents of zstd:chunked, add it to annotations, to be set in the layer descriptor.
+func (c Compression) compressor(w io.Writer, annotations map[string]string) (io.WriteCloser, error) {
+	format, err := c.compressionFormat()
+	if err != nil {
+		return nil, err
+	}
+	if format == nil {
+		return nopWriteCloser{w}, nil
+	}
+	return compression.CompressStreamWithMetadata(w, annotations, *format, c.Level)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package imagebuilder
+
+import (
+	"testing"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		value     string
+		want      string
+		mediaType string
+		wantErr   bool
+	}{
+		{value: "none", want: "none", mediaType: imgspecv1.MediaTypeImageLayer},
+		{value: "gzip", want: "gzip", mediaType: imgspecv1.MediaTypeImageLayerGzip},
+		{value: "gzip:1", want: "gzip:1", mediaType: imgspecv1.MediaTypeImageLayerGzip},
+		{value: "gzip:9", want: "gzip:9", mediaType: imgspecv1.MediaTypeImageLayerGzip},
+		{value: "zstd", want: "zstd", mediaType: imgspecv1.MediaTypeImageLayerZstd},
+		{value: "zstd:22", want: "zstd:22", mediaType: imgspecv1.MediaTypeImageLayerZstd},
+		{value: "zstd:chunked", want: "zstd:chunked", mediaType: imgspecv1.MediaTypeImageLayerZstd},
+		{value: "zstd:chunked:3", want: "zstd:chunked:3", mediaType: imgspecv1.MediaTypeImageLayerZstd},
+		{value: "none:1", wantErr: true},
+		{value: "gzip:0", wantErr: true},
+		{value: "gzip:10", wantErr: true},
+		{value: "gzip:-1", wantErr: true},
+		{value: "zstd:0", wantErr: true},
+		{value: "zstd:23", wantErr: true},
+		{value: "zstd:chunked:23", wantErr: true},
+		{value: "gzip:fast", wantErr: true},
+		{value: "brotli", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			compression, err := ParseCompression(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseCompression(%q) = %s, want an error", tt.value, compression)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := compression.String(); got != tt.want {
+				t.Errorf("ParseCompression(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+			if got := compression.mediaType(); got != tt.mediaType {
+				t.Errorf("ParseCompression(%q) has media type %s, want %s", tt.value, got, tt.mediaType)
+			}
+		})
+	}
+}
+
+func TestCompressionZeroValue(t *testing.T) {
+	var compression Compression
+	if got := compression.String(); got != CompressionGzip {
+		t.Errorf("zero compression is %s, want %s", got, CompressionGzip)
+	}
+}
@@ -0,0 +1,249 @@
+package imagebuilder
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RegistrySecretRegistryKey is the optional key of a registry credentials Secret with the registry, and
+// repository prefix, the checkpoint images are pushed to, e.g. registry.example.com/team-a. In the Secrets
+// of the namespaces it must be one of the allowed registries of the RegistryResolver.
+const RegistrySecretRegistryKey = "registry"
+
+// RegistryResolver resolves the registry, and its credentials, the checkpoint images of a namespace are
+// pushed to. Credentials are read from Secrets of type kubernetes.io/dockerconfigjson every time they are
+// resolved, so rotated credentials are used without restarting.
+//
+// The Secret named NamespaceSecretName in the namespace of the checkpoint takes precedence, so every tenant
+// pushes to its own repositories with its own credentials. Its registry key is only honored for the
+// AllowedRegistries, as anyone writing Secrets in the namespace could otherwise send the checkpoints to any
+// host. Otherwise the Secret referenced by Secret is used, and when neither exists the Default registry is
+// used as configured.
+type RegistryResolver struct {
+	// Reader reads the Secrets. It should read straight from the API server, so the Secrets of the cluster
+	// are not cached.
+	Reader client.Reader
+	// Default is the registry the images are pushed to when there is no credentials Secret.
+	Default RegistryAuth
+	// Secret is the Secret with the credentials of the default registry, ignored when its name is empty.
+	Secret types.NamespacedName
+	// NamespaceSecretName is the name of the Secret with the registry credentials of each namespace,
+	// ignored when empty.
+	NamespaceSecretName string
+	// AllowedRegistries are the registries, with an optional repository prefix, the registry key of the
+	// Secrets of the namespaces may set. A registry is allowed when it is one of them or in one of their
+	// repositories. The key is rejected when there are none.
+	AllowedRegistries []string
+}
+
+// ParseSecretReference parses a reference to a Secret, like the registry credentials, in the form namespace/name.
+func ParseSecretReference(value string) (types.NamespacedName, error) {
+	namespace, name, found := strings.Cut(value, "/")
+	if !found || namespace == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid secret %q, must be namespace/name", value)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
+
+// Resolve returns the registry the checkpoint images of the namespace are pushed to.
+func (r RegistryResolver) Resolve(ctx context.Context, namespace string) (RegistryAuth, error) {
+	if r.Reader == nil {
+		return r.Default, nil
+	}
+
+	if r.NamespaceSecretName != "" {
+		key := types.NamespacedName{Namespace: namespace, Name: r.NamespaceSecretName}
+		registryAuth, found, err := r.resolveSecret(ctx, key, true)
+		if err != nil || found {
+			return registryAuth, err
+		}
+	}
+	if r.Secret.Name != "" {
+		// The Secret of the default registry is set by the operator, any registry is allowed.
+		registryAuth, found, err := r.resolveSecret(ctx, r.Secret, false)
+		if err != nil || found {
+			return registryAuth, err
+		}
+	}
+	return r.Default, nil
+}
+
+// PullSecret returns the name of the registry credentials Secret of the namespace, which the pods restored in
+// the namespace need to pull the checkpoint images pushed with it. The name is empty when the namespace has
+// none.
+func (r RegistryResolver) PullSecret(ctx context.Context, namespace string) (string, error) {
+	if r.Reader == nil || r.NamespaceSecretName == "" {
+		return "", nil
+	}
+	var secret corev1.Secret
+	key := types.NamespacedName{Namespace: namespace, Name: r.NamespaceSecretName}
+	if err := r.Reader.Get(ctx, key, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get registry credentials secret %s: %w", key, err)
+	}
+	return secret.Name, nil
+}
+
+// resolveSecret returns the registry of the credentials Secret, and whether the Secret exists. The registry
+// key of a restricted Secret must be one of the AllowedRegistries.
+func (r RegistryResolver) resolveSecret(
+	ctx context.Context, key types.NamespacedName, restricted bool,
+) (RegistryAuth, bool, error) {
+	var secret corev1.Secret
+	if err := r.Reader.Get(ctx, key, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return RegistryAuth{}, false, nil
+		}
+		return RegistryAuth{}, false, fmt.Errorf("failed to get registry credentials secret %s: %w", key, err)
+	}
+	registryAuth, err := registryAuthFromSecret(&secret, r.Default)
+	if err != nil {
+		return RegistryAuth{}, true, fmt.Errorf("invalid registry credentials secret %s: %w", key, err)
+	}
+	if _, ok := secret.Data[RegistrySecretRegistryKey]; ok && restricted &&
+		!registryAllowed(registryAuth.URL, r.AllowedRegistries) {
+		return RegistryAuth{}, true, fmt.Errorf("registry %s of registry credentials secret %s is not allowed",
+			registryAuth.URL, key)
+	}
+	return registryAuth, true, nil
+}
+
+// registryAllowed reports whether the registry, with its optional repository prefix, is one of the allowed
+// registries or in one of their repositories.
+func registryAllowed(registry string, allowedRegistries []string) bool {
+	for _, allowed := range allowedRegistries {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if allowed != "" && (registry == allowed || strings.HasPrefix(registry, allowed+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddImagePullSecret adds the Secret to the image pull Secrets of the pod, unless it is already there.
+func AddImagePullSecret(spec *corev1.PodSpec, name string) {
+	for _, secret := range spec.ImagePullSecrets {
+		if secret.Name == name {
+			return
+		}
+	}
+	spec.ImagePullSecrets = append(spec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+}
+
+// ResolveRegistry returns the registry at url, e.g. the one described by a CheckpointRegistry, which keeps
+// the TLS configuration of the Default registry unless insecure is set. The credentials are read from the
+// given Secret, ignoring its registry key, and when its name is empty from the auth file of the Default
+// registry.
+func (r RegistryResolver) ResolveRegistry(
+	ctx context.Context, url string, secret types.NamespacedName, insecure bool,
+) (RegistryAuth, error) {
+	registryAuth := r.Default
+	registryAuth.URL = url
+	registryAuth.Basic = nil
+	registryAuth.Insecure = registryAuth.Insecure || insecure
+	if secret.Name == "" {
+		return registryAuth, nil
+	}
+	if r.Reader == nil {
+		return RegistryAuth{}, fmt.Errorf("unable to read registry credentials secret %s", secret)
+	}
+
+	var credentialsSecret corev1.Secret
+	if err := r.Reader.Get(ctx, secret, &credentialsSecret); err != nil {
+		return RegistryAuth{}, fmt.Errorf("failed to get registry credentials secret %s: %w", secret, err)
+	}
+	credentials, err := secretCredentials(&credentialsSecret, url)
+	if err != nil {
+		return RegistryAuth{}, fmt.Errorf("invalid registry credentials secret %s: %w", secret, err)
+	}
+	registryAuth.Basic = credentials
+	registryAuth.AuthFile = nil
+	return registryAuth, nil
+}
+
+// registryAuthFromSecret returns the registry of the credentials Secret. The TLS configuration is kept from
+// base, and so is the registry when the Secret does not set one.
+func registryAuthFromSecret(secret *corev1.Secret, base RegistryAuth) (RegistryAuth, error) {
+	registryAuth := base
+	if registry, ok := secret.Data[RegistrySecretRegistryKey]; ok {
+		registryAuth.URL = strings.TrimSpace(string(registry))
+	}
+
+	credentials, err := secretCredentials(secret, registryAuth.URL)
+	if err != nil {
+		return RegistryAuth{}, err
+	}
+	registryAuth.Basic = credentials
+	registryAuth.AuthFile = nil
+	return registryAuth, nil
+}
+
+// secretCredentials returns the credentials of the registry URL in a Secret of type
+// kubernetes.io/dockerconfigjson.
+func secretCredentials(secret *corev1.Secret, registryURL string) (*RegistryBasicAuth, error) {
+	if secret.Type != corev1.SecretTypeDockerConfigJson {
+		return nil, fmt.Errorf("type must be %s", corev1.SecretTypeDockerConfigJson)
+	}
+	return dockerConfigCredentials(secret.Data[corev1.DockerConfigJsonKey], registryURL)
+}
+
+// dockerConfigEntry is an entry of the auths of a docker config.json file.
+type dockerConfigEntry struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// dockerConfigCredentials returns the credentials of the docker config.json content for the registry URL.
+// The most specific entry matching the registry and its repository prefix is used.
+func dockerConfigCredentials(content []byte, registryURL string) (*RegistryBasicAuth, error) {
+	var config struct {
+		Auths map[string]dockerConfigEntry `json:"auths"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", corev1.DockerConfigJsonKey, err)
+	}
+
+	entries := make(map[string]dockerConfigEntry, len(config.Auths))
+	for key, entry := range config.Auths {
+		key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		entries[strings.TrimSuffix(key, "/")] = entry
+	}
+
+	for candidate := registryURL; candidate != ""; {
+		if entry, ok := entries[candidate]; ok {
+			return entry.credentials()
+		}
+		index := strings.LastIndex(candidate, "/")
+		if index < 0 {
+			break
+		}
+		candidate = candidate[:index]
+	}
+	return nil, fmt.Errorf("no credentials for registry %s", registryURL)
+}
+
+func (e dockerConfigEntry) credentials() (*RegistryBasicAuth, error) {
+	if e.Username != "" || e.Password != "" {
+		return &RegistryBasicAuth{Username: e.Username, Password: e.Password}, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(e.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth: %w", err)
+	}
+	username, password, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return nil, fmt.Errorf("invalid auth: expected username:password")
+	}
+	return &RegistryBasicAuth{Username: username, Password: password}, nil
+}
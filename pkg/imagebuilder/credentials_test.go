@@ -0,0 +1,124 @@
+package imagebuilder
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// registrySecret returns a registry credentials Secret for the registry server, pushing to registry when it
+// is not empty.
+func registrySecret(namespace, name, server, registry string) *corev1.Secret {
+	auth := base64.StdEncoding.EncodeToString([]byte(name + ":password"))
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, server, auth)),
+		},
+	}
+	if registry != "" {
+		secret.Data[RegistrySecretRegistryKey] = []byte(registry)
+	}
+	return secret
+}
+
+func TestRegistryResolverResolve(t *testing.T) {
+	resolver := RegistryResolver{
+		Reader: fake.NewClientBuilder().WithObjects(
+			registrySecret("kcr-system", "default-credentials", "registry.example.com", "registry.example.com/default"),
+			registrySecret("team-a", "kcr-registry-credentials", "registry.example.com", "registry.example.com/tenants/a"),
+			registrySecret("team-b", "kcr-registry-credentials", "evil.example.com", "evil.example.com/b"),
+			registrySecret("team-c", "kcr-registry-credentials", "registry.example.com", "registry.example.com/tenantsc"),
+			registrySecret("team-d", "kcr-registry-credentials", "registry.example.com", ""),
+		).Build(),
+		Default:             RegistryAuth{URL: "registry.example.com/checkpoints", CertsDirectory: "/etc/kcr/certs"},
+		Secret:              types.NamespacedName{Namespace: "kcr-system", Name: "default-credentials"},
+		NamespaceSecretName: "kcr-registry-credentials",
+		AllowedRegistries:   []string{"registry.example.com/tenants/"},
+	}
+
+	tests := []struct {
+		namespace string
+		wantURL   string
+		wantUser  string
+		wantErr   bool
+	}{
+		{namespace: "team-a", wantURL: "registry.example.com/tenants/a", wantUser: "kcr-registry-credentials"},
+		{namespace: "team-b", wantErr: true},
+		{namespace: "team-c", wantErr: true},
+		{namespace: "team-d", wantURL: "registry.example.com/checkpoints", wantUser: "kcr-registry-credentials"},
+		{namespace: "team-e", wantURL: "registry.example.com/default", wantUser: "default-credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			registryAuth, err := resolver.Resolve(context.Background(), tt.namespace)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolved registry %s, want an error", registryAuth.URL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if registryAuth.URL != tt.wantURL {
+				t.Errorf("resolved registry %s, want %s", registryAuth.URL, tt.wantURL)
+			}
+			if registryAuth.Basic == nil || registryAuth.Basic.Username != tt.wantUser {
+				t.Errorf("resolved credentials %v, want the user %s", registryAuth.Basic, tt.wantUser)
+			}
+			if registryAuth.CertsDirectory != resolver.Default.CertsDirectory {
+				t.Errorf("resolved certificates %s, want the default ones", registryAuth.CertsDirectory)
+			}
+		})
+	}
+}
+
+func TestRegistryResolverResolveWithoutAllowedRegistries(t *testing.T) {
+	resolver := RegistryResolver{
+		Reader: fake.NewClientBuilder().WithObjects(
+			registrySecret("team-a", "kcr-registry-credentials", "registry.example.com", "registry.example.com/a"),
+		).Build(),
+		Default:             RegistryAuth{URL: "registry.example.com/checkpoints"},
+		NamespaceSecretName: "kcr-registry-credentials",
+	}
+	if registryAuth, err := resolver.Resolve(context.Background(), "team-a"); err == nil {
+		t.Errorf("resolved registry %s, want an error", registryAuth.URL)
+	}
+}
+
+func TestRegistryResolverPullSecret(t *testing.T) {
+	resolver := RegistryResolver{
+		Reader: fake.NewClientBuilder().WithObjects(
+			registrySecret("team-a", "kcr-registry-credentials", "registry.example.com", ""),
+		).Build(),
+		NamespaceSecretName: "kcr-registry-credentials",
+	}
+	for namespace, want := range map[string]string{"team-a": "kcr-registry-credentials", "team-b": ""} {
+		got, err := resolver.PullSecret(context.Background(), namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("pull secret of %s is %q, want %q", namespace, got, want)
+		}
+	}
+}
+
+func TestAddImagePullSecret(t *testing.T) {
+	spec := corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "app-credentials"}}}
+	AddImagePullSecret(&spec, "kcr-registry-credentials")
+	AddImagePullSecret(&spec, "kcr-registry-credentials")
+	want := []corev1.LocalObjectReference{{Name: "app-credentials"}, {Name: "kcr-registry-credentials"}}
+	if len(spec.ImagePullSecrets) != len(want) || spec.ImagePullSecrets[0] != want[0] ||
+		spec.ImagePullSecrets[1] != want[1] {
+		t.Errorf("image pull secrets are %v, want %v", spec.ImagePullSecrets, want)
+	}
+}
@@ -0,0 +1,210 @@
+package imagebuilder
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/containers/ocicrypt"
+	encconfig "github.com/containers/ocicrypt/config"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Encryption schemes of the recipients of the checkpoint image layers.
+const (
+	// EncryptionSchemeJWE encrypts the layer keys for a public key in PEM format.
+	EncryptionSchemeJWE = "jwe"
+	// EncryptionSchemePKCS7 encrypts the layer keys for the public key of a x509 certificate in PEM format.
+	EncryptionSchemePKCS7 = "pkcs7"
+)
+
+// encryptedMediaTypeSuffix is appended to the media type of the encrypted layers.
+const encryptedMediaTypeSuffix = "+encrypted"
+
+// Encryption encrypts the checkpoint image layers with ocicrypt, so the memory dumps stored in the
+// registry can only be read with one of the recipients private keys. Container runtimes decrypt the layers
+// when they pull the image, with the keys in their decryption keys directory.
+type Encryption struct {
+	cryptoConfig encconfig.CryptoConfig
+	// KeyIDs identify the public keys of the recipients, see KeyID.
+	KeyIDs []string
+}
+
+// NewEncryption creates an Encryption for the recipients, in the form scheme:path, where scheme is jwe for
+// a public key file and pkcs7 for a certificate file.
+func NewEncryption(recipients []string) (*Encryption, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no encryption recipients")
+	}
+
+	var publicKeys, certificates [][]byte
+	encryption := &Encryption{}
+	for _, recipient := range recipients {
+		scheme, path, ok := strings.Cut(recipient, ":")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid encryption recipient %q, must be in the form scheme:path", recipient)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption recipient %s: %w", path, err)
+		}
+
+		var publicKey crypto.PublicKey
+		switch scheme {
+		case EncryptionSchemeJWE:
+			publicKey, err = parsePublicKey(content)
+			publicKeys = append(publicKeys, content)
+		case EncryptionSchemePKCS7:
+			var certificate *x509.Certificate
+			if certificate, err = parseCertificate(content); err == nil {
+				publicKey = certificate.PublicKey
+			}
+			certificates = append(certificates, content)
+		default:
+			return nil, fmt.Errorf("unknown encryption scheme %q, must be one of %s, %s",
+				scheme, EncryptionSchemeJWE, EncryptionSchemePKCS7)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption recipient %s: %w", path, err)
+		}
+
+		keyID, err := KeyID(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption recipient %s: %w", path, err)
+		}
+		encryption.KeyIDs = append(encryption.KeyIDs, keyID)
+	}
+
+	var cryptoConfigs []encconfig.CryptoConfig
+	if len(publicKeys) > 0 {
+		cryptoConfig, err := encconfig.EncryptWithJwe(publicKeys)
+		if err != nil {
+			return nil, err
+		}
+		cryptoConfigs = append(cryptoConfigs, cryptoConfig)
+	}
+	if len(certificates) > 0 {
+		cryptoConfig, err := encconfig.EncryptWithPkcs7(certificates)
+		if err != nil {
+			return nil, err
+		}
+		cryptoConfigs = append(cryptoConfigs, cryptoConfig)
+	}
+	encryption.cryptoConfig = encconfig.CombineCryptoConfigs(cryptoConfigs)
+	return encryption, nil
+}
+
+// encryptConfig returns the ocicrypt configuration encrypting the layers for the recipients.
+func (e *Encryption) encryptConfig() *encconfig.EncryptConfig {
+	return e.cryptoConfig.EncryptConfig
+}
+
+// encryptLayer writes the compressed layer content, described by desc, encrypted into w. It returns the
+// annotations of the encrypted layer, which hold the layer key wrapped for every recipient.
+func (e *Encryption) encryptLayer(w io.Writer, content io.Reader, desc imgspecv1.Descriptor) (map[string]string, error) {
+	reader, finalizer, err := ocicrypt.EncryptLayer(e.encryptConfig(), content, desc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt layer %s: %w", desc.Digest, err)
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		return nil, err
+	}
+	encryptionAnnotations, err := finalizer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt layer %s: %w", desc.Digest, err)
+	}
+
+	annotations := make(map[string]string, len(desc.Annotations)+len(encryptionAnnotations))
+	for key, value := range desc.Annotations {
+		annotations[key] = value
+	}
+	for key, value := range encryptionAnnotations {
+		annotations[key] = value
+	}
+	return annotations, nil
+}
+
+// Decryption decrypts the checkpoint image layers encrypted by Encryption, with the private key of one of
+// its recipients.
+type Decryption struct {
+	decryptConfig *encconfig.DecryptConfig
+}
+
+// NewDecryption creates a Decryption with the private keys in PEM format, which must not be protected by a
+// passphrase.
+func NewDecryption(privateKeys [][]byte) (*Decryption, error) {
+	if len(privateKeys) == 0 {
+		return nil, fmt.Errorf("no decryption keys")
+	}
+	cryptoConfig, err := encconfig.DecryptWithPrivKeys(privateKeys, make([][]byte, len(privateKeys)))
+	if err != nil {
+		return nil, err
+	}
+	return &Decryption{decryptConfig: cryptoConfig.DecryptConfig}, nil
+}
+
+// decryptLayer returns the compressed content of the encrypted layer described by desc.
+func (d *Decryption) decryptLayer(content io.Reader, desc imgspecv1.Descriptor) (io.Reader, error) {
+	reader, _, err := ocicrypt.DecryptLayer(d.decryptConfig, content, desc, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt layer %s: %w", desc.Digest, err)
+	}
+	return reader, nil
+}
+
+// KeyID returns the identifier of a public key, sha256:<hex> of its PKIX encoding. It identifies the key
+// pair without revealing anything about it, so it can be recorded in the cluster.
+func KeyID(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return digest.SHA256.String() + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// PrivateKeyID returns the KeyID of the public key of the private key in PEM format.
+func PrivateKeyID(privateKey []byte) (string, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return "", fmt.Errorf("private key is not in PEM format")
+	}
+
+	var key any
+	var err error
+	if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+				return "", fmt.Errorf("failed to parse private key: %w", err)
+			}
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", fmt.Errorf("unsupported private key type %T", key)
+	}
+	return KeyID(signer.Public())
+}
+
+func parsePublicKey(content []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("public key is not in PEM format")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func parseCertificate(content []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("certificate is not in PEM format")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,278 @@
+package imagebuilder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// generateRSAKey generates a RSA key, returning it with its private key in PKCS#1 PEM format.
+func generateRSAKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// writePublicKey writes the public key in PEM format, returning its path.
+func writePublicKey(t *testing.T, publicKey crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	key, privateKey := generateRSAKey(t)
+	encryption, err := NewEncryption([]string{EncryptionSchemeJWE + ":" + writePublicKey(t, key.Public())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryption, err := NewDecryption([][]byte{privateKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("checkpoint layer")
+	desc := imgspecv1.Descriptor{
+		MediaType:   imgspecv1.MediaTypeImageLayerGzip,
+		Digest:      digest.FromBytes(content),
+		Size:        int64(len(content)),
+		Annotations: map[string]string{LayerFileAnnotation: "checkpoint/pages-1.img"},
+	}
+	var encrypted bytes.Buffer
+	annotations, err := encryption.encryptLayer(&encrypted, bytes.NewReader(content), desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(encrypted.Bytes(), content) {
+		t.Errorf("encrypted layer holds its content in clear")
+	}
+	if annotations[LayerFileAnnotation] != "checkpoint/pages-1.img" {
+		t.Errorf("encrypted layer annotations %v do not keep the layer annotations", annotations)
+	}
+
+	decrypted, err := decryption.decryptLayer(&encrypted, imgspecv1.Descriptor{
+		MediaType:   desc.MediaType + encryptedMediaTypeSuffix,
+		Digest:      digest.FromBytes(encrypted.Bytes()),
+		Size:        int64(encrypted.Len()),
+		Annotations: annotations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("decrypted layer is %q, want %q", got, content)
+	}
+
+	_, otherKey := generateRSAKey(t)
+	otherDecryption, err := NewDecryption([][]byte{otherKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := otherDecryption.decryptLayer(bytes.NewReader(encrypted.Bytes()), imgspecv1.Descriptor{
+		MediaType:   desc.MediaType + encryptedMediaTypeSuffix,
+		Annotations: annotations,
+	}); err == nil {
+		t.Errorf("layer decrypted with the key of another recipient")
+	}
+}
+
+func TestNewEncryptionInvalidRecipients(t *testing.T) {
+	key, _ := generateRSAKey(t)
+	publicKeyPath := writePublicKey(t, key.Public())
+
+	tests := []struct {
+		name       string
+		recipients []string
+	}{
+		{name: "no recipients"},
+		{name: "no scheme", recipients: []string{publicKeyPath}},
+		{name: "unknown scheme", recipients: []string{"gpg:" + publicKeyPath}},
+		{name: "missing file", recipients: []string{EncryptionSchemeJWE + ":" + publicKeyPath + ".missing"}},
+		{name: "certificate is a public key", recipients: []string{EncryptionSchemePKCS7 + ":" + publicKeyPath}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEncryption(tt.recipients); err == nil {
+				t.Errorf("NewEncryption(%v) succeeded", tt.recipients)
+			}
+		})
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	key, _ := generateRSAKey(t)
+	keyID, err := KeyID(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(keyID, "sha256:") || digest.Digest(keyID).Validate() != nil {
+		t.Errorf("key ID %q is not a sha256 digest", keyID)
+	}
+	if again, _ := KeyID(key.Public()); again != keyID {
+		t.Errorf("key ID of the same key is %q, then %q", keyID, again)
+	}
+
+	otherKey, _ := generateRSAKey(t)
+	if otherKeyID, _ := KeyID(otherKey.Public()); otherKeyID == keyID {
+		t.Errorf("two keys have the key ID %q", keyID)
+	}
+
+	encryption, err := NewEncryption([]string{EncryptionSchemeJWE + ":" + writePublicKey(t, key.Public())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encryption.KeyIDs) != 1 || encryption.KeyIDs[0] != keyID {
+		t.Errorf("encryption key IDs are %v, want [%s]", encryption.KeyIDs, keyID)
+	}
+}
+
+func TestPrivateKeyID(t *testing.T) {
+	rsaKey, pkcs1 := generateRSAKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if der, err = x509.MarshalECPrivateKey(ecKey); err != nil {
+		t.Fatal(err)
+	}
+	ec := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	tests := []struct {
+		name       string
+		privateKey []byte
+		publicKey  crypto.PublicKey
+		wantErr    bool
+	}{
+		{name: "PKCS#1", privateKey: pkcs1, publicKey: rsaKey.Public()},
+		{name: "PKCS#8", privateKey: pkcs8, publicKey: rsaKey.Public()},
+		{name: "EC", privateKey: ec, publicKey: ecKey.Public()},
+		{name: "not PEM", privateKey: []byte("private key"), wantErr: true},
+		{name: "not a key", privateKey: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}),
+			wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PrivateKeyID(tt.privateKey)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("PrivateKeyID() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := KeyID(tt.publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("PrivateKeyID() = %q, want the key ID of its public key %q", got, want)
+			}
+		})
+	}
+}
+
+func TestOCIImageBuilderEncryptsIdenticalLayers(t *testing.T) {
+	key, privateKey := generateRSAKey(t)
+	encryption, err := NewEncryption([]string{EncryptionSchemeJWE + ":" + writePublicKey(t, key.Public())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryption, err := NewDecryption([][]byte{privateKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layoutDirectory := t.TempDir()
+	builder, err := NewOCIImageBuilder(ImageFormatOCI, layoutDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The memory pages are written twice in the archive, so both of their layers share the same blob.
+	entries := testArchiveEntries()
+	entries = append(entries, entries[2])
+	err = builder.BuildFromCheckpoint(
+		writeTestArchive(t, entries), CheckpointMetadata{}, BuildOptions{Encryption: encryption}, "checkpoint",
+		context.Background(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layoutPath := filepath.Join(layoutDirectory, "checkpoint")
+	var index imgspecv1.Index
+	content, err := os.ReadFile(filepath.Join(layoutPath, imgspecv1.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, &index); err != nil {
+		t.Fatal(err)
+	}
+	var manifest imgspecv1.Manifest
+	readJSONBlob(t, layoutPath, index.Manifests[0], &manifest)
+	if len(manifest.Layers) != 3 {
+		t.Fatalf("manifest has %d layers, want 3", len(manifest.Layers))
+	}
+	for i, layer := range manifest.Layers[:2] {
+		if !strings.HasSuffix(layer.MediaType, encryptedMediaTypeSuffix) {
+			t.Errorf("layer %d has media type %s", i, layer.MediaType)
+		}
+		decrypted, err := decryption.decryptLayer(bytes.NewReader(readBlob(t, layoutPath, layer)), layer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uncompressed, err := gzip.NewReader(decrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := readTarEntries(t, uncompressed)
+		if !bytes.Equal(got["checkpoint/pages-1.img"], entries[2].content) {
+			t.Errorf("layer %d does not hold the memory pages", i)
+		}
+	}
+
+	// Only the encrypted blobs, the config and the manifest are left in the layout.
+	blobs, err := os.ReadDir(filepath.Join(layoutPath, "blobs", digest.SHA256.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != len(manifest.Layers)+2 {
+		t.Errorf("layout has %d blobs, want %d", len(blobs), len(manifest.Layers)+2)
+	}
+}
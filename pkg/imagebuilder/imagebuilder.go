@@ -2,6 +2,14 @@ package imagebuilder
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type RegistryBasicAuth struct {
@@ -13,9 +21,186 @@ type RegistryAuth struct {
 	Basic    *RegistryBasicAuth
 	AuthFile *string
 	URL      string
+	// CertsDirectory is a directory with the TLS certificates of the registry, following the layout of
+	// /etc/containers/certs.d: *.crt files are CA certificates, *.cert and *.key files are client key pairs.
+	CertsDirectory string
+	// Insecure disables the TLS verification of the registry and allows plain HTTP.
+	Insecure bool
+}
+
+// NewRegistryAuth creates the RegistryAuth for the registry at url. Basic authentication is used when both
+// username and password are given, otherwise the auth file is used.
+func NewRegistryAuth(url, username, password, authFile string) RegistryAuth {
+	registryAuth := RegistryAuth{
+		URL: url,
+	}
+	if username != "" && password != "" {
+		registryAuth.Basic = &RegistryBasicAuth{
+			Username: username,
+			Password: password,
+		}
+	} else {
+		registryAuth.AuthFile = &authFile
+	}
+	return registryAuth
+}
+
+// systemContext returns the system context to access the registry with the configured credentials.
+func (a RegistryAuth) systemContext() *types.SystemContext {
+	systemContext := types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.NewOptionalBool(a.Insecure),
+		DockerCertPath:              a.CertsDirectory,
+	}
+	if a.Basic != nil {
+		systemContext.DockerAuthConfig = &types.DockerAuthConfig{
+			Username: a.Basic.Username,
+			Password: a.Basic.Password,
+		}
+	} else if a.AuthFile != nil {
+		systemContext.AuthFilePath = *a.AuthFile
+	}
+	return &systemContext
+}
+
+// tlsConfig returns the TLS configuration to access the registry.
+func (a RegistryAuth) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: a.Insecure, // nolint:gosec
+	}
+	if a.CertsDirectory != "" {
+		if err := tlsclientconfig.SetupCertificates(a.CertsDirectory, config); err != nil {
+			return nil, fmt.Errorf("failed to load registry certificates from %s: %w", a.CertsDirectory, err)
+		}
+	}
+	return config, nil
+}
+
+// ImageFormat is the format of the checkpoint images, which defines the annotations set in the image.
+type ImageFormat string
+
+const (
+	// ImageFormatCRIO only sets the annotation CRI-O requires to restore the checkpoint image.
+	ImageFormatCRIO ImageFormat = "cri-o"
+	// ImageFormatOCI follows the checkpoint image specification, setting the full set of checkpoint
+	// annotations, so the image can be restored by CRI-O and by containerd.
+	ImageFormatOCI ImageFormat = "oci"
+)
+
+// ParseImageFormat parses the name of an image format.
+func ParseImageFormat(format string) (ImageFormat, error) {
+	switch ImageFormat(format) {
+	case ImageFormatCRIO, ImageFormatOCI:
+		return ImageFormat(format), nil
+	default:
+		return "", fmt.Errorf("unknown image format %q, must be one of %s, %s", format, ImageFormatCRIO, ImageFormatOCI)
+	}
+}
+
+// CheckpointMetadata describes the checkpointed container. It is stored in the checkpoint image annotations
+// so the container runtime is able to restore it. Empty fields are not added to the image.
+type CheckpointMetadata struct {
+	// ContainerName is the name of the checkpointed container.
+	ContainerName string
+	// PodName is the name of the pod of the checkpointed container.
+	PodName string
+	// PodNamespace is the namespace of the pod of the checkpointed container.
+	PodNamespace string
+	// RuntimeName is the OCI runtime that ran the container, e.g. runc or crun.
+	RuntimeName string
+	// RootfsImageName is the name of the image the container was created from.
+	RootfsImageName string
+	// RootfsImageRef is the reference of the image the container was created from, usually its digest.
+	RootfsImageRef string
+	// Engine is the container engine that created the checkpoint, e.g. cri-o.
+	Engine string
+	// EngineVersion is the version of the container engine that created the checkpoint, as reported by the
+	// node where the container was checkpointed.
+	EngineVersion string
+	// CriuVersion is the version of CRIU used to checkpoint the container, read from the dump log of the
+	// checkpoint archive.
+	CriuVersion string
+	// KernelVersion is the kernel version of the node where the container was checkpointed, as reported by
+	// the node. The image may be built in another node, so it is not the kernel of the image builder.
+	KernelVersion string
+	// ParentImage is the name, in the registry, of the image of the previous checkpoint of the container.
+	// The image builders reusing parent layers, see ReusesParentLayers, reuse its layers for the files that
+	// did not change.
+	ParentImage string
+}
+
+// Names of the image builder implementations.
+const (
+	// ImageBuilderBuildah builds the images with buildah in a containers/storage store, it requires root.
+	ImageBuilderBuildah = "buildah"
+	// ImageBuilderOCI writes the images as OCI layouts in pure Go and can run unprivileged.
+	ImageBuilderOCI = "oci"
+	// ImageBuilderStream streams the images straight to the registry without storing them on disk.
+	ImageBuilderStream = "stream"
+)
+
+// ReusesParentLayers reports whether the images built by builder reuse the layers of the parent image of an
+// incremental checkpoint for the files that did not change. The buildah builder stores the archive as a single
+// layer, which changes with every checkpoint, so its images are always full checkpoints.
+func ReusesParentLayers(builder ImageBuilder) bool {
+	switch builder.(type) {
+	case OCIImageBuilder, *StreamingImageBuilder:
+		return true
+	default:
+		return false
+	}
+}
+
+// BuildOptions are the options of a checkpoint image build.
+type BuildOptions struct {
+	// Compression is the compression of the image layers.
+	Compression Compression
+	// Encryption encrypts the image layers when set.
+	Encryption *Encryption
+}
+
+// validate checks the options can be combined.
+func (o BuildOptions) validate() error {
+	// The zstd:chunked metadata points into the compressed layer, which is meaningless once encrypted.
+	if o.Encryption != nil && o.Compression.algorithm() == CompressionZstdChunked {
+		return fmt.Errorf("encrypted layers can not be compressed with %s", CompressionZstdChunked)
+	}
+	return nil
+}
+
+// PushedImage describes a checkpoint image pushed to the registry.
+type PushedImage struct {
+	// Digest is the digest of the image manifest in the registry. Unlike the tag the image was pushed
+	// with, it always refers to the same image.
+	Digest digest.Digest
+	// Size is the size of the image layers stored in the registry, after compression.
+	Size int64
+}
+
+// pushedImage describes the image with the given manifest and manifest digest.
+func pushedImage(manifest imgspecv1.Manifest, manifestDigest digest.Digest) PushedImage {
+	image := PushedImage{Digest: manifestDigest}
+	for _, layer := range manifest.Layers {
+		image.Size += layer.Size
+	}
+	return image
+}
+
+// pushedImageFromManifest describes the image with the given OCI or Docker schema 2 manifest, which share
+// the layers format.
+func pushedImageFromManifest(content []byte) (PushedImage, error) {
+	var manifest imgspecv1.Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return PushedImage{}, fmt.Errorf("failed to decode image manifest: %w", err)
+	}
+	return pushedImage(manifest, digest.FromBytes(content)), nil
 }
 
 type ImageBuilder interface {
-	BuildFromCheckpoint(checkpointLocation, containerName, imageName string, ctx context.Context) error
-	PushToNodeRuntime(ctx context.Context, localImageName string, runtimeImageName string) error
+	BuildFromCheckpoint(
+		checkpointLocation string, metadata CheckpointMetadata, options BuildOptions, imageName string, ctx context.Context,
+	) error
+	PushToNodeRuntime(
+		ctx context.Context, localImageName string, runtimeImageName string, registryAuth RegistryAuth,
+	) (PushedImage, error)
 }
@@ -0,0 +1,152 @@
+package imagebuilder
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// LayerFileAnnotation is the path, in the checkpoint archive, of the file stored in a single file layer.
+	LayerFileAnnotation = "io.kcr.checkpoint.layer.file"
+	// LayerFileDigestAnnotation is the digest of the content of the file stored in a single file layer.
+	LayerFileDigestAnnotation = "io.kcr.checkpoint.layer.file.digest"
+)
+
+// fileLayerThreshold is the size from which a file of the checkpoint archive is stored in its own layer.
+const fileLayerThreshold = 1024 * 1024
+
+// checkpointLayer is a layer of a checkpoint image with the digest of its uncompressed content.
+type checkpointLayer struct {
+	descriptor imgspecv1.Descriptor
+	diffID     digest.Digest
+}
+
+// splitArchive splits the tar stream of the checkpoint archive in layers. Every file of at least
+// fileLayerThreshold bytes, like the memory pages and the root file system diff, is passed to fileLayer
+// with its content so it can be stored in its own layer. The remaining entries are returned as a single
+// tar stream.
+//
+// The entries are stripped of their timestamps, so a file that did not change between two checkpoints
+// produces the same layer and is deduplicated by the registry.
+func splitArchive(content io.Reader, fileLayer func(header *tar.Header, content io.Reader) error) ([]byte, error) {
+	reader := tar.NewReader(content)
+	var rest bytes.Buffer
+	restWriter := tar.NewWriter(&rest)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		header = normalizeHeader(header)
+		if header.Typeflag == tar.TypeReg && header.Size >= fileLayerThreshold {
+			if err := fileLayer(header, reader); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := restWriter.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(restWriter, reader); err != nil {
+			return nil, err
+		}
+	}
+	if err := restWriter.Close(); err != nil {
+		return nil, err
+	}
+	return rest.Bytes(), nil
+}
+
+// normalizeHeader returns a copy of the header without timestamps.
+func normalizeHeader(header *tar.Header) *tar.Header {
+	normalized := *header
+	normalized.ModTime = time.Unix(0, 0)
+	normalized.AccessTime = time.Time{}
+	normalized.ChangeTime = time.Time{}
+	if header.PAXRecords != nil {
+		normalized.PAXRecords = maps.Clone(header.PAXRecords)
+		for _, record := range []string{"mtime", "atime", "ctime"} {
+			delete(normalized.PAXRecords, record)
+		}
+	}
+	normalized.Format = tar.FormatUnknown
+	return &normalized
+}
+
+// fileLayerContent returns the tar stream of a layer holding a single file. The digester receives the file
+// content while the stream is read.
+func fileLayerContent(header *tar.Header, content io.Reader, digester digest.Digester) (io.Reader, error) {
+	var headerBlock bytes.Buffer
+	tarWriter := tar.NewWriter(&headerBlock)
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	// The content is padded to the tar block size and followed by the two empty blocks ending the archive.
+	const blockSize = 512
+	padding := (blockSize - header.Size%blockSize) % blockSize
+	trailer := make([]byte, padding+2*blockSize)
+
+	return io.MultiReader(
+		&headerBlock,
+		io.TeeReader(io.LimitReader(content, header.Size), digester.Hash()),
+		bytes.NewReader(trailer),
+	), nil
+}
+
+// addFileLayerAnnotations adds the annotations of a single file layer to its descriptor.
+func addFileLayerAnnotations(descriptor *imgspecv1.Descriptor, header *tar.Header, fileDigest digest.Digest) {
+	if descriptor.Annotations == nil {
+		descriptor.Annotations = map[string]string{}
+	}
+	descriptor.Annotations[LayerFileAnnotation] = header.Name
+	descriptor.Annotations[LayerFileDigestAnnotation] = fileDigest.String()
+}
+
+// compressLayer writes the layer content compressed with c into w, returning the digest of the uncompressed
+// content and the annotations of the layer descriptor required by the compression.
+func compressLayer(w io.Writer, content io.Reader, c Compression) (digest.Digest, map[string]string, error) {
+	annotations := map[string]string{}
+	compressor, err := c.compressor(w, annotations)
+	if err != nil {
+		return "", nil, err
+	}
+	diffIDDigester := digest.SHA256.Digester()
+	if _, err := io.Copy(io.MultiWriter(compressor, diffIDDigester.Hash()), content); err != nil {
+		_ = compressor.Close()
+		return "", nil, err
+	}
+	if err := compressor.Close(); err != nil {
+		return "", nil, err
+	}
+	return diffIDDigester.Digest(), annotations, nil
+}
+
+// layerDiffIDs returns the digests of the uncompressed content of the layers.
+func layerDiffIDs(layers []checkpointLayer) []digest.Digest {
+	diffIDs := make([]digest.Digest, 0, len(layers))
+	for _, layer := range layers {
+		diffIDs = append(diffIDs, layer.diffID)
+	}
+	return diffIDs
+}
+
+// layerDescriptors returns the descriptors of the layers.
+func layerDescriptors(layers []checkpointLayer) []imgspecv1.Descriptor {
+	descriptors := make([]imgspecv1.Descriptor, 0, len(layers))
+	for _, layer := range layers {
+		descriptors = append(descriptors, layer.descriptor)
+	}
+	return descriptors
+}
@@ -0,0 +1,153 @@
+package imagebuilder
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// archiveWithTimes returns the tar stream of the entries, stamped with the given time in the PAX format.
+func archiveWithTimes(t *testing.T, entries []testArchiveEntry, stamp time.Time) io.Reader {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Typeflag:   tar.TypeReg,
+			Name:       entry.name,
+			Mode:       0o600,
+			Size:       int64(len(entry.content)),
+			ModTime:    stamp,
+			AccessTime: stamp,
+			ChangeTime: stamp,
+			Format:     tar.FormatPAX,
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(entry.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &archive
+}
+
+// splitTestArchive splits the archive, returning the digests of the single file layers by file, the
+// annotations of their descriptors and the remaining tar stream.
+func splitTestArchive(
+	t *testing.T, content io.Reader,
+) (map[string]digest.Digest, map[string]map[string]string, []byte) {
+	t.Helper()
+	layers := map[string]digest.Digest{}
+	annotations := map[string]map[string]string{}
+	rest, err := splitArchive(content, func(header *tar.Header, content io.Reader) error {
+		fileDigester := digest.SHA256.Digester()
+		layerContent, err := fileLayerContent(header, content, fileDigester)
+		if err != nil {
+			return err
+		}
+		layerDigest, err := digest.SHA256.FromReader(layerContent)
+		if err != nil {
+			return err
+		}
+		var descriptor imgspecv1.Descriptor
+		addFileLayerAnnotations(&descriptor, header, fileDigester.Digest())
+		layers[header.Name] = layerDigest
+		annotations[header.Name] = descriptor.Annotations
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layers, annotations, rest
+}
+
+func TestSplitArchive(t *testing.T) {
+	entries := testArchiveEntries()
+	layers, annotations, rest := splitTestArchive(t, archiveWithTimes(t, entries, time.Now()))
+
+	if len(layers) != 1 {
+		t.Fatalf("archive was split in %d single file layers, want 1", len(layers))
+	}
+	pages := entries[2]
+	want := map[string]string{
+		LayerFileAnnotation:       pages.name,
+		LayerFileDigestAnnotation: digest.FromBytes(pages.content).String(),
+	}
+	if got := annotations[pages.name]; len(got) != len(want) ||
+		got[LayerFileAnnotation] != want[LayerFileAnnotation] ||
+		got[LayerFileDigestAnnotation] != want[LayerFileDigestAnnotation] {
+		t.Errorf("memory pages layer has annotations %v, want %v", got, want)
+	}
+
+	restEntries := readTarEntries(t, bytes.NewReader(rest))
+	if len(restEntries) != len(entries)-1 {
+		t.Errorf("remaining layer has %d entries, want %d", len(restEntries), len(entries)-1)
+	}
+	for _, entry := range entries {
+		if entry.name == pages.name {
+			continue
+		}
+		if !bytes.Equal(restEntries[entry.name], entry.content) {
+			t.Errorf("remaining layer has %q for %s", restEntries[entry.name], entry.name)
+		}
+	}
+}
+
+func TestSplitArchiveIsDeterministic(t *testing.T) {
+	entries := testArchiveEntries()
+	firstLayers, _, firstRest := splitTestArchive(t, archiveWithTimes(t, entries, time.Now()))
+	secondLayers, _, secondRest := splitTestArchive(t, archiveWithTimes(t, entries, time.Now().Add(time.Hour)))
+
+	// The same files checkpointed at another time produce the same layers.
+	for name, layerDigest := range firstLayers {
+		if secondLayers[name] != layerDigest {
+			t.Errorf("layer of %s is %s, then %s", name, layerDigest, secondLayers[name])
+		}
+	}
+	if !bytes.Equal(firstRest, secondRest) {
+		t.Error("remaining layer changed with the timestamps of the entries")
+	}
+
+	// A changed file only changes its own layer.
+	entries[0].content = []byte(`{"id":"4567"}`)
+	changedLayers, _, changedRest := splitTestArchive(t, archiveWithTimes(t, entries, time.Now()))
+	if changedLayers[entries[2].name] != firstLayers[entries[2].name] {
+		t.Error("memory pages layer changed with another file")
+	}
+	if bytes.Equal(changedRest, firstRest) {
+		t.Error("remaining layer did not change with its file")
+	}
+}
+
+func TestNormalizeHeader(t *testing.T) {
+	stamp := time.Now()
+	header := &tar.Header{
+		Name:       "checkpoint/pages-1.img",
+		ModTime:    stamp,
+		AccessTime: stamp,
+		ChangeTime: stamp,
+		PAXRecords: map[string]string{"mtime": "1", "atime": "1", "ctime": "1", "SCHILY.xattr.user.kcr": "1"},
+		Format:     tar.FormatPAX,
+	}
+	normalized := normalizeHeader(header)
+
+	if !normalized.ModTime.Equal(time.Unix(0, 0)) || !normalized.AccessTime.IsZero() || !normalized.ChangeTime.IsZero() {
+		t.Errorf("normalized header has times %v, %v and %v",
+			normalized.ModTime, normalized.AccessTime, normalized.ChangeTime)
+	}
+	if len(normalized.PAXRecords) != 1 || normalized.PAXRecords["SCHILY.xattr.user.kcr"] != "1" {
+		t.Errorf("normalized header has PAX records %v", normalized.PAXRecords)
+	}
+	if len(header.PAXRecords) != 4 || !header.ModTime.Equal(stamp) {
+		t.Error("original header was modified")
+	}
+}
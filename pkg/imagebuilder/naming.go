@@ -0,0 +1,90 @@
+package imagebuilder
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// Default templates of the checkpoint image names.
+const (
+	DefaultRepositoryTemplate = "checkpoint-{{ .Checkpoint }}"
+	DefaultTagTemplate        = "latest"
+)
+
+// ImageNameData are the values the templates of the checkpoint image names receive.
+type ImageNameData struct {
+	// Namespace is the namespace of the Checkpoint.
+	Namespace string
+	// Pod is the name of the checkpointed pod.
+	Pod string
+	// Container is the name of the checkpointed container.
+	Container string
+	// Checkpoint is the name of the Checkpoint.
+	Checkpoint string
+	// Schedule is the name of the CheckpointSchedule that created the checkpoint, empty when it was
+	// requested directly.
+	Schedule string
+	// Node is the name of the node where the container was checkpointed.
+	Node string
+	// Timestamp is the time the container was checkpointed.
+	Timestamp time.Time
+}
+
+// ImageName renders the name of a checkpoint image, in the form repository:tag, from the templates of its
+// repository and tag. Empty templates fall back to the defaults.
+func ImageName(repositoryTemplate, tagTemplate string, data ImageNameData) (string, error) {
+	if repositoryTemplate == "" {
+		repositoryTemplate = DefaultRepositoryTemplate
+	}
+	if tagTemplate == "" {
+		tagTemplate = DefaultTagTemplate
+	}
+
+	repository, err := renderTemplate("repository", repositoryTemplate, data)
+	if err != nil {
+		return "", err
+	}
+	tag, err := renderTemplate("tag", tagTemplate, data)
+	if err != nil {
+		return "", err
+	}
+
+	imageName := strings.ToLower(strings.Trim(repository, "/")) + ":" + tag
+	// The repository is relative to the registry, a placeholder domain is enough to validate it.
+	named, err := reference.ParseNormalizedNamed("registry.invalid/" + imageName)
+	if err != nil {
+		return "", fmt.Errorf("invalid checkpoint image name %q: %w", imageName, err)
+	}
+	if _, ok := named.(reference.NamedTagged); !ok {
+		return "", fmt.Errorf("invalid checkpoint image name %q: missing tag", imageName)
+	}
+	return imageName, nil
+}
+
+// DigestReference returns the reference by digest, in the form repository@digest, of the image named
+// imageName, in the form repository[:tag] or repository@digest.
+func DigestReference(imageName string, imageDigest digest.Digest) string {
+	repository, _, _ := strings.Cut(imageName, "@")
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+	return repository + "@" + imageDigest.String()
+}
+
+func renderTemplate(name, text string, data ImageNameData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return strings.TrimSpace(rendered.String()), nil
+}
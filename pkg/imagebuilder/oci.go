@@ -0,0 +1,358 @@
+package imagebuilder
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/archive"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// OCIImageBuilder builds the checkpoint images as OCI image layouts on disk without a container storage,
+// so it does not require root or user namespaces. The checkpoint archive is split in layers, one for every
+// large file and one for the remaining entries, so unchanged files are deduplicated by the registry.
+type OCIImageBuilder struct {
+	imageFormat     ImageFormat
+	layoutDirectory string
+}
+
+// NewOCIImageBuilder creates an OCIImageBuilder writing the image layouts into layoutDirectory.
+func NewOCIImageBuilder(imageFormat ImageFormat, layoutDirectory string) (ImageBuilder, error) {
+	if err := os.MkdirAll(layoutDirectory, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create OCI layout directory %s: %w", layoutDirectory, err)
+	}
+	return OCIImageBuilder{
+		imageFormat:     imageFormat,
+		layoutDirectory: layoutDirectory,
+	}, nil
+}
+
+func (b OCIImageBuilder) BuildFromCheckpoint(
+	checkpointLocation string, metadata CheckpointMetadata, options BuildOptions, imageName string, ctx context.Context,
+) error {
+	log := log.FromContext(ctx)
+
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	// Every image is written to its own layout, so concurrent builds never update the same index.
+	layoutPath := b.layoutPath(imageName)
+	if err := os.RemoveAll(layoutPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(layoutPath, "blobs", digest.SHA256.String()), 0o700); err != nil {
+		return err
+	}
+
+	layers, err := writeLayers(layoutPath, checkpointLocation, options)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint layers: %w", err)
+	}
+	log.Info("Successfully added the checkpoint file to the OCI layout",
+		"layers", len(layers), "compression", options.Compression.String(), "encrypted", options.Encryption != nil)
+
+	configDescriptor, err := writeJSONBlob(
+		layoutPath, imgspecv1.MediaTypeImageConfig, newImageConfig(layerDiffIDs(layers)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write image config: %w", err)
+	}
+
+	manifest := newImageManifest(
+		configDescriptor, layerDescriptors(layers), checkpointAnnotations(b.imageFormat, metadata),
+	)
+	manifestDescriptor, err := writeJSONBlob(layoutPath, imgspecv1.MediaTypeImageManifest, manifest)
+	if err != nil {
+		return fmt.Errorf("failed to write image manifest: %w", err)
+	}
+	manifestDescriptor.Annotations = map[string]string{imgspecv1.AnnotationRefName: imageName}
+
+	index := imgspecv1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Manifests: []imgspecv1.Descriptor{manifestDescriptor},
+	}
+	if err := writeJSONFile(filepath.Join(layoutPath, imgspecv1.ImageIndexFile), index); err != nil {
+		return fmt.Errorf("failed to write image index: %w", err)
+	}
+	return writeJSONFile(
+		filepath.Join(layoutPath, imgspecv1.ImageLayoutFile),
+		imgspecv1.ImageLayout{Version: imgspecv1.ImageLayoutVersion},
+	)
+}
+
+func (b OCIImageBuilder) PushToNodeRuntime(
+	ctx context.Context, localImageName string, runtimeImageName string, registryAuth RegistryAuth,
+) (PushedImage, error) {
+	logger := log.FromContext(ctx)
+
+	layoutPath := b.layoutPath(localImageName)
+	sourceReference, err := layout.NewReference(layoutPath, localImageName)
+	if err != nil {
+		return PushedImage{}, fmt.Errorf("local image %s not found for push: %w", localImageName, err)
+	}
+
+	destinationSpec := "docker://" + registryAuth.URL + "/" + runtimeImageName
+	destinationReference, err := alltransports.ParseImageName(destinationSpec)
+	if err != nil {
+		logger.Error(err, "Failed to parse destination spec", "destination", destinationSpec)
+		return PushedImage{}, fmt.Errorf("failed to parse destination spec %s: %w", destinationSpec, err)
+	}
+
+	// The image was just built by us, there are no signatures to verify.
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+	if err != nil {
+		return PushedImage{}, err
+	}
+	defer func() {
+		_ = policyContext.Destroy()
+	}()
+
+	progress, stopProgress := copyProgress(ctx)
+	manifest, err := copy.Image(ctx, policyContext, destinationReference, sourceReference, &copy.Options{
+		ReportWriter:     os.Stderr,
+		DestinationCtx:   registryAuth.systemContext(),
+		PreserveDigests:  true,
+		Progress:         progress,
+		ProgressInterval: time.Second,
+	})
+	stopProgress()
+	if err != nil {
+		logger.Error(err, "Failed to push image to node runtime", "imageName", localImageName, "destination", destinationSpec)
+		return PushedImage{}, fmt.Errorf("failed to push image %s to %s: %w", localImageName, destinationSpec, err)
+	}
+
+	logger.Info("Successfully pushed image to local runtime", "imageName", localImageName, "destination", destinationSpec)
+
+	// The image is in the registry now, there is no reason to keep another copy on disk.
+	if err := os.RemoveAll(layoutPath); err != nil {
+		logger.Error(err, "Failed to remove OCI layout", "path", layoutPath)
+	}
+
+	return pushedImageFromManifest(manifest)
+}
+
+func (b OCIImageBuilder) layoutPath(imageName string) string {
+	return filepath.Join(b.layoutDirectory, imageName)
+}
+
+// newImageConfig creates the configuration of a checkpoint image with the given layers.
+func newImageConfig(diffIDs []digest.Digest) imgspecv1.Image {
+	now := time.Now().UTC()
+	return imgspecv1.Image{
+		Created: &now,
+		Platform: imgspecv1.Platform{
+			OS:           runtime.GOOS,
+			Architecture: runtime.GOARCH,
+		},
+		RootFS: imgspecv1.RootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
+		},
+	}
+}
+
+// newImageManifest creates the manifest of a checkpoint image.
+func newImageManifest(config imgspecv1.Descriptor, layers []imgspecv1.Descriptor, annotations map[string]string) imgspecv1.Manifest {
+	return imgspecv1.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   imgspecv1.MediaTypeImageManifest,
+		Config:      config,
+		Layers:      layers,
+		Annotations: annotations,
+	}
+}
+
+// writeLayers writes the checkpoint archive as layer blobs built with options, returning the layers.
+func writeLayers(layoutPath, checkpointLocation string, options BuildOptions) ([]checkpointLayer, error) {
+	file, err := os.Open(checkpointLocation)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	content, err := archive.Decompress(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []checkpointLayer
+	rest, err := splitArchive(content, func(header *tar.Header, content io.Reader) error {
+		fileDigester := digest.SHA256.Digester()
+		layerContent, err := fileLayerContent(header, content, fileDigester)
+		if err != nil {
+			return err
+		}
+		layer, err := writeLayer(layoutPath, layerContent, options)
+		if err != nil {
+			return err
+		}
+		addFileLayerAnnotations(&layer.descriptor, header, fileDigester.Digest())
+		layers = append(layers, layer)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	layer, err := writeLayer(layoutPath, bytes.NewReader(rest), options)
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, layer)
+	if options.Encryption != nil {
+		return encryptLayers(layoutPath, layers, options.Encryption)
+	}
+	return layers, nil
+}
+
+// writeLayer writes the layer content as a blob compressed as set in options.
+func writeLayer(layoutPath string, content io.Reader, options BuildOptions) (checkpointLayer, error) {
+	c := options.Compression
+	var annotations map[string]string
+	descriptor, diffID, err := writeBlob(layoutPath, c.mediaType(), func(w io.Writer) (digest.Digest, error) {
+		var err error
+		var diffID digest.Digest
+		diffID, annotations, err = compressLayer(w, content, c)
+		return diffID, err
+	})
+	if err != nil {
+		return checkpointLayer{}, err
+	}
+	if len(annotations) > 0 {
+		descriptor.Annotations = annotations
+	}
+	return checkpointLayer{descriptor: descriptor, diffID: diffID}, nil
+}
+
+// encryptLayers replaces the layer blobs with their encrypted version. Identical layers share the same
+// plaintext blob, so the plaintext blobs are only removed once every layer is encrypted.
+func encryptLayers(layoutPath string, layers []checkpointLayer, encryption *Encryption) ([]checkpointLayer, error) {
+	plaintextBlobs := map[string]bool{}
+	defer func() {
+		for path := range plaintextBlobs {
+			_ = os.Remove(path)
+		}
+	}()
+
+	for i := range layers {
+		plaintextBlobs[blobPath(layoutPath, layers[i].descriptor.Digest)] = true
+		encrypted, err := encryptBlob(layoutPath, layers[i].descriptor, encryption)
+		if err != nil {
+			return nil, err
+		}
+		layers[i].descriptor = encrypted
+	}
+	return layers, nil
+}
+
+// encryptBlob writes the encrypted version of the layer blob described by descriptor.
+func encryptBlob(layoutPath string, descriptor imgspecv1.Descriptor, encryption *Encryption) (imgspecv1.Descriptor, error) {
+	blob, err := os.Open(blobPath(layoutPath, descriptor.Digest))
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	defer func() {
+		_ = blob.Close()
+	}()
+
+	var annotations map[string]string
+	encrypted, _, err := writeBlob(layoutPath, descriptor.MediaType+encryptedMediaTypeSuffix,
+		func(w io.Writer) (digest.Digest, error) {
+			var err error
+			annotations, err = encryption.encryptLayer(w, blob, descriptor)
+			return "", err
+		})
+	encrypted.Annotations = annotations
+	return encrypted, err
+}
+
+// blobPath returns the path of the blob with the given digest in the layout.
+func blobPath(layoutPath string, blobDigest digest.Digest) string {
+	return filepath.Join(layoutPath, "blobs", blobDigest.Algorithm().String(), blobDigest.Encoded())
+}
+
+// writeJSONBlob writes value as a JSON blob of the given media type.
+func writeJSONBlob(layoutPath, mediaType string, value any) (imgspecv1.Descriptor, error) {
+	descriptor, _, err := writeBlob(layoutPath, mediaType, func(w io.Writer) (digest.Digest, error) {
+		return "", json.NewEncoder(w).Encode(value)
+	})
+	return descriptor, err
+}
+
+// writeBlob writes the content produced by write into the layout blobs, named by its digest. The digest
+// returned by write is returned alongside the blob descriptor.
+func writeBlob(
+	layoutPath, mediaType string, write func(w io.Writer) (digest.Digest, error),
+) (imgspecv1.Descriptor, digest.Digest, error) {
+	blobsPath := filepath.Join(layoutPath, "blobs", digest.SHA256.String())
+	file, err := os.CreateTemp(blobsPath, ".tmp-")
+	if err != nil {
+		return imgspecv1.Descriptor{}, "", err
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	digester := digest.SHA256.Digester()
+	counter := &countingWriter{writer: io.MultiWriter(file, digester.Hash())}
+	result, err := write(counter)
+	if err != nil {
+		return imgspecv1.Descriptor{}, "", err
+	}
+	if err := file.Close(); err != nil {
+		return imgspecv1.Descriptor{}, "", err
+	}
+
+	blobDigest := digester.Digest()
+	if err := os.Rename(file.Name(), filepath.Join(blobsPath, blobDigest.Encoded())); err != nil {
+		return imgspecv1.Descriptor{}, "", err
+	}
+
+	return imgspecv1.Descriptor{
+		MediaType: mediaType,
+		Digest:    blobDigest,
+		Size:      counter.written,
+	}, result, nil
+}
+
+func writeJSONFile(path string, value any) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,270 @@
+package imagebuilder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testArchiveEntry is a regular file of a test checkpoint archive.
+type testArchiveEntry struct {
+	name    string
+	content []byte
+}
+
+// testArchiveEntries returns the entries of a checkpoint archive with a memory pages file large enough to be
+// stored in its own layer.
+func testArchiveEntries() []testArchiveEntry {
+	pages := make([]byte, 2*fileLayerThreshold)
+	_, _ = rand.New(rand.NewSource(1)).Read(pages)
+	return []testArchiveEntry{
+		{name: "config.dump", content: []byte(`{"id":"0123"}`)},
+		{name: "spec.dump", content: []byte(`{"ociVersion":"1.0.2"}`)},
+		{name: "checkpoint/pages-1.img", content: pages},
+		{name: "checkpoint/inventory.img", content: []byte("inventory")},
+	}
+}
+
+// writeTestArchive writes the entries as a tar checkpoint archive, returning its path.
+func writeTestArchive(t *testing.T, entries []testArchiveEntry) string {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     entry.name,
+			Mode:     0o600,
+			Size:     int64(len(entry.content)),
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(entry.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "checkpoint.tar")
+	if err := os.WriteFile(path, archive.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readTarEntries returns the content of the regular files of the tar stream by name.
+func readTarEntries(t *testing.T, content io.Reader) map[string][]byte {
+	t.Helper()
+	entries := map[string][]byte{}
+	reader := tar.NewReader(content)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[header.Name] = data
+	}
+}
+
+// readBlob reads the blob with the given digest from the layout, checking its content matches the digest.
+func readBlob(t *testing.T, layoutPath string, descriptor imgspecv1.Descriptor) []byte {
+	t.Helper()
+	content, err := os.ReadFile(
+		filepath.Join(layoutPath, "blobs", descriptor.Digest.Algorithm().String(), descriptor.Digest.Encoded()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := digest.FromBytes(content); got != descriptor.Digest {
+		t.Fatalf("blob %s has digest %s", descriptor.Digest, got)
+	}
+	if int64(len(content)) != descriptor.Size {
+		t.Fatalf("blob %s has %d bytes, its descriptor %d", descriptor.Digest, len(content), descriptor.Size)
+	}
+	return content
+}
+
+func readJSONBlob(t *testing.T, layoutPath string, descriptor imgspecv1.Descriptor, value any) {
+	t.Helper()
+	if err := json.Unmarshal(readBlob(t, layoutPath, descriptor), value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOCIImageBuilderLayout(t *testing.T) {
+	layoutDirectory := t.TempDir()
+	builder, err := NewOCIImageBuilder(ImageFormatOCI, layoutDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compression, err := ParseCompression("gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := testArchiveEntries()
+	metadata := CheckpointMetadata{ContainerName: "app", PodName: "web-0", PodNamespace: "default"}
+	err = builder.BuildFromCheckpoint(
+		writeTestArchive(t, entries), metadata, BuildOptions{Compression: compression}, "checkpoint-web-0",
+		context.Background(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layoutPath := filepath.Join(layoutDirectory, "checkpoint-web-0")
+	var layout imgspecv1.ImageLayout
+	content, err := os.ReadFile(filepath.Join(layoutPath, imgspecv1.ImageLayoutFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, &layout); err != nil {
+		t.Fatal(err)
+	}
+	if layout.Version != imgspecv1.ImageLayoutVersion {
+		t.Errorf("layout version is %q, want %q", layout.Version, imgspecv1.ImageLayoutVersion)
+	}
+
+	var index imgspecv1.Index
+	content, err = os.ReadFile(filepath.Join(layoutPath, imgspecv1.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 {
+		t.Fatalf("index has %d manifests, want 1", len(index.Manifests))
+	}
+	if got := index.Manifests[0].Annotations[imgspecv1.AnnotationRefName]; got != "checkpoint-web-0" {
+		t.Errorf("manifest is named %q, want %q", got, "checkpoint-web-0")
+	}
+
+	var manifest imgspecv1.Manifest
+	readJSONBlob(t, layoutPath, index.Manifests[0], &manifest)
+	if !reflect.DeepEqual(manifest.Annotations, checkpointAnnotations(ImageFormatOCI, metadata)) {
+		t.Errorf("manifest annotations are %v", manifest.Annotations)
+	}
+	var config imgspecv1.Image
+	readJSONBlob(t, layoutPath, manifest.Config, &config)
+
+	// The memory pages are in their own layer, the remaining entries in the last one.
+	if len(manifest.Layers) != 2 {
+		t.Fatalf("manifest has %d layers, want 2", len(manifest.Layers))
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		t.Fatalf("config has %d diff IDs for %d layers", len(config.RootFS.DiffIDs), len(manifest.Layers))
+	}
+	got := map[string][]byte{}
+	for i, layer := range manifest.Layers {
+		if layer.MediaType != imgspecv1.MediaTypeImageLayerGzip {
+			t.Errorf("layer %d has media type %s", i, layer.MediaType)
+		}
+		uncompressed, err := gzip.NewReader(bytes.NewReader(readBlob(t, layoutPath, layer)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(uncompressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diffID := digest.FromBytes(content); diffID != config.RootFS.DiffIDs[i] {
+			t.Errorf("layer %d has diff ID %s, config %s", i, diffID, config.RootFS.DiffIDs[i])
+		}
+		for name, data := range readTarEntries(t, bytes.NewReader(content)) {
+			got[name] = data
+		}
+	}
+
+	pagesLayer := manifest.Layers[0]
+	if name := pagesLayer.Annotations[LayerFileAnnotation]; name != "checkpoint/pages-1.img" {
+		t.Errorf("first layer stores %q, want the memory pages", name)
+	}
+	pagesDigest := digest.FromBytes(entries[2].content).String()
+	if fileDigest := pagesLayer.Annotations[LayerFileDigestAnnotation]; fileDigest != pagesDigest {
+		t.Errorf("first layer has file digest %s, want %s", fileDigest, pagesDigest)
+	}
+
+	want := map[string][]byte{}
+	for _, entry := range entries {
+		want[entry.name] = entry.content
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("layers do not hold the checkpoint archive entries")
+	}
+}
+
+func TestOCIImageBuilderPush(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layoutDirectory := t.TempDir()
+	builder, err := NewOCIImageBuilder(ImageFormatOCI, layoutDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	err = builder.BuildFromCheckpoint(
+		writeTestArchive(t, testArchiveEntries()), CheckpointMetadata{ContainerName: "app"}, BuildOptions{},
+		"checkpoint-web-0", ctx,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pushed, err := builder.PushToNodeRuntime(ctx, "checkpoint-web-0", "checkpoint-web-0:latest", RegistryAuth{
+		URL:      serverURL.Host,
+		Insecure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed.Size == 0 {
+		t.Error("pushed image has no layers")
+	}
+
+	response, err := http.Get(server.URL + "/v2/checkpoint-web-0/manifests/" + pushed.Digest.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("registry returned %s for the pushed manifest", response.Status)
+	}
+
+	if _, err := os.Stat(filepath.Join(layoutDirectory, "checkpoint-web-0")); !os.IsNotExist(err) {
+		t.Errorf("layout was not removed after the push: %v", err)
+	}
+}
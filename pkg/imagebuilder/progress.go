@@ -0,0 +1,51 @@
+package imagebuilder
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/types"
+)
+
+// PushProgress is called with the number of bytes of the image layers uploaded to the registry since its
+// previous call.
+type PushProgress func(pushed int64)
+
+type pushProgressKey struct{}
+
+// WithPushProgress returns a copy of ctx which reports the progress of the image pushes made with it to
+// progress. The builders which can not follow the upload of the layers, like buildah, do not report it.
+func WithPushProgress(ctx context.Context, progress PushProgress) context.Context {
+	return context.WithValue(ctx, pushProgressKey{}, progress)
+}
+
+// ReportPushProgress reports the bytes uploaded by a push to the PushProgress of ctx, when it has one.
+func ReportPushProgress(ctx context.Context, pushed int64) {
+	if progress, ok := ctx.Value(pushProgressKey{}).(PushProgress); ok && pushed > 0 {
+		progress(pushed)
+	}
+}
+
+// copyProgress follows the copy of an image by containers/image and reports the uploaded bytes to the
+// PushProgress of ctx. The channel is the Progress of the copy options, it is nil when ctx has no
+// PushProgress. The returned function must be called once the copy returned.
+func copyProgress(ctx context.Context) (chan types.ProgressProperties, func()) {
+	if _, ok := ctx.Value(pushProgressKey{}).(PushProgress); !ok {
+		return nil, func() {}
+	}
+	progress := make(chan types.ProgressProperties)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The copy blocks until its events are received, the channel is drained until it is closed.
+		for properties := range progress {
+			switch properties.Event {
+			case types.ProgressEventRead, types.ProgressEventDone:
+				ReportPushProgress(ctx, int64(properties.OffsetUpdate))
+			}
+		}
+	}()
+	return progress, func() {
+		close(progress)
+		<-done
+	}
+}
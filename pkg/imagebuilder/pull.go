@@ -0,0 +1,135 @@
+package imagebuilder
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PullCheckpointArchive writes the checkpoint archive stored in a checkpoint image to w, as an uncompressed
+// tar file. The image named imageName, relative to the registry, is pulled by imageDigest when it is not
+// empty. Encrypted layers are decrypted with decryption, which may be nil for images that are not encrypted.
+func PullCheckpointArchive(
+	ctx context.Context,
+	registryAuth RegistryAuth,
+	imageName string,
+	imageDigest digest.Digest,
+	decryption *Decryption,
+	w io.Writer,
+) error {
+	imageReference, err := pullImageReference(registryAuth, imageName, imageDigest)
+	if err != nil {
+		return err
+	}
+	source, err := imageReference.NewImageSource(ctx, registryAuth.systemContext())
+	if err != nil {
+		return fmt.Errorf("failed to access checkpoint image %s: %w", imageName, err)
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	content, mimeType, err := source.GetManifest(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get manifest of checkpoint image %s: %w", imageName, err)
+	}
+	if imageDigest != "" {
+		matches, err := manifest.MatchesDigest(content, imageDigest)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			return fmt.Errorf("manifest of checkpoint image %s does not match digest %s", imageName, imageDigest)
+		}
+	}
+	imageManifest, err := manifest.FromBlob(content, manifest.NormalizedMIMEType(mimeType))
+	if err != nil {
+		return fmt.Errorf("invalid manifest of checkpoint image %s: %w", imageName, err)
+	}
+
+	// Every layer holds files of the archive, a file of a later layer replaces the one of an earlier layer
+	// when the archive is extracted.
+	writer := tar.NewWriter(w)
+	for _, layer := range imageManifest.LayerInfos() {
+		if err := copyLayer(ctx, source, layer.BlobInfo, decryption, writer); err != nil {
+			return fmt.Errorf("failed to read layer %s of checkpoint image %s: %w", layer.Digest, imageName, err)
+		}
+	}
+	return writer.Close()
+}
+
+// pullImageReference returns the reference of the image named imageName, by digest when it is not empty.
+func pullImageReference(registryAuth RegistryAuth, imageName string, imageDigest digest.Digest) (types.ImageReference, error) {
+	if imageDigest != "" {
+		return digestImageReference(registryAuth, imageName, imageDigest)
+	}
+	imageReference, err := docker.ParseReference("//" + registryAuth.URL + "/" + imageName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint image %s: %w", imageName, err)
+	}
+	return imageReference, nil
+}
+
+// copyLayer writes the entries of the layer to writer.
+func copyLayer(
+	ctx context.Context, source types.ImageSource, layer types.BlobInfo, decryption *Decryption, writer *tar.Writer,
+) error {
+	blob, _, err := source.GetBlob(ctx, layer, none.NoCache)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = blob.Close()
+	}()
+
+	var content io.Reader = blob
+	if strings.HasSuffix(layer.MediaType, encryptedMediaTypeSuffix) {
+		if decryption == nil {
+			return fmt.Errorf("layer is encrypted and no decryption key was given")
+		}
+		content, err = decryption.decryptLayer(blob, imgspecv1.Descriptor{
+			MediaType:   layer.MediaType,
+			Digest:      layer.Digest,
+			Size:        layer.Size,
+			Annotations: layer.Annotations,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	decompressed, _, err := compression.AutoDecompress(content)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = decompressed.Close()
+	}()
+
+	reader := tar.NewReader(decompressed)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(writer, reader); err != nil {
+			return err
+		}
+	}
+}
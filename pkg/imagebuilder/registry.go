@@ -0,0 +1,453 @@
+package imagebuilder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// maxChunkRetries is the number of times an upload chunk is resumed before giving up.
+const maxChunkRetries = 3
+
+// registryClient implements the parts of the OCI distribution API needed to push checkpoint images
+// straight from a stream, with chunked uploads that are resumed when a chunk fails.
+type registryClient struct {
+	httpClient *http.Client
+	baseURL    *url.URL
+	prefix     string
+	repository string
+	username   string
+	password   string
+	token      string
+	// pullRepositories are the other repositories the client reads from, e.g. to mount blobs of the parent
+	// image. They must be set before the first request so they are part of the token scope.
+	pullRepositories []string
+}
+
+// newRegistryClient creates a client to push the image named imageName, in the form name[:tag], to the
+// registry, returning the client and the image tag.
+func newRegistryClient(ctx context.Context, registryAuth RegistryAuth, imageName string) (*registryClient, string, error) {
+	host, prefix, _ := strings.Cut(registryAuth.URL, "/")
+
+	tlsConfig, err := registryAuth.tlsConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &registryClient{
+		httpClient: &http.Client{Transport: transport},
+		prefix:     prefix,
+	}
+	repository, tag := client.imageReference(imageName)
+	client.repository = repository
+
+	if registryAuth.Basic != nil {
+		client.username = registryAuth.Basic.Username
+		client.password = registryAuth.Basic.Password
+	} else if registryAuth.AuthFile != nil && *registryAuth.AuthFile != "" {
+		credentials, err := config.GetCredentials(&types.SystemContext{AuthFilePath: *registryAuth.AuthFile}, host)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read credentials for %s: %w", host, err)
+		}
+		client.username = credentials.Username
+		client.password = credentials.Password
+	}
+
+	// Registries used for development usually serve plain HTTP, fall back to it when HTTPS is not available
+	// and the registry is insecure.
+	schemes := []string{"https"}
+	if registryAuth.Insecure {
+		schemes = append(schemes, "http")
+	}
+	for _, scheme := range schemes {
+		client.baseURL = &url.URL{Scheme: scheme, Host: host}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, client.baseURL.JoinPath("v2/").String(), nil)
+		if err != nil {
+			return nil, "", err
+		}
+		// Any response, even an authentication challenge, means the registry speaks this scheme.
+		res, err := client.httpClient.Do(req)
+		if err != nil {
+			continue
+		}
+		closeBody(res)
+		return client, tag, nil
+	}
+	return nil, "", fmt.Errorf("registry %s is not reachable", host)
+}
+
+// uploadBlob uploads the content read from r in chunks of chunkSize bytes, computing its digest while
+// streaming. Only the current chunk is kept in memory.
+func (c *registryClient) uploadBlob(ctx context.Context, r io.Reader, chunkSize int) (digest.Digest, int64, error) {
+	location, err := c.startUpload(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	digester := digest.SHA256.Digester()
+	chunk := make([]byte, chunkSize)
+	var offset int64
+	for {
+		n, readErr := io.ReadFull(r, chunk)
+		if n > 0 {
+			_, _ = digester.Hash().Write(chunk[:n])
+			location, err = c.uploadChunk(ctx, location, chunk[:n], offset)
+			if err != nil {
+				return "", 0, err
+			}
+			offset += int64(n)
+			ReportPushProgress(ctx, int64(n))
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return "", 0, readErr
+		}
+	}
+
+	blobDigest := digester.Digest()
+	return blobDigest, offset, c.completeUpload(ctx, location, blobDigest, nil)
+}
+
+// uploadJSONBlob uploads value as a JSON blob in a single request.
+func (c *registryClient) uploadJSONBlob(ctx context.Context, mediaType string, value any) (imgspecv1.Descriptor, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	descriptor := imgspecv1.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+
+	location, err := c.startUpload(ctx)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	return descriptor, c.completeUpload(ctx, location, descriptor.Digest, content)
+}
+
+// getJSON reads the JSON manifest or blob of kind, "manifests" or "blobs", from the repository into value.
+func (c *registryClient) getJSON(ctx context.Context, repository, kind, reference string, value any) error {
+	header := http.Header{"Accept": []string{imgspecv1.MediaTypeImageManifest}}
+	res, err := c.do(ctx, http.MethodGet, c.baseURL.JoinPath("v2", repository, kind, reference).String(), header, nil)
+	if err != nil {
+		return err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusOK {
+		return responseError(fmt.Sprintf("failed to get %s %s", kind, reference), res)
+	}
+	return json.NewDecoder(res.Body).Decode(value)
+}
+
+// mountBlob mounts the blob of another repository in the client repository, reporting whether the registry
+// mounted it. Registries that do not support mounting, or do not have the blob, start a regular upload
+// instead, which is cancelled.
+func (c *registryClient) mountBlob(ctx context.Context, blobDigest digest.Digest, fromRepository string) (bool, error) {
+	mountURL, err := url.Parse(c.repositoryURL("blobs", "uploads/"))
+	if err != nil {
+		return false, err
+	}
+	query := mountURL.Query()
+	query.Set("mount", blobDigest.String())
+	query.Set("from", fromRepository)
+	mountURL.RawQuery = query.Encode()
+
+	res, err := c.do(ctx, http.MethodPost, mountURL.String(), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer closeBody(res)
+	switch res.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		location, err := c.location(res)
+		if err != nil {
+			return false, err
+		}
+		c.cancelUpload(ctx, location)
+		return false, nil
+	default:
+		return false, responseError("failed to mount blob", res)
+	}
+}
+
+// putManifest uploads the image manifest with the given tag, returning the manifest digest.
+func (c *registryClient) putManifest(ctx context.Context, tag string, manifest imgspecv1.Manifest) (digest.Digest, error) {
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	header := http.Header{"Content-Type": []string{imgspecv1.MediaTypeImageManifest}}
+	res, err := c.do(ctx, http.MethodPut, c.repositoryURL("manifests", tag), header, content)
+	if err != nil {
+		return "", err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusCreated {
+		return "", responseError("failed to put manifest", res)
+	}
+	return digest.FromBytes(content), nil
+}
+
+// cancelUpload cancels the upload at location. Not every registry allows it, the upload is then left to
+// expire in the registry.
+func (c *registryClient) cancelUpload(ctx context.Context, location string) {
+	res, err := c.do(ctx, http.MethodDelete, location, nil, nil)
+	if err == nil {
+		closeBody(res)
+	}
+}
+
+func (c *registryClient) startUpload(ctx context.Context) (string, error) {
+	res, err := c.do(ctx, http.MethodPost, c.repositoryURL("blobs", "uploads/"), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusAccepted {
+		return "", responseError("failed to start blob upload", res)
+	}
+	return c.location(res)
+}
+
+// uploadChunk uploads chunk starting at offset of the blob. When the request fails the registry is asked
+// how much of the upload it received, and the rest of the chunk is sent again.
+func (c *registryClient) uploadChunk(ctx context.Context, location string, chunk []byte, offset int64) (string, error) {
+	var start int64
+	for attempt := 0; ; attempt++ {
+		header := http.Header{
+			"Content-Type":  []string{"application/octet-stream"},
+			"Content-Range": []string{fmt.Sprintf("%d-%d", offset+start, offset+int64(len(chunk))-1)},
+		}
+		res, err := c.do(ctx, http.MethodPatch, location, header, chunk[start:])
+		if err == nil {
+			// The specification requires 202, some registries answer with 204.
+			if res.StatusCode == http.StatusAccepted || res.StatusCode == http.StatusNoContent {
+				closeBody(res)
+				return c.location(res)
+			}
+			err = responseError("failed to upload blob chunk", res)
+			closeBody(res)
+		}
+		if attempt == maxChunkRetries || ctx.Err() != nil {
+			return "", err
+		}
+
+		received, newLocation, statusErr := c.uploadStatus(ctx, location)
+		if statusErr != nil {
+			// Not every registry reports the upload status, send the chunk again from the same position.
+			continue
+		}
+		if offset == 0 && received <= 1 {
+			// The registry reports "0-0" both for an empty upload and for a single byte, nothing tells how much
+			// of the first chunk it has. Nothing was acknowledged yet, so the upload starts over.
+			if newLocation, statusErr = c.startUpload(ctx); statusErr != nil {
+				return "", statusErr
+			}
+			received = 0
+		}
+		location = newLocation
+		start = min(max(received-offset, 0), int64(len(chunk)))
+		if start == int64(len(chunk)) {
+			// Only the response was lost.
+			return location, nil
+		}
+	}
+}
+
+// uploadStatus returns the number of bytes of the upload received by the registry. The Range header is
+// inclusive, so "0-0" is a single byte, but registries also return it for empty uploads.
+func (c *registryClient) uploadStatus(ctx context.Context, location string) (int64, string, error) {
+	res, err := c.do(ctx, http.MethodGet, location, nil, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusNoContent {
+		return 0, "", responseError("failed to get blob upload status", res)
+	}
+
+	newLocation, err := c.location(res)
+	if err != nil {
+		return 0, "", err
+	}
+	_, end, found := strings.Cut(res.Header.Get("Range"), "-")
+	if !found {
+		return 0, newLocation, nil
+	}
+	last, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return 0, newLocation, nil
+	}
+	return last + 1, newLocation, nil
+}
+
+func (c *registryClient) completeUpload(ctx context.Context, location string, blobDigest digest.Digest, content []byte) error {
+	uploadURL, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	query := uploadURL.Query()
+	query.Set("digest", blobDigest.String())
+	uploadURL.RawQuery = query.Encode()
+
+	header := http.Header{"Content-Type": []string{"application/octet-stream"}}
+	res, err := c.do(ctx, http.MethodPut, uploadURL.String(), header, content)
+	if err != nil {
+		return err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusCreated {
+		return responseError("failed to complete blob upload", res)
+	}
+	return nil
+}
+
+// do sends the request, authenticating with the registry when it answers with an authentication challenge.
+func (c *registryClient) do(
+	ctx context.Context, method, requestURL string, header http.Header, body []byte,
+) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+		return c.httpClient.Do(req)
+	}
+
+	res, err := send()
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	challenge := res.Header.Get("WWW-Authenticate")
+	closeBody(res)
+	if err := c.authenticate(ctx, challenge); err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+// authenticate answers a bearer token challenge of the registry, requesting a token with the credentials.
+func (c *registryClient) authenticate(ctx context.Context, challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		if c.username == "" {
+			return errors.New("registry requires authentication but no credentials were configured")
+		}
+		// Basic authentication is already sent with every request.
+		return nil
+	}
+
+	values := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		values[key] = strings.Trim(value, `"`)
+	}
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil {
+		return fmt.Errorf("invalid token realm %q: %w", values["realm"], err)
+	}
+	query := tokenURL.Query()
+	query.Set("service", values["service"])
+	query.Set("scope", fmt.Sprintf("repository:%s:pull,push", c.repository))
+	for _, repository := range c.pullRepositories {
+		query.Add("scope", fmt.Sprintf("repository:%s:pull", repository))
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(res)
+	if res.StatusCode != http.StatusOK {
+		return responseError("failed to get registry token", res)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	return nil
+}
+
+// imageReference returns the repository and the tag, or digest, of the image named imageName, in the form
+// name[:tag] or name@digest.
+func (c *registryClient) imageReference(imageName string) (string, string) {
+	repository, tag, found := strings.Cut(imageName, "@")
+	if !found {
+		repository, tag, found = strings.Cut(imageName, ":")
+	}
+	if !found {
+		tag = "latest"
+	}
+	if c.prefix != "" {
+		repository = c.prefix + "/" + repository
+	}
+	return repository, tag
+}
+
+func (c *registryClient) repositoryURL(kind, reference string) string {
+	return c.baseURL.JoinPath("v2", c.repository, kind, reference).String()
+}
+
+// location returns the absolute upload location from the response, which may be relative to the registry.
+func (c *registryClient) location(res *http.Response) (string, error) {
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return "", fmt.Errorf("invalid upload location: %w", err)
+	}
+	return c.baseURL.ResolveReference(location).String(), nil
+}
+
+func responseError(message string, res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("%s: %s: %s", message, res.Status, strings.TrimSpace(string(body)))
+}
+
+func closeBody(res *http.Response) {
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+}
@@ -0,0 +1,365 @@
+package imagebuilder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// testRegistry is an in-memory registry implementing the parts of the OCI distribution API used by the
+// registryClient, with chunked uploads whose status can be read back, blob mounts and bearer tokens.
+type testRegistry struct {
+	t      *testing.T
+	server *httptest.Server
+
+	// username and password, when set, are required to get a bearer token for any other request.
+	username string
+	password string
+
+	mutex sync.Mutex
+	// blobs holds the blobs of every repository by digest.
+	blobs map[string]map[digest.Digest][]byte
+	// manifests holds the manifests of every repository by tag and digest.
+	manifests map[string]map[string][]byte
+	uploads   map[string]*bytes.Buffer
+	// startedUploads is the number of uploads started, which names the next upload.
+	startedUploads int
+	// failedPatches is the number of chunks of which the registry keeps the first keptBytes bytes and then
+	// fails, as a connection broken in the middle of the upload.
+	failedPatches int
+	keptBytes     int
+	patches       int
+	mounts        int
+	scopes        []string
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	registry := &testRegistry{
+		t:         t,
+		blobs:     map[string]map[digest.Digest][]byte{},
+		manifests: map[string]map[string][]byte{},
+		uploads:   map[string]*bytes.Buffer{},
+	}
+	registry.server = httptest.NewServer(registry)
+	t.Cleanup(registry.server.Close)
+	return registry
+}
+
+// auth returns the RegistryAuth of the registry.
+func (r *testRegistry) auth() RegistryAuth {
+	serverURL, err := url.Parse(r.server.URL)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	auth := RegistryAuth{URL: serverURL.Host, Insecure: true}
+	if r.username != "" {
+		auth.Basic = &RegistryBasicAuth{Username: r.username, Password: r.password}
+	}
+	return auth
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+	if r.username != "" && req.Header.Get("Authorization") != "Bearer test-token" {
+		w.Header().Set("WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case path == "":
+		w.WriteHeader(http.StatusOK)
+	case strings.Contains(path, "/blobs/uploads/"):
+		repository, id, _ := strings.Cut(path, "/blobs/uploads/")
+		r.serveUpload(w, req, repository, id)
+	case strings.Contains(path, "/blobs/"):
+		repository, reference, _ := strings.Cut(path, "/blobs/")
+		content, ok := r.blobs[repository][digest.Digest(reference)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+	case strings.Contains(path, "/manifests/"):
+		repository, reference, _ := strings.Cut(path, "/manifests/")
+		r.serveManifest(w, req, repository, reference)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *testRegistry) serveToken(w http.ResponseWriter, req *http.Request) {
+	username, password, _ := req.BasicAuth()
+	if username != r.username || password != r.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.scopes = append(r.scopes, req.URL.Query()["scope"]...)
+	_, _ = io.WriteString(w, `{"token":"test-token"}`)
+}
+
+func (r *testRegistry) serveUpload(w http.ResponseWriter, req *http.Request, repository, id string) {
+	switch req.Method {
+	case http.MethodPost:
+		query := req.URL.Query()
+		if mount := digest.Digest(query.Get("mount")); mount != "" {
+			if content, ok := r.blobs[query.Get("from")][mount]; ok {
+				r.putBlob(repository, mount, content)
+				r.mounts++
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		id := strconv.Itoa(r.startedUploads)
+		r.startedUploads++
+		r.uploads[id] = &bytes.Buffer{}
+		w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/"+id)
+		w.Header().Set("Range", "0-0")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	upload, ok := r.uploads[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	switch req.Method {
+	case http.MethodGet:
+		r.writeUploadStatus(w, repository, id, upload, http.StatusNoContent)
+	case http.MethodPatch:
+		r.patches++
+		var start, end int
+		if _, err := fmt.Sscanf(req.Header.Get("Content-Range"), "%d-%d", &start, &end); err != nil ||
+			start != upload.Len() || end-start+1 != len(body) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if r.failedPatches > 0 {
+			r.failedPatches--
+			upload.Write(body[:min(r.keptBytes, len(body))])
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		upload.Write(body)
+		r.writeUploadStatus(w, repository, id, upload, http.StatusAccepted)
+	case http.MethodDelete:
+		delete(r.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut:
+		upload.Write(body)
+		blobDigest := digest.Digest(req.URL.Query().Get("digest"))
+		if digest.FromBytes(upload.Bytes()) != blobDigest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(r.uploads, id)
+		r.putBlob(repository, blobDigest, upload.Bytes())
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// writeUploadStatus writes the status of the upload the way the distribution registry does, which reports
+// "0-0" for empty uploads.
+func (r *testRegistry) writeUploadStatus(
+	w http.ResponseWriter, repository, id string, upload *bytes.Buffer, status int,
+) {
+	w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/"+id)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", max(upload.Len()-1, 0)))
+	w.WriteHeader(status)
+}
+
+func (r *testRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repository, reference string) {
+	switch req.Method {
+	case http.MethodGet:
+		content, ok := r.manifests[repository][reference]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(content)
+	case http.MethodPut:
+		content, err := io.ReadAll(req.Body)
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		if r.manifests[repository] == nil {
+			r.manifests[repository] = map[string][]byte{}
+		}
+		r.manifests[repository][reference] = content
+		r.manifests[repository][digest.FromBytes(content).String()] = content
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *testRegistry) putBlob(repository string, blobDigest digest.Digest, content []byte) {
+	if r.blobs[repository] == nil {
+		r.blobs[repository] = map[digest.Digest][]byte{}
+	}
+	r.blobs[repository][blobDigest] = bytes.Clone(content)
+}
+
+// blob returns the blob of the repository with the given digest.
+func (r *testRegistry) blob(repository string, blobDigest digest.Digest) ([]byte, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	content, ok := r.blobs[repository][blobDigest]
+	return content, ok
+}
+
+func TestRegistryClientUploadBlob(t *testing.T) {
+	content := make([]byte, 10)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	tests := []struct {
+		name          string
+		failedPatches int
+		keptBytes     int
+	}{
+		{name: "uploads every chunk"},
+		{name: "resumes a chunk the registry received in part", failedPatches: 1, keptBytes: 2},
+		{name: "resumes a chunk the registry received nothing of", failedPatches: 1},
+		{name: "resumes a chunk the registry received a single byte of", failedPatches: 1, keptBytes: 1},
+		{name: "resumes a chunk the registry received entirely", failedPatches: 1, keptBytes: 4},
+		{name: "resumes a chunk failing several times", failedPatches: maxChunkRetries, keptBytes: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newTestRegistry(t)
+			registry.failedPatches = tt.failedPatches
+			registry.keptBytes = tt.keptBytes
+
+			ctx := context.Background()
+			client, tag, err := newRegistryClient(ctx, registry.auth(), "checkpoint-web-0:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.repository != "checkpoint-web-0" || tag != "1" {
+				t.Errorf("client pushes to %s:%s", client.repository, tag)
+			}
+
+			blobDigest, size, err := client.uploadBlob(ctx, bytes.NewReader(content), 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if blobDigest != digest.FromBytes(content) || size != int64(len(content)) {
+				t.Errorf("uploaded blob %s of %d bytes", blobDigest, size)
+			}
+			if got, ok := registry.blob("checkpoint-web-0", blobDigest); !ok || !bytes.Equal(got, content) {
+				t.Errorf("registry has blob %v", got)
+			}
+		})
+	}
+}
+
+func TestRegistryClientUploadBlobGivesUp(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.failedPatches = maxChunkRetries + 1
+
+	ctx := context.Background()
+	client, _, err := newRegistryClient(ctx, registry.auth(), "checkpoint-web-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.uploadBlob(ctx, strings.NewReader("checkpoint"), 4); err == nil {
+		t.Fatal("upload succeeded with a failing registry")
+	}
+	if registry.patches != maxChunkRetries+1 {
+		t.Errorf("chunk was sent %d times, want %d", registry.patches, maxChunkRetries+1)
+	}
+}
+
+func TestRegistryClientAuthentication(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.username = "kcr"
+	registry.password = "secret"
+
+	ctx := context.Background()
+	client, _, err := newRegistryClient(ctx, registry.auth(), "team/checkpoint-web-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.pullRepositories = []string{"team/checkpoint-web-1"}
+	blobDigest, _, err := client.uploadBlob(ctx, strings.NewReader("checkpoint"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := registry.blob("team/checkpoint-web-0", blobDigest); !ok {
+		t.Error("blob was not uploaded")
+	}
+	want := []string{"repository:team/checkpoint-web-0:pull,push", "repository:team/checkpoint-web-1:pull"}
+	if strings.Join(registry.scopes, " ") != strings.Join(want, " ") {
+		t.Errorf("token requested for scopes %v, want %v", registry.scopes, want)
+	}
+
+	auth := registry.auth()
+	auth.Basic.Password = "wrong"
+	client, _, err = newRegistryClient(ctx, auth, "team/checkpoint-web-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.uploadBlob(ctx, strings.NewReader("checkpoint"), 4); err == nil {
+		t.Error("upload succeeded with wrong credentials")
+	}
+}
+
+func TestRegistryClientMountBlob(t *testing.T) {
+	registry := newTestRegistry(t)
+	content := []byte("checkpoint")
+	registry.putBlob("checkpoint-web-0", digest.FromBytes(content), content)
+
+	ctx := context.Background()
+	client, _, err := newRegistryClient(ctx, registry.auth(), "checkpoint-web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mounted, err := client.mountBlob(ctx, digest.FromBytes(content), "checkpoint-web-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mounted {
+		t.Error("existing blob was not mounted")
+	}
+	if _, ok := registry.blob("checkpoint-web-1", digest.FromBytes(content)); !ok {
+		t.Error("mounted blob is not in the repository")
+	}
+
+	mounted, err = client.mountBlob(ctx, digest.FromString("missing"), "checkpoint-web-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mounted {
+		t.Error("missing blob was mounted")
+	}
+	if len(registry.uploads) != 0 {
+		t.Errorf("%d uploads started by the registry for the missing blob were left open", len(registry.uploads))
+	}
+}
@@ -0,0 +1,169 @@
+package imagebuilder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/signature/signer"
+	"github.com/containers/image/v5/signature/sigstore"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// ImageSigner signs the checkpoint images pushed to the registry.
+type ImageSigner interface {
+	// SignImage signs the image named imageName, relative to the registry, with the manifest digest
+	// imageDigest.
+	SignImage(ctx context.Context, registryAuth RegistryAuth, imageName string, imageDigest digest.Digest) error
+}
+
+// SigstoreImageSigner signs the checkpoint images with a sigstore private key, as generated by cosign
+// generate-key-pair. The signatures are stored in the registry as sigstore attachments of the image.
+type SigstoreImageSigner struct {
+	privateKeyFile string
+	passphrase     []byte
+}
+
+// NewSigstoreImageSigner creates a SigstoreImageSigner with the private key in privateKeyFile, encrypted
+// with the passphrase in passphraseFile. The key is read on every signature, so a rotated key mounted from
+// a Secret is used without restarting.
+func NewSigstoreImageSigner(privateKeyFile, passphraseFile string) (*SigstoreImageSigner, error) {
+	var passphrase []byte
+	if passphraseFile != "" {
+		content, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key passphrase: %w", err)
+		}
+		passphrase = []byte(strings.TrimRight(string(content), "\r\n"))
+	}
+
+	imageSigner := &SigstoreImageSigner{privateKeyFile: privateKeyFile, passphrase: passphrase}
+	// Fail early when the key can not be used.
+	s, err := imageSigner.newSigner()
+	if err != nil {
+		return nil, err
+	}
+	_ = s.Close()
+	return imageSigner, nil
+}
+
+func (s *SigstoreImageSigner) newSigner() (*signer.Signer, error) {
+	imageSigner, err := sigstore.NewSigner(sigstore.WithPrivateKeyFile(s.privateKeyFile, s.passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key %s: %w", s.privateKeyFile, err)
+	}
+	return imageSigner, nil
+}
+
+func (s *SigstoreImageSigner) SignImage(
+	ctx context.Context, registryAuth RegistryAuth, imageName string, imageDigest digest.Digest,
+) error {
+	imageSigner, err := s.newSigner()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = imageSigner.Close()
+	}()
+
+	// The signature claims the name the image was pushed with, and is verified against the image digest.
+	identity, err := reference.ParseNormalizedNamed(registryAuth.URL + "/" + imageName)
+	if err != nil {
+		return fmt.Errorf("invalid checkpoint image %s: %w", imageName, err)
+	}
+	imageReference, err := digestImageReference(registryAuth, imageName, imageDigest)
+	if err != nil {
+		return err
+	}
+	systemContext, err := registryAuth.signaturesSystemContext()
+	if err != nil {
+		return err
+	}
+
+	// Copying the image onto itself only uploads the signature, the image is already in the registry.
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = policyContext.Destroy()
+	}()
+	if _, err := copy.Image(ctx, policyContext, imageReference, imageReference, &copy.Options{
+		ReportWriter:    io.Discard,
+		SourceCtx:       systemContext,
+		DestinationCtx:  systemContext,
+		Signers:         []*signer.Signer{imageSigner},
+		SignIdentity:    identity,
+		PreserveDigests: true,
+	}); err != nil {
+		return fmt.Errorf("failed to sign checkpoint image %s: %w", imageName, err)
+	}
+	return nil
+}
+
+// NewSignaturePolicy returns the trust policy the checkpoint images must satisfy before they are restored.
+// The policy is read from policyFile, in the containers-policy.json format, or requires a sigstore
+// signature by the public key in publicKeyFile. It is nil when both are empty.
+func NewSignaturePolicy(policyFile, publicKeyFile string) (*signature.Policy, error) {
+	switch {
+	case policyFile != "" && publicKeyFile != "":
+		return nil, fmt.Errorf("only one of the signature policy and the signature public key can be set")
+	case policyFile != "":
+		return signature.NewPolicyFromFile(policyFile)
+	case publicKeyFile != "":
+		requirement, err := signature.NewPRSigstoreSignedKeyPath(publicKeyFile, signature.NewPRMMatchRepoDigestOrExact())
+		if err != nil {
+			return nil, err
+		}
+		return &signature.Policy{Default: []signature.PolicyRequirement{requirement}}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// digestImageReference returns the reference of the image named imageName, relative to the registry, by
+// its digest.
+func digestImageReference(registryAuth RegistryAuth, imageName string, imageDigest digest.Digest) (types.ImageReference, error) {
+	imageReference, err := docker.ParseReference("//" + registryAuth.URL + "/" + DigestReference(imageName, imageDigest))
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint image %s: %w", imageName, err)
+	}
+	return imageReference, nil
+}
+
+// sigstoreRegistriesDirectory returns a registries.d directory configuring every registry to store the
+// sigstore signatures as attachments of the images.
+var sigstoreRegistriesDirectory = sync.OnceValues(func() (string, error) {
+	directory, err := os.MkdirTemp("", "kcr-registries.d-")
+	if err != nil {
+		return "", err
+	}
+	configuration := []byte("default-docker:\n  use-sigstore-attachments: true\n")
+	if err := os.WriteFile(filepath.Join(directory, "default.yaml"), configuration, 0o644); err != nil {
+		return "", err
+	}
+	return directory, nil
+})
+
+// signaturesSystemContext returns the system context to access the registry and the signatures of its
+// images.
+func (a RegistryAuth) signaturesSystemContext() (*types.SystemContext, error) {
+	registriesDirectory, err := sigstoreRegistriesDirectory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure the registry signatures: %w", err)
+	}
+	systemContext := a.systemContext()
+	systemContext.RegistriesDirPath = registriesDirectory
+	return systemContext, nil
+}
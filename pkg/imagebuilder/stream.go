@@ -0,0 +1,344 @@
+package imagebuilder
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/GianOrtiz/kcr/pkg/checkpoint/archive"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultStreamChunkSize is the size of the chunks uploaded to the registry by the StreamingImageBuilder.
+const DefaultStreamChunkSize = 16 * 1024 * 1024
+
+// StreamingImageBuilder pushes the checkpoint images straight to the registry. The checkpoint archive is
+// compressed on the fly and uploaded in chunks, without storing the image on disk, which cuts the disk
+// usage and latency for large memory dumps.
+//
+// Nothing is written by BuildFromCheckpoint, the checkpoints to build are kept in memory until they are
+// pushed, so an image must be pushed by the process that built it and is lost when the process restarts
+// in between. The checkpoint reconciler builds and pushes an image in a single pass, and builds again the
+// checkpoints left in the Processing phase by a restart.
+type StreamingImageBuilder struct {
+	imageFormat ImageFormat
+	chunkSize   int
+
+	mutex  sync.Mutex
+	builds map[string]streamingBuild
+}
+
+// streamingBuild is a checkpoint image waiting to be streamed to the registry.
+type streamingBuild struct {
+	checkpointLocation string
+	metadata           CheckpointMetadata
+	options            BuildOptions
+}
+
+// NewStreamingImageBuilder creates a StreamingImageBuilder uploading chunks of chunkSize bytes.
+func NewStreamingImageBuilder(imageFormat ImageFormat, chunkSize int) (ImageBuilder, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	return &StreamingImageBuilder{
+		imageFormat: imageFormat,
+		chunkSize:   chunkSize,
+		builds:      make(map[string]streamingBuild),
+	}, nil
+}
+
+// BuildFromCheckpoint only records the checkpoint to be built, the image is assembled while it is pushed.
+func (b *StreamingImageBuilder) BuildFromCheckpoint(
+	checkpointLocation string, metadata CheckpointMetadata, options BuildOptions, imageName string, ctx context.Context,
+) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(checkpointLocation); err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.builds[imageName] = streamingBuild{checkpointLocation: checkpointLocation, metadata: metadata, options: options}
+	return nil
+}
+
+func (b *StreamingImageBuilder) PushToNodeRuntime(
+	ctx context.Context, localImageName string, runtimeImageName string, registryAuth RegistryAuth,
+) (PushedImage, error) {
+	logger := log.FromContext(ctx)
+
+	b.mutex.Lock()
+	build, ok := b.builds[localImageName]
+	delete(b.builds, localImageName)
+	b.mutex.Unlock()
+	if !ok {
+		return PushedImage{}, fmt.Errorf("local image %s not found for push", localImageName)
+	}
+
+	client, tag, err := newRegistryClient(ctx, registryAuth, runtimeImageName)
+	if err != nil {
+		return PushedImage{}, err
+	}
+
+	var parentRepository string
+	var parentLayers map[string]parentLayer
+	// Encrypted layers of the parent image would keep the keys of its recipients, every layer of an
+	// encrypted image is uploaded with fresh keys.
+	if build.metadata.ParentImage != "" && build.options.Encryption == nil {
+		parentRepository, _ = client.imageReference(build.metadata.ParentImage)
+		client.pullRepositories = append(client.pullRepositories, parentRepository)
+		parentLayers, err = readParentLayers(ctx, client, build.metadata.ParentImage)
+		if err != nil {
+			logger.Error(err, "Failed to read the parent image layers, uploading every layer",
+				"parentImage", build.metadata.ParentImage)
+		}
+	}
+
+	layers, err := b.uploadLayers(ctx, client, build, parentRepository, parentLayers)
+	if err != nil {
+		logger.Error(err, "Failed to upload checkpoint layers", "imageName", localImageName)
+		return PushedImage{}, fmt.Errorf("failed to upload checkpoint layers of %s: %w", localImageName, err)
+	}
+	logger.Info("Successfully uploaded the checkpoint layers", "layers", len(layers))
+
+	configDescriptor, err := client.uploadJSONBlob(ctx, imgspecv1.MediaTypeImageConfig, newImageConfig(layerDiffIDs(layers)))
+	if err != nil {
+		return PushedImage{}, fmt.Errorf("failed to upload image config of %s: %w", localImageName, err)
+	}
+
+	manifest := newImageManifest(
+		configDescriptor, layerDescriptors(layers), checkpointAnnotations(b.imageFormat, build.metadata),
+	)
+	manifestDigest, err := client.putManifest(ctx, tag, manifest)
+	if err != nil {
+		logger.Error(err, "Failed to push image to node runtime", "imageName", localImageName)
+		return PushedImage{}, fmt.Errorf("failed to push image %s: %w", localImageName, err)
+	}
+
+	logger.Info("Successfully pushed image to local runtime",
+		"imageName", localImageName, "destination", registryAuth.URL+"/"+runtimeImageName, "digest", manifestDigest)
+	return pushedImage(manifest, manifestDigest), nil
+}
+
+// parentLayer is a single file layer of the parent image.
+type parentLayer struct {
+	checkpointLayer
+	fileDigest string
+}
+
+// readParentLayers returns the single file layers of the parent image by file path.
+func readParentLayers(ctx context.Context, client *registryClient, parentImage string) (map[string]parentLayer, error) {
+	repository, tag := client.imageReference(parentImage)
+	var manifest imgspecv1.Manifest
+	if err := client.getJSON(ctx, repository, "manifests", tag, &manifest); err != nil {
+		return nil, err
+	}
+	var config imgspecv1.Image
+	if err := client.getJSON(ctx, repository, "blobs", manifest.Config.Digest.String(), &config); err != nil {
+		return nil, err
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, fmt.Errorf("parent image %s has %d layers and %d diff IDs",
+			parentImage, len(manifest.Layers), len(config.RootFS.DiffIDs))
+	}
+
+	layers := make(map[string]parentLayer)
+	for i, descriptor := range manifest.Layers {
+		file, ok := descriptor.Annotations[LayerFileAnnotation]
+		if !ok {
+			continue
+		}
+		layers[file] = parentLayer{
+			checkpointLayer: checkpointLayer{descriptor: descriptor, diffID: config.RootFS.DiffIDs[i]},
+			fileDigest:      descriptor.Annotations[LayerFileDigestAnnotation],
+		}
+	}
+	return layers, nil
+}
+
+// uploadLayers splits the checkpoint archive in layers and compresses, and encrypts, them while uploading. The single file
+// layers of the parent image whose file did not change are mounted from the parent repository instead.
+func (b *StreamingImageBuilder) uploadLayers(
+	ctx context.Context,
+	client *registryClient,
+	build streamingBuild,
+	parentRepository string,
+	parentLayers map[string]parentLayer,
+) ([]checkpointLayer, error) {
+	// The files must be compared with the parent before their layers are uploaded, which requires reading
+	// the archive twice. It is only worth it when there is a parent image to reuse layers from.
+	var fileDigests map[string]digest.Digest
+	if len(parentLayers) > 0 {
+		var err error
+		if fileDigests, err = archiveFileDigests(build.checkpointLocation); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(build.checkpointLocation)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	content, err := archive.Decompress(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []checkpointLayer
+	rest, err := splitArchive(content, func(header *tar.Header, content io.Reader) error {
+		parent, ok := parentLayers[header.Name]
+		if ok && fileDigests[header.Name].String() == parent.fileDigest {
+			mounted, err := client.mountBlob(ctx, parent.descriptor.Digest, parentRepository)
+			if err != nil {
+				return err
+			}
+			if mounted {
+				layers = append(layers, parent.checkpointLayer)
+				return nil
+			}
+		}
+
+		fileDigester := digest.SHA256.Digester()
+		layerContent, err := fileLayerContent(header, content, fileDigester)
+		if err != nil {
+			return err
+		}
+		layer, err := b.uploadLayer(ctx, client, layerContent, build.options)
+		if err != nil {
+			return err
+		}
+		addFileLayerAnnotations(&layer.descriptor, header, fileDigester.Digest())
+		layers = append(layers, layer)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	layer, err := b.uploadLayer(ctx, client, bytes.NewReader(rest), build.options)
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, layer), nil
+}
+
+// uploadLayer compresses the layer content while uploading it.
+func (b *StreamingImageBuilder) uploadLayer(
+	ctx context.Context, client *registryClient, content io.Reader, options BuildOptions,
+) (checkpointLayer, error) {
+	if options.Encryption != nil {
+		return b.uploadEncryptedLayer(ctx, client, content, options)
+	}
+
+	var diffID digest.Digest
+	var annotations map[string]string
+	descriptor, err := b.uploadStream(ctx, client, options.Compression.mediaType(), func(w io.Writer) error {
+		var err error
+		diffID, annotations, err = compressLayer(w, content, options.Compression)
+		return err
+	})
+	if err != nil {
+		return checkpointLayer{}, err
+	}
+	if len(annotations) > 0 {
+		descriptor.Annotations = annotations
+	}
+	return checkpointLayer{descriptor: descriptor, diffID: diffID}, nil
+}
+
+// uploadEncryptedLayer compresses the layer content and encrypts it while uploading it. The encryption
+// records the digest of the compressed layer, so the compressed layer is staged in a temporary file.
+func (b *StreamingImageBuilder) uploadEncryptedLayer(
+	ctx context.Context, client *registryClient, content io.Reader, options BuildOptions,
+) (checkpointLayer, error) {
+	file, err := os.CreateTemp("", "kcr-layer-")
+	if err != nil {
+		return checkpointLayer{}, err
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	digester := digest.SHA256.Digester()
+	counter := &countingWriter{writer: io.MultiWriter(file, digester.Hash())}
+	diffID, annotations, err := compressLayer(counter, content, options.Compression)
+	if err != nil {
+		return checkpointLayer{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return checkpointLayer{}, err
+	}
+
+	compressed := imgspecv1.Descriptor{
+		MediaType:   options.Compression.mediaType(),
+		Digest:      digester.Digest(),
+		Size:        counter.written,
+		Annotations: annotations,
+	}
+	mediaType := compressed.MediaType + encryptedMediaTypeSuffix
+	descriptor, err := b.uploadStream(ctx, client, mediaType, func(w io.Writer) error {
+		var err error
+		annotations, err = options.Encryption.encryptLayer(w, file, compressed)
+		return err
+	})
+	if err != nil {
+		return checkpointLayer{}, err
+	}
+	descriptor.Annotations = annotations
+	return checkpointLayer{descriptor: descriptor, diffID: diffID}, nil
+}
+
+// uploadStream uploads the blob written by write, returning its descriptor with the given media type.
+func (b *StreamingImageBuilder) uploadStream(
+	ctx context.Context, client *registryClient, mediaType string, write func(w io.Writer) error,
+) (imgspecv1.Descriptor, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(write(writer))
+	}()
+
+	blobDigest, size, err := client.uploadBlob(ctx, reader, b.chunkSize)
+	// Unblock the writer when the upload stops early.
+	_ = reader.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	return imgspecv1.Descriptor{MediaType: mediaType, Digest: blobDigest, Size: size}, nil
+}
+
+// archiveFileDigests returns the digests of the content of the files stored in single file layers.
+func archiveFileDigests(checkpointLocation string) (map[string]digest.Digest, error) {
+	file, err := os.Open(checkpointLocation)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	content, err := archive.Decompress(file)
+	if err != nil {
+		return nil, err
+	}
+
+	digests := make(map[string]digest.Digest)
+	_, err = splitArchive(content, func(header *tar.Header, content io.Reader) error {
+		fileDigest, err := digest.SHA256.FromReader(content)
+		digests[header.Name] = fileDigest
+		return err
+	})
+	return digests, err
+}
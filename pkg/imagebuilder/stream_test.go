@@ -0,0 +1,87 @@
+package imagebuilder
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// pushStreamingImage builds and pushes the checkpoint archive with the StreamingImageBuilder, returning the
+// pushed manifest.
+func pushStreamingImage(
+	t *testing.T, registry *testRegistry, entries []testArchiveEntry, metadata CheckpointMetadata, imageName string,
+) imgspecv1.Manifest {
+	t.Helper()
+	builder, err := NewStreamingImageBuilder(ImageFormatOCI, 512*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	err = builder.BuildFromCheckpoint(writeTestArchive(t, entries), metadata, BuildOptions{}, "local", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushed, err := builder.PushToNodeRuntime(ctx, "local", imageName, registry.auth())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repository, _ := (&registryClient{}).imageReference(imageName)
+	registry.mutex.Lock()
+	content, ok := registry.manifests[repository][pushed.Digest.String()]
+	registry.mutex.Unlock()
+	if !ok {
+		t.Fatalf("manifest %s was not pushed", pushed.Digest)
+	}
+	var manifest imgspecv1.Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	for _, layer := range manifest.Layers {
+		if _, ok := registry.blob(repository, layer.Digest); !ok {
+			t.Errorf("layer %s is not in %s", layer.Digest, repository)
+		}
+	}
+	return manifest
+}
+
+func TestStreamingImageBuilderPush(t *testing.T) {
+	registry := newTestRegistry(t)
+	entries := testArchiveEntries()
+	parent := pushStreamingImage(t, registry, entries, CheckpointMetadata{ContainerName: "app"}, "checkpoint-web-0:1")
+	if len(parent.Layers) != 2 {
+		t.Fatalf("image has %d layers, want 2", len(parent.Layers))
+	}
+	if registry.mounts != 0 {
+		t.Errorf("image without parent mounted %d layers", registry.mounts)
+	}
+
+	// The memory pages did not change, their layer is mounted from the parent image.
+	entries[0].content = []byte(`{"id":"4567"}`)
+	metadata := CheckpointMetadata{ContainerName: "app", ParentImage: "checkpoint-web-0:1"}
+	child := pushStreamingImage(t, registry, entries, metadata, "checkpoint-web-1:1")
+	if registry.mounts != 1 {
+		t.Errorf("%d layers were mounted, want 1", registry.mounts)
+	}
+	if child.Layers[0].Digest != parent.Layers[0].Digest {
+		t.Errorf("memory pages layer %s differs from the parent layer %s", child.Layers[0].Digest, parent.Layers[0].Digest)
+	}
+	if child.Layers[1].Digest == parent.Layers[1].Digest {
+		t.Error("changed files have the layer of the parent image")
+	}
+}
+
+func TestStreamingImageBuilderPushWithoutBuild(t *testing.T) {
+	registry := newTestRegistry(t)
+	builder, err := NewStreamingImageBuilder(ImageFormatOCI, DefaultStreamChunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The builds are only kept in memory, an image built by another process can not be pushed.
+	_, err = builder.PushToNodeRuntime(context.Background(), "local", "checkpoint-web-0", registry.auth())
+	if err == nil {
+		t.Error("pushed an image that was not built")
+	}
+}
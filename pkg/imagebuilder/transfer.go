@@ -0,0 +1,83 @@
+package imagebuilder
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// ExportCheckpointImage copies the checkpoint image named imageName, relative to the registry, to the OCI
+// layout at layoutPath, as its only image. The image is read by imageDigest when it is not empty. Its
+// layers are copied as they are, so encrypted layers stay encrypted, but its signatures are not copied.
+func ExportCheckpointImage(
+	ctx context.Context, registryAuth RegistryAuth, imageName string, imageDigest digest.Digest, layoutPath string,
+) error {
+	sourceReference, err := pullImageReference(registryAuth, imageName, imageDigest)
+	if err != nil {
+		return err
+	}
+	destinationReference, err := layout.NewReference(layoutPath, "")
+	if err != nil {
+		return fmt.Errorf("invalid OCI layout %s: %w", layoutPath, err)
+	}
+	if _, err := copyImage(ctx, registryAuth, destinationReference, sourceReference, true); err != nil {
+		return fmt.Errorf("failed to export checkpoint image %s: %w", imageName, err)
+	}
+	return nil
+}
+
+// ImportCheckpointImage pushes the checkpoint image in the OCI layout at layoutPath, as written by
+// ExportCheckpointImage, to the registry with the name imageName.
+func ImportCheckpointImage(
+	ctx context.Context, layoutPath string, registryAuth RegistryAuth, imageName string,
+) (PushedImage, error) {
+	sourceReference, err := layout.NewReference(layoutPath, "")
+	if err != nil {
+		return PushedImage{}, fmt.Errorf("invalid OCI layout %s: %w", layoutPath, err)
+	}
+	destinationReference, err := docker.ParseReference("//" + registryAuth.URL + "/" + imageName)
+	if err != nil {
+		return PushedImage{}, fmt.Errorf("invalid checkpoint image %s: %w", imageName, err)
+	}
+	manifest, err := copyImage(ctx, registryAuth, destinationReference, sourceReference, false)
+	if err != nil {
+		return PushedImage{}, fmt.Errorf("failed to import checkpoint image %s: %w", imageName, err)
+	}
+	return pushedImageFromManifest(manifest)
+}
+
+// copyImage copies the image without changing its layers, so the copy keeps the digest of the image. The
+// registry is the source of the copy when fromRegistry is true and its destination otherwise.
+func copyImage(
+	ctx context.Context, registryAuth RegistryAuth, destination, source types.ImageReference, fromRegistry bool,
+) ([]byte, error) {
+	// The images are checked by digest and checksums, the signatures are verified at restore.
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = policyContext.Destroy()
+	}()
+
+	options := &copy.Options{
+		ReportWriter:     io.Discard,
+		PreserveDigests:  true,
+		RemoveSignatures: true,
+	}
+	if fromRegistry {
+		options.SourceCtx = registryAuth.systemContext()
+	} else {
+		options.DestinationCtx = registryAuth.systemContext()
+	}
+	return copy.Image(ctx, policyContext, destination, source, options)
+}
@@ -0,0 +1,80 @@
+package imagebuilder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature"
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrImageNotVerified is wrapped by the errors of the images which do not match their digest or whose
+// signature is not trusted, verifying them again fails the same.
+var ErrImageNotVerified = errors.New("checkpoint image not verified")
+
+// ImageVerifier verifies a checkpoint image in the registry before it is restored.
+type ImageVerifier interface {
+	// VerifyImage verifies the image named imageName, relative to the registry, has the manifest digest
+	// imageDigest.
+	VerifyImage(ctx context.Context, registryAuth RegistryAuth, imageName string, imageDigest digest.Digest) error
+}
+
+// RegistryImageVerifier verifies the checkpoint images by fetching their manifest from the registry.
+type RegistryImageVerifier struct {
+	// Policy is the trust policy the signatures of the images must satisfy, the signatures are not
+	// verified when nil.
+	Policy *signature.Policy
+}
+
+func (v RegistryImageVerifier) VerifyImage(
+	ctx context.Context, registryAuth RegistryAuth, imageName string, imageDigest digest.Digest,
+) error {
+	imageReference, err := digestImageReference(registryAuth, imageName, imageDigest)
+	if err != nil {
+		return err
+	}
+	systemContext, err := registryAuth.signaturesSystemContext()
+	if err != nil {
+		return err
+	}
+	source, err := imageReference.NewImageSource(ctx, systemContext)
+	if err != nil {
+		return fmt.Errorf("failed to access checkpoint image %s: %w", imageName, err)
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	content, _, err := source.GetManifest(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get manifest of checkpoint image %s: %w", imageName, err)
+	}
+	matches, err := manifest.MatchesDigest(content, imageDigest)
+	if err != nil {
+		return err
+	}
+	if !matches {
+		return fmt.Errorf("%w: manifest of checkpoint image %s does not match digest %s", ErrImageNotVerified,
+			imageName, imageDigest)
+	}
+
+	if v.Policy == nil {
+		return nil
+	}
+	policyContext, err := signature.NewPolicyContext(v.Policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = policyContext.Destroy()
+	}()
+	allowed, err := policyContext.IsRunningImageAllowed(ctx, image.UnparsedInstance(source, nil))
+	if !allowed {
+		return fmt.Errorf("%w: signature of checkpoint image %s is not trusted: %w", ErrImageNotVerified, imageName,
+			err)
+	}
+	return nil
+}
@@ -164,6 +164,21 @@ var _ = Describe("Manager", Ordered, func() {
 			Eventually(verifyControllerUp).Should(Succeed())
 		})
 
+		It("should keep running unprivileged with the shipped arguments", func() {
+			By("validating that the controller-manager container does not restart")
+			verifyNoRestarts := func(g Gomega) {
+				cmd := exec.Command("kubectl", "get",
+					"pods", controllerPodName,
+					"-o", "jsonpath={.status.containerStatuses[?(@.name==\"manager\")].restartCount}",
+					"-n", namespace,
+				)
+				output, err := utils.Run(cmd)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(output).To(Equal("0"), "controller-manager restarted")
+			}
+			Consistently(verifyNoRestarts, 30*time.Second).Should(Succeed())
+		})
+
 		It("should ensure the metrics endpoint is serving metrics", func() {
 			By("creating a ClusterRoleBinding for the service account to allow access to metrics")
 			cmd := exec.Command("kubectl", "create", "clusterrolebinding", metricsRoleBindingName,